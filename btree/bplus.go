@@ -0,0 +1,548 @@
+package btree
+
+import "sort"
+
+type (
+	// bpNodeは、B+木のノードです。葉ノードはitemsにアイテムを持ち、next/prevで隣の葉とつながっています。
+	// 内部ノードはitemsに区切りのキーを持ち、 len(children) == len(items) + 1 を保ちます。
+	// children[i] のアイテムはすべて items[i] より小さく、children[i+1] のアイテムはすべて items[i] 以上です。
+	bpNode[T any] struct {
+		items      items[T]
+		children   []*bpNode[T]
+		next, prev *bpNode[T]
+	}
+
+	// BPlusTreeGは、すべてのアイテムを葉に持ち、葉同士を双方向リストでつないだB+木です。
+	// 範囲走査は開始位置の葉を一度探すだけで、あとは葉を順にたどるので、内部ノードを再帰的に行き来するBTreeGより長い範囲の走査が速くなります。
+	//
+	// 葉のリンクはノードを木の間で共有できないため、BPlusTreeGはコピーオンライトのCloneを持ちません。
+	//Write操作は、複数のゴルーチンによる同時変異に対して安全ではないが、Read操作は安全である。
+	BPlusTreeG[T any] struct {
+		degree int
+		length int
+		root   *bpNode[T]
+		less   LessFunc[T]
+	}
+
+	// BPlusTreeは、アイテムをItemインターフェースで保持するBPlusTreeG[Item]と同じものです。
+	BPlusTree BPlusTreeG[Item]
+)
+
+// NewBPlusGは、与えられたdegreeとless関数を使う新しいB+木を作成します。
+// 各ノードは最大で 2*degree-1 個のアイテム（内部ノードでは 2*degree 個の子）を持ちます。
+func NewBPlusG[T any](degree int, less LessFunc[T]) *BPlusTreeG[T] {
+	if degree <= 1 {
+		panic("bad degree")
+	}
+	if less == nil {
+		panic("nil LessFunc")
+	}
+	return &BPlusTreeG[T]{degree: degree, less: less}
+}
+
+// NewBPlusは、Itemを保持する新しいB+木を作成します。
+func NewBPlus(degree int) *BPlusTree {
+	return (*BPlusTree)(NewBPlusG(degree, itemLess))
+}
+
+// maxItems は、ノードごとに許可するアイテムの最大数を返します。
+func (t *BPlusTreeG[T]) maxItems() int {
+	return t.degree*2 - 1
+}
+
+// minItemsは、ノードごとに許可するアイテムの最小数を返します（ルートノードでは無視されます）。
+func (t *BPlusTreeG[T]) minItems() int {
+	return t.degree - 1
+}
+
+// isLeafは、ノードが葉かどうかを返します。
+func (n *bpNode[T]) isLeaf() bool {
+	return n.children == nil
+}
+
+// childIndexは、内部ノードでitemが含まれるはずの子のインデックス（item以下の区切りキーの数）を返します。
+func (n *bpNode[T]) childIndex(item T, less LessFunc[T]) int {
+	return sort.Search(len(n.items), func(i int) bool {
+		return less(item, n.items[i])
+	})
+}
+
+// leafForは、itemが含まれるはずの葉を返します。
+func (t *BPlusTreeG[T]) leafFor(item T) *bpNode[T] {
+	n := t.root
+	for n != nil && !n.isLeaf() {
+		n = n.children[n.childIndex(item, t.less)]
+	}
+	return n
+}
+
+// firstLeafは、一番左の葉を返します。
+func (t *BPlusTreeG[T]) firstLeaf() *bpNode[T] {
+	n := t.root
+	for n != nil && !n.isLeaf() {
+		n = n.children[0]
+	}
+	return n
+}
+
+// lastLeafは、一番右の葉を返します。
+func (t *BPlusTreeG[T]) lastLeaf() *bpNode[T] {
+	n := t.root
+	for n != nil && !n.isLeaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n
+}
+
+// ReplaceOrInsert は、与えられたアイテムを木に追加する。同じアイテムが既にあれば置き換えて (old, true) を返し、そうでなければ (zeroValue, false) を返す。
+func (t *BPlusTreeG[T]) ReplaceOrInsert(item T) (_ T, _ bool) {
+	if t.root == nil {
+		t.root = &bpNode[T]{}
+	}
+	out, found, sep, right := t.insert(t.root, item)
+	if right != nil {
+		// ルートが分割されたので、木の高さを1つ増やす。
+		t.root = &bpNode[T]{items: items[T]{sep}, children: []*bpNode[T]{t.root, right}}
+	}
+	if !found {
+		t.length++
+	}
+	return out, found
+}
+
+// insertは、nをルートとするサブツリーにitemを挿入します。nが溢れて分割された場合、新しい右側のノードとその区切りキーを返します。
+func (t *BPlusTreeG[T]) insert(n *bpNode[T], item T) (out T, found bool, sep T, right *bpNode[T]) {
+	if n.isLeaf() {
+		i, ok := n.items.find(item, t.less)
+		if ok {
+			out, n.items[i] = n.items[i], item
+			return out, true, sep, nil
+		}
+		n.items.insertAt(i, item)
+		if len(n.items) > t.maxItems() {
+			sep, right = t.splitLeaf(n)
+		}
+		return
+	}
+	i := n.childIndex(item, t.less)
+	var childSep T
+	var childRight *bpNode[T]
+	out, found, childSep, childRight = t.insert(n.children[i], item)
+	if childRight == nil {
+		return
+	}
+	n.items.insertAt(i, childSep)
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = childRight
+	if len(n.children) > t.maxItems()+1 {
+		sep, right = t.splitInternal(n)
+	}
+	return
+}
+
+// splitLeafは、溢れた葉を半分に分割し、右側の葉とその最初のアイテム（区切りキー）を返します。
+func (t *BPlusTreeG[T]) splitLeaf(n *bpNode[T]) (T, *bpNode[T]) {
+	mid := len(n.items) / 2
+	right := &bpNode[T]{next: n.next, prev: n}
+	right.items = append(right.items, n.items[mid:]...)
+	n.items.truncate(mid)
+	if n.next != nil {
+		n.next.prev = right
+	}
+	n.next = right
+	return right.items[0], right
+}
+
+// splitInternalは、溢れた内部ノードを分割し、右側のノードと、親に移す区切りキーを返します。
+func (t *BPlusTreeG[T]) splitInternal(n *bpNode[T]) (T, *bpNode[T]) {
+	mid := len(n.items) / 2
+	sep := n.items[mid]
+	right := &bpNode[T]{}
+	right.items = append(right.items, n.items[mid+1:]...)
+	right.children = append(right.children, n.children[mid+1:]...)
+	n.items.truncate(mid)
+	for i := mid + 1; i < len(n.children); i++ {
+		n.children[i] = nil
+	}
+	n.children = n.children[:mid+1]
+	return sep, right
+}
+
+// Delete は、渡された項目に等しい項目を木から削除し、それを返す。 そのようなアイテムが存在しない場合は、(zeroValue, false) を返す。
+func (t *BPlusTreeG[T]) Delete(item T) (_ T, _ bool) {
+	if t.root == nil {
+		return
+	}
+	out, found := t.remove(t.root, item)
+	if !found {
+		return
+	}
+	t.length--
+	switch {
+	case t.root.isLeaf() && len(t.root.items) == 0:
+		t.root = nil
+	case !t.root.isLeaf() && len(t.root.children) == 1:
+		t.root = t.root.children[0]
+	}
+	return out, true
+}
+
+// DeleteMinは、木の中の最小の項目を削除し、それを返す。
+func (t *BPlusTreeG[T]) DeleteMin() (_ T, _ bool) {
+	if min, ok := t.Min(); ok {
+		return t.Delete(min)
+	}
+	return
+}
+
+// DeleteMaxは、木の中の最大の項目を削除し、それを返す。
+func (t *BPlusTreeG[T]) DeleteMax() (_ T, _ bool) {
+	if max, ok := t.Max(); ok {
+		return t.Delete(max)
+	}
+	return
+}
+
+// removeは、nをルートとするサブツリーからitemを削除し、子が最小数を下回った場合は兄弟から借りるかマージして直します。
+func (t *BPlusTreeG[T]) remove(n *bpNode[T], item T) (_ T, _ bool) {
+	if n.isLeaf() {
+		i, found := n.items.find(item, t.less)
+		if !found {
+			return
+		}
+		return n.items.removeAt(i), true
+	}
+	i := n.childIndex(item, t.less)
+	out, found := t.remove(n.children[i], item)
+	if found && t.underflow(n.children[i]) {
+		t.rebalance(n, i)
+	}
+	return out, found
+}
+
+// underflowは、ルート以外のノードnが最小数を下回っているかどうかを返します。
+func (t *BPlusTreeG[T]) underflow(n *bpNode[T]) bool {
+	if n.isLeaf() {
+		return len(n.items) < t.minItems()
+	}
+	return len(n.children) < t.degree
+}
+
+// canLendは、ノードnが兄弟にアイテム（または子）を1つ貸せるかどうかを返します。
+func (t *BPlusTreeG[T]) canLend(n *bpNode[T]) bool {
+	if n.isLeaf() {
+		return len(n.items) > t.minItems()
+	}
+	return len(n.children) > t.degree
+}
+
+// rebalanceは、親nのi番目の子が最小数を下回ったときに、左右の兄弟から借りるか、兄弟とマージします。
+func (t *BPlusTreeG[T]) rebalance(n *bpNode[T], i int) {
+	child := n.children[i]
+	switch {
+	case i > 0 && t.canLend(n.children[i-1]):
+		left := n.children[i-1]
+		if child.isLeaf() {
+			child.items.insertAt(0, left.items.pop())
+			n.items[i-1] = child.items[0]
+		} else {
+			child.items.insertAt(0, n.items[i-1])
+			child.children = append([]*bpNode[T]{left.children[len(left.children)-1]}, child.children...)
+			left.children[len(left.children)-1] = nil
+			left.children = left.children[:len(left.children)-1]
+			n.items[i-1] = left.items.pop()
+		}
+	case i < len(n.children)-1 && t.canLend(n.children[i+1]):
+		right := n.children[i+1]
+		if child.isLeaf() {
+			child.items = append(child.items, right.items.removeAt(0))
+			n.items[i] = right.items[0]
+		} else {
+			child.items = append(child.items, n.items[i])
+			child.children = append(child.children, right.children[0])
+			copy(right.children, right.children[1:])
+			right.children[len(right.children)-1] = nil
+			right.children = right.children[:len(right.children)-1]
+			n.items[i] = right.items.removeAt(0)
+		}
+	default:
+		// どちらの兄弟も貸せないので、右隣とマージする（一番右の子なら左隣とマージする）。
+		if i == len(n.children)-1 {
+			i--
+		}
+		left, right := n.children[i], n.children[i+1]
+		if left.isLeaf() {
+			left.items = append(left.items, right.items...)
+			left.next = right.next
+			if right.next != nil {
+				right.next.prev = left
+			}
+		} else {
+			left.items = append(left.items, n.items[i])
+			left.items = append(left.items, right.items...)
+			left.children = append(left.children, right.children...)
+		}
+		n.items.removeAt(i)
+		copy(n.children[i+1:], n.children[i+2:])
+		n.children[len(n.children)-1] = nil
+		n.children = n.children[:len(n.children)-1]
+	}
+}
+
+// Get は、木の中からキーとなる項目を探し、それを返す。 その項目が見つからない場合は (zeroValue, false) を返す。
+func (t *BPlusTreeG[T]) Get(key T) (_ T, _ bool) {
+	leaf := t.leafFor(key)
+	if leaf == nil {
+		return
+	}
+	if i, found := leaf.items.find(key, t.less); found {
+		return leaf.items[i], true
+	}
+	return
+}
+
+// 与えられたキーが木の中にある場合、Hasはtrueを返します。
+func (t *BPlusTreeG[T]) Has(key T) bool {
+	_, ok := t.Get(key)
+	return ok
+}
+
+// Minは，木の中で最も小さい項目を返し，木が空の場合は (zeroValue, false) を返す。
+func (t *BPlusTreeG[T]) Min() (_ T, _ bool) {
+	if leaf := t.firstLeaf(); leaf != nil && len(leaf.items) > 0 {
+		return leaf.items[0], true
+	}
+	return
+}
+
+// Maxは，木の中で最大の項目を返し，木が空であれば (zeroValue, false) を返す。
+func (t *BPlusTreeG[T]) Max() (_ T, _ bool) {
+	if leaf := t.lastLeaf(); leaf != nil && len(leaf.items) > 0 {
+		return leaf.items[len(leaf.items)-1], true
+	}
+	return
+}
+
+// Lenは、現在木にあるアイテムの数を返します。
+func (t *BPlusTreeG[T]) Len() int {
+	return t.length
+}
+
+// Clearは、木からすべてのアイテムを削除します。ノードはGoの通常のGC処理に委ねられます。
+func (t *BPlusTreeG[T]) Clear() {
+	t.root, t.length = nil, 0
+}
+
+// ascendは、startの位置から葉のリンクをたどって昇順に走査します。stopに達するかiteratorがfalseを返すと止まります。
+func (t *BPlusTreeG[T]) ascend(start, stop optionalItem[T], includeStart bool, iterator ItemIteratorG[T]) {
+	var leaf *bpNode[T]
+	var i int
+	if start.valid {
+		leaf = t.leafFor(start.item)
+		if leaf == nil {
+			return
+		}
+		var found bool
+		i, found = leaf.items.find(start.item, t.less)
+		if found && !includeStart {
+			i++
+		}
+	} else {
+		leaf = t.firstLeaf()
+	}
+	for ; leaf != nil; leaf, i = leaf.next, 0 {
+		for ; i < len(leaf.items); i++ {
+			if stop.valid && !t.less(leaf.items[i], stop.item) {
+				return
+			}
+			if !iterator(leaf.items[i]) {
+				return
+			}
+		}
+	}
+}
+
+// descendは、startの位置から葉のリンクを逆にたどって降順に走査します。stopに達するかiteratorがfalseを返すと止まります。
+func (t *BPlusTreeG[T]) descend(start, stop optionalItem[T], includeStart bool, iterator ItemIteratorG[T]) {
+	var leaf *bpNode[T]
+	var i int
+	if start.valid {
+		leaf = t.leafFor(start.item)
+		if leaf == nil {
+			return
+		}
+		var found bool
+		i, found = leaf.items.find(start.item, t.less)
+		if !found || !includeStart {
+			i--
+		}
+	} else {
+		leaf = t.lastLeaf()
+		if leaf == nil {
+			return
+		}
+		i = len(leaf.items) - 1
+	}
+	for leaf != nil {
+		for ; i >= 0; i-- {
+			if stop.valid && !t.less(stop.item, leaf.items[i]) {
+				return
+			}
+			if !iterator(leaf.items[i]) {
+				return
+			}
+		}
+		if leaf = leaf.prev; leaf != nil {
+			i = len(leaf.items) - 1
+		}
+	}
+}
+
+// AscendRange は、木の中のすべての値について、範囲 [greaterOrEqual, lessThan) 内で、iterator が false を返すまでイテレータを呼び出します。
+func (t *BPlusTreeG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	t.ascend(optional(greaterOrEqual), optional(lessThan), true, iterator)
+}
+
+// AscendLessThan は、[first, pivot) の範囲内にある木のすべての値に対して、iterator が false を返すまでイテレータを呼び出します。
+func (t *BPlusTreeG[T]) AscendLessThan(pivot T, iterator ItemIteratorG[T]) {
+	t.ascend(empty[T](), optional(pivot), false, iterator)
+}
+
+// AscendGreaterOrEqual は、木の中の [pivot, last] の範囲内のすべての値について、iterator が false を返すまでイテレータを呼び出します。
+func (t *BPlusTreeG[T]) AscendGreaterOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	t.ascend(optional(pivot), empty[T](), true, iterator)
+}
+
+// iteratorがfalseを返すまで、[first, last]の範囲内にある木のすべての値に対して、iteratorを呼び出します。
+func (t *BPlusTreeG[T]) Ascend(iterator ItemIteratorG[T]) {
+	t.ascend(empty[T](), empty[T](), false, iterator)
+}
+
+// DescendRangeは、木の中のすべての値について、[lessOrEqual, greaterThan)の範囲内で、iteratorがfalseを返すまでイテレータを呼び出します。
+func (t *BPlusTreeG[T]) DescendRange(lessOrEqual, greaterThan T, iterator ItemIteratorG[T]) {
+	t.descend(optional(lessOrEqual), optional(greaterThan), true, iterator)
+}
+
+// DescendLessOrEqualは、[pivot, first]の範囲内にある木のすべての値について、iteratorがfalseを返すまで、iteratorを呼び出します。
+func (t *BPlusTreeG[T]) DescendLessOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	t.descend(optional(pivot), empty[T](), true, iterator)
+}
+
+// DescendGreaterThanは、木の中のすべての値について、[last, pivot)の範囲内で、iteratorがfalseを返すまでイテレータを呼び出します。
+func (t *BPlusTreeG[T]) DescendGreaterThan(pivot T, iterator ItemIteratorG[T]) {
+	t.descend(empty[T](), optional(pivot), false, iterator)
+}
+
+// Descendは、[last, first]の範囲内にある木のすべての値について、iteratorがfalseを返すまで、iteratorを呼び出します。
+func (t *BPlusTreeG[T]) Descend(iterator ItemIteratorG[T]) {
+	t.descend(empty[T](), empty[T](), false, iterator)
+}
+
+// BPlusTree
+
+// genericは、tを同じ木のBPlusTreeG[Item]として返します。
+func (t *BPlusTree) generic() *BPlusTreeG[Item] {
+	return (*BPlusTreeG[Item])(t)
+}
+
+// ReplaceOrInsert は、与えられたアイテムを木に追加する。同じアイテムが既にあれば置き換えて返し、そうでなければnilを返す。
+// nilは木に追加できません（パニックになります）。
+func (t *BPlusTree) ReplaceOrInsert(item Item) Item {
+	if item == nil {
+		panic("nil item being added to BPlusTree")
+	}
+	out, _ := t.generic().ReplaceOrInsert(item)
+	return out
+}
+
+// Delete は、渡された項目に等しい項目を木から削除し、それを返す。 そのようなアイテムが存在しない場合は、nil を返す。
+func (t *BPlusTree) Delete(item Item) Item {
+	out, _ := t.generic().Delete(item)
+	return out
+}
+
+// DeleteMinは、木の中の最小の項目を削除し、それを返す。そのような項目が存在しない場合は、nilを返す。
+func (t *BPlusTree) DeleteMin() Item {
+	out, _ := t.generic().DeleteMin()
+	return out
+}
+
+// DeleteMaxは、木の中の最大の項目を削除し、それを返す。そのような項目が存在しない場合は、nilを返す。
+func (t *BPlusTree) DeleteMax() Item {
+	out, _ := t.generic().DeleteMax()
+	return out
+}
+
+// Get は、木の中からキーとなる項目を探し、それを返す。 その項目が見つからない場合はnilを返す。
+func (t *BPlusTree) Get(key Item) Item {
+	out, _ := t.generic().Get(key)
+	return out
+}
+
+// 与えられたキーが木の中にある場合、Hasはtrueを返します。
+func (t *BPlusTree) Has(key Item) bool {
+	return t.generic().Has(key)
+}
+
+// Minは，木の中で最も小さい項目を返し，木が空の場合はnilを返す。
+func (t *BPlusTree) Min() Item {
+	out, _ := t.generic().Min()
+	return out
+}
+
+// Maxは，木の中で最大の項目を返し，木が空であればnilを返す。
+func (t *BPlusTree) Max() Item {
+	out, _ := t.generic().Max()
+	return out
+}
+
+// Lenは、現在木にあるアイテムの数を返します。
+func (t *BPlusTree) Len() int {
+	return t.generic().Len()
+}
+
+// Clearは、木からすべてのアイテムを削除します。
+func (t *BPlusTree) Clear() {
+	t.generic().Clear()
+}
+
+// AscendRange は、範囲 [greaterOrEqual, lessThan) 内の値について、iterator が false を返すまでイテレータを呼び出します。nilの境界は「境界なし」を意味します。
+func (t *BPlusTree) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	t.generic().ascend(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), true, ItemIteratorG[Item](iterator))
+}
+
+// AscendLessThan は、[first, pivot) の範囲内の値に対して、iterator が false を返すまでイテレータを呼び出します。nilのpivotは「境界なし」を意味します。
+func (t *BPlusTree) AscendLessThan(pivot Item, iterator ItemIterator) {
+	t.generic().ascend(empty[Item](), optionalIfNotNil(pivot), false, ItemIteratorG[Item](iterator))
+}
+
+// AscendGreaterOrEqual は、[pivot, last] の範囲内の値について、iterator が false を返すまでイテレータを呼び出します。nilのpivotは「境界なし」を意味します。
+func (t *BPlusTree) AscendGreaterOrEqual(pivot Item, iterator ItemIterator) {
+	t.generic().ascend(optionalIfNotNil(pivot), empty[Item](), true, ItemIteratorG[Item](iterator))
+}
+
+// iteratorがfalseを返すまで、[first, last]の範囲内にある木のすべての値に対して、iteratorを呼び出します。
+func (t *BPlusTree) Ascend(iterator ItemIterator) {
+	t.generic().Ascend(ItemIteratorG[Item](iterator))
+}
+
+// DescendRangeは、[lessOrEqual, greaterThan)の範囲内の値について、iteratorがfalseを返すまでイテレータを呼び出します。nilの境界は「境界なし」を意味します。
+func (t *BPlusTree) DescendRange(lessOrEqual, greaterThan Item, iterator ItemIterator) {
+	t.generic().descend(optionalIfNotNil(lessOrEqual), optionalIfNotNil(greaterThan), true, ItemIteratorG[Item](iterator))
+}
+
+// DescendLessOrEqualは、[pivot, first]の範囲内の値について、iteratorがfalseを返すまで、iteratorを呼び出します。nilのpivotは「境界なし」を意味します。
+func (t *BPlusTree) DescendLessOrEqual(pivot Item, iterator ItemIterator) {
+	t.generic().descend(optionalIfNotNil(pivot), empty[Item](), true, ItemIteratorG[Item](iterator))
+}
+
+// DescendGreaterThanは、[last, pivot)の範囲内の値について、iteratorがfalseを返すまでイテレータを呼び出します。nilのpivotは「境界なし」を意味します。
+func (t *BPlusTree) DescendGreaterThan(pivot Item, iterator ItemIterator) {
+	t.generic().descend(empty[Item](), optionalIfNotNil(pivot), false, ItemIteratorG[Item](iterator))
+}
+
+// Descendは、[last, first]の範囲内にある木のすべての値について、iteratorがfalseを返すまで、iteratorを呼び出します。
+func (t *BPlusTree) Descend(iterator ItemIterator) {
+	t.generic().Descend(ItemIteratorG[Item](iterator))
+}
@@ -0,0 +1,226 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// checkBPlusは、B+木の構造が正しいことを確かめます。すべての葉が同じ深さにあること、根以外のノードの項目数が上限と下限の間にあること、
+// 区切りのキーが子の項目を正しく分けていること、葉のリンクが葉を左から順につないでいること、項目数がLenと一致することを調べます。
+func checkBPlus(t *testing.T, tr *BPlusTreeG[int]) {
+	t.Helper()
+	if tr.root == nil {
+		if tr.length != 0 {
+			t.Fatalf("empty tree has Len %d", tr.length)
+		}
+		return
+	}
+	var leaves []*bpNode[int]
+	depth := -1
+	var walk func(n *bpNode[int], d int, lo, hi optionalItem[int])
+	walk = func(n *bpNode[int], d int, lo, hi optionalItem[int]) {
+		if n != tr.root && (len(n.items) < tr.minItems() || len(n.items) > tr.maxItems()) {
+			t.Fatalf("node at depth %d has %d items, want %d to %d", d, len(n.items), tr.minItems(), tr.maxItems())
+		}
+		for i, item := range n.items {
+			if i > 0 && !tr.less(n.items[i-1], item) {
+				t.Fatalf("items out of order at depth %d: %v", d, n.items)
+			}
+			if lo.valid && tr.less(item, lo.item) || hi.valid && !tr.less(item, hi.item) {
+				t.Fatalf("item %d at depth %d is outside its separators [%+v, %+v)", item, d, lo, hi)
+			}
+		}
+		if n.isLeaf() {
+			if depth >= 0 && d != depth {
+				t.Fatalf("leaves at depths %d and %d", depth, d)
+			}
+			depth = d
+			leaves = append(leaves, n)
+			return
+		}
+		if len(n.children) != len(n.items)+1 {
+			t.Fatalf("internal node has %d items and %d children", len(n.items), len(n.children))
+		}
+		for i, c := range n.children {
+			clo, chi := lo, hi
+			if i > 0 {
+				clo = optional(n.items[i-1])
+			}
+			if i < len(n.items) {
+				chi = optional(n.items[i])
+			}
+			walk(c, d+1, clo, chi)
+		}
+	}
+	walk(tr.root, 0, empty[int](), empty[int]())
+	count := 0
+	for i, leaf := range leaves {
+		count += len(leaf.items)
+		var prev, next *bpNode[int]
+		if i > 0 {
+			prev = leaves[i-1]
+		}
+		if i < len(leaves)-1 {
+			next = leaves[i+1]
+		}
+		if leaf.prev != prev || leaf.next != next {
+			t.Fatalf("leaf %d of %d is linked to the wrong neighbours", i, len(leaves))
+		}
+	}
+	if count != tr.length {
+		t.Fatalf("leaves hold %d items, Len is %d", count, tr.length)
+	}
+}
+
+func TestBPlusMatchesMap(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for _, degree := range []int{2, 3, 5} {
+		tr := NewBPlusG(degree, intLess)
+		model := map[int]bool{}
+		for step := 0; step < 5000; step++ {
+			k := r.Intn(500)
+			switch op := r.Intn(10); {
+			case op < 5:
+				if _, found := tr.ReplaceOrInsert(k); found != model[k] {
+					t.Fatalf("degree %d step %d: ReplaceOrInsert(%d) found %v, model %v", degree, step, k, found, model[k])
+				}
+				model[k] = true
+			case op < 8:
+				if _, found := tr.Delete(k); found != model[k] {
+					t.Fatalf("degree %d step %d: Delete(%d) found %v, model %v", degree, step, k, found, model[k])
+				}
+				delete(model, k)
+			default:
+				keys := bplusKeys(model)
+				del, first := tr.DeleteMin, true
+				if op == 9 {
+					del, first = tr.DeleteMax, false
+				}
+				got, ok := del()
+				if ok != (len(keys) > 0) {
+					t.Fatalf("degree %d step %d: DeleteMin/DeleteMax on %d items returned ok=%v", degree, step, len(keys), ok)
+				}
+				if ok {
+					want := keys[len(keys)-1]
+					if first {
+						want = keys[0]
+					}
+					if got != want {
+						t.Fatalf("degree %d step %d: DeleteMin/DeleteMax (first=%v) = %d, want %d", degree, step, first, got, want)
+					}
+					delete(model, want)
+				}
+			}
+			if step%100 == 0 {
+				checkBPlus(t, tr)
+				if got, want := fmt.Sprint(bplusItems(tr)), fmt.Sprint(bplusKeys(model)); got != want {
+					t.Fatalf("degree %d step %d: tree %v, model %v", degree, step, got, want)
+				}
+			}
+		}
+		checkBPlus(t, tr)
+	}
+}
+
+// TestBPlusRangesは、葉のリンクをたどる走査が、すべての向き、境界、開始位置を含めるかどうかの組み合わせで、iterateと同じ結果を返すことを確かめます。
+func TestBPlusRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	tr := NewBPlusG(3, intLess)
+	var keys []int
+	for i := 0; i < 400; i++ {
+		if r.Intn(3) > 0 {
+			tr.ReplaceOrInsert(i * 2)
+			keys = append(keys, i*2)
+		}
+	}
+	checkBPlus(t, tr)
+	for n := 0; n < 300; n++ {
+		a, b := r.Intn(820)-10, r.Intn(820)-10
+		for _, includeStart := range []bool{true, false} {
+			for _, bounds := range []struct{ start, stop optionalItem[int] }{
+				{optional(a), optional(b)},
+				{optional(a), empty[int]()},
+				{empty[int](), optional(b)},
+				{empty[int](), empty[int]()},
+			} {
+				for _, dir := range []direction{ascend, descend} {
+					got := []int{}
+					collect := func(i int) bool {
+						got = append(got, i)
+						return true
+					}
+					if dir == ascend {
+						tr.ascend(bounds.start, bounds.stop, includeStart, collect)
+					} else {
+						tr.descend(bounds.start, bounds.stop, includeStart, collect)
+					}
+					want := iterateModel(keys, dir, bounds.start, bounds.stop, includeStart)
+					if fmt.Sprint(got) != fmt.Sprint(want) {
+						t.Fatalf("%v(%+v, %+v, %v) = %v, want %v", dir, bounds.start, bounds.stop, includeStart, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBPlusItemWrapper(t *testing.T) {
+	tr := NewBPlus(3)
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	if tr.Len() != 100 || tr.Min() != Int(0) || tr.Max() != Int(99) || !tr.Has(Int(50)) {
+		t.Fatalf("Len=%d Min=%v Max=%v Has(50)=%v", tr.Len(), tr.Min(), tr.Max(), tr.Has(Int(50)))
+	}
+	if got := tr.Delete(Int(1000)); got != nil {
+		t.Fatalf("Delete of a missing item = %v, want nil", got)
+	}
+	var got []Item
+	tr.DescendRange(Int(10), Int(5), func(i Item) bool {
+		got = append(got, i)
+		return true
+	})
+	if fmt.Sprint(got) != "[10 9 8 7 6]" {
+		t.Fatalf("DescendRange(10, 5) = %v", got)
+	}
+	// nilのpivotは境界なしとして、すべての項目を走査する。
+	for name, scan := range map[string]func(Item, ItemIterator){
+		"AscendLessThan":       tr.AscendLessThan,
+		"AscendGreaterOrEqual": tr.AscendGreaterOrEqual,
+		"DescendLessOrEqual":   tr.DescendLessOrEqual,
+		"DescendGreaterThan":   tr.DescendGreaterThan,
+	} {
+		n := 0
+		scan(nil, func(Item) bool {
+			n++
+			return true
+		})
+		if n != 100 {
+			t.Errorf("%s(nil) visited %d items, want 100", name, n)
+		}
+	}
+	tr.Clear()
+	if tr.Len() != 0 || tr.Min() != nil {
+		t.Fatalf("after Clear Len=%d Min=%v", tr.Len(), tr.Min())
+	}
+}
+
+func bplusKeys(model map[int]bool) []int {
+	keys := make([]int, 0, len(model))
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func bplusItems(tr *BPlusTreeG[int]) []int {
+	out := []int{}
+	tr.Ascend(func(i int) bool {
+		out = append(out, i)
+		return true
+	})
+	return out
+}
@@ -0,0 +1,932 @@
+package btree
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	// LessFuncは、a < b かどうかを判定します。
+	// less(a, b) も less(b, a) も偽の場合、a == b を意味するものとして扱います（つまり、ツリーの中でaまたはbのどちらか一方しか保持できない）。
+	LessFunc[T any] func(a, b T) bool
+
+	items[T any] []T
+
+	children[T any] []*node[T]
+
+	// ノードの書き込みコンテキストと同じ書き込みコンテキストを持つツリーは、そのノードを変更することができます。
+	// 書き込みコンテキストがノードの書き込みコンテキストと一致しないツリーは、そのノードを変更することができず、書き込み可能な新しいコピーを作成する必要があります（IE：クローンです）。
+	//
+	// 書き込み操作を行う場合、現在のノードのコンテキストは書き込みを要求したツリーのコンテキストと等しいという不変性を維持します。
+	// これは、ノードに降りる前に、コンテキストが一致しない場合に、正しいコンテキストを持つコピーを作成することで実現します。
+	//
+	// 書き込みの際に現在訪問しているノードは、要求元のツリーのコンテキストを持っているので、そのノードはその場で変更可能です。
+	// そのノードの子ノードはコンテキストを共有していないかもしれませんが、その子ノードに降りる前に、変更可能な
+	copyOnWriteContext[T any] struct {
+		// genは、このコンテキストが新しく作るノードの世代で、sync/atomicで読み書きします（32ビット環境での整列のために先頭に置きます）。
+		// shareで進めると、それまでに作ったノードは所有されていない（書き込む前にコピーが必要な）状態になります。
+		gen      uint64
+		freelist *FreeListG[T]
+		less     LessFunc[T]
+		// itemCapは、このコンテキストで割り当てるノードの項目のスライスに必要な容量（木の最大項目数）です。
+		itemCap int
+		// countsは、RecordEventsで記録している場合に、進行中の書き込みでの構造の変化を数える先です。記録していない場合はnilです。
+		counts *structCounts
+		// scoreは、OptionsG.Scoreです。nilでなければ、各ノードにサブツリーのスコアの最小値と最大値を保持します。
+		score func(T) float64
+	}
+
+	node[T any] struct {
+		items    items[T]
+		children children[T]
+		// sizeは、このノードをルートとするサブツリーの項目数です。GetAtやRankで位置を求めるために使われます。
+		size int
+		// minScoreとmaxScoreは、OptionsG.Scoreを指定した木で、このノードをルートとするサブツリーの項目のスコアの最小値と最大値です。MinByやMaxByで使われます。
+		minScore, maxScore float64
+		cow                *copyOnWriteContext[T]
+		// genは、このノードを作ったときのcow.genです。
+		gen uint64
+	}
+
+	// BTreeGは、任意の型Tのアイテムを保持する、ジェネリックなB-Treeの実装である。
+	// アイテムはインターフェースに包まれないので、int64や構造体のキーを割り当てや型アサーションなしで保持できる。
+	//Write操作は、複数のゴルーチンによる同時変異に対して安全ではないが、Read操作は安全である。
+	BTreeG[T any] struct {
+		degree int
+		length int
+		root   *node[T]
+		cow    *copyOnWriteContext[T]
+		// iteratingは、進行中の反復の数です（btreedebugビルドでのみ、sync/atomicで読み書きします）。
+		iterating int32
+		// mutationsは、木を変更しうる操作の回数です。カーソルが木の変更を検出するために使われます。
+		mutations uint64
+		// recoverPanicsがtrueの場合、公開メソッドで発生したパニックを回復してerrに記録します。
+		recoverPanics bool
+		err           error
+		poisoned      bool
+		// writerは、開いている書き込み可能なトランザクションです。
+		writer *TxnG[T]
+		// eventsは、RecordEventsで記録を始めた場合のイベントの記録です。
+		events *eventLog
+	}
+
+	// OptionsGは、NewWithOptionsGで木を作成する際の設定です。ゼロ値はNewGと同じ設定になります。
+	OptionsG[T any] struct {
+		// FreeListは、木が使用するノードのフリーリストです。nilの場合は新しいフリーリストを作成します。
+		FreeList *FreeListG[T]
+		// FreeListSizeは、FreeListがnilの場合に作成するフリーリストの大きさです。0の場合はDefaultFreeListSizeです。
+		// 挿入と削除を激しく繰り返す木では、大きくするとノードの割り当てが減ります。
+		FreeListSize int
+		// ArenaSlabが正の場合、木はアリーナモードになり、ノードをArenaSlab個ずつまとめて割り当てます（NewWithArenaGを参照）。
+		// アリーナは木とそのCloneだけが使うので、FreeListと同時には指定できません。
+		ArenaSlab int
+		// RecoverPanicsがtrueの場合、公開メソッド内で発生したパニック（ユーザーのLess実装によるものを含む）を回復し、
+		// ErrInternalを包んだエラーとしてErrで取得できるようにします。パニックしたメソッドはゼロ値を返します。
+		RecoverPanics bool
+		// Scoreは、項目から順序のキーとは別の数値を取り出す関数です。指定すると、各ノードにサブツリーのスコアの最小値と最大値を保持し、
+		// MinByRangeやMaxByRangeでキーの範囲の中でスコアが最小や最大の項目をO(log n)で求められるようになります。
+		// 書き込みのたびに経路上のノードでScoreを呼び直すので、書き込みはdegreeに比例して遅くなります。ScoreはNaNを返してはいけません。
+		// Union、Intersect、Differenceでは、両方の木が同じScoreを使っている必要があります。
+		Score func(T) float64
+	}
+
+	// ItemIteratorGは、Ascend*の呼び出し元がツリーの一部を順番に反復処理することを可能にします。
+	//この関数が false を返すと、反復処理は停止し、関連する Ascend* 関数が直ちに返されます。
+	ItemIteratorG[T any] func(item T) bool
+
+	// optionalItemは、範囲の境界のように、省略可能なアイテムを表します。
+	optionalItem[T any] struct {
+		item  T
+		valid bool
+	}
+
+	toRemove  int
+	freeType  int
+	direction int
+)
+
+const (
+	DefaultFreeListSize = 32
+
+	removeItem toRemove = iota // 与えられた項目を削除します。
+	removeMin                  // サブツリー内の最小の項目を削除します。
+	removeMax                  // サブツリーの最大の項目を削除します。
+
+	ftFreelistFull freeType = iota // ノードが解放された（GCで利用可能、フリーリストに保存されない）。
+	ftStored                       // ノードがフリーリストに保存され、後で使用されるようになった
+	ftNotOwned                     // ノードは、別のノードに所有されているため、COWによって無視されました。
+
+	descend = direction(-1)
+	ascend  = direction(+1)
+)
+
+func optional[T any](item T) optionalItem[T] {
+	return optionalItem[T]{item: item, valid: true}
+}
+
+func empty[T any]() optionalItem[T] {
+	return optionalItem[T]{}
+}
+
+// NewGは、与えられたdegreeとless関数を使う新しいBTreeGを作成します。
+func NewG[T any](degree int, less LessFunc[T]) *BTreeG[T] {
+	return NewWithFreeListG(degree, less, NewFreeListG[T](DefaultFreeListSize))
+}
+
+// 与えられたノードフリーリストを使用する新しい BTreeG を作成します。
+func NewWithFreeListG[T any](degree int, less LessFunc[T], f *FreeListG[T]) *BTreeG[T] {
+	return NewWithOptionsG(degree, less, OptionsG[T]{FreeList: f})
+}
+
+// NewWithOptionsGは、与えられた設定で新しい BTreeG を作成します。
+func NewWithOptionsG[T any](degree int, less LessFunc[T], opts OptionsG[T]) *BTreeG[T] {
+	if degree <= 1 {
+		panic("bad degree")
+	}
+	if less == nil {
+		panic("nil LessFunc")
+	}
+	size := opts.FreeListSize
+	if size <= 0 {
+		size = DefaultFreeListSize
+	}
+	f := opts.FreeList
+	switch {
+	case opts.ArenaSlab > 0 && f != nil:
+		panic("arena with a shared FreeList")
+	case opts.ArenaSlab > 0:
+		f = newArenaFreeList[T](size, opts.ArenaSlab, degree*2-1)
+	case f == nil:
+		f = NewFreeListG[T](size)
+	}
+	return &BTreeG[T]{
+		degree:        degree,
+		cow:           &copyOnWriteContext[T]{freelist: f, less: less, itemCap: degree*2 - 1, score: opts.Score},
+		recoverPanics: opts.RecoverPanics,
+	}
+}
+
+// NewWithArenaGは、ノードをDefaultArenaSlab個ずつまとめて割り当てるアリーナモードの新しいBTreeGを作成します。
+//
+// ノードと項目のスライスをスラブ単位で割り当てるので、大きな木を作るときの割り当ての回数とGCが追跡するオブジェクトの数が大きく減ります。
+// Clearはノードを1つずつフリーリストに戻す代わりに、フリーリストとアリーナの参照をまとめて手放し、スラブごとGCに回収させます。
+// その代わり、スラブの中に1つでも生きているノードがあればスラブ全体が解放されないので、削除が多く木が縮む用途には向きません。
+func NewWithArenaG[T any](degree int, less LessFunc[T]) *BTreeG[T] {
+	return NewWithOptionsG(degree, less, OptionsG[T]{ArenaSlab: DefaultArenaSlab})
+}
+
+// items
+
+// insertAtは、与えられたインデックスに値を挿入し、それ以降の値をすべて後ろに移す。
+func (s *items[T]) insertAt(index int, item T) {
+	var zero T
+	*s = append(*s, zero)
+	if index < len(*s) {
+		copy((*s)[index+1:], (*s)[index:]) // 前に後ろをコピーする
+	}
+	(*s)[index] = item
+}
+
+// removeAtは、指定されたインデックスの値を削除し、それ以降の値をすべて引き戻します。
+func (s *items[T]) removeAt(index int) T {
+	item := (*s)[index]
+	copy((*s)[index:], (*s)[index+1:])
+	var zero T
+	(*s)[len(*s)-1] = zero
+	*s = (*s)[:len(*s)-1]
+	return item
+}
+
+// pop は、リストの最後の要素を削除して返します。
+func (s *items[T]) pop() (out T) {
+	index := len(*s) - 1
+	out = (*s)[index]
+	var zero T
+	(*s)[index] = zero
+	*s = (*s)[:index]
+	return
+}
+
+// truncateは、このインスタンスをindexで切り捨て、最初のindex項目のみを含むようにする。indexはlength以下でなければならない。
+// 切り捨てた部分はGCのためにゼロ値で埋める。
+func (s *items[T]) truncate(index int) {
+	var toClear items[T]
+	*s, toClear = (*s)[:index], (*s)[index:]
+	var zero T
+	for i := range toClear {
+		toClear[i] = zero
+	}
+}
+
+// find は、与えられた項目をこのリストに挿入するためのインデックスを返す。 'found' は、その項目が既にリストの中の与えられたインデックスに存在する場合に真となる。
+// itemより大きいs[i]を探す、なのでs[i-1]はitemより小さいか同じ、!less(s[i-1], item)はs[i-1]よりitemが大きくないので同じになる
+func (s items[T]) find(item T, less LessFunc[T]) (index int, found bool) {
+	i := sort.Search(len(s), func(i int) bool {
+		return less(item, s[i])
+	})
+	if i > 0 && !less(s[i-1], item) {
+		return i - 1, true
+	}
+	return i, false
+}
+
+// children
+
+// insertAtは、与えられたインデックスに値を挿入し、それ以降の値をすべて前方に押し出します。
+func (s *children[T]) insertAt(index int, n *node[T]) {
+	*s = append(*s, nil)
+	if index < len(*s) {
+		copy((*s)[index+1:], (*s)[index:])
+	}
+	(*s)[index] = n
+}
+
+func (s *children[T]) removeAt(index int) *node[T] {
+	n := (*s)[index]
+	copy((*s)[index:], (*s)[index+1:])
+	(*s)[len(*s)-1] = nil
+	*s = (*s)[:len(*s)-1]
+	return n
+}
+
+func (s *children[T]) pop() (out *node[T]) {
+	index := len(*s) - 1
+	out = (*s)[index]
+	(*s)[index] = nil
+	*s = (*s)[:index]
+	return
+}
+
+func (s *children[T]) truncate(index int) {
+	var toClear children[T]
+	*s, toClear = (*s)[:index], (*s)[index:]
+	for i := range toClear {
+		toClear[i] = nil
+	}
+}
+
+// node
+//nodeは、木の内部ノードである。
+// このノードは、常に、 * len(children) == 0, len(items) unconstrained * len(children) == len(items) + 1 という不変性を保持していなければならない。
+
+// cow の newnode(freelistの端のnode res)を、n のnodenのitems,childrenをコピーして返す。
+func (n *node[T]) mutableFor(cow *copyOnWriteContext[T]) *node[T] {
+	if cow.owns(n) {
+		return n
+	}
+	cow.freelist.countCopy()
+	if cow.counts != nil {
+		cow.counts.copies++
+	}
+	out := cow.newNode()
+	if cap(out.items) >= len(n.items) {
+		out.items = out.items[:len(n.items)]
+	} else {
+		out.items = make(items[T], len(n.items), cap(n.items))
+	}
+	copy(out.items, n.items)
+	// Copy children
+	if cap(out.children) >= len(n.children) {
+		out.children = out.children[:len(n.children)]
+	} else {
+		out.children = make(children[T], len(n.children), cap(n.children))
+	}
+	copy(out.children, n.children)
+	out.size = n.size
+	out.minScore, out.maxScore = n.minScore, n.maxScore
+	return out
+}
+
+// recountは、項目と子のサブツリーの項目数からsizeを計算し直します。スコアを保持する木では、スコアの最小値と最大値も計算し直します。
+func (n *node[T]) recount() {
+	n.size = len(n.items)
+	for _, c := range n.children {
+		n.size += c.size
+	}
+	n.rescore()
+}
+
+// mutableChild は、与えられたインデックスの子ノードを返す。このノードは、このノードのコピーでなければならない。
+func (n *node[T]) mutableChild(i int) *node[T] {
+	c := n.children[i].mutableFor(n.cow)
+	n.children[i] = c
+	return c
+}
+
+// split は、与えられたノードを与えられたインデックスで分割する。
+// 現在のノードは縮小し、この関数はそのインデックスに存在していたアイテムと、それ以降のすべてのアイテム/子ノードを含む新しいノードを返す。
+func (n *node[T]) split(i int) (T, *node[T]) {
+	item := n.items[i]
+	if n.cow.counts != nil {
+		n.cow.counts.splits++
+	}
+	next := n.cow.newNode()
+	next.items = append(next.items, n.items[i+1:]...)
+	n.items.truncate(i)
+	if len(n.children) > 0 {
+		next.children = append(next.children, n.children[i+1:]...)
+		n.children.truncate(i + 1)
+	}
+	n.recount()
+	next.recount()
+	return item, next
+}
+
+// maybeSplitChildは、子機が分割されるべきかどうかをチェックし、分割される場合は分割する。分割が行われたかどうかを返します。
+func (n *node[T]) maybeSplitChild(i, maxItems int) bool {
+	if len(n.children[i].items) < maxItems {
+		return false
+	}
+	// i個目の子ノードをコピーしたnodeを返す。
+	first := n.mutableChild(i)
+	// 分割
+	item, second := first.split(maxItems / 2)
+	// itemsにi個目にitemをinsert
+	n.items.insertAt(i, item)
+	n.children.insertAt(i+1, second)
+	return true
+}
+
+// insert は、このノードをルートとするサブツリーにアイテムを挿入し、
+// サブツリー内のノードが maxItems アイテムを超えていないことを確認する。 insertによって同等のアイテムが見つかったり置き換えられたりした場合は、それが返されます。
+// item より大きいアイテムが見つかった場合、そのサブツリーの前に挿入されます。ない場合はさらにその先一番最後に挿入されます。
+func (n *node[T]) insert(item T, maxItems int) (_ T, _ bool) {
+	i, found := n.items.find(item, n.cow.less)
+	if found {
+		out := n.items[i]
+		n.items[i] = item
+		n.rescore()
+		return out, true
+	}
+	if len(n.children) == 0 {
+		n.items.insertAt(i, item)
+		n.size++
+		n.rescore()
+		return
+	}
+	if n.maybeSplitChild(i, maxItems) {
+		inTree := n.items[i]
+		switch {
+		case n.cow.less(item, inTree):
+			// no change, we want first split node
+		case n.cow.less(inTree, item):
+			i++ // we want second split node
+		default:
+			out := n.items[i]
+			n.items[i] = item
+			n.rescore()
+			return out, true
+		}
+	}
+	out, found := n.mutableChild(i).insert(item, maxItems)
+	if !found {
+		n.size++
+	}
+	// 置き換えでも項目のスコアは変わりうるので、見つかった場合も計算し直す。
+	n.rescore()
+	return out, found
+}
+
+// getは、サブツリーから与えられたキーを見つけ、それを返す。
+func (n *node[T]) get(key T) (_ T, _ bool) {
+	i, found := n.items.find(key, n.cow.less)
+	if found {
+		return n.items[i], true
+	} else if len(n.children) > 0 {
+		return n.children[i].get(key)
+	}
+	return
+}
+
+// minは、サブツリーの最初の項目を返す。
+func min[T any](n *node[T]) (_ T, found bool) {
+	if n == nil {
+		return
+	}
+	for len(n.children) > 0 {
+		n = n.children[0]
+	}
+	if len(n.items) == 0 {
+		return
+	}
+	return n.items[0], true
+}
+
+// max は、サブツリーの最後の項目を返す。
+func max[T any](n *node[T]) (_ T, found bool) {
+	if n == nil {
+		return
+	}
+	for len(n.children) > 0 {
+		n = n.children[len(n.children)-1]
+	}
+	if len(n.items) == 0 {
+		return
+	}
+	return n.items[len(n.items)-1], true
+}
+
+// remove は、このノードをルートとするサブツリーから項目を削除する。
+func (n *node[T]) remove(item T, minItems int, typ toRemove) (_ T, _ bool) {
+	var i int
+	var found bool
+	switch typ {
+	case removeMax:
+		if len(n.children) == 0 {
+			out := n.items.pop()
+			n.size--
+			n.rescore()
+			return out, true
+		}
+		i = len(n.items)
+	case removeMin:
+		if len(n.children) == 0 {
+			out := n.items.removeAt(0)
+			n.size--
+			n.rescore()
+			return out, true
+		}
+		i = 0
+	case removeItem:
+		i, found = n.items.find(item, n.cow.less)
+		if len(n.children) == 0 {
+			if found {
+				out := n.items.removeAt(i)
+				n.size--
+				n.rescore()
+				return out, true
+			}
+			return
+		}
+	default:
+		panic("invalid type")
+	}
+	// ここまでくれば、子ノードもいる。
+	if len(n.children[i].items) <= minItems {
+		return n.growChildAndRemove(i, item, minItems, typ)
+	}
+	child := n.mutableChild(i)
+	//もともと十分なアイテムがあったのか、それともマージやスティールをしたのか、今は十分なアイテムがあるので、物を返す準備はできています。
+	if found {
+		// アイテムはインデックス 'i' に存在し、選択した子は前任者を与えることができる。なぜなら、ここまで来れば、 > minItems アイテムを持っているからである。
+		out := n.items[i]
+		// 特別なケースである'remove'呼び出し（typ=maxItem）を使って、アイテムiの前任者（すぐ左の子の右端の葉）を引き出し、アイテムを引き出した場所にセットするのです。
+		var zero T
+		n.items[i], _ = child.remove(zero, minItems, removeMax)
+		n.size--
+		n.rescore()
+		return out, true
+	}
+	// 最後の再帰的呼び出し。 ここまでくれば、アイテムがこのノードにないこと、子ノードが十分な大きさでそこから削除できることがわかります。
+	out, removed := child.remove(item, minItems, typ)
+	if removed {
+		n.size--
+		n.rescore()
+	}
+	return out, removed
+}
+
+// growChildAndRemove は、子 'i' を成長させ、minItems を維持しながらそこからアイテムを取り除くことが可能であることを確認し、それから実際に取り除くために remove を呼び出します。
+// 多くのドキュメントによると、2つの特別なケーシングを行う必要があるようです：
+// 1) アイテムがこのノードの中にある
+// 2) 項目が子ノードにある
+// どちらの場合も、2つのサブケースを処理する必要があります：
+// A) ノードが十分な値を持っていて、1つの値を確保できる。
+// B) ノードが十分な値を持っていない
+// 後者の場合、以下のことを確認する必要があります：
+// a)左の兄弟にノードの予備がある
+// b) 右の兄弟に余裕のあるノードがある。
+// c) マージする必要がある
+// ノードに十分なアイテムがない場合は、（a,b,cを使用して）アイテムがあることを確認します。そして、removeコールをやり直すだけで、2回目には（ケース1でも2でも）十分なアイテムがあり、ケースAに当たることが保証されます。
+// 左から取る場合、i,i-1をコピーして,右側の子の最大を取り、iの子のコピーには一番最小にnodeのitems[i-1]を入れる,それをnodeのitems[i-1]に入れる,
+func (n *node[T]) growChildAndRemove(i int, item T, minItems int, typ toRemove) (T, bool) {
+	if i > 0 && len(n.children[i-1].items) > minItems {
+		// 左子から盗む
+		child := n.mutableChild(i)
+		stealFrom := n.mutableChild(i - 1)
+		stolenItem := stealFrom.items.pop()
+		child.items.insertAt(0, n.items[i-1])
+		n.items[i-1] = stolenItem
+		if len(stealFrom.children) > 0 {
+			child.children.insertAt(0, stealFrom.children.pop())
+		}
+		child.recount()
+		stealFrom.recount()
+		if n.cow.counts != nil {
+			n.cow.counts.steals++
+		}
+	} else if i < len(n.items) && len(n.children[i+1].items) > minItems {
+		// steal from right child
+		child := n.mutableChild(i)
+		stealFrom := n.mutableChild(i + 1)
+		stolenItem := stealFrom.items.removeAt(0)
+		child.items = append(child.items, n.items[i])
+		n.items[i] = stolenItem
+		if len(stealFrom.children) > 0 {
+			child.children = append(child.children, stealFrom.children.removeAt(0))
+		}
+		child.recount()
+		stealFrom.recount()
+		if n.cow.counts != nil {
+			n.cow.counts.steals++
+		}
+	} else {
+		if i >= len(n.items) {
+			i--
+		}
+		child := n.mutableChild(i)
+		// merge with right child
+		mergeItem := n.items.removeAt(i)
+		mergeChild := n.children.removeAt(i + 1)
+		child.items = append(child.items, mergeItem)
+		child.items = append(child.items, mergeChild.items...)
+		child.children = append(child.children, mergeChild.children...)
+		child.recount()
+		n.cow.freeNode(mergeChild)
+		if n.cow.counts != nil {
+			n.cow.counts.merges++
+		}
+	}
+	return n.remove(item, minItems, typ)
+}
+
+//	iterate は、ツリー内の要素を反復処理するための簡単なメソッドを提供する。
+//
+// 昇順の場合は 'start' が 'stop' よりも小さく、降順の場合は 'start' が 'stop' よりも大きくなければなりません。
+// includeStart' を true に設定すると、イテレータが 'start' と等しい場合に最初の項目を含めるようになり、単なる "greaterThan" や "lessThan" ではなく "greaterOrEqual" や "lessThanEqual" というクエリが作成されます。
+func (n *node[T]) iterate(dir direction, start, stop optionalItem[T], includeStart bool, hit bool, iter ItemIteratorG[T]) (bool, bool) {
+	var ok, found bool
+	var index int
+	less := n.cow.less
+	if hit {
+		// 開始位置はすでに通り過ぎているので、このノードの項目はすべて開始位置の内側にある。
+		// 開始位置との比較と、開始位置を探す二分探索を省く。
+		start = empty[T]()
+	}
+	switch dir {
+	case ascend:
+		if start.valid {
+			// 開始位置と等しい項目を含めない場合は、その項目と、開始位置より小さい項目だけを持つ左の子を飛ばす。
+			index, found = n.items.find(start.item, less)
+			if found && !includeStart {
+				index++
+				hit = true
+			}
+		}
+		for i := index; i < len(n.items); i++ {
+			if len(n.children) > 0 {
+				if hit, ok = n.children[i].iterate(dir, start, stop, includeStart, hit, iter); !ok {
+					return hit, false
+				}
+			}
+			hit = true
+			if stop.valid && !less(n.items[i], stop.item) {
+				return hit, false
+			}
+			if !iter(n.items[i]) {
+				return hit, false
+			}
+		}
+		if len(n.children) > 0 {
+			if hit, ok = n.children[len(n.children)-1].iterate(dir, start, stop, includeStart, hit, iter); !ok {
+				return hit, false
+			}
+		}
+	case descend:
+		index = len(n.items) - 1
+		if start.valid {
+			// 二分探索で開始位置以下の最後の項目を求めるので、開始位置と比べる必要があるのはその項目だけになる。
+			// 開始位置と等しい項目を含めない場合は、その項目と、開始位置より大きい項目だけを持つ右の子を飛ばす。
+			index, found = n.items.find(start.item, less)
+			if !found || !includeStart {
+				index--
+			}
+		}
+		for i := index; i >= 0; i-- {
+			if len(n.children) > 0 {
+				if hit, ok = n.children[i+1].iterate(dir, start, stop, includeStart, hit, iter); !ok {
+					return hit, false
+				}
+			}
+			if stop.valid && !less(stop.item, n.items[i]) {
+				return hit, false //	continue
+			}
+			hit = true
+			if !iter(n.items[i]) {
+				return hit, false
+			}
+		}
+		if len(n.children) > 0 {
+			if hit, ok = n.children[0].iterate(dir, start, stop, includeStart, hit, iter); !ok {
+				return hit, false
+			}
+		}
+	}
+	return hit, true
+}
+
+// Printは、木のノードを1行に1つずつ、深さに応じて字下げしてwに書き出します。デバッグのためのもので、形式は変わることがあります。
+func (t *BTreeG[T]) Print(w io.Writer) {
+	if t.root == nil {
+		return
+	}
+	t.root.print(w, 0)
+}
+
+// テスト/デバッグのために使用されます。
+func (n *node[T]) print(w io.Writer, level int) {
+	fmt.Fprintf(w, "%sNODE:%v\n", strings.Repeat("  ", level), n.items)
+	for _, c := range n.children {
+		c.print(w, level+1)
+	}
+}
+
+// Btree
+
+// Clone は btree のクローンを作成します。 Cloneは同時に呼び出すべきではありませんが、Cloneの呼び出しが完了すると、元のツリー（t）と新しいツリー（t2）は同時に使用することができます。
+// b の内部ツリー構造は読み取り専用とされ、t と t2 の間で共有されます。 tとt2の両方への書き込みは、コピーオンライトのロジックを使用し、bの元のノードの1つが変更されるたびに新しいノードを作成します。
+// 読み出し操作の性能低下はないはずです。 tとt2の両方に対する書き込み操作では、前述のコピーオンライト・ロジックによる追加的な割り当てとコピーによって、最初は小さな速度低下が発生しますが、元のツリーの性能特性に収束するはずです。
+func (t *BTreeG[T]) Clone() (t2 *BTreeG[T]) {
+	// コピーオンライトのコンテキストを2つ作成する。この操作により、実質的に3つのツリーが作成されます：元の共有ノード（古いb.cow） 新しいb.cowノード 新しいout.cowノード
+	cow1, cow2 := *t.cow, *t.cow
+	cow2.counts = nil
+	out := *t
+	t.cow = &cow1
+	out.cow = &cow2
+	out.writer = nil
+	out.events = nil
+	return &out
+}
+
+// maxItems は、ノードごとに許可するアイテムの最大数を返します。
+func (t *BTreeG[T]) maxItems() int {
+	return t.degree*2 - 1
+}
+
+// minItemsは、ノードごとに許可するアイテムの最小数を返します（ルートノードでは無視されます）。
+func (t *BTreeG[T]) minItems() int {
+	return t.degree - 1
+}
+
+func (c *copyOnWriteContext[T]) newNode() (n *node[T]) {
+	n = c.freelist.newNode(c.itemCap)
+	n.cow = c
+	n.gen = atomic.LoadUint64(&c.gen)
+	return
+}
+
+// ownsは、nがこのコンテキストに所有されていて、コピーせずに変更できるかどうかを返します。
+func (c *copyOnWriteContext[T]) owns(n *node[T]) bool {
+	return n.cow == c && n.gen == atomic.LoadUint64(&c.gen)
+}
+
+// shareは、このコンテキストがこれまでに作ったノードを所有していない状態にします。以後の書き込みは、それらのノードをコピーしてから変更します。
+// Cloneと違い木のコンテキストを置き換えないので、木を読んでいる他のゴルーチンと同時に呼べます。
+func (c *copyOnWriteContext[T]) share() {
+	atomic.AddUint64(&c.gen, 1)
+}
+
+// freeNodeは、与えられたCOWコンテキスト内のノードを解放します（そのコンテキストによって所有されている場合）。 それは、ノードに何が起こったかを返します（freeType constのドキュメントを参照）。
+func (c *copyOnWriteContext[T]) freeNode(n *node[T]) freeType {
+	if c.owns(n) {
+		// clear to allow GC
+		n.items.truncate(0)
+		n.children.truncate(0)
+		n.size = 0
+		n.cow = nil
+		if c.freelist.freeNode(n) {
+			return ftStored
+		} else {
+			return ftFreelistFull
+		}
+	} else {
+		return ftNotOwned
+	}
+}
+
+// ReplaceOrInsert は、与えられたアイテムをツリーに追加する。 もし、ツリー内のアイテムがすでに与えられたものと等しい場合は、ツリーから取り除かれて返され、第2戻り値はtrueになる。
+// そうでない場合は、(zeroValue, false) が返されます。
+func (t *BTreeG[T]) ReplaceOrInsert(item T) (_ T, _ bool) {
+	if t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic("ReplaceOrInsert", true)
+	}
+	t.debugBeforeMutate("ReplaceOrInsert")
+	defer t.debugAfterMutate("ReplaceOrInsert")
+	t.mutations++
+	if t.events != nil {
+		defer t.events.end("ReplaceOrInsert", t.beginEvent())
+	}
+	if t.root == nil {
+		t.root = t.cow.newNode()
+		t.root.items = append(t.root.items, item)
+		t.root.recount()
+		t.length++
+		return
+	} else {
+		t.root = t.root.mutableFor(t.cow)
+		if len(t.root.items) >= t.maxItems() {
+			item2, second := t.root.split(t.maxItems() / 2)
+			oldroot := t.root
+			t.root = t.cow.newNode()
+			t.root.items = append(t.root.items, item2)
+			t.root.children = append(t.root.children, oldroot, second)
+			t.root.recount()
+		}
+	}
+	out, outb := t.root.insert(item, t.maxItems())
+	if !outb {
+		t.length++
+	}
+	return out, outb
+}
+
+// Delete は、渡された項目に等しい項目をツリーから削除し、それを返す。 そのようなアイテムが存在しない場合は、(zeroValue, false) を返す。
+func (t *BTreeG[T]) Delete(item T) (T, bool) {
+	return t.deleteItem("Delete", item, removeItem)
+}
+
+// DeleteMinは、ツリー内の最小の項目を削除し、それを返す。そのような項目が存在しない場合は、(zeroValue, false) を返す。
+func (t *BTreeG[T]) DeleteMin() (T, bool) {
+	var zero T
+	return t.deleteItem("DeleteMin", zero, removeMin)
+}
+
+// DeleteMaxは、ツリー内の最大の項目を削除し、それを返す。そのような項目が存在しない場合は、(zeroValue, false) を返します。
+func (t *BTreeG[T]) DeleteMax() (T, bool) {
+	var zero T
+	return t.deleteItem("DeleteMax", zero, removeMax)
+}
+
+// deleteItemは、Delete、DeleteMin、DeleteMaxの共通の実装です。opは呼び出したメソッドの名前で、パニックやイベントの記録に使います。
+func (t *BTreeG[T]) deleteItem(op string, item T, typ toRemove) (_ T, _ bool) {
+	if t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic(op, true)
+	}
+	t.debugBeforeMutate(op)
+	defer t.debugAfterMutate(op)
+	if t.events != nil {
+		defer t.events.end(op, t.beginEvent())
+	}
+	if t.root == nil || len(t.root.items) == 0 {
+		return
+	}
+	// removeは項目がなくても降りながら節点を併合するので、先に探して、ない場合は木に触れずに返す。
+	// 何も削除しない呼び出しでmutationsを進めると、Txnのコミットが無用に衝突する。
+	if typ == removeItem {
+		if _, ok := t.root.get(item); !ok {
+			return
+		}
+	}
+	t.mutations++
+	t.root = t.root.mutableFor(t.cow)
+	out, outb := t.root.remove(item, t.minItems(), typ)
+	if len(t.root.items) == 0 && len(t.root.children) > 0 {
+		oldroot := t.root
+		t.root = t.root.children[0]
+		t.cow.freeNode(oldroot)
+	}
+	if outb {
+		t.length--
+	}
+	return out, outb
+}
+
+// AscendRange は、ツリー内のすべての値について、範囲 [greaterOrEqual, lessThan) 内で、iterator が false を返すまでイテレータを呼び出します。
+func (t *BTreeG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	t.iterate(ascend, optional(greaterOrEqual), optional(lessThan), true, iterator)
+}
+
+// AscendLessThan は、[first, pivot) の範囲内にあるツリーのすべての値に対して、iterator が false を返すまでイテレータを呼び出します。
+func (t *BTreeG[T]) AscendLessThan(pivot T, iterator ItemIteratorG[T]) {
+	t.iterate(ascend, empty[T](), optional(pivot), false, iterator)
+}
+
+// AscendGreaterOrEqual は、ツリー内の [pivot, last] の範囲内のすべての値について、iterator が false を返すまでイテレータを呼び出します。
+func (t *BTreeG[T]) AscendGreaterOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	t.iterate(ascend, optional(pivot), empty[T](), true, iterator)
+}
+
+// iteratorがfalseを返すまで、[first, last]の範囲内にあるツリーのすべての値に対して、iteratorを呼び出します。
+func (t *BTreeG[T]) Ascend(iterator ItemIteratorG[T]) {
+	t.iterate(ascend, empty[T](), empty[T](), false, iterator)
+}
+
+// DescendRangeは、ツリー内のすべての値について、[lessOrEqual, greaterThan)の範囲内で、iteratorがfalseを返すまでイテレータを呼び出します。
+func (t *BTreeG[T]) DescendRange(lessOrEqual, greaterThan T, iterator ItemIteratorG[T]) {
+	t.iterate(descend, optional(lessOrEqual), optional(greaterThan), true, iterator)
+}
+
+// DescendLessOrEqualは、[pivot, first]の範囲内にあるツリーのすべての値について、iteratorがfalseを返すまで、iteratorを呼び出します。
+func (t *BTreeG[T]) DescendLessOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	t.iterate(descend, optional(pivot), empty[T](), true, iterator)
+}
+
+// DescendGreaterThanは、ツリー内のすべての値について、[last, pivot)の範囲内で、iteratorがfalseを返すまでイテレータを呼び出します。
+func (t *BTreeG[T]) DescendGreaterThan(pivot T, iterator ItemIteratorG[T]) {
+	t.iterate(descend, empty[T](), optional(pivot), false, iterator)
+}
+
+// Descendは、[last, first]の範囲内にあるツリーのすべての値について、iteratorがfalseを返すまで、iteratorを呼び出します。
+func (t *BTreeG[T]) Descend(iterator ItemIteratorG[T]) {
+	t.iterate(descend, empty[T](), empty[T](), false, iterator)
+}
+
+// iterateは、Ascend*/Descend*の共通の入り口です。
+func (t *BTreeG[T]) iterate(dir direction, start, stop optionalItem[T], includeStart bool, iterator ItemIteratorG[T]) {
+	if t.root == nil || t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic("iterate", false)
+	}
+	t.debugBeginIterate()
+	defer t.debugEndIterate()
+	t.root.iterate(dir, start, stop, includeStart, false, iterator)
+}
+
+// Get は、ツリーの中からキーとなる項目を探し、それを返す。 その項目が見つからない場合は (zeroValue, false) を返す。
+func (t *BTreeG[T]) Get(key T) (_ T, _ bool) {
+	if t.recoverPanics {
+		defer t.recoverPanic("Get", false)
+	}
+	if t.root == nil || t.poisoned {
+		return
+	}
+	return t.root.get(key)
+}
+
+// Minは，木の中で最も小さい項目を返し，木が空の場合は (zeroValue, false) を返す。
+func (t *BTreeG[T]) Min() (_ T, _ bool) {
+	if t.poisoned {
+		return
+	}
+	return min(t.root)
+}
+
+// Maxは，木の中で最大の項目を返し，木が空であれば (zeroValue, false) を返す。
+func (t *BTreeG[T]) Max() (_ T, _ bool) {
+	if t.poisoned {
+		return
+	}
+	return max(t.root)
+}
+
+// 与えられたキーがツリー内にある場合、Hasはtrueを返します。
+func (t *BTreeG[T]) Has(key T) bool {
+	_, ok := t.Get(key)
+	return ok
+}
+
+// Lenは、現在ツリーにあるアイテムの数を返します。
+func (t *BTreeG[T]) Len() int {
+	return t.length
+}
+
+// Clearは、btreeからすべてのアイテムを削除します。 addNodesToFreelistがtrueの場合、tのノードはこの呼び出しの一部として、freelistが一杯になるまでそのfreelistに追加されます。
+// そうでない場合は、ルートノードは単に参照解除され、サブツリーはGoの通常のGC処理に委ねられます。
+// 汚染された木に対して呼ぶと、ノードはフリーリストに戻さずに捨てられ、木は空の正常な状態に戻ります。
+// アリーナモードの木では、addNodesToFreelistにかかわらずフリーリストとアリーナの参照をまとめて手放し、スラブごとGCに回収させます。
+//
+// これは、すべての要素に対してDeleteを呼び出すよりもはるかに高速に実行できます。 また、古いツリーを置き換えるために新しいツリーを作成するよりも、多少速くなります。
+// なぜなら、古いツリーのノードはガベージコレクタに失われるのではなく、新しいツリーで使用するためにフリーリストに再要求されるからです。
+//
+// この呼び出しには、次のような時間がかかります：
+// O(1): addNodesToFreelistがfalseのとき、これは1回の処理です。
+// =O(1): フリーリストがすでに満杯の場合、すぐに脱走する。
+// O(freelist size): freelistが空で、ノードがすべてこの木の所有物であるとき、満杯になるまでfreelistにノードが追加される。
+// O(tree size): すべてのノードが別の木に所有されている場合、フリーリストに追加するノードを探してすべてのノードを反復処理するが、所有権の関係で追加されない。
+func (t *BTreeG[T]) Clear(addNodesToFreelist bool) {
+	t.debugBeforeMutate("Clear")
+	t.mutations++
+	if t.events != nil {
+		defer t.events.end("Clear", t.beginEvent())
+	}
+	if t.cow.freelist.arena != nil {
+		// アリーナのノードをフリーリストに戻すとスラブが解放されなくなるので、まとめて手放す。
+		t.cow.freelist.release()
+	} else if t.root != nil && addNodesToFreelist && !t.poisoned {
+		t.root.reset(t.cow)
+	}
+	t.root, t.length = nil, 0
+	t.poisoned, t.err = false, nil
+}
+
+// reset は、freelist にサブツリーを返します。 freelistが満杯の場合、反復することの唯一の利点はfreelistを満杯にすることであるため、すぐに脱落する。
+// 親のリセット呼び出しが継続されるべき場合は、trueを返します。
+func (n *node[T]) reset(c *copyOnWriteContext[T]) bool {
+	for _, child := range n.children {
+		if !child.reset(c) {
+			return false
+		}
+	}
+	return c.freeNode(n) != ftFreelistFull
+}
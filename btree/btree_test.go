@@ -0,0 +1,189 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestIterateBoundsは、ランダムな木と境界で、iterateの向き、開始位置を含めるかどうか、境界の有無のすべての組み合わせをスライスのモデルと比べます。
+func TestIterateBounds(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	for _, degree := range []int{2, 3, 8} {
+		tr := NewG(degree, intLess)
+		var keys []int
+		for i := 0; i < 300; i++ {
+			if r.Intn(3) > 0 {
+				tr.ReplaceOrInsert(i * 2)
+				keys = append(keys, i*2)
+			}
+		}
+		for n := 0; n < 200; n++ {
+			// 偶数の境界は木にあるかもしれない項目、奇数の境界は木にない項目になる。
+			a, b := r.Intn(620)-10, r.Intn(620)-10
+			for _, dir := range []direction{ascend, descend} {
+				for _, includeStart := range []bool{true, false} {
+					for _, bounds := range []struct{ start, stop optionalItem[int] }{
+						{optional(a), optional(b)},
+						{optional(a), empty[int]()},
+						{empty[int](), optional(b)},
+						{empty[int](), empty[int]()},
+					} {
+						got := []int{}
+						tr.iterate(dir, bounds.start, bounds.stop, includeStart, func(i int) bool {
+							got = append(got, i)
+							return true
+						})
+						want := iterateModel(keys, dir, bounds.start, bounds.stop, includeStart)
+						if fmt.Sprint(got) != fmt.Sprint(want) {
+							t.Fatalf("degree %d: iterate(%v, %+v, %+v, %v) = %v, want %v", degree, dir, bounds.start, bounds.stop, includeStart, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// iterateModelは、昇順に並んだkeysから、iterateが返すべき項目を順に返します。
+func iterateModel(keys []int, dir direction, start, stop optionalItem[int], includeStart bool) []int {
+	// beforeは、走査の向きでaがbより前にあるかどうかを返します。
+	before := func(a, b int) bool {
+		if dir == descend {
+			return a > b
+		}
+		return a < b
+	}
+	out := []int{}
+	for i := range keys {
+		k := keys[i]
+		if dir == descend {
+			k = keys[len(keys)-1-i]
+		}
+		if start.valid && (before(k, start.item) || k == start.item && !includeStart) {
+			continue
+		}
+		if stop.valid && !before(k, stop.item) {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// rangeBenchSizesは、範囲の走査のベンチマークで使う木の項目数です。
+var rangeBenchSizes = []int{1000, 100000, 1000000}
+
+// BenchmarkAscendRangeとBenchmarkDescendRangeは、0からn-1までの整数を入れた次数32の木の中央の半分を、昇順と降順で走査します。
+// 2つの結果を比べて、降順の走査が昇順より遅くなっていないかを確かめるためのものです。
+// "int"はBTreeG[int]、"Item"はInt型の項目を入れたBTreeの結果です。
+func BenchmarkAscendRange(b *testing.B) {
+	benchmarkRange(b, ascend)
+}
+
+func BenchmarkDescendRange(b *testing.B) {
+	benchmarkRange(b, descend)
+}
+
+func benchmarkRange(b *testing.B, dir direction) {
+	for _, n := range rangeBenchSizes {
+		lo, hi := n/4, n-n/4
+		b.Run(fmt.Sprintf("int/%d", n), func(b *testing.B) {
+			tr := NewG(32, intLess)
+			for i := 0; i < n; i++ {
+				tr.ReplaceOrInsert(i)
+			}
+			count := 0
+			iter := func(int) bool {
+				count++
+				return true
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				count = 0
+				if dir == ascend {
+					tr.AscendRange(lo, hi, iter)
+				} else {
+					tr.DescendRange(hi-1, lo-1, iter)
+				}
+				if count != hi-lo {
+					b.Fatalf("visited %d items, want %d", count, hi-lo)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Item/%d", n), func(b *testing.B) {
+			tr := New(32)
+			for i := 0; i < n; i++ {
+				tr.ReplaceOrInsert(Int(i))
+			}
+			count := 0
+			iter := func(Item) bool {
+				count++
+				return true
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				count = 0
+				if dir == ascend {
+					tr.AscendRange(Int(lo), Int(hi), iter)
+				} else {
+					tr.DescendRange(Int(hi-1), Int(lo-1), iter)
+				}
+				if count != hi-lo {
+					b.Fatalf("visited %d items, want %d", count, hi-lo)
+				}
+			}
+		})
+	}
+}
+
+// TestIterationAllocsは、走査、Get、カーソルの移動がヒープに割り当てないことを確かめます。
+// 走査の割り当てはスキャンの多い利用者のGCを支配するので、ここで0に固定しておきます。
+func TestIterationAllocs(t *testing.T) {
+	const n = 10000
+	tr := NewG(32, intLess)
+	it := New(32)
+	for i := 0; i < n; i++ {
+		tr.ReplaceOrInsert(i)
+		it.ReplaceOrInsert(Int(i))
+	}
+	// Intからインタフェースへの変換で割り当てないように、Item版の境界は先に作っておく。
+	var lo, hi, key Item = Int(n / 4), Int(n - n/4), Int(n / 2)
+	count := 0
+	iter := func(int) bool {
+		count++
+		return true
+	}
+	itemIter := func(Item) bool {
+		count++
+		return true
+	}
+	c := tr.Cursor()
+	for _, tc := range []struct {
+		name string
+		fn   func()
+	}{
+		{"Ascend", func() { tr.Ascend(iter) }},
+		{"AscendRange", func() { tr.AscendRange(n/4, n-n/4, iter) }},
+		{"AscendGreaterOrEqual", func() { tr.AscendGreaterOrEqual(n/2, iter) }},
+		{"Descend", func() { tr.Descend(iter) }},
+		{"DescendRange", func() { tr.DescendRange(n-n/4, n/4, iter) }},
+		{"DescendLessOrEqual", func() { tr.DescendLessOrEqual(n/2, iter) }},
+		{"Get", func() { tr.Get(n / 2) }},
+		{"Cursor", func() {
+			for _, ok := c.Seek(n / 2); ok; _, ok = c.Next() {
+			}
+		}},
+		{"Item/Ascend", func() { it.Ascend(itemIter) }},
+		{"Item/AscendRange", func() { it.AscendRange(lo, hi, itemIter) }},
+		{"Item/Descend", func() { it.Descend(itemIter) }},
+		{"Item/DescendRange", func() { it.DescendRange(hi, lo, itemIter) }},
+		{"Item/Get", func() { it.Get(key) }},
+	} {
+		if allocs := testing.AllocsPerRun(10, tc.fn); allocs != 0 {
+			t.Errorf("%s allocates %v times per run, want 0", tc.name, allocs)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package btree
+
+// DefaultMapDegreeは、FromMapで作るBTreeMapの木のdegreeです。
+const DefaultMapDegree = 32
+
+type (
+	// BTreeMapは、キーの順に並んだキーと値の組を保持するマップです。BTreeGの上に作られています。
+	// Goのマップと違ってキーの順に走査でき、FromMapとToMapでGoのマップと相互に変換できるように、キーはcomparableに限ります。並行に書き込むことはできません。
+	BTreeMap[K comparable, V any] struct {
+		t *BTreeG[mapEntry[K, V]]
+	}
+
+	// mapEntryは、BTreeMapの木の1項目です。
+	mapEntry[K, V any] struct {
+		key   K
+		value V
+	}
+)
+
+// NewBTreeMapは、与えられたdegreeとキーのLessFuncで空のBTreeMapを作成します。
+func NewBTreeMap[K comparable, V any](degree int, less LessFunc[K]) *BTreeMap[K, V] {
+	return &BTreeMap[K, V]{t: NewG(degree, func(a, b mapEntry[K, V]) bool {
+		return less(a.key, b.key)
+	})}
+}
+
+// FromMapは、mのキーと値を持つBTreeMapを作成します。キーを並べ替えてから木を下から組み立てるので、1つずつ挿入するより速く、
+// 時間は並べ替えのO(n log n)で決まります。
+func FromMap[K Ordered, V any](m map[K]V) *BTreeMap[K, V] {
+	return FromMapFunc(m, Less[K]())
+}
+
+// FromMapFuncは、mのキーと値を持ち、キーをlessで順序付けるBTreeMapを作成します。キーがOrderedでない場合に使います。
+func FromMapFunc[K comparable, V any](m map[K]V, less LessFunc[K]) *BTreeMap[K, V] {
+	out := NewBTreeMap[K, V](DefaultMapDegree, less)
+	entries := make([]mapEntry[K, V], 0, len(m))
+	for _, k := range SortedKeysFunc(m, less) {
+		entries = append(entries, mapEntry[K, V]{key: k, value: m[k]})
+	}
+	out.t.loadSorted(entries)
+	return out
+}
+
+// ToMapは、すべてのキーと値を持つ新しいGoのマップを返します。
+func (m *BTreeMap[K, V]) ToMap() map[K]V {
+	out := make(map[K]V, m.Len())
+	m.Ascend(func(key K, value V) bool {
+		out[key] = value
+		return true
+	})
+	return out
+}
+
+// Getは、keyの値を返します。keyがない場合は (zeroValue, false) を返します。
+func (m *BTreeMap[K, V]) Get(key K) (value V, ok bool) {
+	e, ok := m.t.Get(mapEntry[K, V]{key: key})
+	return e.value, ok
+}
+
+// Setは、keyの値をvalueにし、以前の値とkeyがあったかどうかを返します。
+func (m *BTreeMap[K, V]) Set(key K, value V) (previous V, replaced bool) {
+	e, replaced := m.t.ReplaceOrInsert(mapEntry[K, V]{key: key, value: value})
+	return e.value, replaced
+}
+
+// Deleteは、keyを削除し、削除前の値とkeyがあったかどうかを返します。
+func (m *BTreeMap[K, V]) Delete(key K) (value V, deleted bool) {
+	e, deleted := m.t.Delete(mapEntry[K, V]{key: key})
+	return e.value, deleted
+}
+
+// Lenは、キーの数を返します。
+func (m *BTreeMap[K, V]) Len() int {
+	return m.t.Len()
+}
+
+// Ascendは、すべてのキーと値について、キーの昇順にfがfalseを返すまでfを呼び出します。
+func (m *BTreeMap[K, V]) Ascend(f func(key K, value V) bool) {
+	m.t.Ascend(func(e mapEntry[K, V]) bool {
+		return f(e.key, e.value)
+	})
+}
+
+// AscendRangeは、[greaterOrEqual, lessThan) の範囲のキーについて、キーの昇順にfがfalseを返すまでfを呼び出します。
+func (m *BTreeMap[K, V]) AscendRange(greaterOrEqual, lessThan K, f func(key K, value V) bool) {
+	m.t.AscendRange(mapEntry[K, V]{key: greaterOrEqual}, mapEntry[K, V]{key: lessThan}, func(e mapEntry[K, V]) bool {
+		return f(e.key, e.value)
+	})
+}
+
+// Keysは、すべてのキーを昇順に並べた新しいスライスを返します。
+func (m *BTreeMap[K, V]) Keys() []K {
+	out := make([]K, 0, m.Len())
+	m.Ascend(func(key K, _ V) bool {
+		out = append(out, key)
+		return true
+	})
+	return out
+}
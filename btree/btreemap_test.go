@@ -0,0 +1,79 @@
+package btree
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoadSortedInvariants(t *testing.T) {
+	for _, degree := range []int{2, 3, 5, 32} {
+		for n := 0; n < 700; n += 1 + n/7 {
+			items := make([]int, n)
+			for i := range items {
+				items[i] = i * 2
+			}
+			tr := NewG(degree, intLess)
+			tr.loadSorted(items)
+			if err := tr.Verify(); err != nil {
+				t.Fatalf("degree %d, %d items: %v", degree, n, err)
+			}
+			if tr.Len() != n {
+				t.Fatalf("degree %d: Len() = %d, want %d", degree, tr.Len(), n)
+			}
+			// 組み立てた木にも普通に書き込める。
+			tr.ReplaceOrInsert(-1)
+			tr.Delete(0)
+			if err := tr.Verify(); err != nil {
+				t.Fatalf("degree %d, %d items after writes: %v", degree, n, err)
+			}
+		}
+	}
+}
+
+func TestFromMapToMap(t *testing.T) {
+	m := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		m[fmt.Sprintf("k%04d", (i*37)%1000)] = i
+	}
+	bm := FromMap(m)
+	if err := bm.t.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if bm.Len() != len(m) {
+		t.Fatalf("Len() = %d, want %d", bm.Len(), len(m))
+	}
+	keys := bm.Keys()
+	if !sort.StringsAreSorted(keys) {
+		t.Fatal("Keys() is not sorted")
+	}
+	if !reflect.DeepEqual(keys, SortedKeys(m)) {
+		t.Fatal("Keys() differs from SortedKeys")
+	}
+	if v, ok := bm.Get("k0123"); !ok || v != m["k0123"] {
+		t.Fatalf("Get(k0123) = %d, %v", v, ok)
+	}
+	bm.Set("zzz", -1)
+	bm.Delete("k0000")
+	back := bm.ToMap()
+	m["zzz"] = -1
+	delete(m, "k0000")
+	if !reflect.DeepEqual(back, m) {
+		t.Fatal("ToMap() after writes differs from the map model")
+	}
+}
+
+func TestSortedKeysFunc(t *testing.T) {
+	m := map[int]bool{5: true, 1: true, 3: true}
+	if got := SortedKeys(m); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Fatalf("SortedKeys = %v", got)
+	}
+	desc := SortedKeysFunc(m, func(a, b int) bool { return a > b })
+	if !reflect.DeepEqual(desc, []int{5, 3, 1}) {
+		t.Fatalf("SortedKeysFunc(desc) = %v", desc)
+	}
+	if got := FromMapFunc(m, func(a, b int) bool { return a > b }).Keys(); !reflect.DeepEqual(got, desc) {
+		t.Fatalf("FromMapFunc(desc).Keys() = %v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package btree
+
+// loadSortedは、空の木tに、昇順に並んだ重複のないitemsから組み立てたノードを入れます。
+// 1つずつ挿入するのと違い、どのノードも一度だけ作り、分割もしないので、O(n)で終わります。
+// 各ノードの項目は、不変条件を満たす範囲でなるべく均等に配ります。itemsの順序は検査しません。
+func (t *BTreeG[T]) loadSorted(items []T) {
+	if len(items) == 0 {
+		return
+	}
+	// 高さhのサブツリーには最大で (2*degree)^(h+1)-1 個の項目が入るので、すべてが入る最も低い高さにする。
+	height, span := 0, 2*t.degree
+	for span <= len(items) {
+		height++
+		span *= 2 * t.degree
+	}
+	t.root = t.buildSorted(items, height, true)
+	t.length = len(items)
+}
+
+// buildSortedは、itemsを持つ高さhのサブツリーを組み立てます。
+// 子の数は、各子のサブツリーが項目を詰めきれる最小の数にし、ルート以外では下限のdegreeまで増やします。
+// 子には項目を均等に配るので、どの子の項目数も高さh-1のサブツリーの下限と上限の間に入ります。
+func (t *BTreeG[T]) buildSorted(items []T, h int, root bool) *node[T] {
+	n := t.cow.newNode()
+	if h == 0 {
+		n.items = append(n.items, items...)
+		n.recount()
+		return n
+	}
+	// childSpanは、高さh-1のサブツリーが持てる項目の最大数+1です。
+	childSpan := 1
+	for i := 0; i < h; i++ {
+		childSpan *= 2 * t.degree
+	}
+	total := len(items) + 1
+	children := (total + childSpan - 1) / childSpan
+	if !root && children < t.degree {
+		children = t.degree
+	}
+	start := 0
+	for i := 0; i < children; i++ {
+		share := total / children
+		if i < total%children {
+			share++
+		}
+		n.children = append(n.children, t.buildSorted(items[start:start+share-1], h-1, false))
+		start += share - 1
+		if i < children-1 {
+			n.items = append(n.items, items[start])
+			start++
+		}
+	}
+	n.recount()
+	return n
+}
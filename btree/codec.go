@@ -0,0 +1,40 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+type (
+	// CodecGは、T型の項目とバイト列を相互に変換します。スナップショットやディスク上の木で項目を保存するために使われます。
+	// Decodeが返す項目は、Encodeに渡した項目とLessの意味で等しくなければなりません。Decodeに渡されるバイト列は保持して構いません。
+	CodecG[T any] interface {
+		Encode(item T) ([]byte, error)
+		Decode(data []byte) (T, error)
+	}
+
+	// Codecは、BTreeの項目のCodecGです。
+	Codec = CodecG[Item]
+
+	// IntCodecは、Intをvarintで符号化するCodecです。
+	IntCodec struct{}
+)
+
+// Encodeは、Intをvarintで符号化します。
+func (IntCodec) Encode(item Item) ([]byte, error) {
+	i, ok := item.(Int)
+	if !ok {
+		return nil, fmt.Errorf("btree: IntCodec cannot encode %T", item)
+	}
+	return binary.AppendVarint(nil, int64(i)), nil
+}
+
+// Decodeは、Encodeが符号化したバイト列をIntに戻します。
+func (IntCodec) Decode(data []byte) (Item, error) {
+	v, n := binary.Varint(data)
+	if n != len(data) {
+		return nil, errors.New("btree: bad varint")
+	}
+	return Int(v), nil
+}
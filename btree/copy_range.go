@@ -0,0 +1,40 @@
+package btree
+
+// CopyRangeは、[greaterOrEqual, lessThan) の範囲の項目だけを持つ新しい木を返します。tは変更されません。
+//
+// 項目を1つずつ挿入するのではなく、DeleteRangeと同じく木を範囲の両端で分割するので、時間は範囲の大きさによらずO(log n)です。
+// 範囲に完全に含まれるサブツリーは、コピーせずに新しい木と共有され、以後のtと新しい木への書き込みはコピーオンライトになります。
+// tの内容は変わらないので、読み取りと同様に他のゴルーチンが木を読んでいる間に呼べます。tが汚染されている場合はnilを返します。
+func (t *BTreeG[T]) CopyRange(greaterOrEqual, lessThan T) *BTreeG[T] {
+	return t.copyRange(optional(greaterOrEqual), optional(lessThan))
+}
+
+func (t *BTreeG[T]) copyRange(lo, hi optionalItem[T]) *BTreeG[T] {
+	if t.poisoned {
+		return nil
+	}
+	out := t.emptyLike()
+	if lo.valid && hi.valid && !t.cow.less(lo.item, hi.item) {
+		return out
+	}
+	// 既存のノードをどの木も所有しない状態にしてから、outのコンテキストで経路上のノードだけを作り直す。
+	t.cow.share()
+	s := t.subtree()
+	if lo.valid {
+		_, s = out.splitAt(s, lo.item)
+	}
+	if hi.valid {
+		s, _ = out.splitAt(s, hi.item)
+	}
+	out.root = s.root
+	if s.root != nil {
+		out.length = s.root.size
+	}
+	out.debugAfterMutate("CopyRange")
+	return out
+}
+
+// CopyRangeは、[greaterOrEqual, lessThan) の範囲の項目だけを持つ新しい木を返します。nilの境界は「境界なし」を意味します。詳細はBTreeG.CopyRangeを参照してください。
+func (t *BTree) CopyRange(greaterOrEqual, lessThan Item) *BTree {
+	return (*BTree)(t.generic().copyRange(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan)))
+}
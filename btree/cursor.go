@@ -0,0 +1,236 @@
+package btree
+
+type (
+	// cursorFrameは、カーソルの経路上の1つのノードと、そのノード内の位置です。
+	// 内部ノードでは、iは降りている子のインデックスであり、同時にその子の直後の項目のインデックスでもあります。
+	cursorFrame[T any] struct {
+		n *node[T]
+		i int
+	}
+
+	// CursorGは、木の中の位置を保持し、SeekやNext/Prevで項目を1つずつたどる状態を持ったイテレータです。
+	// コールバックを使うAscend*/Descend*と違い、他の処理（例えば2つの木のマージ結合）と交互に進めることができます。
+	//
+	// カーソルはルートから現在の項目までのノードの経路を保持します。カーソルを作った後に木が変更された場合、
+	// First、Last、Seekで位置を決め直すまで、Next、Prev、Itemはパニックします。
+	CursorG[T any] struct {
+		t         *BTreeG[T]
+		stack     []cursorFrame[T]
+		mutations uint64
+	}
+
+	// Cursorは、BTreeのカーソルです。項目がない位置ではnilを返します。
+	Cursor CursorG[Item]
+)
+
+// Cursorは、木のカーソルを返します。カーソルは位置を持たない状態で作られるので、First、Last、Seekのいずれかで位置を決めてください。
+func (t *BTreeG[T]) Cursor() *CursorG[T] {
+	return &CursorG[T]{t: t, mutations: t.mutations}
+}
+
+// resetは、経路を空にし、木の現在の状態に合わせます。
+func (c *CursorG[T]) reset() {
+	for i := range c.stack {
+		c.stack[i] = cursorFrame[T]{}
+	}
+	c.stack = c.stack[:0]
+	c.mutations = c.t.mutations
+}
+
+// checkは、カーソルを作った後（または最後に位置を決めた後）に木が変更されていればパニックします。
+func (c *CursorG[T]) check() {
+	if c.mutations != c.t.mutations {
+		panic("btree: cursor used after the tree was modified")
+	}
+}
+
+// itemは、現在の項目を返します。カーソルが項目を指していない場合は (zeroValue, false) を返します。
+func (c *CursorG[T]) item() (_ T, _ bool) {
+	if len(c.stack) == 0 {
+		return
+	}
+	f := c.stack[len(c.stack)-1]
+	return f.n.items[f.i], true
+}
+
+// pushLeftは、nからその左端の葉までの経路を積みます。
+func (c *CursorG[T]) pushLeft(n *node[T]) {
+	for {
+		c.stack = append(c.stack, cursorFrame[T]{n: n})
+		if len(n.children) == 0 {
+			return
+		}
+		n = n.children[0]
+	}
+}
+
+// pushRightは、nからその右端の葉までの経路を積みます。
+func (c *CursorG[T]) pushRight(n *node[T]) {
+	for {
+		if len(n.children) == 0 {
+			c.stack = append(c.stack, cursorFrame[T]{n: n, i: len(n.items) - 1})
+			return
+		}
+		c.stack = append(c.stack, cursorFrame[T]{n: n, i: len(n.items)})
+		n = n.children[len(n.items)]
+	}
+}
+
+// Firstは、カーソルを木の最小の項目に移動してそれを返します。木が空の場合は (zeroValue, false) を返します。
+func (c *CursorG[T]) First() (_ T, _ bool) {
+	c.reset()
+	if c.t.root == nil || len(c.t.root.items) == 0 || c.t.poisoned {
+		return
+	}
+	c.pushLeft(c.t.root)
+	return c.item()
+}
+
+// Lastは、カーソルを木の最大の項目に移動してそれを返します。木が空の場合は (zeroValue, false) を返します。
+func (c *CursorG[T]) Last() (_ T, _ bool) {
+	c.reset()
+	if c.t.root == nil || len(c.t.root.items) == 0 || c.t.poisoned {
+		return
+	}
+	c.pushRight(c.t.root)
+	return c.item()
+}
+
+// Seekは、カーソルをkey以上の最小の項目に移動してそれを返します。そのような項目がない場合は (zeroValue, false) を返します。
+func (c *CursorG[T]) Seek(key T) (_ T, _ bool) {
+	c.reset()
+	if c.t.root == nil || len(c.t.root.items) == 0 || c.t.poisoned {
+		return
+	}
+	less := c.t.cow.less
+	for n := c.t.root; ; {
+		i, found := n.items.find(key, less)
+		c.stack = append(c.stack, cursorFrame[T]{n: n, i: i})
+		if found {
+			return c.item()
+		}
+		if len(n.children) == 0 {
+			if i < len(n.items) {
+				return c.item()
+			}
+			// 葉の項目はすべてkeyより小さいので、葉の最後の項目から1つ進める。
+			c.stack[len(c.stack)-1].i = len(n.items) - 1
+			return c.next()
+		}
+		n = n.children[i]
+	}
+}
+
+// Itemは、カーソルが指している項目を返します。カーソルが項目を指していない場合は (zeroValue, false) を返します。
+func (c *CursorG[T]) Item() (_ T, _ bool) {
+	c.check()
+	return c.item()
+}
+
+// Nextは、カーソルを次の項目に移動してそれを返します。次の項目がない場合は (zeroValue, false) を返し、カーソルは位置を失います。
+func (c *CursorG[T]) Next() (_ T, _ bool) {
+	c.check()
+	return c.next()
+}
+
+func (c *CursorG[T]) next() (_ T, _ bool) {
+	if len(c.stack) == 0 {
+		return
+	}
+	top := &c.stack[len(c.stack)-1]
+	if len(top.n.children) > 0 {
+		// 内部ノードの項目の次は、その右の子の左端の項目。
+		top.i++
+		c.pushLeft(top.n.children[top.i])
+		return c.item()
+	}
+	if top.i++; top.i < len(top.n.items) {
+		return c.item()
+	}
+	// 葉を使い切ったので、まだ項目が残っている祖先まで戻る。
+	for {
+		c.stack[len(c.stack)-1] = cursorFrame[T]{}
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) == 0 {
+			return
+		}
+		if top := c.stack[len(c.stack)-1]; top.i < len(top.n.items) {
+			return c.item()
+		}
+	}
+}
+
+// Prevは、カーソルを前の項目に移動してそれを返します。前の項目がない場合は (zeroValue, false) を返し、カーソルは位置を失います。
+func (c *CursorG[T]) Prev() (_ T, _ bool) {
+	c.check()
+	if len(c.stack) == 0 {
+		return
+	}
+	top := &c.stack[len(c.stack)-1]
+	if len(top.n.children) > 0 {
+		// 内部ノードの項目の前は、その左の子の右端の項目。
+		c.pushRight(top.n.children[top.i])
+		return c.item()
+	}
+	if top.i--; top.i >= 0 {
+		return c.item()
+	}
+	for {
+		c.stack[len(c.stack)-1] = cursorFrame[T]{}
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) == 0 {
+			return
+		}
+		if top := &c.stack[len(c.stack)-1]; top.i > 0 {
+			top.i--
+			return c.item()
+		}
+	}
+}
+
+// Cursor
+
+// Cursorは、木のカーソルを返します。詳細はBTreeG.Cursorを参照してください。
+func (t *BTree) Cursor() *Cursor {
+	return (*Cursor)(t.generic().Cursor())
+}
+
+func (c *Cursor) generic() *CursorG[Item] {
+	return (*CursorG[Item])(c)
+}
+
+// Firstは、カーソルを木の最小の項目に移動してそれを返します。木が空の場合はnilを返します。
+func (c *Cursor) First() Item {
+	out, _ := c.generic().First()
+	return out
+}
+
+// Lastは、カーソルを木の最大の項目に移動してそれを返します。木が空の場合はnilを返します。
+func (c *Cursor) Last() Item {
+	out, _ := c.generic().Last()
+	return out
+}
+
+// Seekは、カーソルをkey以上の最小の項目に移動してそれを返します。そのような項目がない場合はnilを返します。
+func (c *Cursor) Seek(key Item) Item {
+	out, _ := c.generic().Seek(key)
+	return out
+}
+
+// Itemは、カーソルが指している項目を返します。項目を指していない場合はnilを返します。
+func (c *Cursor) Item() Item {
+	out, _ := c.generic().Item()
+	return out
+}
+
+// Nextは、カーソルを次の項目に移動してそれを返します。次の項目がない場合はnilを返します。
+func (c *Cursor) Next() Item {
+	out, _ := c.generic().Next()
+	return out
+}
+
+// Prevは、カーソルを前の項目に移動してそれを返します。前の項目がない場合はnilを返します。
+func (c *Cursor) Prev() Item {
+	out, _ := c.generic().Prev()
+	return out
+}
@@ -0,0 +1,171 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// cursorStateは、カーソルの戻り値を"item"または"-"（項目なし）で表します。
+func cursorState(item int, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprint(item)
+}
+
+// TestCursorMatchesModelは、Seek、First、Lastで位置を決めた後のNextとPrevの列が、ソート済みのスライスの上の位置の移動と一致することを確かめます。
+func TestCursorMatchesModel(t *testing.T) {
+	r := rand.New(rand.NewSource(18))
+	for _, degree := range []int{2, 3, 4, 16} {
+		for n := 0; n < 200; n++ {
+			tr, keys := randomTree(r, degree, r.Intn(3)*r.Intn(200))
+			c := tr.Cursor()
+			for probe := 0; probe < 20; probe++ {
+				// posは、モデルでのカーソルの位置です。-1は位置を失った状態です。
+				var pos int
+				var got string
+				var what string
+				switch op := r.Intn(4); op {
+				case 0:
+					what = "First"
+					got = cursorState(c.First())
+					pos = 0
+				case 1:
+					what = "Last"
+					got = cursorState(c.Last())
+					pos = len(keys) - 1
+				default:
+					key := r.Intn(2*len(keys)+6) - 3
+					what = fmt.Sprintf("Seek(%d)", key)
+					got = cursorState(c.Seek(key))
+					pos = sort.SearchInts(keys, key)
+				}
+				if pos < 0 || pos >= len(keys) {
+					pos = -1
+				}
+				for step := 0; step < 30; step++ {
+					want := "-"
+					if pos >= 0 {
+						want = fmt.Sprint(keys[pos])
+					}
+					if got != want {
+						t.Fatalf("degree %d, %d items: %s = %s, want %s", degree, len(keys), what, got, want)
+					}
+					if item := cursorState(c.Item()); item != want {
+						t.Fatalf("degree %d, %d items: Item after %s = %s, want %s", degree, len(keys), what, item, want)
+					}
+					if r.Intn(2) == 0 {
+						what += ".Next"
+						got = cursorState(c.Next())
+						if pos >= 0 {
+							pos++
+						}
+					} else {
+						what += ".Prev"
+						got = cursorState(c.Prev())
+						if pos >= 0 {
+							pos--
+						}
+					}
+					if pos >= len(keys) {
+						pos = -1
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestCursorWalkは、FirstからNextで、LastからPrevで、すべての項目をちょうど1回ずつたどることを確かめます。
+func TestCursorWalk(t *testing.T) {
+	for _, degree := range []int{2, 3, 5} {
+		for _, size := range []int{0, 1, 2, 3, 10, 100, 1000} {
+			tr := NewG(degree, intLess)
+			for i := 0; i < size; i++ {
+				tr.ReplaceOrInsert(i * 2)
+			}
+			c := tr.Cursor()
+			var fwd, back []int
+			for i, ok := c.First(); ok; i, ok = c.Next() {
+				fwd = append(fwd, i)
+			}
+			for i, ok := c.Last(); ok; i, ok = c.Prev() {
+				back = append(back, i)
+			}
+			if len(fwd) != size || len(back) != size {
+				t.Fatalf("degree %d, %d items: Next visited %d, Prev visited %d", degree, size, len(fwd), len(back))
+			}
+			for i := range fwd {
+				if fwd[i] != i*2 || back[i] != (size-1-i)*2 {
+					t.Fatalf("degree %d, %d items: walks %v and %v", degree, size, fwd, back)
+				}
+			}
+			// 端を越えて位置を失った後は、Next、Prevとも項目を返さない。
+			if _, ok := c.Next(); ok {
+				t.Fatalf("degree %d, %d items: Next after running off the start returned an item", degree, size)
+			}
+			if _, ok := c.Prev(); ok {
+				t.Fatalf("degree %d, %d items: Prev after running off the start returned an item", degree, size)
+			}
+		}
+	}
+}
+
+func TestCursorAfterModification(t *testing.T) {
+	tr, _ := randomTree(rand.New(rand.NewSource(19)), 3, 100)
+	c := tr.Cursor()
+	c.Seek(50)
+	tr.ReplaceOrInsert(-1)
+	for name, f := range map[string]func(){
+		"Next": func() { c.Next() },
+		"Prev": func() { c.Prev() },
+		"Item": func() { c.Item() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s after the tree was modified did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+	// 位置を決め直せば、また使える。
+	if i, ok := c.First(); !ok || i != -1 {
+		t.Fatalf("First after the modification = %d, %v", i, ok)
+	}
+	if _, ok := c.Next(); !ok {
+		t.Fatal("Next after repositioning returned no item")
+	}
+	// 位置を持たないカーソルでも、作った後に変更されていればパニックする。
+	fresh := tr.Cursor()
+	tr.Delete(-1)
+	defer func() {
+		if recover() == nil {
+			t.Error("Next on an unpositioned cursor after a modification did not panic")
+		}
+	}()
+	fresh.Next()
+}
+
+func TestCursorItemWrapper(t *testing.T) {
+	tr := New(3)
+	c := tr.Cursor()
+	if c.First() != nil || c.Last() != nil || c.Seek(Int(0)) != nil || c.Item() != nil {
+		t.Fatal("cursor on an empty tree returned an item")
+	}
+	for i := 0; i < 10; i++ {
+		tr.ReplaceOrInsert(Int(i * 10))
+	}
+	if got := c.Seek(Int(35)); got != Int(40) {
+		t.Fatalf("Seek(35) = %v", got)
+	}
+	if got := c.Prev(); got != Int(30) {
+		t.Fatalf("Prev = %v", got)
+	}
+	if got := c.Seek(Int(95)); got != nil || c.Item() != nil || c.Next() != nil {
+		t.Fatalf("Seek past the end = %v", got)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !btreedebug
+
+package btree
+
+// btreedebugビルドタグが付いていない場合、デバッグ用のフックはすべて何もしません。
+
+func (t *BTreeG[T]) debugBeginIterate() {}
+
+func (t *BTreeG[T]) debugEndIterate() {}
+
+func (t *BTreeG[T]) debugBeforeMutate(op string) {}
+
+func (t *BTreeG[T]) debugAfterMutate(op string) {}
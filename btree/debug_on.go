@@ -0,0 +1,40 @@
+//go:build btreedebug
+
+package btree
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// btreedebugビルドタグを付けてビルドすると、すべての公開された変更操作の後に木の不変条件を検査し、
+// 反復中の変更のような誤用を検出した時点で、状況を説明するメッセージとともにパニックします。
+// 検査は木全体を走査するので非常に遅く、開発やテストでのみ使うことを想定しています。
+
+// debugBeginIterateは、反復の開始を記録します。読み取りは複数のゴルーチンから同時に行えるので、数はアトミックに増減します。
+func (t *BTreeG[T]) debugBeginIterate() {
+	atomic.AddInt32(&t.iterating, 1)
+}
+
+// debugEndIterateは、反復の終了を記録します。
+func (t *BTreeG[T]) debugEndIterate() {
+	atomic.AddInt32(&t.iterating, -1)
+}
+
+// debugBeforeMutateは、反復中に木が変更されようとしていればパニックします。
+func (t *BTreeG[T]) debugBeforeMutate(op string) {
+	if n := atomic.LoadInt32(&t.iterating); n > 0 {
+		panic(fmt.Sprintf("btree: %s called during iteration (%d active iterators)", op, n))
+	}
+}
+
+// debugAfterMutateは、変更操作の後に木の不変条件を検査し、破られていれば木を汚染済みにしてパニックします。
+func (t *BTreeG[T]) debugAfterMutate(op string) {
+	if t.poisoned {
+		return
+	}
+	if err := t.checkInvariants(); err != nil {
+		t.poison(err)
+		panic(fmt.Sprintf("btree: invariant violated after %s: %v", op, err))
+	}
+}
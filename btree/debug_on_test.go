@@ -0,0 +1,60 @@
+//go:build btreedebug
+
+package btree
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestDebugParallelReadersは、複数のゴルーチンが同時に反復しても反復の数が競合せずに数えられ、すべて終わった後は変更できることを確かめます。
+// go test -race -tags btreedebug で実行してください。
+func TestDebugParallelReaders(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 1000; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				count := 0
+				tr.Ascend(func(int) bool {
+					count++
+					return true
+				})
+				tr.DescendRange(g*100+50, g*100, func(int) bool {
+					count++
+					return true
+				})
+				if count != 1050 {
+					t.Errorf("goroutine %d saw %d items, want 1050", g, count)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if tr.iterating != 0 {
+		t.Fatalf("%d iterators still recorded after all readers finished", tr.iterating)
+	}
+	tr.ReplaceOrInsert(1000)
+}
+
+func TestDebugMutateDuringIteration(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 10; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Delete during Ascend did not panic")
+		}
+	}()
+	tr.Ascend(func(i int) bool {
+		tr.Delete(i)
+		return true
+	})
+}
@@ -0,0 +1,360 @@
+package btree
+
+import "sort"
+
+// subtreeは、ルートとその高さ（葉の高さは0）の組で表した木です。ルートがnilの場合は空の木です。
+// ルート以外のノードはすべて不変条件を満たしますが、ルートは minItems を下回っていても構いません（1つ以上の項目は持ちます）。
+type subtree[T any] struct {
+	root   *node[T]
+	height int
+}
+
+// DeleteRangeは、[greaterOrEqual, lessThan) の範囲の項目をすべて木から削除し、削除した数を返します。
+//
+// 項目を1つずつ削除するのではなく、木を範囲の両端で3つに分割し、中央の木をまとめて捨て（所有しているノードはClear(true)と同様にフリーリストに戻します）、
+// 残った左右の木を連結します。分割と連結は範囲の両端を通る経路上のノードだけを作り直すので、削除する項目数にほとんど依存しません。
+func (t *BTreeG[T]) DeleteRange(greaterOrEqual, lessThan T) int {
+	return t.deleteRange(optional(greaterOrEqual), optional(lessThan))
+}
+
+func (t *BTreeG[T]) deleteRange(lo, hi optionalItem[T]) (removed int) {
+	if t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic("DeleteRange", true)
+	}
+	t.debugBeforeMutate("DeleteRange")
+	defer t.debugAfterMutate("DeleteRange")
+	if t.events != nil {
+		defer t.events.end("DeleteRange", t.beginEvent())
+	}
+	if t.root == nil || len(t.root.items) == 0 {
+		return
+	}
+	if lo.valid && hi.valid && !t.cow.less(lo.item, hi.item) {
+		return
+	}
+	// 範囲に項目がなければ、木を作り直さずに済ませる。
+	start, end := 0, t.length
+	if lo.valid {
+		start, _ = t.Rank(lo.item)
+	}
+	if hi.valid {
+		end, _ = t.Rank(hi.item)
+	}
+	if end <= start {
+		return
+	}
+	t.mutations++
+	whole := subtree[T]{root: t.root, height: t.height()}
+	left, rest := subtree[T]{}, whole
+	if lo.valid {
+		left, rest = t.splitAt(whole, lo.item)
+	}
+	mid, right := rest, subtree[T]{}
+	if hi.valid {
+		mid, right = t.splitAt(rest, hi.item)
+	}
+	if mid.root != nil {
+		removed = mid.root.size
+		mid.root.reset(t.cow)
+	}
+	t.root = t.concat(left, right).root
+	t.length -= removed
+	return removed
+}
+
+// RetainRangeは、[greaterOrEqual, lessThan) の範囲の外の項目をすべて木から削除し、削除した数を返します。
+//
+// DeleteRangeと同じく、木を範囲の両端で分割して範囲の外側の2つの木をまとめて捨てるので、時間は削除する項目数にほとんど依存しません。
+// 古いキーを捨てて直近の区間だけを残すような、スライディングウィンドウでの保持に使います。
+func (t *BTreeG[T]) RetainRange(greaterOrEqual, lessThan T) int {
+	return t.retainRange(optional(greaterOrEqual), optional(lessThan))
+}
+
+func (t *BTreeG[T]) retainRange(lo, hi optionalItem[T]) (removed int) {
+	if t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic("RetainRange", true)
+	}
+	t.debugBeforeMutate("RetainRange")
+	defer t.debugAfterMutate("RetainRange")
+	if t.events != nil {
+		defer t.events.end("RetainRange", t.beginEvent())
+	}
+	if t.root == nil || len(t.root.items) == 0 {
+		return
+	}
+	start, end := 0, t.length
+	if lo.valid {
+		start, _ = t.Rank(lo.item)
+	}
+	if hi.valid {
+		end, _ = t.Rank(hi.item)
+	}
+	// 範囲の外に項目がなければ、木を作り直さずに済ませる。
+	if start == 0 && end == t.length {
+		return
+	}
+	t.mutations++
+	if end <= start {
+		removed = t.length
+		t.root.reset(t.cow)
+		t.root, t.length = nil, 0
+		return removed
+	}
+	whole := subtree[T]{root: t.root, height: t.height()}
+	left, mid := subtree[T]{}, whole
+	if lo.valid {
+		left, mid = t.splitAt(whole, lo.item)
+	}
+	right := subtree[T]{}
+	if hi.valid {
+		mid, right = t.splitAt(mid, hi.item)
+	}
+	for _, s := range []subtree[T]{left, right} {
+		if s.root != nil {
+			removed += s.root.size
+			s.root.reset(t.cow)
+		}
+	}
+	t.root = mid.root
+	t.length -= removed
+	return removed
+}
+
+// heightは、木の高さ（葉だけの木では0）を返します。
+func (t *BTreeG[T]) height() int {
+	h := 0
+	for n := t.root; n != nil && len(n.children) > 0; n = n.children[0] {
+		h++
+	}
+	return h
+}
+
+// normalizeは、項目を持たないルートを取り除き、空の木か、ルートが1つ以上の項目を持つ木にします。
+func (t *BTreeG[T]) normalize(s subtree[T]) subtree[T] {
+	for s.root != nil && len(s.root.items) == 0 {
+		old := s.root
+		if len(old.children) == 0 {
+			s.root, s.height = nil, 0
+		} else {
+			s.root, s.height = old.children[0], s.height-1
+		}
+		t.cow.freeNode(old)
+	}
+	return s
+}
+
+// splitAtは、木sを、keyより小さい項目の木と、key以上の項目の木に分割します。
+// sのノードは変更せず、経路上のノードを新しく作り、sが所有していたものはフリーリストに戻します。
+func (t *BTreeG[T]) splitAt(s subtree[T], key T) (left, right subtree[T]) {
+	n := s.root
+	if n == nil {
+		return
+	}
+	less := t.cow.less
+	i := sort.Search(len(n.items), func(k int) bool { return !less(n.items[k], key) })
+	if len(n.children) == 0 {
+		l := t.cow.newNode()
+		l.items = append(l.items, n.items[:i]...)
+		l.recount()
+		r := t.cow.newNode()
+		r.items = append(r.items, n.items[i:]...)
+		r.recount()
+		t.cow.freeNode(n)
+		return t.normalize(subtree[T]{l, 0}), t.normalize(subtree[T]{r, 0})
+	}
+	lc, rc := t.splitAt(subtree[T]{n.children[i], s.height - 1}, key)
+	left = lc
+	if i > 0 {
+		l := t.cow.newNode()
+		l.items = append(l.items, n.items[:i-1]...)
+		l.children = append(l.children, n.children[:i]...)
+		l.recount()
+		left = t.join(t.normalize(subtree[T]{l, s.height}), n.items[i-1], lc)
+	}
+	right = rc
+	if i < len(n.items) {
+		r := t.cow.newNode()
+		r.items = append(r.items, n.items[i+1:]...)
+		r.children = append(r.children, n.children[i+1:]...)
+		r.recount()
+		right = t.join(rc, n.items[i], t.normalize(subtree[T]{r, s.height}))
+	}
+	t.cow.freeNode(n)
+	return left, right
+}
+
+// concatは、leftのすべての項目がrightのすべての項目より小さい2つの木を連結します。
+func (t *BTreeG[T]) concat(left, right subtree[T]) subtree[T] {
+	if left.root == nil {
+		return right
+	}
+	if right.root == nil {
+		return left
+	}
+	// rightの最小の項目を取り出し、2つの木の区切りにする。
+	root := right.root.mutableFor(t.cow)
+	var zero T
+	sep, _ := root.remove(zero, t.minItems(), removeMin)
+	return t.join(left, sep, t.normalize(subtree[T]{root, right.height}))
+}
+
+// joinは、left < sep < right となる2つの木と区切りの項目を連結します。
+// 低い方の木を、高い方の木の端の経路上の同じ高さの位置に子として付け、あふれたノードを上に向かって分割します。
+func (t *BTreeG[T]) join(left subtree[T], sep T, right subtree[T]) subtree[T] {
+	switch {
+	case left.root == nil:
+		return t.insertInto(right, sep)
+	case right.root == nil:
+		return t.insertInto(left, sep)
+	case left.height == right.height:
+		if len(left.root.items)+1+len(right.root.items) <= t.maxItems() {
+			n := left.root.mutableFor(t.cow)
+			n.items = append(n.items, sep)
+			n.items = append(n.items, right.root.items...)
+			n.children = append(n.children, right.root.children...)
+			n.recount()
+			t.cow.freeNode(right.root)
+			return subtree[T]{n, left.height}
+		}
+		n := t.cow.newNode()
+		n.items = append(n.items, sep)
+		n.children = append(n.children, left.root, right.root)
+		n.fixChild(0, t.minItems())
+		n.fixChild(1, t.minItems())
+		n.recount()
+		return subtree[T]{n, left.height + 1}
+	case left.height > right.height:
+		root := left.root.mutableFor(t.cow)
+		if item, next, split := t.joinRight(root, left.height, sep, right); split {
+			return t.grow(root, item, next, left.height)
+		}
+		return subtree[T]{root, left.height}
+	default:
+		root := right.root.mutableFor(t.cow)
+		if item, next, split := t.joinLeft(root, right.height, sep, left); split {
+			return t.grow(root, item, next, right.height)
+		}
+		return subtree[T]{root, right.height}
+	}
+}
+
+// growは、分割されたルートの2つの半分と区切りから、1段高い新しいルートを作ります。
+func (t *BTreeG[T]) grow(first *node[T], item T, second *node[T], height int) subtree[T] {
+	n := t.cow.newNode()
+	n.items = append(n.items, item)
+	n.children = append(n.children, first, second)
+	n.recount()
+	return subtree[T]{n, height + 1}
+}
+
+// joinRightは、高さhのノードnの右端の経路をたどり、rと同じ高さの子の位置にsepとrのルートを追加します。
+// nがあふれた場合は分割し、区切りの項目と右半分のノードを返します。
+func (t *BTreeG[T]) joinRight(n *node[T], h int, sep T, r subtree[T]) (_ T, _ *node[T], _ bool) {
+	if h == r.height+1 {
+		n.items = append(n.items, sep)
+		n.children = append(n.children, r.root)
+		n.fixChild(len(n.children)-1, t.minItems())
+	} else if item, next, split := t.joinRight(n.mutableChild(len(n.children)-1), h-1, sep, r); split {
+		n.items = append(n.items, item)
+		n.children = append(n.children, next)
+	}
+	n.recount()
+	if len(n.items) > t.maxItems() {
+		item, next := n.split(t.maxItems() / 2)
+		return item, next, true
+	}
+	return
+}
+
+// joinLeftは、joinRightの左右を逆にしたもので、nの左端の経路上にlのルートとsepを追加します。
+func (t *BTreeG[T]) joinLeft(n *node[T], h int, sep T, l subtree[T]) (_ T, _ *node[T], _ bool) {
+	if h == l.height+1 {
+		n.items.insertAt(0, sep)
+		n.children.insertAt(0, l.root)
+		n.fixChild(0, t.minItems())
+	} else if item, next, split := t.joinLeft(n.mutableChild(0), h-1, sep, l); split {
+		n.items.insertAt(0, item)
+		n.children.insertAt(1, next)
+	}
+	n.recount()
+	if len(n.items) > t.maxItems() {
+		item, next := n.split(t.maxItems() / 2)
+		return item, next, true
+	}
+	return
+}
+
+// insertIntoは、木sにitemを挿入した木を返します。
+func (t *BTreeG[T]) insertInto(s subtree[T], item T) subtree[T] {
+	if s.root == nil {
+		n := t.cow.newNode()
+		n.items = append(n.items, item)
+		n.recount()
+		return subtree[T]{n, 0}
+	}
+	root := s.root.mutableFor(t.cow)
+	if len(root.items) >= t.maxItems() {
+		mid, second := root.split(t.maxItems() / 2)
+		s = t.grow(root, mid, second, s.height)
+		root = s.root
+	}
+	root.insert(item, t.maxItems())
+	return subtree[T]{root, s.height}
+}
+
+// fixChildは、子iが minItems 以上の項目を持つようになるまで、兄弟から借りるか兄弟とマージします。
+// 子iの子孫は不変条件を満たしている必要があります。マージによってこのノード自身の項目数は減ることがあります。
+func (n *node[T]) fixChild(i, minItems int) {
+	for len(n.children) > 1 && len(n.children[i].items) < minItems {
+		switch {
+		case i > 0 && len(n.children[i-1].items) > minItems:
+			child := n.mutableChild(i)
+			stealFrom := n.mutableChild(i - 1)
+			child.items.insertAt(0, n.items[i-1])
+			n.items[i-1] = stealFrom.items.pop()
+			if len(stealFrom.children) > 0 {
+				child.children.insertAt(0, stealFrom.children.pop())
+			}
+			child.recount()
+			stealFrom.recount()
+		case i < len(n.items) && len(n.children[i+1].items) > minItems:
+			child := n.mutableChild(i)
+			stealFrom := n.mutableChild(i + 1)
+			child.items = append(child.items, n.items[i])
+			n.items[i] = stealFrom.items.removeAt(0)
+			if len(stealFrom.children) > 0 {
+				child.children = append(child.children, stealFrom.children.removeAt(0))
+			}
+			child.recount()
+			stealFrom.recount()
+		default:
+			if i >= len(n.items) {
+				i--
+			}
+			child := n.mutableChild(i)
+			mergeItem := n.items.removeAt(i)
+			mergeChild := n.children.removeAt(i + 1)
+			child.items = append(child.items, mergeItem)
+			child.items = append(child.items, mergeChild.items...)
+			child.children = append(child.children, mergeChild.children...)
+			child.recount()
+			n.cow.freeNode(mergeChild)
+		}
+	}
+}
+
+// DeleteRangeは、[greaterOrEqual, lessThan) の範囲の項目をすべて木から削除し、削除した数を返します。nilの境界は「境界なし」を意味します。
+func (t *BTree) DeleteRange(greaterOrEqual, lessThan Item) int {
+	return t.generic().deleteRange(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan))
+}
+
+// RetainRangeは、[greaterOrEqual, lessThan) の範囲の外の項目をすべて木から削除し、削除した数を返します。nilの境界は「境界なし」を意味します。
+func (t *BTree) RetainRange(greaterOrEqual, lessThan Item) int {
+	return t.generic().retainRange(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan))
+}
@@ -0,0 +1,159 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// allItemsは、木の項目を昇順に返します。
+func allItems(tr *BTreeG[int]) []int {
+	out := []int{}
+	tr.Ascend(func(i int) bool {
+		out = append(out, i)
+		return true
+	})
+	return out
+}
+
+// randomTreeは、0から2n-1までの整数のうちランダムに選んだものを入れた木と、その項目を昇順に返します。
+func randomTree(r *rand.Rand, degree, n int) (*BTreeG[int], []int) {
+	tr := NewG(degree, intLess)
+	var keys []int
+	for i := 0; i < 2*n; i++ {
+		if r.Intn(2) == 0 {
+			tr.ReplaceOrInsert(i)
+			keys = append(keys, i)
+		}
+	}
+	return tr, keys
+}
+
+// filterは、keysのうちkeepを満たすものを返します。
+func filter(keys []int, keep func(int) bool) []int {
+	out := []int{}
+	for _, k := range keys {
+		if keep(k) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// mustVerifyは、木の不変条件が成り立つことを確かめます。
+func mustVerify(t *testing.T, what string, tr *BTreeG[int]) {
+	t.Helper()
+	if err := tr.Verify(); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
+
+func TestDeleteRangeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	for _, degree := range []int{2, 3, 4, 16} {
+		for n := 0; n < 300; n++ {
+			size := r.Intn(400)
+			tr, keys := randomTree(r, degree, size)
+			// Cloneした木と共有しているノードを、分割と連結が書き換えないことも確かめる。
+			clone := tr.Clone()
+			lo, hi := r.Intn(2*size+10)-5, r.Intn(2*size+10)-5
+			what := fmt.Sprintf("degree %d, %d items, DeleteRange(%d, %d)", degree, len(keys), lo, hi)
+			want := filter(keys, func(k int) bool { return k < lo || k >= hi })
+			mutations := tr.mutations
+			if removed := tr.DeleteRange(lo, hi); removed != len(keys)-len(want) {
+				t.Fatalf("%s removed %d, want %d", what, removed, len(keys)-len(want))
+			}
+			// 何も削除しなかった場合は、トランザクションが衝突しないように変更として数えない。
+			if changed := tr.mutations != mutations; changed != (len(want) < len(keys)) {
+				t.Fatalf("%s counted as a mutation = %v", what, changed)
+			}
+			mustVerify(t, what, tr)
+			if got := allItems(tr); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s = %v, want %v", what, got, want)
+			}
+			mustVerify(t, what+" (clone)", clone)
+			if got := allItems(clone); fmt.Sprint(got) != fmt.Sprint(keys) {
+				t.Fatalf("%s changed the clone", what)
+			}
+		}
+	}
+}
+
+func TestRetainRangeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	for _, degree := range []int{2, 3, 16} {
+		for n := 0; n < 300; n++ {
+			size := r.Intn(400)
+			tr, keys := randomTree(r, degree, size)
+			clone := tr.Clone()
+			lo, hi := r.Intn(2*size+10)-5, r.Intn(2*size+10)-5
+			what := fmt.Sprintf("degree %d, %d items, RetainRange(%d, %d)", degree, len(keys), lo, hi)
+			want := filter(keys, func(k int) bool { return k >= lo && k < hi })
+			mutations := tr.mutations
+			if removed := tr.RetainRange(lo, hi); removed != len(keys)-len(want) {
+				t.Fatalf("%s removed %d, want %d", what, removed, len(keys)-len(want))
+			}
+			if changed := tr.mutations != mutations; changed != (len(want) < len(keys)) {
+				t.Fatalf("%s counted as a mutation = %v", what, changed)
+			}
+			mustVerify(t, what, tr)
+			if got := allItems(tr); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s = %v, want %v", what, got, want)
+			}
+			if got := allItems(clone); fmt.Sprint(got) != fmt.Sprint(keys) {
+				t.Fatalf("%s changed the clone", what)
+			}
+		}
+	}
+}
+
+// TestCopyRangeRandomは、CopyRangeの結果と元の木が範囲の項目を共有したまま、互いの書き込みの影響を受けないことを確かめます。
+func TestCopyRangeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	for _, degree := range []int{2, 3, 16} {
+		for n := 0; n < 300; n++ {
+			size := r.Intn(400)
+			tr, keys := randomTree(r, degree, size)
+			lo, hi := r.Intn(2*size+10)-5, r.Intn(2*size+10)-5
+			what := fmt.Sprintf("degree %d, %d items, CopyRange(%d, %d)", degree, len(keys), lo, hi)
+			want := filter(keys, func(k int) bool { return k >= lo && k < hi })
+			out := tr.CopyRange(lo, hi)
+			mustVerify(t, what, out)
+			if got := allItems(out); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s = %v, want %v", what, got, want)
+			}
+			// 結果の木を空にしても、元の木は変わらない。
+			for _, k := range want {
+				out.Delete(k)
+			}
+			tr.ReplaceOrInsert(-100)
+			mustVerify(t, what+" (source)", tr)
+			if got := allItems(tr); len(got) != len(keys)+1 || got[0] != -100 {
+				t.Fatalf("%s: writes to the copy changed the source", what)
+			}
+			if out.Len() != 0 || out.Has(-100) {
+				t.Fatalf("%s: writes to the source changed the copy", what)
+			}
+		}
+	}
+}
+
+// TestCopyRangeConcurrentReadersは、他のゴルーチンが読んでいる木からCopyRangeしても競合せず、その後の元の木への書き込みがコピーに漏れないことを確かめます。-raceで実行してください。
+func TestCopyRangeConcurrentReaders(t *testing.T) {
+	tr, keys := randomTree(rand.New(rand.NewSource(14)), 3, 1000)
+	copies := make([]*BTreeG[int], 50)
+	whileReading(tr, func() {
+		for i := range copies {
+			copies[i] = tr.CopyRange(i*20, i*20+500)
+		}
+	})
+	tr.Clear(false)
+	for i, c := range copies {
+		what := fmt.Sprintf("CopyRange(%d, %d)", i*20, i*20+500)
+		mustVerify(t, what, c)
+		want := filter(keys, func(k int) bool { return k >= i*20 && k < i*20+500 })
+		if got := allItems(c); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package disk
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// checkSamplesは、時間内に木を走査しきれなかった場合に、チェックサムだけを検査する標本のページの数です。
+const checkSamples = 64
+
+// CheckCodeは、CheckFileが見つけた問題の種類を表す、機械で読める符号です。
+type CheckCode string
+
+const (
+	// CodeBadMetaは、メタページが壊れていることを示します。
+	CodeBadMeta CheckCode = "bad-meta"
+	// CodeBadChecksumは、ページのチェックサムが合わないことを示します。
+	CodeBadChecksum CheckCode = "bad-checksum"
+	// CodeBadPageは、木から参照されるページの種類や内容が壊れていることを示します。
+	CodeBadPage CheckCode = "bad-page"
+	// CodeBadFreeListは、空きページのリストが空きページでないページを指しているか、循環していることを示します。
+	CodeBadFreeList CheckCode = "bad-free-list"
+	// CodeDoubleUseは、木から参照されるページが、空きページのリストにもあるか、木の2か所から参照されていることを示します。
+	CodeDoubleUse CheckCode = "double-use"
+	// CodeLeakedPagesは、木からも空きページのリストからも参照されないページがあることを示します。
+	CodeLeakedPages CheckCode = "leaked-pages"
+	// CodeLengthMismatchは、メタページの項目数が木にある項目の数と合わないことを示します。
+	CodeLengthMismatch CheckCode = "length-mismatch"
+	// CodeTrailingDataは、ファイルがメタページのページ数より長いことを示します。
+	CodeTrailingData CheckCode = "trailing-data"
+)
+
+// Suggestionは、codeの問題への対処の提案を返します。
+func (c CheckCode) Suggestion() string {
+	switch c {
+	case CodeBadMeta, CodeBadChecksum, CodeBadPage, CodeDoubleUse:
+		return "pages the tree may read are damaged; restore the file from a backup"
+	case CodeBadFreeList:
+		return "reads are unaffected, but writes may reuse live pages; copy all items into a new file before writing"
+	case CodeLeakedPages:
+		return "harmless but the space is never reused; copy all items into a new file to reclaim it"
+	case CodeLengthMismatch:
+		return "Len is wrong, usually after a crash without Sync; copy all items into a new file to fix it"
+	case CodeTrailingData:
+		return "harmless, usually pages allocated after the last Sync; the file can be truncated to the size in the detail"
+	default:
+		return ""
+	}
+}
+
+// Fatalは、codeの問題が読み取りの結果を誤らせるものかどうかを返します。falseの問題は、空間の無駄やLenの誤りにとどまります。
+func (c CheckCode) Fatal() bool {
+	switch c {
+	case CodeBadMeta, CodeBadChecksum, CodeBadPage, CodeDoubleUse:
+		return true
+	default:
+		return false
+	}
+}
+
+type (
+	// Findingは、CheckFileが見つけた1つの問題です。
+	Finding struct {
+		Code CheckCode `json:"code"`
+		// Pageは、問題のあったページの番号です。特定のページによらない問題では-1です。
+		Page   int64  `json:"page"`
+		Detail string `json:"detail"`
+	}
+
+	// CheckReportは、CheckFileとOptions.CheckOnOpenの検査の結果です。
+	CheckReport struct {
+		Findings []Finding `json:"findings"`
+		// Completeは、時間内にすべてのページを検査できたかどうかです。
+		// falseの場合は木の走査を途中で打ち切り、残りは標本のページのチェックサムだけを検査しています。CodeLeakedPagesとCodeLengthMismatchは、Completeで、かつ木のすべてのページを読めた場合だけ調べます。
+		Complete bool `json:"complete"`
+		// Pagesは、ファイルのページ数（メタページを含む）です。
+		Pages int64 `json:"pages"`
+		// Checkedは、読んで検査したページの数です。
+		Checked int64         `json:"checked"`
+		Elapsed time.Duration `json:"elapsed_ns"`
+	}
+
+	// checkerは、ファイルのページを読み、木と空きページのリストの整合性を調べます。
+	checker struct {
+		f        *os.File
+		pageSize int
+		npages   uint64
+		buf      []byte
+		deadline time.Time
+		// stateは、ページごとの参照元（pageFreeかpageTree）です。
+		state []byte
+		items int
+		// damagedは、木か空きページのリストのページを読めなかったかどうかです。その先はたどっていないので、参照されないページや項目数は調べられません。
+		damaged bool
+		report  *CheckReport
+	}
+)
+
+// ページの参照元です。
+const (
+	pageUnseen byte = iota
+	pageFree
+	pageTree
+)
+
+// OKは、問題が見つからなかった場合にtrueを返します。
+func (r *CheckReport) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// Fatalは、Fatalな問題が見つかった場合にtrueを返します。
+func (r *CheckReport) Fatal() bool {
+	for _, f := range r.Findings {
+		if f.Code.Fatal() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CheckReport) add(code CheckCode, page int64, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{Code: code, Page: page, Detail: fmt.Sprintf(format, args...)})
+}
+
+// CheckFileは、pathのファイルを読み取り専用で開き、メタページ、空きページのリストと木から参照されるページの対応、ページのチェックサムを検査します。
+// budgetが0より大きい場合は、その時間を過ぎると木の走査を打ち切り、標本のページのチェックサムだけを検査します。
+// Codecは要らないので、項目の中身は検査しません。見つけた問題は報告に含め、ファイルを読めない場合や木のファイルでない場合だけエラーを返します。
+func CheckFile(path string, budget time.Duration) (*CheckReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, errors.New("disk: empty file")
+	}
+	start := time.Now()
+	t := &Tree{p: &pager{f: f, cache: make(map[uint64]*node), lru: list.New(), npages: 1}}
+	if err := t.readMeta(fi.Size(), Options{}); err != nil {
+		var ce *btree.CorruptionError
+		if !errors.As(err, &ce) {
+			return nil, err
+		}
+		r := &CheckReport{Elapsed: time.Since(start)}
+		r.add(CodeBadMeta, 0, "%s", ce.Detail)
+		return r, nil
+	}
+	return t.checkFile(fi.Size(), start, budget), nil
+}
+
+// checkFileは、メタページを読み込んだ直後の木のファイルを検査します。キャッシュは使わずにファイルを直接読みます。
+func (t *Tree) checkFile(size int64, start time.Time, budget time.Duration) *CheckReport {
+	c := &checker{
+		f:        t.p.f,
+		pageSize: t.p.pageSize,
+		npages:   t.p.npages,
+		buf:      make([]byte, t.p.pageSize),
+		state:    make([]byte, t.p.npages),
+		report:   &CheckReport{Pages: int64(t.p.npages), Complete: true},
+	}
+	if budget > 0 {
+		c.deadline = start.Add(budget)
+	}
+	if end := int64(t.p.npages) * int64(t.p.pageSize); size > end {
+		c.report.add(CodeTrailingData, -1, "file is %d bytes but its %d pages end at %d", size, t.p.npages, end)
+	}
+	c.freeList(t.p.freeHead)
+	if t.root != 0 && c.report.Complete {
+		c.walk(t.root)
+	}
+	switch {
+	case !c.report.Complete:
+		c.sample()
+	case !c.damaged:
+		c.leaks()
+		if c.items != t.length {
+			c.report.add(CodeLengthMismatch, 0, "meta page says %d items, the tree has %d", t.length, c.items)
+		}
+	}
+	c.report.Elapsed = time.Since(start)
+	return c.report
+}
+
+// expiredは、時間を使い切った場合にtrueを返し、報告を不完全にします。
+func (c *checker) expired() bool {
+	if c.deadline.IsZero() || time.Now().Before(c.deadline) {
+		return false
+	}
+	c.report.Complete = false
+	return true
+}
+
+// readは、ページidをbufに読み込み、チェックサムが合えばtrueを返します。合わなければ問題を報告します。
+func (c *checker) read(id uint64) bool {
+	c.report.Checked++
+	if _, err := c.f.ReadAt(c.buf, int64(id)*int64(c.pageSize)); err != nil {
+		c.report.add(CodeBadPage, int64(id), "read: %v", err)
+		return false
+	}
+	sum := binary.LittleEndian.Uint32(c.buf[c.pageSize-checksumSize:])
+	if crc32.ChecksumIEEE(c.buf[:c.pageSize-checksumSize]) != sum {
+		c.report.add(CodeBadChecksum, int64(id), "checksum mismatch")
+		return false
+	}
+	return true
+}
+
+// freeListは、空きページのリストをたどり、各ページを空きページとして記録します。
+func (c *checker) freeList(id uint64) {
+	for prev := uint64(0); id != 0; prev, id = id, binary.LittleEndian.Uint64(c.buf[1:]) {
+		if c.expired() {
+			return
+		}
+		switch {
+		case id >= c.npages:
+			c.report.add(CodeBadFreeList, int64(prev), "next free page %d is past the end of the file", id)
+			c.damaged = true
+			return
+		case c.state[id] == pageFree:
+			c.report.add(CodeBadFreeList, int64(id), "free list loops back to page %d", id)
+			return
+		}
+		c.state[id] = pageFree
+		if !c.read(id) {
+			c.damaged = true
+			return
+		}
+		if c.buf[0] != kindFree {
+			c.report.add(CodeBadFreeList, int64(id), "page on the free list has kind %d", c.buf[0])
+			c.damaged = true
+			return
+		}
+	}
+}
+
+// walkは、ページidを根とする部分木のページを検査し、木から参照されるページとして記録します。
+func (c *checker) walk(id uint64) {
+	if c.expired() {
+		return
+	}
+	switch c.state[id] {
+	case pageFree:
+		c.report.add(CodeDoubleUse, int64(id), "page is in the tree and on the free list")
+		return
+	case pageTree:
+		c.report.add(CodeDoubleUse, int64(id), "page is referenced twice in the tree")
+		return
+	}
+	c.state[id] = pageTree
+	if !c.read(id) {
+		c.damaged = true
+		return
+	}
+	b := c.buf[:c.pageSize-checksumSize]
+	kind := b[0]
+	if kind != kindLeaf && kind != kindInternal {
+		c.report.add(CodeBadPage, int64(id), "unexpected page kind %d", kind)
+		c.damaged = true
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(b[1:]))
+	c.items += count
+	if kind == kindLeaf {
+		return
+	}
+	if nodeHeaderSize+(count+1)*8 > len(b) {
+		c.report.add(CodeBadPage, int64(id), "%d children do not fit in a page", count+1)
+		c.damaged = true
+		return
+	}
+	// 子を読むとbufが上書きされるので、先に子のページ番号を取り出しておく。
+	children := make([]uint64, count+1)
+	for i := range children {
+		children[i] = binary.LittleEndian.Uint64(b[nodeHeaderSize+i*8:])
+	}
+	for i, child := range children {
+		if child == 0 || child >= c.npages {
+			c.report.add(CodeBadPage, int64(id), "child %d points to page %d (file has %d pages)", i, child, c.npages)
+			c.damaged = true
+			continue
+		}
+		c.walk(child)
+	}
+}
+
+// leaksは、どこからも参照されないページを1つの問題としてまとめて報告します。
+func (c *checker) leaks() {
+	first, n := int64(-1), 0
+	for id := uint64(1); id < c.npages; id++ {
+		if c.state[id] == pageUnseen {
+			if first < 0 {
+				first = int64(id)
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		c.report.add(CodeLeakedPages, first, "%d pages are neither in the tree nor on the free list (first is page %d)", n, first)
+	}
+}
+
+// sampleは、まだ読んでいないページから最大checkSamples個を選び、チェックサムだけを検査します。
+func (c *checker) sample() {
+	var unseen []uint64
+	for id := uint64(1); id < c.npages; id++ {
+		if c.state[id] == pageUnseen {
+			unseen = append(unseen, id)
+		}
+	}
+	rand.Shuffle(len(unseen), func(i, j int) {
+		unseen[i], unseen[j] = unseen[j], unseen[i]
+	})
+	if len(unseen) > checkSamples {
+		unseen = unseen[:checkSamples]
+	}
+	for _, id := range unseen {
+		c.read(id)
+	}
+}
@@ -0,0 +1,128 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// checkedFileは、500個の項目を入れて閉じた木のファイルのパスと、その根のページ番号を返します。
+func checkedFile(t *testing.T) (string, uint64) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tree")
+	tr := openTest(t, path)
+	fill(t, tr, 500)
+	root := tr.root
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, root
+}
+
+// codesは、報告に含まれる問題の種類を集めます。
+func codes(r *CheckReport) map[CheckCode]bool {
+	out := map[CheckCode]bool{}
+	for _, f := range r.Findings {
+		out[f.Code] = true
+	}
+	return out
+}
+
+func TestCheckFileClean(t *testing.T) {
+	path, _ := checkedFile(t)
+	r, err := CheckFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || !r.Complete || r.Fatal() {
+		t.Fatalf("clean file: %+v", r)
+	}
+	if r.Checked != r.Pages-1 {
+		t.Fatalf("checked %d of %d pages", r.Checked, r.Pages-1)
+	}
+}
+
+func TestCheckFileBadChecksum(t *testing.T) {
+	path, root := checkedFile(t)
+	flip(t, path, minPageSize, root, nodeHeaderSize)
+	r, err := CheckFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !codes(r)[CodeBadChecksum] || !r.Fatal() {
+		t.Fatalf("corrupt root: %+v", r.Findings)
+	}
+	if r.Findings[0].Page != int64(root) {
+		t.Fatalf("finding is for page %d, want the root %d", r.Findings[0].Page, root)
+	}
+	// 木をたどれなかったので、参照されないページや項目数の問題は報告しない。
+	if codes(r)[CodeLeakedPages] || codes(r)[CodeLengthMismatch] {
+		t.Fatalf("damaged tree reported leaks or a length mismatch: %+v", r.Findings)
+	}
+}
+
+func TestCheckFileBadMeta(t *testing.T) {
+	path, _ := checkedFile(t)
+	// マジックより後ろのバイトを壊し、メタページのチェックサムを合わなくする。
+	flip(t, path, minPageSize, 0, metaRoot)
+	r, err := CheckFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Findings) != 1 || r.Findings[0].Code != CodeBadMeta || !r.Fatal() {
+		t.Fatalf("corrupt meta page: %+v", r.Findings)
+	}
+	if _, err := ReadHeader(path); err == nil {
+		t.Fatal("ReadHeader accepted a corrupt meta page")
+	}
+}
+
+func TestCheckFileTrailingData(t *testing.T) {
+	path, _ := checkedFile(t)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, minPageSize)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	r, err := CheckFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Findings) != 1 || r.Findings[0].Code != CodeTrailingData || r.Fatal() {
+		t.Fatalf("file with a trailing page: %+v", r.Findings)
+	}
+	if r.Findings[0].Code.Suggestion() == "" {
+		t.Fatal("CodeTrailingData has no suggestion")
+	}
+}
+
+func TestCheckFileBudget(t *testing.T) {
+	path, _ := checkedFile(t)
+	r, err := CheckFile(path, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Complete {
+		t.Fatal("a 1ns budget produced a complete report")
+	}
+	if r.Checked == 0 || r.Checked > checkSamples {
+		t.Fatalf("an expired check read %d pages, want 1 to %d samples", r.Checked, checkSamples)
+	}
+	if !r.OK() {
+		t.Fatalf("sampled clean file: %+v", r.Findings)
+	}
+}
+
+func TestCheckFileNotATree(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(path, make([]byte, minPageSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckFile(path, 0); err == nil {
+		t.Fatal("CheckFile accepted a file that is not a tree")
+	}
+}
@@ -0,0 +1,799 @@
+// Package diskは、ノードをファイルの固定長のページに対応させ、RAMに収まらない大きさのデータを扱えるB-Treeを提供します。
+// ページはLRUキャッシュを通して読み書きされ、削除で空いたページは空きページのリストで再利用されます。
+//
+// 変更はキャッシュから追い出されるときに随時ファイルへ書き戻されますが、木の根や項目数を記録するメタページが書かれるのはSyncとCloseのときだけです。
+// 先行書き込みログはないので、Syncの途中やSyncしていない状態でプロセスがクラッシュしたファイルは壊れている可能性があります。
+package disk
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+const (
+	// DefaultPageSizeは、Options.PageSizeが0の場合のページの大きさ（バイト）です。
+	DefaultPageSize = 4096
+	// DefaultCachePagesは、Options.CachePagesが0の場合にキャッシュに保持するノードの数です。
+	DefaultCachePages = 1024
+	// minPageSizeは、ページの大きさの下限です。
+	minPageSize = 512
+)
+
+// magicは、メタページの先頭に書かれるファイルの識別子です。
+const magic = "btreedsk"
+
+// FormatVersionは、このパッケージが読み書きするファイル形式のバージョンです。
+const FormatVersion = 1
+
+// メタページ（ページ0）内の各フィールドの位置です。
+const (
+	metaVersion  = 8
+	metaPageSize = 12
+	metaDegree   = 16
+	metaRoot     = 20
+	metaLength   = 28
+	metaPages    = 36
+	metaFreeHead = 44
+)
+
+type (
+	// Codecは、項目とページに書かれるバイト列を相互に変換します。btree.Codecと同じものです。
+	Codec = btree.Codec
+
+	// IntCodecは、btree.Intをvarintで符号化するCodecです。btree.IntCodecと同じものです。
+	IntCodec = btree.IntCodec
+
+	// Optionsは、OpenFileWithOptionsでファイルを開く際の設定です。
+	Options struct {
+		// Degreeは、木のdegreeです。新しいファイルでは必須で、既存のファイルでは0か保存されている値と同じでなければなりません。
+		Degree int
+		// Codecは、項目の符号化方法です。必須です。
+		Codec Codec
+		// PageSizeは、ページの大きさ（バイト）です。0の場合、新しいファイルではDefaultPageSize、既存のファイルでは保存されている値になります。
+		PageSize int
+		// CachePagesは、キャッシュに保持するノードの数です。0の場合はDefaultCachePagesになります。
+		CachePages int
+		// CheckOnOpenが0より大きい場合、既存のファイルを開くときにCheckFileと同じ検査をこの時間まで行い、結果をTree.CheckReportで返します。
+		// 問題が見つかってもファイルは開くので、どう扱うかは呼び出し元が決めます。
+		CheckOnOpen time.Duration
+	}
+
+	// Patchは、Configureで開いている木に適用する設定の変更です。ゼロ値のフィールドは現在の値のまま変更しません。
+	// DegreeやPageSizeのようにファイルに保存されている設定は、Patchには含まれません。
+	Patch struct {
+		// CachePagesは、キャッシュに保持するノードの新しい数です。
+		CachePages int
+	}
+
+	// Treeは、ファイルに保存されるB-Treeです。BTreeと同じ操作を持ちますが、ディスクの読み書きに失敗しうるので、各操作はエラーを返します。
+	// 書き込み操作の途中でディスクへの書き込みに失敗すると、木は汚染され、以降の操作はErrPoisonedを包んだエラーを返します。
+	// Treeは複数のゴルーチンから同時に使ってはいけません（読み取り操作もキャッシュを更新します）。
+	Tree struct {
+		p       *pager
+		degree  int
+		maxItem int // 符号化した1項目の大きさの上限
+		root    uint64
+		length  int
+		err     error
+		closed  bool
+		checked *CheckReport // CheckOnOpenの結果
+	}
+)
+
+// OpenFileは、pathのファイルを開いて（存在しなければ作成して）、degreeとcodecを使う木を返します。
+func OpenFile(path string, degree int, codec Codec) (*Tree, error) {
+	return OpenFileWithOptions(path, Options{Degree: degree, Codec: codec})
+}
+
+// OpenFileWithOptionsは、与えられた設定でpathのファイルを開いて（存在しなければ作成して）木を返します。
+func OpenFileWithOptions(path string, opts Options) (*Tree, error) {
+	if opts.Codec == nil {
+		return nil, errors.New("disk: nil Codec")
+	}
+	if opts.CachePages <= 0 {
+		opts.CachePages = DefaultCachePages
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	t, err := open(f, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// openは、開いたファイルfのメタページを読み込むか、空のファイルであれば初期化します。
+func open(f *os.File, opts Options) (*Tree, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	p := &pager{
+		f:        f,
+		codec:    opts.Codec,
+		capacity: opts.CachePages,
+		cache:    make(map[uint64]*node),
+		lru:      list.New(),
+		npages:   1,
+	}
+	t := &Tree{p: p, degree: opts.Degree}
+	if fi.Size() == 0 {
+		p.pageSize = opts.PageSize
+		if p.pageSize == 0 {
+			p.pageSize = DefaultPageSize
+		}
+		if err := t.init(); err != nil {
+			return nil, err
+		}
+		p.buf = make([]byte, p.pageSize)
+		if err := t.Sync(); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	if err := t.readMeta(fi.Size(), opts); err != nil {
+		return nil, err
+	}
+	if opts.CheckOnOpen > 0 {
+		t.checked = t.checkFile(fi.Size(), time.Now(), opts.CheckOnOpen)
+	}
+	return t, t.init()
+}
+
+// initは、degreeとページの大きさを検証し、1項目の大きさの上限を求めます。
+// 満杯のノード（2*degree-1個の項目と2*degree個の子）が必ず1ページに収まるように上限を決めます。
+func (t *Tree) init() error {
+	var err error
+	t.maxItem, err = MaxItemSize(t.degree, t.p.pageSize)
+	return err
+}
+
+// MaxItemSizeは、degreeとページの大きさpageSizeの組み合わせで保存できる、符号化した1項目の大きさの上限を返します。
+// 組み合わせが不正な場合はエラーを返します。
+func MaxItemSize(degree, pageSize int) (int, error) {
+	if degree <= 1 {
+		return 0, fmt.Errorf("disk: bad degree %d", degree)
+	}
+	if pageSize < minPageSize || pageSize > 1<<20 {
+		return 0, fmt.Errorf("disk: bad page size %d", pageSize)
+	}
+	per := (pageSize - nodeHeaderSize - checksumSize - 2*degree*8) / (2*degree - 1)
+	max := per - uvarintLen(uint64(per))
+	if per <= 0 || max < 1 {
+		return 0, fmt.Errorf("disk: degree %d is too large for %d-byte pages", degree, pageSize)
+	}
+	return max, nil
+}
+
+// readMetaは、大きさsizeのファイルからメタページを読み込み、optsと矛盾しないことを確かめます。
+func (t *Tree) readMeta(size int64, opts Options) error {
+	head := make([]byte, metaFreeHead+8)
+	if _, err := t.p.f.ReadAt(head, 0); err != nil {
+		if err == io.EOF {
+			err = &btree.CorruptionError{Page: 0, Detail: "truncated meta page"}
+		}
+		return err
+	}
+	if string(head[:len(magic)]) != magic {
+		return errors.New("disk: not a btree file")
+	}
+	if v := binary.LittleEndian.Uint32(head[metaVersion:]); v != FormatVersion {
+		return fmt.Errorf("disk: unsupported format version %d", v)
+	}
+	t.p.pageSize = int(binary.LittleEndian.Uint32(head[metaPageSize:]))
+	if t.p.pageSize < minPageSize || t.p.pageSize > 1<<20 {
+		return &btree.CorruptionError{Page: 0, Detail: fmt.Sprintf("bad page size %d", t.p.pageSize)}
+	}
+	if opts.PageSize != 0 && opts.PageSize != t.p.pageSize {
+		return fmt.Errorf("disk: file has page size %d, not %d", t.p.pageSize, opts.PageSize)
+	}
+	t.p.buf = make([]byte, t.p.pageSize)
+	var err error
+	func() {
+		defer t.catch(&err, false)
+		t.p.read(0)
+	}()
+	if err != nil {
+		return err
+	}
+	b := t.p.buf
+	degree := int(binary.LittleEndian.Uint32(b[metaDegree:]))
+	if opts.Degree != 0 && opts.Degree != degree {
+		return fmt.Errorf("disk: file has degree %d, not %d", degree, opts.Degree)
+	}
+	t.degree = degree
+	t.root = binary.LittleEndian.Uint64(b[metaRoot:])
+	t.length = int(binary.LittleEndian.Uint64(b[metaLength:]))
+	t.p.npages = binary.LittleEndian.Uint64(b[metaPages:])
+	t.p.freeHead = binary.LittleEndian.Uint64(b[metaFreeHead:])
+	if t.p.npages == 0 || int64(t.p.npages)*int64(t.p.pageSize) > size {
+		return &btree.CorruptionError{Page: 0, Detail: fmt.Sprintf("file is shorter than its %d pages", t.p.npages)}
+	}
+	if t.root >= t.p.npages || t.p.freeHead >= t.p.npages {
+		return &btree.CorruptionError{Page: 0, Detail: "root or free list points past the end of the file"}
+	}
+	return nil
+}
+
+// writeMetaは、メタページを書き込みます。
+func (t *Tree) writeMeta() {
+	b := t.p.buf
+	for i := range b {
+		b[i] = 0
+	}
+	copy(b, magic)
+	binary.LittleEndian.PutUint32(b[metaVersion:], FormatVersion)
+	binary.LittleEndian.PutUint32(b[metaPageSize:], uint32(t.p.pageSize))
+	binary.LittleEndian.PutUint32(b[metaDegree:], uint32(t.degree))
+	binary.LittleEndian.PutUint64(b[metaRoot:], t.root)
+	binary.LittleEndian.PutUint64(b[metaLength:], uint64(t.length))
+	binary.LittleEndian.PutUint64(b[metaPages:], t.p.npages)
+	binary.LittleEndian.PutUint64(b[metaFreeHead:], t.p.freeHead)
+	t.p.write(0)
+}
+
+// checkは、木が閉じられているか汚染されている場合にエラーを返します。
+func (t *Tree) check() error {
+	if t.closed {
+		return btree.ErrClosed
+	}
+	if t.err != nil {
+		return &btree.PoisonedError{Cause: t.err}
+	}
+	return nil
+}
+
+// catchは、公開メソッドから遅延呼び出しされ、pagerのfailureによるパニックをerrに変換します。
+// 書き込み操作の途中（write）か、ディスクへの書き込みで失敗した場合は木を汚染します。
+func (t *Tree) catch(err *error, write bool) {
+	if r := recover(); r != nil {
+		f, ok := r.(failure)
+		if !ok {
+			panic(r)
+		}
+		*err = f.err
+		if write || f.write {
+			t.err = f.err
+		}
+	}
+}
+
+// beginWriteは、書き込み操作の間キャッシュからノードを追い出さないようにします。
+func (t *Tree) beginWrite() {
+	t.p.hold = true
+}
+
+// endWriteは、書き込み操作の終わりに遅延呼び出しされ、キャッシュを容量まで縮めます。
+func (t *Tree) endWrite(err *error) {
+	t.p.hold = false
+	if *err != nil {
+		return
+	}
+	defer t.catch(err, true)
+	t.p.trim()
+}
+
+// Errは、木を汚染したエラーを返します。汚染されていない場合はnilを返します。
+func (t *Tree) Err() error {
+	if t.err == nil {
+		return nil
+	}
+	return &btree.PoisonedError{Cause: t.err}
+}
+
+// Syncは、変更されたノードとメタページをファイルに書き込み、fsyncします。
+func (t *Tree) Sync() (err error) {
+	if err = t.check(); err != nil {
+		return err
+	}
+	defer t.catch(&err, true)
+	t.p.flush()
+	t.writeMeta()
+	if err := t.p.f.Sync(); err != nil {
+		fail(err, true)
+	}
+	return nil
+}
+
+// Closeは、Syncしてからファイルを閉じます。汚染された木の場合は、変更を書き込まずにファイルを閉じます。
+func (t *Tree) Close() error {
+	if t.closed {
+		return btree.ErrClosed
+	}
+	var err error
+	if t.err == nil {
+		err = t.Sync()
+	}
+	t.closed = true
+	if cerr := t.p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Configureは、開いている木にpatchの設定を適用します。ゼロ値のフィールドは変更しません。
+// CachePagesを小さくした場合は、古いノードを（変更されていれば書き戻してから）すぐにキャッシュから追い出します。
+// CachePagesが負の場合はエラーを返し、何も変更しません。
+func (t *Tree) Configure(patch Patch) (err error) {
+	if err = t.check(); err != nil {
+		return err
+	}
+	if patch.CachePages < 0 {
+		return fmt.Errorf("disk: bad CachePages %d", patch.CachePages)
+	}
+	if patch.CachePages == 0 {
+		return nil
+	}
+	t.p.capacity = patch.CachePages
+	defer t.catch(&err, true)
+	t.p.trim()
+	return nil
+}
+
+// CheckReportは、Options.CheckOnOpenで開いたときの検査の結果を返します。検査していない場合はnilを返します。
+func (t *Tree) CheckReport() *CheckReport {
+	return t.checked
+}
+
+// Lenは、木の項目数を返します。
+func (t *Tree) Len() int {
+	return t.length
+}
+
+// MaxItemSizeは、Codecで符号化した1項目の大きさの上限（バイト）を返します。
+func (t *Tree) MaxItemSize() int {
+	return t.maxItem
+}
+
+// maxItemsは、ノードごとに許可するアイテムの最大数を返します。
+func (t *Tree) maxItems() int {
+	return t.degree*2 - 1
+}
+
+// minItemsは、ノードごとに許可するアイテムの最小数を返します（ルートノードでは無視されます）。
+func (t *Tree) minItems() int {
+	return t.degree - 1
+}
+
+// encodeは、itemを符号化し、1ページに収まる大きさかどうかを確かめます。
+func (t *Tree) encode(item btree.Item) (entry, error) {
+	raw, err := t.p.codec.Encode(item)
+	if err != nil {
+		return entry{}, err
+	}
+	if len(raw) > t.maxItem {
+		return entry{}, fmt.Errorf("%w: %d bytes encoded (max %d)", btree.ErrKeyTooLarge, len(raw), t.maxItem)
+	}
+	return entry{item: item, raw: raw}, nil
+}
+
+// findは、ノードn内でitemが置かれるべき位置と、等しい項目があるかどうかを返します。
+func find(n *node, item btree.Item) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return item.Less(n.items[i].item)
+	})
+	if i > 0 && !n.items[i-1].item.Less(item) {
+		return i - 1, true
+	}
+	return i, false
+}
+
+// Getは、木の中からキーとなる項目を探し、それを返す。その項目が見つからない場合はnilを返す。
+func (t *Tree) Get(key btree.Item) (_ btree.Item, err error) {
+	if err = t.check(); err != nil {
+		return nil, err
+	}
+	defer t.catch(&err, false)
+	for id := t.root; id != 0; {
+		n := t.p.get(id)
+		i, found := find(n, key)
+		if found {
+			return n.items[i].item, nil
+		}
+		if n.leaf() {
+			break
+		}
+		id = n.children[i]
+	}
+	return nil, nil
+}
+
+// Hasは、与えられたキーが木の中にある場合にtrueを返します。
+func (t *Tree) Has(key btree.Item) (bool, error) {
+	item, err := t.Get(key)
+	return item != nil, err
+}
+
+// Minは、木の中で最も小さい項目を返し、木が空の場合はnilを返す。
+func (t *Tree) Min() (_ btree.Item, err error) {
+	return t.edge(true)
+}
+
+// Maxは、木の中で最大の項目を返し、木が空であればnilを返す。
+func (t *Tree) Max() (_ btree.Item, err error) {
+	return t.edge(false)
+}
+
+// edgeは、木の左端（first）または右端の項目を返します。
+func (t *Tree) edge(first bool) (_ btree.Item, err error) {
+	if err = t.check(); err != nil {
+		return nil, err
+	}
+	defer t.catch(&err, false)
+	if t.root == 0 {
+		return nil, nil
+	}
+	n := t.p.get(t.root)
+	for !n.leaf() {
+		if first {
+			n = t.p.get(n.children[0])
+		} else {
+			n = t.p.get(n.children[len(n.children)-1])
+		}
+	}
+	if first {
+		return n.items[0].item, nil
+	}
+	return n.items[len(n.items)-1].item, nil
+}
+
+// ReplaceOrInsertは、与えられたアイテムを木に追加する。木の中のアイテムがすでに与えられたものと等しい場合は、置き換えてそれを返す。そうでない場合はnilを返す。
+// 符号化した項目がMaxItemSizeより大きい場合は、ErrKeyTooLargeを包んだエラーを返します。nilは木に追加できません（パニックになります）。
+func (t *Tree) ReplaceOrInsert(item btree.Item) (_ btree.Item, err error) {
+	if item == nil {
+		panic("nil item being added to disk.Tree")
+	}
+	if err = t.check(); err != nil {
+		return nil, err
+	}
+	e, err := t.encode(item)
+	if err != nil {
+		return nil, err
+	}
+	t.beginWrite()
+	defer t.endWrite(&err)
+	defer t.catch(&err, true)
+	if t.root == 0 {
+		n := t.p.alloc()
+		n.items = append(n.items, e)
+		t.root = n.id
+		t.length++
+		return nil, nil
+	}
+	root := t.p.get(t.root)
+	if len(root.items) >= t.maxItems() {
+		mid, second := t.split(root, t.maxItems()/2)
+		n := t.p.alloc()
+		n.items = append(n.items, mid)
+		n.children = append(n.children, root.id, second.id)
+		t.root = n.id
+		root = n
+	}
+	out, found := t.insert(root, e)
+	if !found {
+		t.length++
+		return nil, nil
+	}
+	return out.item, nil
+}
+
+// splitは、ノードnを与えられたインデックスで分割します。インデックスiの項目と、それ以降の項目/子を持つ新しいノードを返します。
+func (t *Tree) split(n *node, i int) (entry, *node) {
+	item := n.items[i]
+	next := t.p.alloc()
+	next.items = append(next.items, n.items[i+1:]...)
+	n.items = append([]entry(nil), n.items[:i]...)
+	if !n.leaf() {
+		next.children = append(next.children, n.children[i+1:]...)
+		n.children = append([]uint64(nil), n.children[:i+1]...)
+	}
+	n.dirty = true
+	return item, next
+}
+
+// maybeSplitChildは、ノードnの子iが満杯であれば分割し、分割したかどうかを返します。
+func (t *Tree) maybeSplitChild(n *node, i int) bool {
+	child := t.p.get(n.children[i])
+	if len(child.items) < t.maxItems() {
+		return false
+	}
+	item, second := t.split(child, t.maxItems()/2)
+	n.items = append(n.items, entry{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = item
+	n.children = append(n.children, 0)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = second.id
+	n.dirty = true
+	return true
+}
+
+// insertは、ノードnをルートとするサブツリーにeを挿入します。満杯のノードは降りる前に分割されるので、n自身は満杯ではありません。
+func (t *Tree) insert(n *node, e entry) (entry, bool) {
+	i, found := find(n, e.item)
+	if found {
+		out := n.items[i]
+		n.items[i] = e
+		n.dirty = true
+		return out, true
+	}
+	if n.leaf() {
+		n.items = append(n.items, entry{})
+		copy(n.items[i+1:], n.items[i:])
+		n.items[i] = e
+		n.dirty = true
+		return entry{}, false
+	}
+	if t.maybeSplitChild(n, i) {
+		inTree := n.items[i].item
+		switch {
+		case e.item.Less(inTree):
+			// 変更なし、最初の分割ノードが欲しい
+		case inTree.Less(e.item):
+			i++ // 2つ目の分割ノードが欲しい
+		default:
+			out := n.items[i]
+			n.items[i] = e
+			n.dirty = true
+			return out, true
+		}
+	}
+	return t.insert(t.p.get(n.children[i]), e)
+}
+
+// removeの種類です。
+type toRemove int
+
+const (
+	removeItem toRemove = iota // 指定された項目を削除する
+	removeMin                  // サブツリーの最小の項目を削除する
+	removeMax                  // サブツリーの最大の項目を削除する
+)
+
+// Deleteは、渡された項目に等しい項目を木から削除し、それを返す。そのような項目が存在しない場合はnilを返す。
+func (t *Tree) Delete(item btree.Item) (btree.Item, error) {
+	return t.deleteItem(item, removeItem)
+}
+
+// DeleteMinは、木の中の最小の項目を削除し、それを返す。木が空の場合はnilを返す。
+func (t *Tree) DeleteMin() (btree.Item, error) {
+	return t.deleteItem(nil, removeMin)
+}
+
+// DeleteMaxは、木の中の最大の項目を削除し、それを返す。木が空の場合はnilを返す。
+func (t *Tree) DeleteMax() (btree.Item, error) {
+	return t.deleteItem(nil, removeMax)
+}
+
+func (t *Tree) deleteItem(item btree.Item, typ toRemove) (_ btree.Item, err error) {
+	if err = t.check(); err != nil {
+		return nil, err
+	}
+	if t.root == 0 {
+		return nil, nil
+	}
+	t.beginWrite()
+	defer t.endWrite(&err)
+	defer t.catch(&err, true)
+	root := t.p.get(t.root)
+	out, found := t.remove(root, item, typ)
+	if len(root.items) == 0 {
+		if root.leaf() {
+			t.root = 0
+		} else {
+			t.root = root.children[0]
+		}
+		t.p.release(root)
+	}
+	if !found {
+		return nil, nil
+	}
+	t.length--
+	return out.item, nil
+}
+
+// removeは、ノードnをルートとするサブツリーから項目を削除します。
+// 降りる先の子が最小数の項目しか持たない場合は、先に兄弟から借りるか兄弟とマージして、子から項目を削除できるようにします。
+func (t *Tree) remove(n *node, item btree.Item, typ toRemove) (entry, bool) {
+	var i int
+	var found bool
+	switch typ {
+	case removeMax:
+		if n.leaf() {
+			out := n.items[len(n.items)-1]
+			n.items = n.items[:len(n.items)-1]
+			n.dirty = true
+			return out, true
+		}
+		i = len(n.items)
+	case removeMin:
+		if n.leaf() {
+			out := n.items[0]
+			n.items = append(n.items[:0], n.items[1:]...)
+			n.dirty = true
+			return out, true
+		}
+		i = 0
+	case removeItem:
+		i, found = find(n, item)
+		if n.leaf() {
+			if !found {
+				return entry{}, false
+			}
+			out := n.items[i]
+			n.items = append(n.items[:i], n.items[i+1:]...)
+			n.dirty = true
+			return out, true
+		}
+	}
+	child := t.p.get(n.children[i])
+	if len(child.items) <= t.minItems() {
+		t.growChild(n, i)
+		return t.remove(n, item, typ)
+	}
+	if found {
+		// 項目をこのノードから取り除き、代わりに左の子の最大の項目を置く。
+		out := n.items[i]
+		n.items[i], _ = t.remove(child, nil, removeMax)
+		n.dirty = true
+		return out, true
+	}
+	return t.remove(child, item, typ)
+}
+
+// growChildは、ノードnの子iが最小数より多くの項目を持つように、左右の兄弟から項目を借りるか、兄弟とマージします。
+func (t *Tree) growChild(n *node, i int) {
+	child := t.p.get(n.children[i])
+	if i > 0 {
+		if left := t.p.get(n.children[i-1]); len(left.items) > t.minItems() {
+			// 左から借りる
+			child.items = append([]entry{n.items[i-1]}, child.items...)
+			n.items[i-1] = left.items[len(left.items)-1]
+			left.items = left.items[:len(left.items)-1]
+			if !left.leaf() {
+				child.children = append([]uint64{left.children[len(left.children)-1]}, child.children...)
+				left.children = left.children[:len(left.children)-1]
+			}
+			n.dirty, child.dirty, left.dirty = true, true, true
+			return
+		}
+	}
+	if i < len(n.items) {
+		if right := t.p.get(n.children[i+1]); len(right.items) > t.minItems() {
+			// 右から借りる
+			child.items = append(child.items, n.items[i])
+			n.items[i] = right.items[0]
+			right.items = append(right.items[:0], right.items[1:]...)
+			if !right.leaf() {
+				child.children = append(child.children, right.children[0])
+				right.children = append(right.children[:0], right.children[1:]...)
+			}
+			n.dirty, child.dirty, right.dirty = true, true, true
+			return
+		}
+	}
+	// 右隣とマージする（一番右の子なら左隣とマージする）。
+	if i >= len(n.items) {
+		i--
+	}
+	child = t.p.get(n.children[i])
+	merge := t.p.get(n.children[i+1])
+	child.items = append(child.items, n.items[i])
+	child.items = append(child.items, merge.items...)
+	child.children = append(child.children, merge.children...)
+	n.items = append(n.items[:i], n.items[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+	n.dirty, child.dirty = true, true
+	t.p.release(merge)
+}
+
+// iterateは、ノードidをルートとするサブツリーのうち、昇順では[start, stop)、降順では(stop, start]の範囲の項目を順にiteratorへ渡します。
+// 範囲外の項目に達するかiteratorがfalseを返した場合はfalseを返します。
+func (t *Tree) iterate(id uint64, ascending bool, start, stop btree.Item, iterator btree.ItemIterator) bool {
+	n := t.p.get(id)
+	if ascending {
+		i := 0
+		if start != nil {
+			i = sort.Search(len(n.items), func(i int) bool { return !n.items[i].item.Less(start) })
+		}
+		for ; i < len(n.items); i++ {
+			if !n.leaf() && !t.iterate(n.children[i], ascending, start, stop, iterator) {
+				return false
+			}
+			item := n.items[i].item
+			if stop != nil && !item.Less(stop) {
+				return false
+			}
+			if !iterator(item) {
+				return false
+			}
+		}
+		return n.leaf() || t.iterate(n.children[len(n.children)-1], ascending, start, stop, iterator)
+	}
+	i := len(n.items) - 1
+	if start != nil {
+		i = sort.Search(len(n.items), func(i int) bool { return start.Less(n.items[i].item) }) - 1
+	}
+	if !n.leaf() && !t.iterate(n.children[i+1], ascending, start, stop, iterator) {
+		return false
+	}
+	for ; i >= 0; i-- {
+		item := n.items[i].item
+		if stop != nil && !stop.Less(item) {
+			return false
+		}
+		if !iterator(item) {
+			return false
+		}
+		if !n.leaf() && !t.iterate(n.children[i], ascending, start, stop, iterator) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanは、反復処理の公開メソッドの共通の入り口です。
+func (t *Tree) scan(ascending bool, start, stop btree.Item, iterator btree.ItemIterator) (err error) {
+	if err = t.check(); err != nil {
+		return err
+	}
+	if t.root == 0 {
+		return nil
+	}
+	defer t.catch(&err, false)
+	t.iterate(t.root, ascending, start, stop, iterator)
+	return nil
+}
+
+// AscendRangeは、木の中の[greaterOrEqual, lessThan)の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+// nilの境界は「境界なし」を意味します。反復処理中に木を変更してはいけません。
+func (t *Tree) AscendRange(greaterOrEqual, lessThan btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(true, greaterOrEqual, lessThan, iterator)
+}
+
+// AscendLessThanは、[first, pivot)の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) AscendLessThan(pivot btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(true, nil, pivot, iterator)
+}
+
+// AscendGreaterOrEqualは、[pivot, last]の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) AscendGreaterOrEqual(pivot btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(true, pivot, nil, iterator)
+}
+
+// Ascendは、[first, last]の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) Ascend(iterator btree.ItemIterator) error {
+	return t.scan(true, nil, nil, iterator)
+}
+
+// DescendRangeは、[lessOrEqual, greaterThan)の範囲内の値について、降順にiteratorがfalseを返すまでiteratorを呼び出します。
+// nilの境界は「境界なし」を意味します。
+func (t *Tree) DescendRange(lessOrEqual, greaterThan btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(false, lessOrEqual, greaterThan, iterator)
+}
+
+// DescendLessOrEqualは、[pivot, first]の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) DescendLessOrEqual(pivot btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(false, pivot, nil, iterator)
+}
+
+// DescendGreaterThanは、[last, pivot)の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) DescendGreaterThan(pivot btree.Item, iterator btree.ItemIterator) error {
+	return t.scan(false, nil, pivot, iterator)
+}
+
+// Descendは、[last, first]の範囲内の値について、iteratorがfalseを返すまでiteratorを呼び出します。
+func (t *Tree) Descend(iterator btree.ItemIterator) error {
+	return t.scan(false, nil, nil, iterator)
+}
@@ -0,0 +1,248 @@
+package disk
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/seipan/btree/btree"
+)
+
+// openTestは、テスト用の一時ディレクトリにファイルを作り、キャッシュの小さい木を開きます。
+// キャッシュを小さくして、ノードの追い出しと読み直しが頻繁に起きるようにします。
+func openTest(t *testing.T, path string) *Tree {
+	t.Helper()
+	tr, err := OpenFileWithOptions(path, Options{Degree: 3, Codec: IntCodec{}, PageSize: minPageSize, CachePages: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// contentsは、木の項目を昇順に読み出します。
+func contents(t *testing.T, tr *Tree) []int {
+	t.Helper()
+	var out []int
+	if err := tr.Ascend(func(i btree.Item) bool {
+		out = append(out, int(i.(btree.Int)))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// sortedKeysは、モデルのキーを昇順に返します。
+func sortedKeys(model map[int]bool) []int {
+	keys := make([]int, 0, len(model))
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// verifyは、木の項目と項目数がモデルと一致することを確かめます。
+func verify(t *testing.T, tr *Tree, model map[int]bool) {
+	t.Helper()
+	got, want := contents(t, tr), sortedKeys(model)
+	if len(got) != len(want) || tr.Len() != len(want) {
+		t.Fatalf("tree has %d items (Len %d), model has %d", len(got), tr.Len(), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("item %d = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTreeMatchesMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr := openTest(t, path)
+	model := map[int]bool{}
+	r := rand.New(rand.NewSource(1))
+	for step := 0; step < 20000; step++ {
+		k := r.Intn(2000)
+		switch op := r.Intn(10); {
+		case op < 5:
+			old, err := tr.ReplaceOrInsert(btree.Int(k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (old != nil) != model[k] {
+				t.Fatalf("step %d: ReplaceOrInsert(%d) returned %v, model has it: %v", step, k, old, model[k])
+			}
+			model[k] = true
+		case op < 8:
+			old, err := tr.Delete(btree.Int(k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (old != nil) != model[k] {
+				t.Fatalf("step %d: Delete(%d) returned %v, model has it: %v", step, k, old, model[k])
+			}
+			delete(model, k)
+		case op == 8:
+			ok, err := tr.Has(btree.Int(k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != model[k] {
+				t.Fatalf("step %d: Has(%d) = %v, want %v", step, k, ok, model[k])
+			}
+		default:
+			del, first := tr.DeleteMin, true
+			if r.Intn(2) == 0 {
+				del, first = tr.DeleteMax, false
+			}
+			old, err := del()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := sortedKeys(model)
+			if len(keys) == 0 {
+				if old != nil {
+					t.Fatalf("step %d: delete from an empty tree returned %v", step, old)
+				}
+				break
+			}
+			want := keys[len(keys)-1]
+			if first {
+				want = keys[0]
+			}
+			if old != btree.Int(want) {
+				t.Fatalf("step %d: DeleteMin/DeleteMax (first=%v) returned %v, want %d", step, first, old, want)
+			}
+			delete(model, want)
+		}
+		if step%2500 == 2499 {
+			verify(t, tr, model)
+			// 閉じて開き直し、ファイルに書かれた内容が同じであることを確かめる。
+			if err := tr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			report, err := CheckFile(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || !report.Complete {
+				t.Fatalf("step %d: CheckFile found problems in a closed file: %+v", step, report)
+			}
+			tr = openTest(t, path)
+			verify(t, tr, model)
+		}
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDescendRangeMatchesMap(t *testing.T) {
+	tr := openTest(t, filepath.Join(t.TempDir(), "tree"))
+	defer tr.Close()
+	model := map[int]bool{}
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		k := r.Intn(1000)
+		if _, err := tr.ReplaceOrInsert(btree.Int(k)); err != nil {
+			t.Fatal(err)
+		}
+		model[k] = true
+	}
+	keys := sortedKeys(model)
+	for n := 0; n < 100; n++ {
+		hi, lo := r.Intn(1000), r.Intn(1000)
+		var got, want []int
+		if err := tr.DescendRange(btree.Int(hi), btree.Int(lo), func(i btree.Item) bool {
+			got = append(got, int(i.(btree.Int)))
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i] <= hi && keys[i] > lo {
+				want = append(want, keys[i])
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("DescendRange(%d, %d) returned %d items, want %d", hi, lo, len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("DescendRange(%d, %d) item %d = %d, want %d", hi, lo, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// TestReopenAfterCrashは、Syncの後に書き込んでからSyncもCloseもせずにファイルを閉じた（クラッシュした）場合に、
+// 開き直すとSyncした時点の内容が読めることを確かめます。
+func TestReopenAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr, err := OpenFileWithOptions(path, Options{Degree: 3, Codec: IntCodec{}, CachePages: 1 << 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		if _, err := tr.ReplaceOrInsert(btree.Int(i)); err != nil {
+			t.Fatal(err)
+		}
+		model[i] = true
+	}
+	if err := tr.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// キャッシュに収まる挿入だけなので、Sync後の変更はファイルに書かれないまま失われる。
+	for i := 1000; i < 2000; i++ {
+		if _, err := tr.ReplaceOrInsert(btree.Int(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr.p.f.Close()
+
+	tr, err = OpenFileWithOptions(path, Options{Codec: IntCodec{}, CheckOnOpen: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if r := tr.CheckReport(); r == nil || r.Fatal() {
+		t.Fatalf("CheckOnOpen after a crash reported %+v", r)
+	}
+	verify(t, tr, model)
+}
+
+func TestOpenFileOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr, err := OpenFile(path, 4, IntCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Close(); !errors.Is(err, btree.ErrClosed) {
+		t.Fatalf("second Close = %v, want ErrClosed", err)
+	}
+	if _, err := OpenFile(path, 5, IntCodec{}); err == nil {
+		t.Fatal("opening a degree 4 file with degree 5 succeeded")
+	}
+	if _, err := OpenFileWithOptions(path, Options{Codec: IntCodec{}, PageSize: 8192}); err == nil {
+		t.Fatal("opening a 4096-byte page file with 8192-byte pages succeeded")
+	}
+	h, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Degree != 4 || h.PageSize != DefaultPageSize || h.Length != 0 {
+		t.Fatalf("ReadHeader = %+v", h)
+	}
+	if _, err := MaxItemSize(1, DefaultPageSize); err == nil {
+		t.Fatal("MaxItemSize accepted degree 1")
+	}
+	if _, err := MaxItemSize(400, minPageSize); err == nil {
+		t.Fatal("MaxItemSize accepted a degree that does not fit a page")
+	}
+}
@@ -0,0 +1,48 @@
+package disk
+
+import (
+	"container/list"
+	"errors"
+	"os"
+)
+
+// Headerは、ファイルのメタページに記録されている情報です。
+type Header struct {
+	Version     int   // ファイル形式のバージョン
+	PageSize    int   // ページの大きさ（バイト）
+	Degree      int   // 木のdegree
+	Pages       int64 // ページの数（メタページと空きページを含む）
+	Length      int   // 項目の数
+	MaxItemSize int   // 符号化した1項目の大きさの上限
+}
+
+// ReadHeaderは、pathのファイルを読み取り専用で開き、メタページを検証してその内容を返します。ファイルには書き込みません。
+func ReadHeader(path string) (Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Header{}, err
+	}
+	if fi.Size() == 0 {
+		return Header{}, errors.New("disk: empty file")
+	}
+	t := &Tree{p: &pager{f: f, cache: make(map[uint64]*node), lru: list.New(), npages: 1}}
+	if err := t.readMeta(fi.Size(), Options{}); err != nil {
+		return Header{}, err
+	}
+	if err := t.init(); err != nil {
+		return Header{}, err
+	}
+	return Header{
+		Version:     FormatVersion,
+		PageSize:    t.p.pageSize,
+		Degree:      t.degree,
+		Pages:       int64(t.p.npages),
+		Length:      t.length,
+		MaxItemSize: t.maxItem,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package disk
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"github.com/seipan/btree/btree"
+)
+
+// ページの種類です。ページの先頭1バイトに書かれます。
+const (
+	kindLeaf     byte = 1
+	kindInternal byte = 2
+	kindFree     byte = 3
+)
+
+// nodeHeaderSizeは、ノードページの先頭の種類（1バイト）と項目数（2バイト）の大きさです。
+const nodeHeaderSize = 3
+
+// checksumSizeは、各ページの末尾に置くCRC32の大きさです。
+const checksumSize = 4
+
+type (
+	// entryは、ノードに保持される項目と、それをCodecで符号化したバイト列です。
+	entry struct {
+		item btree.Item
+		raw  []byte
+	}
+
+	// nodeは、1ページに対応するノードをデコードしたものです。childrenが空のノードは葉です。
+	node struct {
+		id       uint64
+		items    []entry
+		children []uint64
+		dirty    bool
+		elem     *list.Element
+	}
+
+	// failureは、ページの読み書きに失敗したことを呼び出し元の公開メソッドまで伝えるためのパニックの値です。
+	// writeは、ディスクへの書き込みに失敗したため木の内容が失われた可能性があることを示します。
+	failure struct {
+		err   error
+		write bool
+	}
+
+	// pagerは、ファイルを固定長のページの並びとして扱い、デコード済みのノードをLRUキャッシュに保持します。
+	// 変更されたノードはキャッシュから追い出されるときかflushのときに書き戻されます。
+	pager struct {
+		f        *os.File
+		codec    Codec
+		pageSize int
+		capacity int
+		cache    map[uint64]*node
+		lru      *list.List // 先頭が最も最近使われたノード
+		// holdがtrueの間は、キャッシュからノードを追い出しません。
+		// 書き込み操作はノードへのポインタを持ったまま変更するので、その間に追い出されると変更が失われるためです。
+		hold     bool
+		npages   uint64 // メタページを含むファイル中のページ数
+		freeHead uint64 // 空きページのリストの先頭。0の場合は空
+		buf      []byte
+	}
+)
+
+// failは、errをfailureとしてパニックします。
+func fail(err error, write bool) {
+	panic(failure{err: err, write: write})
+}
+
+// corruptは、ページidの破損をCorruptionErrorとしてパニックします。
+func corrupt(id uint64, format string, args ...interface{}) {
+	fail(&btree.CorruptionError{Page: int64(id), Detail: fmt.Sprintf(format, args...)}, false)
+}
+
+func (n *node) leaf() bool {
+	return len(n.children) == 0
+}
+
+// getは、ページidのノードを返します。キャッシュにない場合はファイルから読み込みます。
+func (p *pager) get(id uint64) *node {
+	if n, ok := p.cache[id]; ok {
+		p.lru.MoveToFront(n.elem)
+		return n
+	}
+	if id == 0 || id >= p.npages {
+		corrupt(id, "page out of range (file has %d pages)", p.npages)
+	}
+	p.read(id)
+	n := p.decode(id)
+	p.add(n)
+	return n
+}
+
+// allocは、空きページのリストから（空であればファイルの末尾に）新しいページを割り当て、空のノードを返します。
+func (p *pager) alloc() *node {
+	var id uint64
+	if p.freeHead != 0 {
+		id = p.freeHead
+		p.read(id)
+		if p.buf[0] != kindFree {
+			corrupt(id, "page on the free list has kind %d", p.buf[0])
+		}
+		p.freeHead = binary.LittleEndian.Uint64(p.buf[1:])
+	} else {
+		id = p.npages
+		p.npages++
+	}
+	n := &node{id: id, dirty: true}
+	p.add(n)
+	return n
+}
+
+// releaseは、ノードnのページを空きページのリストに戻します。
+func (p *pager) release(n *node) {
+	p.lru.Remove(n.elem)
+	delete(p.cache, n.id)
+	for i := range p.buf {
+		p.buf[i] = 0
+	}
+	p.buf[0] = kindFree
+	binary.LittleEndian.PutUint64(p.buf[1:], p.freeHead)
+	p.write(n.id)
+	p.freeHead = n.id
+}
+
+// addは、ノードをキャッシュに加え、holdされていなければキャッシュを容量まで縮めます。
+func (p *pager) add(n *node) {
+	n.elem = p.lru.PushFront(n)
+	p.cache[n.id] = n
+	if !p.hold {
+		p.trim()
+	}
+}
+
+// trimは、キャッシュのノード数が容量を超えている間、最も古いノードを（変更されていれば書き戻してから）追い出します。
+func (p *pager) trim() {
+	for len(p.cache) > p.capacity {
+		n := p.lru.Back().Value.(*node)
+		if n.dirty {
+			p.writeNode(n)
+		}
+		p.lru.Remove(n.elem)
+		delete(p.cache, n.id)
+	}
+}
+
+// flushは、変更されたノードをすべて書き戻します。
+func (p *pager) flush() {
+	for _, n := range p.cache {
+		if n.dirty {
+			p.writeNode(n)
+		}
+	}
+}
+
+// readは、ページidをbufに読み込み、チェックサムを検証します。
+func (p *pager) read(id uint64) {
+	if _, err := p.f.ReadAt(p.buf, int64(id)*int64(p.pageSize)); err != nil {
+		fail(fmt.Errorf("disk: read page %d: %w", id, err), false)
+	}
+	sum := binary.LittleEndian.Uint32(p.buf[p.pageSize-checksumSize:])
+	if crc32.ChecksumIEEE(p.buf[:p.pageSize-checksumSize]) != sum {
+		corrupt(id, "checksum mismatch")
+	}
+}
+
+// writeは、bufにチェックサムを付けてページidに書き込みます。
+func (p *pager) write(id uint64) {
+	binary.LittleEndian.PutUint32(p.buf[p.pageSize-checksumSize:], crc32.ChecksumIEEE(p.buf[:p.pageSize-checksumSize]))
+	if _, err := p.f.WriteAt(p.buf, int64(id)*int64(p.pageSize)); err != nil {
+		fail(fmt.Errorf("disk: write page %d: %w", id, err), true)
+	}
+}
+
+// writeNodeは、ノードnをエンコードしてそのページに書き込みます。
+func (p *pager) writeNode(n *node) {
+	for i := range p.buf {
+		p.buf[i] = 0
+	}
+	p.buf[0] = kindLeaf
+	if !n.leaf() {
+		p.buf[0] = kindInternal
+	}
+	binary.LittleEndian.PutUint16(p.buf[1:], uint16(len(n.items)))
+	off := nodeHeaderSize
+	for _, c := range n.children {
+		binary.LittleEndian.PutUint64(p.buf[off:], c)
+		off += 8
+	}
+	limit := p.pageSize - checksumSize
+	for _, e := range n.items {
+		if off+uvarintLen(uint64(len(e.raw)))+len(e.raw) > limit {
+			// 項目の大きさはReplaceOrInsertで検査しているので、ここに来るのはバグです。
+			panic(fmt.Sprintf("disk: node %d does not fit in a page", n.id))
+		}
+		off += binary.PutUvarint(p.buf[off:], uint64(len(e.raw)))
+		off += copy(p.buf[off:], e.raw)
+	}
+	p.write(n.id)
+	n.dirty = false
+}
+
+// decodeは、bufに読み込まれたページidをノードにデコードします。
+func (p *pager) decode(id uint64) *node {
+	b := p.buf[:p.pageSize-checksumSize]
+	kind := b[0]
+	if kind != kindLeaf && kind != kindInternal {
+		corrupt(id, "unexpected page kind %d", kind)
+	}
+	count := int(binary.LittleEndian.Uint16(b[1:]))
+	n := &node{id: id, items: make([]entry, 0, count)}
+	off := nodeHeaderSize
+	if kind == kindInternal {
+		if off+(count+1)*8 > len(b) {
+			corrupt(id, "%d children do not fit in a page", count+1)
+		}
+		n.children = make([]uint64, count+1)
+		for i := range n.children {
+			n.children[i] = binary.LittleEndian.Uint64(b[off:])
+			off += 8
+		}
+	}
+	for i := 0; i < count; i++ {
+		l, w := binary.Uvarint(b[off:])
+		if w <= 0 || l > uint64(len(b)-off-w) {
+			corrupt(id, "item %d has a bad length", i)
+		}
+		off += w
+		raw := append([]byte(nil), b[off:off+int(l)]...)
+		off += int(l)
+		item, err := p.codec.Decode(raw)
+		if err != nil {
+			corrupt(id, "item %d: %v", i, err)
+		}
+		n.items = append(n.items, entry{item: item, raw: raw})
+	}
+	return n
+}
+
+// uvarintLenは、vをuvarintで符号化したときのバイト数を返します。
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,172 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seipan/btree/btree"
+)
+
+// fillは、0からn-1までの整数を木に入れます。
+func fill(t *testing.T, tr *Tree, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := tr.ReplaceOrInsert(btree.Int(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// flipは、ファイルのページidの先頭からoff番目のバイトを反転させます。
+func flip(t *testing.T, path string, pageSize int, id uint64, off int) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	pos := int64(id)*int64(pageSize) + int64(off)
+	if _, err := f.ReadAt(b, pos); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, pos); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFreedPagesAreReused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr := openTest(t, path)
+	fill(t, tr, 2000)
+	if err := tr.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	pages := tr.p.npages
+	for i := 0; i < 2000; i++ {
+		if _, err := tr.Delete(btree.Int(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tr.p.freeHead == 0 {
+		t.Fatal("deleting every item left the free list empty")
+	}
+	fill(t, tr, 2000)
+	if tr.p.npages != pages {
+		t.Fatalf("refilling the tree grew the file from %d to %d pages", pages, tr.p.npages)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := CheckFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("CheckFile after reusing pages: %+v", report.Findings)
+	}
+}
+
+// TestReadCorruptPageは、チェックサムの合わないページを読むとCorruptionErrorを返し、読み取りでは木を汚染しないことを確かめます。
+func TestReadCorruptPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr := openTest(t, path)
+	fill(t, tr, 500)
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tr = openTest(t, path)
+	defer tr.Close()
+	// 根のページを壊すと、どの項目の探索も最初に失敗する。
+	flip(t, path, minPageSize, tr.root, nodeHeaderSize)
+	_, err := tr.Get(btree.Int(1))
+	var ce *btree.CorruptionError
+	if !errors.As(err, &ce) || ce.Page != int64(tr.root) {
+		t.Fatalf("Get from a corrupt root = %v, want a CorruptionError for page %d", err, tr.root)
+	}
+	if !errors.Is(err, btree.ErrCorrupted) {
+		t.Fatalf("CorruptionError %v does not match ErrCorrupted", err)
+	}
+	if tr.Err() != nil {
+		t.Fatalf("a failed read poisoned the tree: %v", tr.Err())
+	}
+}
+
+// TestWriteFailurePoisonsは、ディスクへの書き込みに失敗した木が汚染され、以降の操作がErrPoisonedを返すことを確かめます。
+func TestWriteFailurePoisons(t *testing.T) {
+	tr := openTest(t, filepath.Join(t.TempDir(), "tree"))
+	fill(t, tr, 100)
+	// ファイルを閉じると、キャッシュからの追い出しやSyncでの書き込みが失敗する。
+	tr.p.f.Close()
+	if err := tr.Sync(); err == nil {
+		t.Fatal("Sync to a closed file succeeded")
+	}
+	if _, err := tr.ReplaceOrInsert(btree.Int(1000)); !errors.Is(err, btree.ErrPoisoned) {
+		t.Fatalf("ReplaceOrInsert after a failed write = %v, want ErrPoisoned", err)
+	}
+	if _, err := tr.Get(btree.Int(1)); !errors.Is(err, btree.ErrPoisoned) {
+		t.Fatalf("Get after a failed write = %v, want ErrPoisoned", err)
+	}
+	var pe *btree.PoisonedError
+	if !errors.As(tr.Err(), &pe) {
+		t.Fatalf("Err() = %v, want a PoisonedError", tr.Err())
+	}
+}
+
+// blobは、符号化した大きさを自由に決められるテスト用の項目です。
+type blob string
+
+func (a blob) Less(b btree.Item) bool { return a < b.(blob) }
+
+type blobCodec struct{}
+
+func (blobCodec) Encode(item btree.Item) ([]byte, error) { return []byte(item.(blob)), nil }
+
+func (blobCodec) Decode(data []byte) (btree.Item, error) { return blob(data), nil }
+
+func TestItemTooLarge(t *testing.T) {
+	tr, err := OpenFileWithOptions(filepath.Join(t.TempDir(), "tree"), Options{Degree: 3, Codec: blobCodec{}, PageSize: minPageSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	big := make([]byte, tr.MaxItemSize()+1)
+	if _, err := tr.ReplaceOrInsert(blob(big)); !errors.Is(err, btree.ErrKeyTooLarge) {
+		t.Fatalf("inserting %d bytes = %v, want ErrKeyTooLarge", len(big), err)
+	}
+	if _, err := tr.ReplaceOrInsert(blob(big[1:])); err != nil {
+		t.Fatalf("inserting MaxItemSize bytes: %v", err)
+	}
+	if tr.Err() != nil {
+		t.Fatalf("a rejected item poisoned the tree: %v", tr.Err())
+	}
+}
+
+// TestConfigureCachePagesは、ConfigureでCachePagesを変えるとキャッシュがすぐに縮み、ゼロ値や不正な値のPatchでは変わらないことを確かめます。
+func TestConfigureCachePages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	tr := openTest(t, path)
+	defer tr.Close()
+	fill(t, tr, 500)
+	if err := tr.Configure(Patch{CachePages: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if tr.p.capacity != 2 || len(tr.p.cache) > 2 {
+		t.Fatalf("after Configure(CachePages: 2) capacity=%d, cached=%d", tr.p.capacity, len(tr.p.cache))
+	}
+	if err := tr.Configure(Patch{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Configure(Patch{CachePages: -1}); err == nil {
+		t.Fatal("Configure accepted a negative CachePages")
+	}
+	if tr.p.capacity != 2 {
+		t.Fatalf("an empty or rejected Patch changed the capacity to %d", tr.p.capacity)
+	}
+	if got := contents(t, tr); len(got) != 500 {
+		t.Fatalf("tree has %d items after shrinking the cache, want 500", len(got))
+	}
+}
@@ -0,0 +1,93 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// このパッケージのエラーはすべて以下のいずれかを%wで包んで返すので、呼び出し元はerrors.Isで分岐できます。
+var (
+	// ErrClosedは、閉じられた木やストアに対して操作が行われたことを示します。
+	ErrClosed = errors.New("btree: closed")
+	// ErrReadOnlyは、読み取り専用の木やトランザクションに書き込もうとしたことを示します。
+	ErrReadOnly = errors.New("btree: read-only")
+	// ErrConflictは、並行する書き込みと衝突したため操作が適用されなかったことを示します。
+	ErrConflict = errors.New("btree: conflict")
+	// ErrCorruptedは、木の構造や保存されたデータが壊れていることを示します。詳細はCorruptionErrorで得られます。
+	ErrCorrupted = errors.New("btree: corrupted")
+	// ErrKeyTooLargeは、キーや値が1ノード（ページ）に収まらないことを示します。
+	ErrKeyTooLarge = errors.New("btree: key too large")
+	// ErrTxTooBigは、トランザクションが許容される大きさを超えたことを示します。
+	ErrTxTooBig = errors.New("btree: transaction too big")
+	// ErrInternalは、木の内部でパニックが発生したことを示します。詳細はInternalErrorで得られます。
+	ErrInternal = errors.New("btree: internal error")
+	// ErrPoisonedは、木が汚染されているため操作が拒否されたことを示します。詳細はPoisonedErrorで得られます。
+	ErrPoisoned = errors.New("btree: tree is poisoned")
+)
+
+// CorruptionErrorは、壊れた構造を見つけた場所と内容を表します。
+// errors.Is(err, ErrCorrupted) はCorruptionErrorに対してtrueを返します。
+type CorruptionError struct {
+	Page   int64 // 壊れていたページ番号。ページを持たないメモリ上の木では-1
+	Detail string
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Page < 0 {
+		return fmt.Sprintf("%v: %s", ErrCorrupted, e.Detail)
+	}
+	return fmt.Sprintf("%v: page %d: %s", ErrCorrupted, e.Page, e.Detail)
+}
+
+// Isは、targetがErrCorruptedの場合にtrueを返します。
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// corruptedは、メモリ上の木で見つかった構造の破損をCorruptionErrorとして返します。
+func corrupted(format string, args ...interface{}) error {
+	return &CorruptionError{Page: -1, Detail: fmt.Sprintf(format, args...)}
+}
+
+// InternalErrorは、RecoverPanicsが有効な木で回復されたパニックを表します。
+// errors.Is(err, ErrInternal) はInternalErrorに対してtrueを返します。
+type InternalError struct {
+	Op    string      // パニックが発生した操作
+	Value interface{} // recoverが返した値
+	Stack []byte      // パニック時のスタックトレース
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("%v: panic in %s: %v", ErrInternal, e.Op, e.Value)
+}
+
+// Isは、targetがErrInternalの場合にtrueを返します。
+func (e *InternalError) Is(target error) bool {
+	return target == ErrInternal
+}
+
+// Unwrapは、パニックの値がerrorであればそれを返します。
+func (e *InternalError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// PoisonedErrorは、内部のパニックや不変条件の違反によって木が汚染されたことを表します。
+// errors.Is(err, ErrPoisoned) はtrueを返し、Unwrapで汚染の原因を得られます。
+type PoisonedError struct {
+	Cause error
+}
+
+func (e *PoisonedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPoisoned, e.Cause)
+}
+
+// Isは、targetがErrPoisonedの場合にtrueを返します。
+func (e *PoisonedError) Is(target error) bool {
+	return target == ErrPoisoned
+}
+
+// Unwrapは、汚染の原因を返します。
+func (e *PoisonedError) Unwrap() error {
+	return e.Cause
+}
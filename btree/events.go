@@ -0,0 +1,99 @@
+package btree
+
+import "time"
+
+type (
+	// Eventは、RecentEventsが返す1つの書き込みの記録です。
+	Event struct {
+		// Timeは、書き込みを始めた時刻です。
+		Time time.Time
+		// Opは、書き込みを行ったメソッドの名前です（"ReplaceOrInsert"、"Delete"、"Clear"など）。
+		Op string
+		// Durationは、書き込みにかかった時間です。
+		Duration time.Duration
+		// Splitsは、満杯のノードを分割した回数です。
+		Splits int
+		// Mergesは、項目の少ないノードを兄弟と併合した回数です。
+		Merges int
+		// Stealsは、項目の少ないノードが兄弟から項目を借りた回数です。
+		Steals int
+		// Copiesは、Cloneした木と共有していたためにコピーオンライトで複製したノードの数です。
+		Copies int
+	}
+
+	// eventLogは、RecordEventsで記録を始めた木のイベントのリングバッファです。
+	eventLog struct {
+		ring []Event
+		// startは、ringの中で最も古いイベントの位置です。
+		start int
+		slow  time.Duration
+		// countsは、進行中の書き込みでの構造の変化の回数です。木のコピーオンライトのコンテキストから参照されます。
+		counts structCounts
+	}
+
+	// structCountsは、1回の書き込みの間のノードの分割、併合、借り入れ、複製の回数です。
+	structCounts struct {
+		splits, merges, steals, copies int
+	}
+)
+
+// RecordEventsは、木の構造を変えた書き込み（ノードの分割、併合、兄弟からの借り入れ、コピーオンライトの複製を伴うもの）と、
+// slow以上かかった書き込みを、新しいものからcapacity個まで記録し始めます。記録はRecentEventsで読めます。
+// slowが0以下の場合は、構造を変えた書き込みだけを記録します。
+// すでに記録している場合は、それまでの記録を捨てて記録し直します。capacityが0以下の場合は記録をやめます。
+//
+// 「なぜこの書き込みは50msかかったのか」を、遅延の急増と時刻を突き合わせて調べるためのものです。
+// 記録している間は書き込みごとに時刻を2回読みます。Cloneした木には引き継がれません。
+func (t *BTreeG[T]) RecordEvents(capacity int, slow time.Duration) {
+	if capacity <= 0 {
+		t.events, t.cow.counts = nil, nil
+		return
+	}
+	t.events = &eventLog{ring: make([]Event, 0, capacity), slow: slow}
+}
+
+// RecentEventsは、RecordEventsで記録したイベントのコピーを古い順に返します。記録していない場合はnilを返します。
+func (t *BTreeG[T]) RecentEvents() []Event {
+	if t.events == nil {
+		return nil
+	}
+	l := t.events
+	out := make([]Event, 0, len(l.ring))
+	out = append(out, l.ring[l.start:]...)
+	return append(out, l.ring[:l.start]...)
+}
+
+// beginEventは、記録している木の書き込みの始めに、構造の変化の回数を0にしてコピーオンライトのコンテキストから数えられるようにし、開始時刻を返します。
+// トランザクションのCommitで木のコンテキストが入れ替わるので、書き込みのたびに結び付け直します。
+func (t *BTreeG[T]) beginEvent() time.Time {
+	l := t.events
+	l.counts = structCounts{}
+	t.cow.counts = &l.counts
+	return time.Now()
+}
+
+// endは、書き込みの終わりに遅延呼び出しされ、構造が変わったかslow以上かかった場合にイベントを記録します。
+func (l *eventLog) end(op string, start time.Time) {
+	d := time.Since(start)
+	c := l.counts
+	if c == (structCounts{}) && (l.slow <= 0 || d < l.slow) {
+		return
+	}
+	e := Event{Time: start, Op: op, Duration: d, Splits: c.splits, Merges: c.merges, Steals: c.steals, Copies: c.copies}
+	if len(l.ring) < cap(l.ring) {
+		l.ring = append(l.ring, e)
+		return
+	}
+	l.ring[l.start] = e
+	l.start = (l.start + 1) % len(l.ring)
+}
+
+// RecordEventsは、構造を変えた書き込みとslow以上かかった書き込みを記録し始めます。詳細はBTreeG.RecordEventsを参照してください。
+func (t *BTree) RecordEvents(capacity int, slow time.Duration) {
+	t.generic().RecordEvents(capacity, slow)
+}
+
+// RecentEventsは、RecordEventsで記録したイベントを古い順に返します。
+func (t *BTree) RecentEvents() []Event {
+	return t.generic().RecentEvents()
+}
@@ -0,0 +1,52 @@
+package btree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecentEventsOps(t *testing.T) {
+	tr := NewG(2, intLess)
+	for i := 0; i < 20; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	// slowを1nsにして、構造が変わらない書き込みも記録させる。
+	tr.RecordEvents(16, time.Nanosecond)
+	tr.Delete(5)
+	tr.DeleteMin()
+	tr.DeleteMax()
+	got := tr.RecentEvents()
+	want := []string{"Delete", "DeleteMin", "DeleteMax"}
+	if len(got) != len(want) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i, e := range got {
+		if e.Op != want[i] {
+			t.Errorf("event %d Op = %q, want %q", i, e.Op, want[i])
+		}
+	}
+}
+
+func TestRecentEventsStructuralOnly(t *testing.T) {
+	tr := NewG(2, intLess)
+	tr.RecordEvents(4, 0)
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	events := tr.RecentEvents()
+	if len(events) != 4 {
+		t.Fatalf("recorded %d events, want the ring to hold 4", len(events))
+	}
+	for i, e := range events {
+		if e.Splits == 0 {
+			t.Errorf("event %d has no splits: %+v", i, e)
+		}
+		if i > 0 && e.Time.Before(events[i-1].Time) {
+			t.Errorf("events are not oldest first at %d", i)
+		}
+	}
+	tr.RecordEvents(0, 0)
+	if tr.RecentEvents() != nil {
+		t.Fatal("RecentEvents after RecordEvents(0, 0) is not nil")
+	}
+}
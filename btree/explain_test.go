@@ -0,0 +1,71 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestExplainCountsMatchScan(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	tr := NewG(4, intLess)
+	for i := 0; i < 3000; i++ {
+		tr.ReplaceOrInsert(r.Intn(10000))
+	}
+	count := func(op RangeOpG[int]) int {
+		n := 0
+		it := func(int) bool { n++; return true }
+		switch {
+		case !op.Descend && op.HasStart && op.HasStop:
+			tr.AscendRange(op.Start, op.Stop, it)
+		case !op.Descend && op.HasStart:
+			tr.AscendGreaterOrEqual(op.Start, it)
+		case !op.Descend && op.HasStop:
+			tr.AscendLessThan(op.Stop, it)
+		case !op.Descend:
+			tr.Ascend(it)
+		case op.HasStart && op.HasStop:
+			tr.DescendRange(op.Start, op.Stop, it)
+		case op.HasStart:
+			tr.DescendLessOrEqual(op.Start, it)
+		case op.HasStop:
+			tr.DescendGreaterThan(op.Stop, it)
+		default:
+			tr.Descend(it)
+		}
+		return n
+	}
+	for i := 0; i < 500; i++ {
+		op := RangeOpG[int]{
+			Descend:  r.Intn(2) == 0,
+			Start:    r.Intn(10000),
+			Stop:     r.Intn(10000),
+			HasStart: r.Intn(4) != 0,
+			HasStop:  r.Intn(4) != 0,
+		}
+		want := count(op)
+		p := tr.Explain(op)
+		if p.RangeItems != want || p.Items != want {
+			t.Fatalf("Explain(%+v) = %d/%d items, scan visits %d", op, p.Items, p.RangeItems, want)
+		}
+		op.Limit = 10
+		if p := tr.Explain(op); p.RangeItems != want || (want > 10 && p.Items != 10) {
+			t.Fatalf("Explain(%+v) = %+v with a limit, scan visits %d", op, p, want)
+		}
+	}
+}
+
+func TestExplainBTreeNilBounds(t *testing.T) {
+	tr := New(3)
+	if p := tr.Explain(RangeOp{}); p.Height != -1 || p.Items != 0 {
+		t.Fatalf("Explain on an empty tree = %+v", p)
+	}
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	if p := tr.Explain(RangeOp{Start: Int(90)}); p.Items != 10 {
+		t.Fatalf("Explain(Start: 90) = %d items, want 10", p.Items)
+	}
+	if p := tr.Explain(RangeOp{Descend: true, Start: Int(9)}); p.Items != 10 {
+		t.Fatalf("Explain(Descend, Start: 9) = %d items, want 10", p.Items)
+	}
+}
@@ -0,0 +1,246 @@
+package btree
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultArenaSlabは、NewWithArenaGが1回にまとめて割り当てるノードの数です。
+const DefaultArenaSlab = 128
+
+type (
+	// FreeListGは、BTreeGのノードのフリーリストです。複数の木の間で安全に共有できます。
+	//
+	// フリーリストは1つ以上のシャードに分かれていて、シャードごとにロックを持ちます。多くのゴルーチンがそれぞれの木で同じフリーリストを共有する場合は、
+	// NewShardedFreeListGでシャードを増やすと、ロックの奪い合いが減ります。
+	//
+	// 各シャードはノードを項目のスライスの容量でクラスに分けて保持し、木の最大項目数に容量が足りるクラスからだけノードを再利用します。
+	// degreeの違う木が同じフリーリストを共有しても、容量の足りないノードを受け取って項目のスライスを割り当て直すことがありません。
+	FreeListG[T any] struct {
+		shards []freeShard[T]
+		// nextは、次に使うシャードを決めるためのカウンタです。
+		next uint32
+		// arenaは、アリーナモードでノードをまとめて割り当てるアロケータです。アリーナモードでない場合はnilです。
+		arena *arena[T]
+	}
+
+	// freeShardは、フリーリストの1つのシャードです。
+	freeShard[T any] struct {
+		mu sync.Mutex
+		// classesは、項目のスライスの容量のクラス（capClass）ごとのノードのリストです。
+		classes [bits.UintSize + 1][]*node[T]
+		size    int
+		limit   int
+		stats   FreeListStats
+		// 隣のシャードとキャッシュラインを共有しないための詰め物。
+		_ [64]byte
+	}
+
+	// arenaは、ノードと項目のスライスをslab個ずつまとめて割り当てます。
+	// 切り出したノードは個別には解放せず、同じスラブのノードがすべて参照されなくなったときにスラブごとGCに回収されます。
+	arena[T any] struct {
+		mu      sync.Mutex
+		slab    int
+		itemCap int
+		nodes   []node[T]
+		items   []T
+		slabs   uint64
+	}
+
+	// FreeListStatsは、フリーリストを共有する木（Cloneで作られた木を含む）のノードの割り当てと解放の回数です。
+	FreeListStats struct {
+		Size       int    // 現在フリーリストにあるノードの数
+		Hits       uint64 // フリーリストから再利用したノードの数
+		Misses     uint64 // フリーリストに再利用できるノードがなく新しく割り当てたノードの数
+		Mismatches uint64 // Missesのうち、フリーリストにノードはあったが容量の足りるクラスが空だった数
+		Stored     uint64 // フリーリストに戻したノードの数
+		Dropped    uint64 // フリーリストが一杯でGCに任せたノードの数
+		Copies     uint64 // 別の木と共有していたためにコピーオンライトで複製したノードの数
+		Slabs      uint64 // アリーナモードでまとめて割り当てたスラブの数
+	}
+)
+
+// NewFreeListGは、最大size個のノードを保持できるフリーリストを作成します。
+func NewFreeListG[T any](size int) *FreeListG[T] {
+	return NewShardedFreeListG[T](1, size)
+}
+
+// NewShardedFreeListGは、shards個のシャードに分かれ、全体で最大size個のノードを保持できるフリーリストを作成します。
+// 多くのゴルーチンが同時にノードを割り当てたり解放したりする場合に、1つのロックを奪い合わないようにするために使います。
+func NewShardedFreeListG[T any](shards, size int) *FreeListG[T] {
+	if shards < 1 {
+		panic("bad shard count")
+	}
+	f := &FreeListG[T]{shards: make([]freeShard[T], shards)}
+	per := (size + shards - 1) / shards
+	for i := range f.shards {
+		f.shards[i].limit = per
+	}
+	return f
+}
+
+// capClassは、容量cのクラスを返します。クラスkには容量が [2^(k-1), 2^k) のノードが入ります。
+func capClass(c int) int {
+	return bits.Len(uint(c))
+}
+
+// takeは、項目のスライスの容量がneed以上のノードを1つ取り出します。そのようなノードがない場合はnilを返します。
+// needのクラスの末尾のノードで足りればそれを使い、足りなければ上のクラスから順に空でないクラスの末尾を使います（上のクラスのノードはどれも足ります）。
+// どちらもなければ、needのクラスの中から足りるノードを探します。needのクラスには、容量の違う木のノードが混ざっていることがあるからです。
+func (s *freeShard[T]) take(need int) *node[T] {
+	c := capClass(need)
+	if l := s.classes[c]; len(l) > 0 && cap(l[len(l)-1].items) >= need {
+		return s.remove(c, len(l)-1)
+	}
+	for k := c + 1; k < len(s.classes); k++ {
+		if l := s.classes[k]; len(l) > 0 {
+			return s.remove(k, len(l)-1)
+		}
+	}
+	l := s.classes[c]
+	for i := len(l) - 2; i >= 0; i-- {
+		if cap(l[i].items) >= need {
+			return s.remove(c, i)
+		}
+	}
+	return nil
+}
+
+// removeは、クラスkのi番目のノードをリストから外して返します。末尾のノードをその位置に移すので、リストの順序は保ちません。
+func (s *freeShard[T]) remove(k, i int) *node[T] {
+	l := s.classes[k]
+	n, last := l[i], len(l)-1
+	l[i], l[last] = l[last], nil
+	s.classes[k] = l[:last]
+	s.size--
+	return n
+}
+
+// newArenaFreeListは、ノードをslab個ずつまとめて割り当てるアリーナモードのフリーリストを作成します。
+// 各ノードの項目のスライスは、itemCap個の容量をスラブから切り出します。
+func newArenaFreeList[T any](size, slab, itemCap int) *FreeListG[T] {
+	f := NewFreeListG[T](size)
+	f.arena = &arena[T]{slab: slab, itemCap: itemCap}
+	return f
+}
+
+// lockは、シャードを1つ選んでロックし、それを返します。ロックされていないシャードを優先して選びます。
+func (f *FreeListG[T]) lock() *freeShard[T] {
+	if len(f.shards) == 1 {
+		s := &f.shards[0]
+		s.mu.Lock()
+		return s
+	}
+	i := int(atomic.AddUint32(&f.next, 1))
+	for j := 0; j < len(f.shards); j++ {
+		s := &f.shards[(i+j)%len(f.shards)]
+		if s.mu.TryLock() {
+			return s
+		}
+	}
+	s := &f.shards[i%len(f.shards)]
+	s.mu.Lock()
+	return s
+}
+
+// newNodeは、項目のスライスの容量がitemCap以上のノードをフリーリストから取り出して返します。
+// 容量の足りるノードがなければ、容量itemCapの項目のスライスを持つノードを新しく割り当てます。
+func (f *FreeListG[T]) newNode(itemCap int) (n *node[T]) {
+	s := f.lock()
+	if n = s.take(itemCap); n != nil {
+		s.stats.Hits++
+		s.mu.Unlock()
+		return n
+	}
+	s.stats.Misses++
+	if s.size > 0 {
+		s.stats.Mismatches++
+	}
+	s.mu.Unlock()
+	if f.arena != nil {
+		return f.arena.alloc()
+	}
+	return &node[T]{items: make(items[T], 0, itemCap)}
+}
+
+// 与えられたノードをリストに追加し、追加された場合はtrueを、破棄された場合はfalseを返す。
+func (f *FreeListG[T]) freeNode(n *node[T]) (out bool) {
+	s := f.lock()
+	defer s.mu.Unlock()
+	if s.size < s.limit {
+		c := capClass(cap(n.items))
+		s.classes[c] = append(s.classes[c], n)
+		s.size++
+		s.stats.Stored++
+		out = true
+	} else {
+		s.stats.Dropped++
+	}
+	return
+}
+
+// countCopyは、コピーオンライトによる複製を1回数えます。
+func (f *FreeListG[T]) countCopy() {
+	s := f.lock()
+	s.stats.Copies++
+	s.mu.Unlock()
+}
+
+// releaseは、フリーリストにあるノードとアリーナの使いかけのスラブを手放し、どの木からも参照されなくなったスラブをGCが回収できるようにします。
+func (f *FreeListG[T]) release() {
+	for i := range f.shards {
+		s := &f.shards[i]
+		s.mu.Lock()
+		for c := range s.classes {
+			s.classes[c] = nil
+		}
+		s.size = 0
+		s.mu.Unlock()
+	}
+	if a := f.arena; a != nil {
+		a.mu.Lock()
+		a.nodes, a.items = nil, nil
+		a.mu.Unlock()
+	}
+}
+
+// Statsは、フリーリストの現在の大きさと、作成されてからの割り当てと解放の回数を返します。シャードに分かれている場合は合計を返します。
+func (f *FreeListG[T]) Stats() FreeListStats {
+	var out FreeListStats
+	for i := range f.shards {
+		s := &f.shards[i]
+		s.mu.Lock()
+		out.Size += s.size
+		out.Hits += s.stats.Hits
+		out.Misses += s.stats.Misses
+		out.Mismatches += s.stats.Mismatches
+		out.Stored += s.stats.Stored
+		out.Dropped += s.stats.Dropped
+		out.Copies += s.stats.Copies
+		s.mu.Unlock()
+	}
+	if a := f.arena; a != nil {
+		a.mu.Lock()
+		out.Slabs = a.slabs
+		a.mu.Unlock()
+	}
+	return out
+}
+
+// allocは、スラブから新しいノードを1つ切り出します。スラブを使い切っていれば、新しいスラブを割り当てます。
+func (a *arena[T]) alloc() *node[T] {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.nodes) == 0 {
+		a.nodes = make([]node[T], a.slab)
+		a.items = make([]T, a.slab*a.itemCap)
+		a.slabs++
+	}
+	n := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+	// 容量を制限しておくので、項目がitemCapを超えた場合は隣のノードの領域ではなく新しい配列に移る。
+	n.items = a.items[:0:a.itemCap]
+	a.items = a.items[a.itemCap:]
+	return n
+}
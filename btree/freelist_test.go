@@ -0,0 +1,125 @@
+package btree
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestFreeListTakeFindsLargerNodes(t *testing.T) {
+	node := func(c int) *node[int] { return &node[int]{items: make(items[int], 0, c)} }
+	for _, tc := range []struct {
+		name string
+		free []int // フリーリストに戻すノードの容量
+		need int
+		want int // 取り出されるノードの容量。0なら取り出せない
+	}{
+		{"same class", []int{4, 7}, 5, 7},
+		{"much larger class", []int{100}, 5, 100},
+		{"larger class before scanning", []int{7, 4, 100}, 5, 100},
+		{"scan own class", []int{7, 4}, 5, 7},
+		{"nothing large enough", []int{4, 2, 1}, 5, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFreeListG[int](len(tc.free))
+			for _, c := range tc.free {
+				f.freeNode(node(c))
+			}
+			s := &f.shards[0]
+			n := s.take(tc.need)
+			switch {
+			case tc.want == 0 && n != nil:
+				t.Fatalf("take(%d) = node of cap %d, want nil", tc.need, cap(n.items))
+			case tc.want != 0 && (n == nil || cap(n.items) != tc.want):
+				t.Fatalf("take(%d) = %v, want a node of cap %d", tc.need, n, tc.want)
+			}
+			if want := len(tc.free); tc.want != 0 && s.size != want-1 {
+				t.Fatalf("size after take = %d, want %d", s.size, want-1)
+			}
+		})
+	}
+}
+
+func TestFreeListMixedDegrees(t *testing.T) {
+	// degreeの違う木が1つのフリーリストを共有しても、容量の足りないノードを受け取らない。
+	f := NewFreeListG[int](1024)
+	small, large := NewWithFreeListG(2, intLess, f), NewWithFreeListG(16, intLess, f)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 2000; i++ {
+			small.ReplaceOrInsert(i)
+			large.ReplaceOrInsert(i)
+		}
+		for _, tr := range []*BTreeG[int]{small, large} {
+			if err := tr.Verify(); err != nil {
+				t.Fatal(err)
+			}
+			tr.Clear(true)
+		}
+	}
+	if st := f.Stats(); st.Hits == 0 {
+		t.Fatalf("no node was reused: %+v", st)
+	}
+}
+
+// churnは、goroutines個のゴルーチンがそれぞれ自分の木にn個の項目を挿入してからClear(true)でノードをフリーリストに戻すことを、rounds回繰り返します。
+func churn(newTree func() *BTreeG[int], goroutines, n, rounds int) {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			tr := newTree()
+			for i := 0; i < rounds; i++ {
+				for j := 0; j < n; j++ {
+					tr.ReplaceOrInsert(r.Int())
+				}
+				tr.Clear(true)
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
+
+// BenchmarkFreeListChurnは、フリーリストの使い方ごとに、木を作っては捨てる負荷での割り当ての回数とGCの停止時間を比べます。
+// gc-pause-ns/opは、1回の操作あたりのGCの停止時間の合計です。
+func BenchmarkFreeListChurn(b *testing.B) {
+	const n, rounds = 10000, 4
+	goroutines := runtime.GOMAXPROCS(0)
+	for _, bc := range []struct {
+		name    string
+		newTree func() func() *BTreeG[int]
+	}{
+		{"per-tree", func() func() *BTreeG[int] {
+			return func() *BTreeG[int] { return NewG(32, intLess) }
+		}},
+		{"shared", func() func() *BTreeG[int] {
+			f := NewFreeListG[int](goroutines * DefaultFreeListSize)
+			return func() *BTreeG[int] { return NewWithFreeListG(32, intLess, f) }
+		}},
+		{"sharded", func() func() *BTreeG[int] {
+			f := NewShardedFreeListG[int](goroutines, goroutines*DefaultFreeListSize)
+			return func() *BTreeG[int] { return NewWithFreeListG(32, intLess, f) }
+		}},
+		{"arena", func() func() *BTreeG[int] {
+			return func() *BTreeG[int] { return NewWithArenaG(32, intLess) }
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			newTree := bc.newTree()
+			b.ReportAllocs()
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				churn(newTree, goroutines, n, rounds)
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+			b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gcs/op")
+		})
+	}
+}
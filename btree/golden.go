@@ -0,0 +1,140 @@
+package btree
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// goldenHeaderは、WriteGoldenが出力する形式の1行目です。
+const goldenHeader = "# btree golden v1"
+
+// WriteGoldenは、木の内容を下流のテストのゴールデンファイルとして使える、安定した差分の取りやすいテキスト形式でwに書き出します。
+// ヘッダにはdegree、項目数、ノード構造のハッシュが含まれ、その後に項目が昇順で1行に1つ書かれます。
+// 項目はencoding.TextMarshalerを実装していればその結果、そうでなければfmt.Sprintの結果で表され、
+// 改行を含むなど1行で表せない場合はstrconv.Quoteで引用されます。
+func (t *BTree) WriteGolden(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, goldenHeader)
+	fmt.Fprintf(bw, "# degree %d\n", t.degree)
+	fmt.Fprintf(bw, "# items %d\n", t.Len())
+	fmt.Fprintf(bw, "# structure %s\n", t.structureHash())
+	var err error
+	t.Ascend(func(i Item) bool {
+		var text string
+		if text, err = goldenText(i); err != nil {
+			return false
+		}
+		_, err = fmt.Fprintln(bw, text)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// goldenTextは、1つの項目をゴールデン形式の1行に変換します。
+func goldenText(i Item) (string, error) {
+	var text string
+	if m, ok := i.(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		text = string(b)
+	} else {
+		text = fmt.Sprint(i)
+	}
+	if text == "" || strings.ContainsAny(text, "\r\n") || text[0] == '#' || text[0] == '"' {
+		text = strconv.Quote(text)
+	}
+	return text, nil
+}
+
+// structureHashは、前順走査で各ノードの項目数と子の数をハッシュし、木の形を表す16進文字列を返します。
+func (t *BTree) structureHash() string {
+	h := sha256.New()
+	var walk func(n *node[Item])
+	walk = func(n *node[Item]) {
+		fmt.Fprintf(h, "%d/%d;", len(n.items), len(n.children))
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	if t.root != nil {
+		walk(t.root)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// LoadGoldenは、WriteGoldenが書き出したテキストを読み込み、同じ項目を持つ木を作成します。
+// 各行のテキストはparseで項目に変換されます。木の形は挿入順に依存するため、構造のハッシュは検証しません。
+func LoadGolden(r io.Reader, parse func(text string) (Item, error)) (*BTree, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var t *BTree
+	want, line := -1, 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if line == 1 {
+			if text != goldenHeader {
+				return nil, fmt.Errorf("btree: golden line 1: unexpected header %q", text)
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			var err error
+			switch f := strings.Fields(text); {
+			case len(f) == 3 && f[1] == "degree":
+				var degree int
+				if degree, err = strconv.Atoi(f[2]); err == nil {
+					if degree <= 1 {
+						return nil, fmt.Errorf("btree: golden line %d: bad degree %d", line, degree)
+					}
+					t = New(degree)
+				}
+			case len(f) == 3 && f[1] == "items":
+				want, err = strconv.Atoi(f[2])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("btree: golden line %d: %w", line, err)
+			}
+			continue
+		}
+		if t == nil {
+			return nil, fmt.Errorf("btree: golden line %d: item before degree header", line)
+		}
+		if strings.HasPrefix(text, `"`) {
+			unquoted, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("btree: golden line %d: %w", line, err)
+			}
+			text = unquoted
+		}
+		item, err := parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("btree: golden line %d: %w", line, err)
+		}
+		if t.ReplaceOrInsert(item) != nil {
+			return nil, fmt.Errorf("btree: golden line %d: duplicate item %q", line, text)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.New("btree: golden data has no degree header")
+	}
+	if want >= 0 && t.Len() != want {
+		return nil, fmt.Errorf("btree: golden data declares %d items but contains %d", want, t.Len())
+	}
+	return t, nil
+}
@@ -0,0 +1,134 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// goldenStringは、文字列のItemです。
+type goldenString string
+
+func (s goldenString) Less(than Item) bool { return s < than.(goldenString) }
+
+func parseGoldenString(text string) (Item, error) { return goldenString(text), nil }
+
+func parseGoldenInt(text string) (Item, error) {
+	n, err := strconv.Atoi(text)
+	return Int(n), err
+}
+
+func TestGoldenRoundTrip(t *testing.T) {
+	tr := New(3)
+	items := []string{"plain", "", "two\nlines", "cr\rhere", "#comment", `"quoted"`, "mid#dle", `mid"dle`, " space", "tab\t", "unicode ✓"}
+	for _, s := range items {
+		tr.ReplaceOrInsert(goldenString(s))
+	}
+	var buf bytes.Buffer
+	if err := tr.WriteGolden(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4+len(items) || lines[0] != goldenHeader || lines[1] != "# degree 3" || lines[2] != fmt.Sprintf("# items %d", len(items)) {
+		t.Fatalf("golden output:\n%s", buf.String())
+	}
+	// 1行で表せないか、コメントや引用と紛らわしい項目だけを引用する。
+	quoted := map[string]bool{}
+	for _, l := range lines[4:] {
+		quoted[l] = true
+	}
+	for _, s := range items {
+		wantQuoted := s == "" || strings.ContainsAny(s, "\r\n") || s[0] == '#' || s[0] == '"'
+		line := s
+		if wantQuoted {
+			line = strconv.Quote(s)
+		}
+		if !quoted[line] {
+			t.Errorf("item %q is not written as %s", s, line)
+		}
+	}
+
+	out, err := LoadGolden(bytes.NewReader(buf.Bytes()), parseGoldenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.degree != 3 || fmt.Sprintf("%q", goldenItems(out)) != fmt.Sprintf("%q", goldenItems(tr)) {
+		t.Fatalf("loaded degree %d, items %q, want %q", out.degree, goldenItems(out), goldenItems(tr))
+	}
+	// 同じ項目でも挿入順で形が変わりうるので、書き直して同じ内容になるかは構造の行を除いて比べる。
+	var again bytes.Buffer
+	if err := out.WriteGolden(&again); err != nil {
+		t.Fatal(err)
+	}
+	if withoutStructure(again.String()) != withoutStructure(buf.String()) {
+		t.Fatalf("rewritten golden data differs:\n%s\nwant\n%s", again.String(), buf.String())
+	}
+}
+
+func TestGoldenStructureHash(t *testing.T) {
+	a, b := New(2), New(2)
+	for i := 0; i < 20; i++ {
+		a.ReplaceOrInsert(Int(i))
+		b.ReplaceOrInsert(Int(19 - i))
+	}
+	var wa, wb bytes.Buffer
+	a.WriteGolden(&wa)
+	b.WriteGolden(&wb)
+	if wa.String() == wb.String() || withoutStructure(wa.String()) != withoutStructure(wb.String()) {
+		t.Fatalf("trees with the same items and different shapes:\n%s\n%s", wa.String(), wb.String())
+	}
+}
+
+func TestLoadGoldenErrors(t *testing.T) {
+	parseErr := errors.New("parse failed")
+	for _, tc := range []struct {
+		name, data string
+		parse      func(string) (Item, error)
+		want       string
+	}{
+		{"bad header", "# btree golden v2\n# degree 3\n", parseGoldenInt, "unexpected header"},
+		{"no degree", goldenHeader + "\n# items 0\n", parseGoldenInt, "no degree header"},
+		{"bad degree", goldenHeader + "\n# degree 1\n", parseGoldenInt, "bad degree 1"},
+		{"item before degree", goldenHeader + "\n1\n# degree 3\n", parseGoldenInt, "item before degree header"},
+		{"bad count", goldenHeader + "\n# degree 3\n# items x\n", parseGoldenInt, "line 3"},
+		{"too few items", goldenHeader + "\n# degree 3\n# items 3\n1\n2\n", parseGoldenInt, "declares 3 items but contains 2"},
+		{"too many items", goldenHeader + "\n# degree 3\n# items 1\n1\n2\n", parseGoldenInt, "declares 1 items but contains 2"},
+		{"duplicate", goldenHeader + "\n# degree 3\n1\n1\n", parseGoldenInt, "line 4: duplicate item"},
+		{"bad quote", goldenHeader + "\n# degree 3\n\"open\n", parseGoldenString, "line 3"},
+		{"parse error", goldenHeader + "\n# degree 3\nx\n", func(string) (Item, error) { return nil, parseErr }, "line 3: parse failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadGolden(strings.NewReader(tc.data), tc.parse)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("LoadGolden = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+	// 項目数の行がなければ、数は検証しない。
+	if tr, err := LoadGolden(strings.NewReader(goldenHeader+"\n# degree 3\n2\n1\n"), parseGoldenInt); err != nil || tr.Len() != 2 {
+		t.Fatalf("LoadGolden without an items header = %v", err)
+	}
+}
+
+func goldenItems(tr *BTree) []string {
+	var out []string
+	tr.Ascend(func(i Item) bool {
+		out = append(out, string(i.(goldenString)))
+		return true
+	})
+	return out
+}
+
+// withoutStructureは、ゴールデン形式のテキストから構造のハッシュの行を除きます。
+func withoutStructure(s string) string {
+	var out []string
+	for _, l := range strings.Split(s, "\n") {
+		if !strings.HasPrefix(l, "# structure ") {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,164 @@
+// Package invidxは、文字列の語から、その語を含む文書IDのBTree（ポスティングリスト）への転置インデックスを提供します。
+// AND/ORの検索は、ポスティングの木同士の積と和として計算されます。
+package invidx
+
+import (
+	"sort"
+
+	"github.com/seipan/btree/btree"
+)
+
+// postingDegreeは、ポスティングの木のdegreeです。
+const postingDegree = 16
+
+type (
+	// DocIDは、文書の識別子です。
+	DocID uint64
+
+	// Indexは、語から文書IDの集合への転置インデックスです。
+	// Write操作は複数のゴルーチンによる同時変異に対して安全ではないが、Read操作は安全である。
+	Index struct {
+		terms    map[string]*btree.BTree
+		freelist *btree.FreeList
+	}
+)
+
+// Lessは、a < bの場合に真を返す。
+func (a DocID) Less(b btree.Item) bool {
+	return a < b.(DocID)
+}
+
+// Newは、空の転置インデックスを作成します。すべてのポスティングの木は1つのフリーリストを共有します。
+func New() *Index {
+	return &Index{
+		terms:    make(map[string]*btree.BTree),
+		freelist: btree.NewFreeList(btree.DefaultFreeListSize),
+	}
+}
+
+// Addは、文書docが語termsを含むことを登録します。
+func (x *Index) Add(doc DocID, terms ...string) {
+	for _, term := range terms {
+		t, ok := x.terms[term]
+		if !ok {
+			t = btree.NewWithFreeList(postingDegree, x.freelist)
+			x.terms[term] = t
+		}
+		t.ReplaceOrInsert(doc)
+	}
+}
+
+// Removeは、文書docと語termsの対応を取り除きます。文書を含まなくなった語はインデックスから消えます。
+func (x *Index) Remove(doc DocID, terms ...string) {
+	for _, term := range terms {
+		t, ok := x.terms[term]
+		if !ok {
+			continue
+		}
+		t.Delete(doc)
+		if t.Len() == 0 {
+			t.Clear(true)
+			delete(x.terms, term)
+		}
+	}
+}
+
+// Countは、語termを含む文書の数を返します。
+func (x *Index) Count(term string) int {
+	if t, ok := x.terms[term]; ok {
+		return t.Len()
+	}
+	return 0
+}
+
+// Termsは、登録されている語を辞書順で返します。
+func (x *Index) Terms() []string {
+	out := make([]string, 0, len(x.terms))
+	for term := range x.terms {
+		out = append(out, term)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Postingsは、語termを含む文書IDを昇順で返します。
+func (x *Index) Postings(term string) []DocID {
+	t, ok := x.terms[term]
+	if !ok {
+		return nil
+	}
+	return collect(t)
+}
+
+// Andは、すべての語を含む文書IDを昇順で返します。
+// 短いポスティングから順にIntersectで積を取ります。Intersectは部分木ごとに積を取ってノードを共有するので、項目を1つずつ調べるより速く、
+// 途中で積が空になればそこで止めます。
+func (x *Index) And(terms ...string) []DocID {
+	if len(terms) == 0 {
+		return nil
+	}
+	trees := make([]*btree.BTree, 0, len(terms))
+	for _, term := range terms {
+		t, ok := x.terms[term]
+		if !ok {
+			return nil
+		}
+		trees = append(trees, t)
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].Len() < trees[j].Len() })
+	acc := trees[0]
+	for _, t := range trees[1:] {
+		if acc.Len() == 0 {
+			break
+		}
+		acc = acc.Intersect(t)
+	}
+	return collect(acc)
+}
+
+// Orは、いずれかの語を含む文書IDを重複なく昇順で返します。ポスティングの木を2つずつUnionで和にします。
+func (x *Index) Or(terms ...string) []DocID {
+	var trees []*btree.BTree
+	for _, term := range terms {
+		if t, ok := x.terms[term]; ok {
+			trees = append(trees, t)
+		}
+	}
+	if len(trees) == 0 {
+		return nil
+	}
+	return collect(union(trees))
+}
+
+// AndNotは、語includeを含み、語excludeのいずれも含まない文書IDを昇順で返します。
+func (x *Index) AndNot(include string, exclude ...string) []DocID {
+	acc, ok := x.terms[include]
+	if !ok {
+		return nil
+	}
+	for _, term := range exclude {
+		if e, ok := x.terms[term]; ok && acc.Len() > 0 {
+			acc = acc.Difference(e)
+		}
+	}
+	return collect(acc)
+}
+
+// collectは、木の文書IDを昇順で返します。
+func collect(t *btree.BTree) []DocID {
+	out := make([]DocID, 0, t.Len())
+	t.Ascend(func(i btree.Item) bool {
+		out = append(out, i.(DocID))
+		return true
+	})
+	return out
+}
+
+// unionは、空でないtreesの和の木を返します。大きさの近い木どうしで和を取るように、半分ずつに分けて再帰的に計算します。
+func union(trees []*btree.BTree) *btree.BTree {
+	if len(trees) == 1 {
+		return trees[0]
+	}
+	mid := len(trees) / 2
+	return union(trees[:mid]).Union(union(trees[mid:]))
+}
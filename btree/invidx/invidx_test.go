@@ -0,0 +1,147 @@
+package invidx
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// modelは、語から文書IDの集合への対応です。
+type model map[string]map[DocID]bool
+
+// docsは、keepを満たす文書IDを昇順で返します。
+func (m model) docs(keep func(doc DocID) bool) []DocID {
+	seen := map[DocID]bool{}
+	for _, set := range m {
+		for doc := range set {
+			seen[doc] = true
+		}
+	}
+	out := []DocID{}
+	for doc := range seen {
+		if keep(doc) {
+			out = append(out, doc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// randomTermsは、t0からt7までと、インデックスにない語"none"から、重複を許して0から3個の語を選びます。
+func randomTerms(r *rand.Rand) []string {
+	terms := make([]string, r.Intn(4))
+	for i := range terms {
+		if r.Intn(10) == 0 {
+			terms[i] = "none"
+		} else {
+			terms[i] = fmt.Sprint("t", r.Intn(8))
+		}
+	}
+	return terms
+}
+
+func TestQueriesMatchModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	x, m := New(), model{}
+	for step := 0; step < 3000; step++ {
+		doc := DocID(r.Intn(300))
+		term := fmt.Sprint("t", r.Intn(8))
+		if r.Intn(3) > 0 {
+			x.Add(doc, term)
+			if m[term] == nil {
+				m[term] = map[DocID]bool{}
+			}
+			m[term][doc] = true
+		} else {
+			x.Remove(doc, term)
+			if delete(m[term], doc); len(m[term]) == 0 {
+				delete(m, term)
+			}
+		}
+		if step%50 != 0 {
+			continue
+		}
+		var terms []string
+		for term := range m {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		if fmt.Sprint(x.Terms()) != fmt.Sprint(terms) {
+			t.Fatalf("step %d: Terms() = %v, want %v", step, x.Terms(), terms)
+		}
+		for _, term := range terms {
+			if x.Count(term) != len(m[term]) {
+				t.Fatalf("step %d: Count(%s) = %d, want %d", step, term, x.Count(term), len(m[term]))
+			}
+		}
+		for n := 0; n < 20; n++ {
+			q := randomTerms(r)
+			has := func(doc DocID, term string) bool { return m[term][doc] }
+			and := m.docs(func(doc DocID) bool {
+				for _, term := range q {
+					if !has(doc, term) {
+						return false
+					}
+				}
+				return len(q) > 0
+			})
+			or := m.docs(func(doc DocID) bool {
+				for _, term := range q {
+					if has(doc, term) {
+						return true
+					}
+				}
+				return false
+			})
+			if got := x.And(q...); fmt.Sprint(got) != fmt.Sprint(and) {
+				t.Fatalf("step %d: And(%q) = %v, want %v", step, q, got, and)
+			}
+			if got := x.Or(q...); fmt.Sprint(got) != fmt.Sprint(or) {
+				t.Fatalf("step %d: Or(%q) = %v, want %v", step, q, got, or)
+			}
+			if len(q) > 0 {
+				andNot := m.docs(func(doc DocID) bool {
+					for _, term := range q[1:] {
+						if has(doc, term) {
+							return false
+						}
+					}
+					return has(doc, q[0])
+				})
+				if got := x.AndNot(q[0], q[1:]...); fmt.Sprint(got) != fmt.Sprint(andNot) {
+					t.Fatalf("step %d: AndNot(%q, %q) = %v, want %v", step, q[0], q[1:], got, andNot)
+				}
+			}
+		}
+	}
+}
+
+// TestQueriesDoNotChangePostingsは、検索の結果の木がポスティングの木とノードを共有していても、その後の追加と削除が結果に影響しないことを確かめます。
+func TestQueriesDoNotChangePostings(t *testing.T) {
+	x := New()
+	for doc := DocID(0); doc < 500; doc++ {
+		x.Add(doc, "all")
+		if doc%2 == 0 {
+			x.Add(doc, "even")
+		}
+	}
+	if n := len(x.And("all", "even")); n != 250 {
+		t.Fatalf("And(all, even) has %d documents, want 250", n)
+	}
+	if n := len(x.Or("all", "even")); n != 500 {
+		t.Fatalf("Or(all, even) has %d documents, want 500", n)
+	}
+	for doc := DocID(0); doc < 500; doc += 2 {
+		x.Remove(doc, "all")
+	}
+	if x.Count("all") != 250 || x.Count("even") != 250 {
+		t.Fatalf("Count(all)=%d Count(even)=%d after removing the even documents from all", x.Count("all"), x.Count("even"))
+	}
+	if n := len(x.And("all", "even")); n != 0 {
+		t.Fatalf("And(all, even) has %d documents, want 0", n)
+	}
+	if got := x.Postings("even"); len(got) != 250 || got[1] != 2 {
+		t.Fatalf("Postings(even) = %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package btree
+
+import (
+	"bytes"
+	"time"
+)
+
+type (
+	// kvEntryは、OrderedKVの木の1項目です。
+	kvEntry struct {
+		key   []byte
+		value []byte
+	}
+
+	// OrderedKVは、バイト列のキーと値をキーの辞書順に保持するキー・バリューストアです。
+	// Defaultdbと違い、順序どおりの走査、範囲の走査、前方一致の走査ができます。
+	//
+	// Setはキーと値をコピーして保持するので、呼び出し元は渡したスライスを再利用して構いません。
+	// 一方、Getや走査で渡される値のスライスはストアの内部のものなので、変更してはいけません。
+	// BTreeと同じく、書き込み操作は複数のゴルーチンから同時に呼んではいけません。
+	//
+	// SoftDeleteで削除したキーはゴミ箱に移り、保持期間の間はUndeleteで元に戻せます。
+	OrderedKV struct {
+		tree *BTreeG[kvEntry]
+		// binは、SoftDeleteしたキーのゴミ箱です。最初に使うまではnilです。
+		bin *kvTrash
+		// nowは、ゴミ箱とトレースが使う時計です。nilの場合はtime.Nowを使います。
+		now func() time.Time
+		// tracesは、Traceで記録中のトレースです。
+		traces []*KVTrace
+	}
+
+	// KVIteratorは、OrderedKVの走査でキーと値の組ごとに呼ばれます。falseを返すと走査を止めます。
+	KVIterator func(key, value []byte) bool
+)
+
+func kvLess(a, b kvEntry) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// NewOrderedKVは、与えられたdegreeの木を使う空のOrderedKVを作成します。
+func NewOrderedKV(degree int) *OrderedKV {
+	return &OrderedKV{tree: NewG(degree, kvLess)}
+}
+
+// Getは、keyの値を返します。keyがない場合は (nil, false) を返します。
+func (kv *OrderedKV) Get(key []byte) ([]byte, bool) {
+	e, ok := kv.tree.Get(kvEntry{key: key})
+	return e.value, ok
+}
+
+// Hasは、keyがあればtrueを返します。
+func (kv *OrderedKV) Has(key []byte) bool {
+	return kv.tree.Has(kvEntry{key: key})
+}
+
+// Setは、keyの値をvalueにします。
+func (kv *OrderedKV) Set(key, value []byte) {
+	_, found := kv.tree.ReplaceOrInsert(kvEntry{
+		key:   append([]byte(nil), key...),
+		value: append([]byte{}, value...),
+	})
+	kv.traceOp("set", key, found)
+}
+
+// Deleteは、keyを削除し、削除した場合はtrueを返します。
+func (kv *OrderedKV) Delete(key []byte) bool {
+	_, ok := kv.tree.Delete(kvEntry{key: key})
+	kv.traceOp("delete", key, ok)
+	return ok
+}
+
+// Lenは、キーの数を返します。
+func (kv *OrderedKV) Len() int {
+	return kv.tree.Len()
+}
+
+// Ascendは、すべてのキーと値の組について、キーの昇順にiteratorを呼び出します。
+func (kv *OrderedKV) Ascend(iterator KVIterator) {
+	kv.tree.Ascend(func(e kvEntry) bool {
+		return iterator(e.key, e.value)
+	})
+}
+
+// Descendは、すべてのキーと値の組について、キーの降順にiteratorを呼び出します。
+func (kv *OrderedKV) Descend(iterator KVIterator) {
+	kv.tree.Descend(func(e kvEntry) bool {
+		return iterator(e.key, e.value)
+	})
+}
+
+// Rangeは、[start, end) の範囲のキーと値の組について、キーの昇順にiteratorを呼び出します。nilの境界は「境界なし」を意味します。
+func (kv *OrderedKV) Range(start, end []byte, iterator KVIterator) {
+	lo, hi := empty[kvEntry](), empty[kvEntry]()
+	if start != nil {
+		lo = optional(kvEntry{key: start})
+	}
+	if end != nil {
+		hi = optional(kvEntry{key: end})
+	}
+	kv.tree.iterate(ascend, lo, hi, true, func(e kvEntry) bool {
+		return iterator(e.key, e.value)
+	})
+}
+
+// ScanPrefixは、prefixで始まるキーと値の組について、キーの昇順にiteratorを呼び出します。
+func (kv *OrderedKV) ScanPrefix(prefix []byte, iterator KVIterator) {
+	kv.Range(prefix, prefixEnd(prefix), iterator)
+}
+
+// prefixEndは、prefixで始まるすべてのキーより大きい最小のキーを返します。そのようなキーがない（prefixがすべて0xffの）場合はnilを返します。
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// Clearは、すべてのキーを削除します。
+func (kv *OrderedKV) Clear() {
+	if len(kv.traces) > 0 {
+		// Ascendの中で記録すると、呼び出し元が木の走査になるので、キーを集めてから記録する。
+		var keys [][]byte
+		kv.tree.Ascend(func(e kvEntry) bool {
+			keys = append(keys, e.key)
+			return true
+		})
+		for _, key := range keys {
+			kv.traceOp("clear", key, true)
+		}
+	}
+	kv.tree.Clear(true)
+}
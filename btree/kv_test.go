@@ -0,0 +1,137 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// randKeyは、0x00、0x01、0xfe、0xffからなる長さ0から3のキーを返します。0xffで終わる前方一致の境界がよく現れます。
+func randKey(r *rand.Rand) []byte {
+	k := make([]byte, r.Intn(4))
+	for i := range k {
+		k[i] = []byte{0x00, 0x01, 0xfe, 0xff}[r.Intn(4)]
+	}
+	return k
+}
+
+// kvPairsは、走査で渡されたキーと値を"key=value"の形で集めるKVIteratorと、その結果を返します。
+func kvPairs() (KVIterator, *[]string) {
+	out := &[]string{}
+	return func(key, value []byte) bool {
+		*out = append(*out, fmt.Sprintf("%x=%s", key, value))
+		return true
+	}, out
+}
+
+// modelPairsは、モデルのうちkeepを満たすキーを昇順に"key=value"の形で返します。
+func modelPairs(model map[string]string, keep func(key string) bool) []string {
+	keys := make([]string, 0, len(model))
+	for k := range model {
+		if keep(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%x=%s", k, model[k]))
+	}
+	return out
+}
+
+func TestOrderedKVMatchesMap(t *testing.T) {
+	r := rand.New(rand.NewSource(15))
+	kv := NewOrderedKV(3)
+	model := map[string]string{}
+	for step := 0; step < 5000; step++ {
+		key := randKey(r)
+		switch op := r.Intn(10); {
+		case op < 5:
+			value := []byte(fmt.Sprint(step))
+			kv.Set(key, value)
+			// Setはキーと値をコピーするので、渡したスライスを書き換えても影響しない。
+			model[string(key)] = string(value)
+			value[0] = 'x'
+			if len(key) > 0 {
+				key[0] ^= 1
+			}
+		case op < 8:
+			_, had := model[string(key)]
+			if ok := kv.Delete(key); ok != had {
+				t.Fatalf("step %d: Delete(%x) = %v, want %v", step, key, ok, had)
+			}
+			delete(model, string(key))
+		default:
+			want, had := model[string(key)]
+			if got, ok := kv.Get(key); ok != had || string(got) != want {
+				t.Fatalf("step %d: Get(%x) = %q, %v, want %q, %v", step, key, got, ok, want, had)
+			}
+			if kv.Has(key) != had {
+				t.Fatalf("step %d: Has(%x) = %v, want %v", step, key, !had, had)
+			}
+		}
+		if step%100 != 0 {
+			continue
+		}
+		if kv.Len() != len(model) {
+			t.Fatalf("step %d: Len() = %d, want %d", step, kv.Len(), len(model))
+		}
+		it, got := kvPairs()
+		kv.Ascend(it)
+		all := modelPairs(model, func(string) bool { return true })
+		if fmt.Sprint(*got) != fmt.Sprint(all) {
+			t.Fatalf("step %d: Ascend = %v, want %v", step, *got, all)
+		}
+		it, got = kvPairs()
+		kv.Descend(it)
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+		if fmt.Sprint(*got) != fmt.Sprint(all) {
+			t.Fatalf("step %d: Descend = %v, want %v", step, *got, all)
+		}
+		for n := 0; n < 20; n++ {
+			// nilの境界は境界なしを、空のキーは最小のキーを表す。
+			var start, end []byte
+			if r.Intn(3) > 0 {
+				start = randKey(r)
+			}
+			if r.Intn(3) > 0 {
+				end = randKey(r)
+			}
+			it, got = kvPairs()
+			kv.Range(start, end, it)
+			want := modelPairs(model, func(k string) bool {
+				return (start == nil || k >= string(start)) && (end == nil || k < string(end))
+			})
+			if fmt.Sprint(*got) != fmt.Sprint(want) {
+				t.Fatalf("step %d: Range(%x, %x) (nil %v, %v) = %v, want %v", step, start, end, start == nil, end == nil, *got, want)
+			}
+			prefix := randKey(r)
+			it, got = kvPairs()
+			kv.ScanPrefix(prefix, it)
+			want = modelPairs(model, func(k string) bool { return strings.HasPrefix(k, string(prefix)) })
+			if fmt.Sprint(*got) != fmt.Sprint(want) {
+				t.Fatalf("step %d: ScanPrefix(%x) = %v, want %v", step, prefix, *got, want)
+			}
+		}
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for _, tc := range []struct{ prefix, want []byte }{
+		{[]byte{}, nil},
+		{[]byte{0x00}, []byte{0x01}},
+		{[]byte{'a', 0xff}, []byte{'b'}},
+		{[]byte{'a', 0xfe, 0xff, 0xff}, []byte{'a', 0xff}},
+		{[]byte{0xff, 0xff}, nil},
+	} {
+		if got := prefixEnd(tc.prefix); !bytes.Equal(got, tc.want) || (got == nil) != (tc.want == nil) {
+			t.Errorf("prefixEnd(%x) = %x, want %x", tc.prefix, got, tc.want)
+		}
+	}
+}
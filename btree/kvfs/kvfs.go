@@ -0,0 +1,255 @@
+// Package kvfsは、btree.OrderedKVのキーをファイルのパス、値をファイルの内容とみなして、fs.FSとして公開します。
+// http.FS(kvfs.New(kv, "assets/"))をhttp.FileServerに渡すと、ストアから静的なファイルやテンプレートを直接配信できます。
+//
+// キーは、prefixを取り除いた残りが"css/site.css"のようなfs.ValidPathの形式のパスであるものだけを使い、それ以外のキーは無視します。
+// ディレクトリは保存せず、"css/"で始まるキーがあれば"css"というディレクトリがあるものとみなします。
+// 同じ名前のキーとディレクトリがある場合は、ファイルとして扱い、そのディレクトリの中のキーは見えなくなります。
+// ディレクトリの一覧は前方一致の範囲の走査で求め、サブディレクトリの中身は読み飛ばすので、時間はその直下の項目の数に比例します。
+//
+// OrderedKVと同じく、FSの読み取りをストアへの書き込みと同時に呼んではいけません。
+package kvfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// errIsDirは、ディレクトリを読もうとしたことを示します。
+var errIsDir = errors.New("is a directory")
+
+type (
+	// FSは、OrderedKVのprefixで始まるキーをファイルとして公開するfs.FSです。fs.ReadDirFS、fs.ReadFileFS、fs.StatFSも満たします。
+	FS struct {
+		kv     *btree.OrderedKV
+		prefix string
+	}
+
+	// fileInfoは、ファイルかディレクトリの情報です。fs.FileInfoを満たします。
+	fileInfo struct {
+		name string
+		size int64
+		dir  bool
+	}
+
+	// fileは、Openで開いたファイルです。http.FileSystemが使うSeekとReadAtも使えます。
+	file struct {
+		*bytes.Reader
+		info fileInfo
+	}
+
+	// dirは、Openで開いたディレクトリです。項目の一覧は最初のReadDirで求めます。
+	dir struct {
+		fsys    *FS
+		name    string
+		info    fileInfo
+		entries []fs.DirEntry
+		read    bool
+	}
+)
+
+// Newは、kvのprefixで始まるキーを、prefixを取り除いたパスのファイルとして公開するFSを返します。prefixが空の場合はすべてのキーを使います。
+func New(kv *btree.OrderedKV, prefix string) *FS {
+	return &FS{kv: kv, prefix: prefix}
+}
+
+// Openは、nameのファイルかディレクトリを開きます。
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		if f.shadowed(name) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if v, ok := f.kv.Get([]byte(f.prefix + name)); ok {
+			return &file{Reader: bytes.NewReader(v), info: fileInfo{name: path.Base(name), size: int64(len(v))}}, nil
+		}
+		if !f.isDir(name) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return &dir{fsys: f, name: name, info: fileInfo{name: path.Base(name), dir: true}}, nil
+}
+
+// ReadFileは、nameのファイルの内容のコピーを返します。
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	if f.shadowed(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	if v, ok := f.kv.Get([]byte(f.prefix + name)); ok {
+		return append([]byte{}, v...), nil
+	}
+	if f.isDir(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+}
+
+// Statは、nameのファイルかディレクトリの情報を返します。
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		err.(*fs.PathError).Op = "stat"
+		return nil, err
+	}
+	return file.Stat()
+}
+
+// ReadDirは、nameのディレクトリの直下の項目を名前の順に返します。
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		err.(*fs.PathError).Op = "readdir"
+		return nil, err
+	}
+	d, ok := file.(*dir)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return d.list(), nil
+}
+
+// firstは、[start, end) の範囲で、prefixを取り除いた残りが正しいパス（"."を除く）である最初のキーとその値を返します。
+func (f *FS) first(start, end []byte) (key, value []byte, ok bool) {
+	f.kv.Range(start, end, func(k, v []byte) bool {
+		if rel := string(k[len(f.prefix):]); rel != "." && fs.ValidPath(rel) {
+			key, value, ok = k, v, true
+			return false
+		}
+		return true
+	})
+	return key, value, ok
+}
+
+// shadowedは、nameの親のディレクトリのどれかが同じ名前のファイルに隠されているかどうかを返します。
+func (f *FS) shadowed(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && f.kv.Has([]byte(f.prefix+name[:i])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirは、name+"/"で始まるパスのキーがあるかどうかを返します。
+func (f *FS) isDir(name string) bool {
+	base := []byte(f.prefix + name + "/")
+	_, _, ok := f.first(base, prefixEnd(base))
+	return ok
+}
+
+// prefixEndは、prefixで始まるすべてのキーより大きい最小のキーを返します。そのようなキーがない場合はnilを返します。
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// listは、ディレクトリの直下の項目を名前の順に返します。
+// サブディレクトリを見つけたら、その中のキーは走査せずに、サブディレクトリの名前+"0"（'/'の次の文字）から走査を続けます。
+func (d *dir) list() []fs.DirEntry {
+	base := d.fsys.prefix
+	if d.name != "." {
+		base += d.name + "/"
+	}
+	start, end := []byte(base), prefixEnd([]byte(base))
+	var out []fs.DirEntry
+	for {
+		key, value, ok := d.fsys.first(start, end)
+		if !ok {
+			break
+		}
+		rest := string(key[len(base):])
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			out = append(out, fs.FileInfoToDirEntry(fileInfo{name: rest[:i], dir: true}))
+			start = []byte(base + rest[:i] + "0")
+		} else {
+			out = append(out, fs.FileInfoToDirEntry(fileInfo{name: rest, size: int64(len(value))}))
+			start = append(key[:len(key):len(key)], 0)
+		}
+	}
+	// "a.txt"は"a/"より前に並ぶので、キーの順は名前の順と一致しない。同じ名前のファイルとディレクトリはファイルを残す。
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Name() != out[j].Name() {
+			return out[i].Name() < out[j].Name()
+		}
+		return !out[i].IsDir() && out[j].IsDir()
+	})
+	uniq := out[:0]
+	for i, e := range out {
+		if i == 0 || e.Name() != out[i-1].Name() {
+			uniq = append(uniq, e)
+		}
+	}
+	return uniq
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDirは、fs.ReadDirFileのReadDirと同じく、n > 0の場合は次の最大n個の項目を、n <= 0の場合は残りのすべての項目を返します。
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.entries, d.read = d.list(), true
+	}
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	out := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Close() error { return nil }
+
+func (i fileInfo) Name() string { return i.name }
+
+func (i fileInfo) Size() int64 { return i.size }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// ModTimeは、ストアが更新時刻を持たないので、常にゼロ値を返します。
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+
+func (i fileInfo) IsDir() bool { return i.dir }
+
+func (i fileInfo) Sys() interface{} { return nil }
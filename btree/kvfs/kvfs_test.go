@@ -0,0 +1,147 @@
+package kvfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/seipan/btree/btree"
+)
+
+// testKVは、"assets/"の下のファイルと、パスとして使えないキーや別のプレフィックスのキーを入れたストアを返します。
+func testKV() *btree.OrderedKV {
+	kv := btree.NewOrderedKV(3)
+	for key, value := range map[string]string{
+		"assets/index.html":      "<html>",
+		"assets/css/site.css":    "body{}",
+		"assets/css/print.css":   "@media print{}",
+		"assets/js/app/main.js":  "main()",
+		"assets/a.txt":           "a",
+		"assets/a/b.txt":         "b",
+		"assets/empty":           "",
+		"assets/dup":             "file",
+		"assets/dup/hidden.txt":  "hidden",
+		"assets//double":         "invalid",
+		"assets/./dot":           "invalid",
+		"assets/../up":           "invalid",
+		"assets/trailing/":       "invalid",
+		"assets/.":               "invalid",
+		"assets/bad/../x":        "invalid",
+		"assetsx":                "outside the prefix",
+		"other/file.txt":         "outside the prefix",
+		"assets/only-bad//child": "invalid",
+	} {
+		kv.Set([]byte(key), []byte(value))
+	}
+	return kv
+}
+
+func TestFS(t *testing.T) {
+	fsys := New(testKV(), "assets/")
+	if err := fstest.TestFS(fsys, "index.html", "css/site.css", "css/print.css", "js/app/main.js", "a.txt", "a/b.txt", "empty", "dup"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dirNamesは、ReadDirの結果を、ディレクトリの名前に"/"を付けて返します。
+func dirNames(t *testing.T, fsys fs.ReadDirFS, name string) string {
+	t.Helper()
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		t.Fatalf("ReadDir(%q): %v", name, err)
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name()+"/")
+		} else {
+			out = append(out, e.Name())
+		}
+	}
+	return fmt.Sprint(out)
+}
+
+func TestReadDir(t *testing.T) {
+	fsys := New(testKV(), "assets/")
+	for name, want := range map[string]string{
+		".":      "[a/ a.txt css/ dup empty index.html js/]",
+		"css":    "[print.css site.css]",
+		"js":     "[app/]",
+		"js/app": "[main.js]",
+	} {
+		if got := dirNames(t, fsys, name); got != want {
+			t.Errorf("ReadDir(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+// TestFileShadowsDirは、同じ名前のキーとディレクトリがある場合に、ファイルだけが見えることを確かめます。
+func TestFileShadowsDir(t *testing.T) {
+	fsys := New(testKV(), "assets/")
+	if b, err := fsys.ReadFile("dup"); err != nil || string(b) != "file" {
+		t.Fatalf("ReadFile(dup) = %q, %v", b, err)
+	}
+	if fi, err := fsys.Stat("dup"); err != nil || fi.IsDir() {
+		t.Fatalf("Stat(dup) = %v, %v, want a file", fi, err)
+	}
+	for _, name := range []string{"dup/hidden.txt"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want ErrNotExist", name, err)
+		}
+		if _, err := fsys.ReadFile(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFile(%q) = %v, want ErrNotExist", name, err)
+		}
+	}
+	if _, err := fsys.ReadDir("dup"); err == nil {
+		t.Fatal("ReadDir(dup) listed a file")
+	}
+}
+
+// TestInvalidPathsは、パスとして正しくないキーが見えず、正しくない名前で開くとErrInvalidになることを確かめます。
+func TestInvalidPaths(t *testing.T) {
+	fsys := New(testKV(), "assets/")
+	for _, name := range []string{"/double", "./dot", "../up", "trailing/", "bad/../x", "/index.html", "css/"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q) = %v, want ErrInvalid", name, err)
+		}
+		if _, err := fsys.ReadFile(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("ReadFile(%q) = %v, want ErrInvalid", name, err)
+		}
+	}
+	// 正しいパスのキーを1つも含まないディレクトリは、存在しない。
+	for _, name := range []string{"bad", "only-bad", "trailing"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want ErrNotExist", name, err)
+		}
+	}
+	if _, err := fsys.ReadFile("."); err == nil {
+		t.Fatal("ReadFile(.) succeeded")
+	}
+}
+
+// TestPrefixは、prefixを取り除いたパスだけが見え、prefixが空の場合はすべてのキーが見えることを確かめます。
+func TestPrefix(t *testing.T) {
+	kv := testKV()
+	if b, err := New(kv, "assets/css/").ReadFile("site.css"); err != nil || string(b) != "body{}" {
+		t.Fatalf("ReadFile(site.css) under assets/css/ = %q, %v", b, err)
+	}
+	if got := dirNames(t, New(kv, "assets/css/"), "."); got != "[print.css site.css]" {
+		t.Fatalf("ReadDir(.) under assets/css/ = %s", got)
+	}
+	if _, err := New(kv, "assets/").Open("assetsx"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Open(assetsx) under assets/ = %v, want ErrNotExist", err)
+	}
+	all := New(kv, "")
+	if got := dirNames(t, all, "."); got != "[assets/ assetsx other/]" {
+		t.Fatalf("ReadDir(.) with no prefix = %s", got)
+	}
+	if b, err := all.ReadFile("assets/js/app/main.js"); err != nil || string(b) != "main()" {
+		t.Fatalf("ReadFile(assets/js/app/main.js) with no prefix = %q, %v", b, err)
+	}
+	// "assets"で始まるが"assets/"で始まらないキーは、ディレクトリassetsの中には見えない。
+	if got := dirNames(t, all, "assets"); got != "[a/ a.txt css/ dup empty index.html js/]" {
+		t.Fatalf("ReadDir(assets) with no prefix = %s", got)
+	}
+}
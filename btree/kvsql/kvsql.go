@@ -0,0 +1,299 @@
+// Package kvsqlは、btree.OrderedKVをテーブルとして読み取り専用で公開する、最小限のdatabase/sqlのドライバを提供します。
+// SQLで読むことを前提にしたレポートのツールから、ストアの内容を直接読めるようにするためのものです。
+//
+// 各テーブルはkeyとvalueの2つの列を持ち、キーの順に並んでいます。使えるのは次の形のSELECT文だけで、WHEREの条件はキーの範囲の走査に変換されます。
+//
+//	SELECT key, value FROM bucket WHERE key BETWEEN ? AND ? LIMIT ?
+//
+// 列は*、key、value、key, valueのいずれか、WHEREの条件はkey = v、key < v、key <= v、key > v、key >= v、key BETWEEN v AND vをANDでつないだもので、
+// vは文字列リテラルか?です。ORDER BY key [ASC]は書けますが、結果は常にキーの昇順です。値は文字列か[]byteで渡し、列は[]byteで返ります。
+//
+// テーブルはCatalogに名前を付けて登録し、sql.OpenDB(catalog.Connector())で開くか、Registerで付けた名前をDSNにしてsql.Open(DriverName, dsn)で開きます。
+// OrderedKVは並行な書き込みに対して安全ではないので、クエリの実行中にテーブルへ書き込んではいけません。
+package kvsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/seipan/btree/btree"
+)
+
+// DriverNameは、sql.Openに渡すこのドライバの名前です。
+const DriverName = "btreekv"
+
+// ErrReadOnlyは、書き込みや読み書きのトランザクションを行おうとしたことを示します。
+var ErrReadOnly = errors.New("kvsql: the database is read-only")
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Catalog{}
+)
+
+func init() {
+	sql.Register(DriverName, Driver{})
+}
+
+type (
+	// Catalogは、テーブル名からOrderedKVへの対応です。
+	Catalog struct {
+		mu     sync.RWMutex
+		tables map[string]*btree.OrderedKV
+	}
+
+	// Driverは、Registerで登録したCatalogをDSNの名前で開くdatabase/sqlのドライバです。
+	Driver struct{}
+
+	// connectorは、1つのCatalogに接続するdriver.Connectorです。
+	connector struct {
+		cat *Catalog
+	}
+
+	conn struct {
+		cat *Catalog
+	}
+
+	stmt struct {
+		cat *Catalog
+		q   *query
+	}
+
+	// txは、読み取り専用のトランザクションです。読み取りは常にその時点のテーブルに対して行うので、何もしません。
+	tx struct{}
+
+	// rowsは、クエリの結果です。1行ごとに直前のキーの次から範囲を走査し直すので、結果をまとめてメモリに持ちません。
+	rows struct {
+		kv   *btree.OrderedKV
+		cols []string
+		next []byte
+		end  []byte
+		left int
+		done bool
+	}
+)
+
+// NewCatalogは、空のCatalogを作成します。
+func NewCatalog() *Catalog {
+	return &Catalog{tables: map[string]*btree.OrderedKV{}}
+}
+
+// AddTableは、kvをnameという名前のテーブルとして登録します。同じ名前のテーブルがあれば置き換えます。
+func (c *Catalog) AddTable(name string, kv *btree.OrderedKV) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[name] = kv
+}
+
+func (c *Catalog) table(name string) (*btree.OrderedKV, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	kv, ok := c.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("kvsql: no such table: %s", name)
+	}
+	return kv, nil
+}
+
+// Connectorは、cに接続するdriver.Connectorを返します。sql.OpenDBに渡して使います。
+func (c *Catalog) Connector() driver.Connector {
+	return connector{cat: c}
+}
+
+// Registerは、cをdsnという名前で登録し、sql.Open(DriverName, dsn)で開けるようにします。同じ名前で登録すると置き換えます。
+func Register(dsn string, c *Catalog) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[dsn] = c
+}
+
+// Openは、dsnの名前で登録したCatalogへの接続を返します。
+func (Driver) Open(dsn string) (driver.Conn, error) {
+	registryMu.Lock()
+	c, ok := registry[dsn]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("kvsql: no catalog registered as %q", dsn)
+	}
+	return &conn{cat: c}, nil
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{cat: c.cat}, nil
+}
+
+func (connector) Driver() driver.Driver {
+	return Driver{}
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	q, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{cat: c.cat, q: q}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+// Beginは、読み書きのトランザクションは使えないので、常にErrReadOnlyを返します。
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrReadOnly
+}
+
+// BeginTxは、読み取り専用のトランザクションだけを開始します。
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	return tx{}, nil
+}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.q.params
+}
+
+func (s *stmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnly
+}
+
+// Queryは、WHEREの条件をキーの範囲 [start, end) にまとめ、その範囲を走査する結果を返します。
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	kv, err := s.cat.table(s.q.table)
+	if err != nil {
+		return nil, err
+	}
+	var lower, upper [][]byte // 下限（含む）と上限（含まない）の候補
+	if s.q.eq != nil {
+		v, err := value(*s.q.eq, args)
+		if err != nil {
+			return nil, err
+		}
+		lower, upper = append(lower, v), append(upper, successor(v))
+	}
+	if b := s.q.lo; b.set {
+		v, err := value(b.v, args)
+		if err != nil {
+			return nil, err
+		}
+		if !b.inclusive {
+			v = successor(v)
+		}
+		lower = append(lower, v)
+	}
+	if b := s.q.hi; b.set {
+		v, err := value(b.v, args)
+		if err != nil {
+			return nil, err
+		}
+		if b.inclusive {
+			v = successor(v)
+		}
+		upper = append(upper, v)
+	}
+	limit, err := s.limit(args)
+	if err != nil {
+		return nil, err
+	}
+	r := &rows{kv: kv, cols: s.q.cols, left: limit}
+	for _, v := range lower {
+		if r.next == nil || bytes.Compare(v, r.next) > 0 {
+			r.next = v
+		}
+	}
+	for _, v := range upper {
+		if r.end == nil || bytes.Compare(v, r.end) < 0 {
+			r.end = v
+		}
+	}
+	r.done = r.next != nil && r.end != nil && bytes.Compare(r.next, r.end) >= 0
+	return r, nil
+}
+
+// limitは、LIMITの値を返します。LIMITがない場合は-1を返します。
+func (s *stmt) limit(args []driver.Value) (int, error) {
+	l := s.q.limit
+	if l == nil {
+		return -1, nil
+	}
+	if l.param < 0 {
+		return strconv.Atoi(l.lit)
+	}
+	n, ok := args[l.param].(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("kvsql: LIMIT must be a non-negative integer, got %v", args[l.param])
+	}
+	return int(n), nil
+}
+
+// valueは、operandのバイト列を返します。
+func value(o operand, args []driver.Value) ([]byte, error) {
+	if o.param < 0 {
+		return []byte(o.lit), nil
+	}
+	switch v := args[o.param].(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("kvsql: key argument %d must be a string or []byte, got %T", o.param+1, args[o.param])
+}
+
+// successorは、vより大きい最小のキー（vの後に0x00を付けたもの）を返します。
+func successor(v []byte) []byte {
+	return append(v[:len(v):len(v)], 0)
+}
+
+func (r *rows) Columns() []string {
+	return r.cols
+}
+
+func (r *rows) Close() error {
+	r.done = true
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done || r.left == 0 {
+		return io.EOF
+	}
+	var key, val []byte
+	found := false
+	r.kv.Range(r.next, r.end, func(k, v []byte) bool {
+		key, val, found = k, v, true
+		return false
+	})
+	if !found {
+		r.done = true
+		return io.EOF
+	}
+	r.next = successor(key)
+	if r.left > 0 {
+		r.left--
+	}
+	for i, c := range r.cols {
+		// ストアの内部のスライスを呼び出し元に渡さないようにコピーする。
+		if c == "key" {
+			dest[i] = append([]byte{}, key...)
+		} else {
+			dest[i] = append([]byte{}, val...)
+		}
+	}
+	return nil
+}
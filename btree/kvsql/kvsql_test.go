@@ -0,0 +1,138 @@
+package kvsql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/seipan/btree/btree"
+)
+
+// openTestは、k00からk98までの偶数のキーと、それぞれv00からv98までの値を持つテーブルtを登録したデータベースを開きます。
+func openTest(t *testing.T) (*sql.DB, []string) {
+	t.Helper()
+	kv := btree.NewOrderedKV(3)
+	var keys []string
+	for i := 0; i < 100; i += 2 {
+		key := fmt.Sprintf("k%02d", i)
+		kv.Set([]byte(key), []byte(fmt.Sprintf("v%02d", i)))
+		keys = append(keys, key)
+	}
+	cat := NewCatalog()
+	cat.AddTable("t", kv)
+	db := sql.OpenDB(cat.Connector())
+	t.Cleanup(func() { db.Close() })
+	return db, keys
+}
+
+// queryKeysは、最初の列がkeyのクエリを実行し、その列を返します。
+func queryKeys(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("%s %v: %v", query, args, err)
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(key))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestQueryRanges(t *testing.T) {
+	db, keys := openTest(t)
+	for _, tc := range []struct {
+		query string
+		args  []interface{}
+		keep  func(key string) bool
+		limit int
+	}{
+		{"SELECT key FROM t", nil, func(string) bool { return true }, -1},
+		{"SELECT key FROM t WHERE key = 'k10'", nil, func(k string) bool { return k == "k10" }, -1},
+		{"SELECT key FROM t WHERE key = ?", []interface{}{"k11"}, func(string) bool { return false }, -1},
+		{"SELECT key FROM t WHERE key < 'k10'", nil, func(k string) bool { return k < "k10" }, -1},
+		{"SELECT key FROM t WHERE key <= 'k10'", nil, func(k string) bool { return k <= "k10" }, -1},
+		{"SELECT key FROM t WHERE key > 'k90'", nil, func(k string) bool { return k > "k90" }, -1},
+		{"SELECT key FROM t WHERE key >= ?", []interface{}{[]byte("k90")}, func(k string) bool { return k >= "k90" }, -1},
+		{"SELECT key FROM t WHERE key BETWEEN ? AND ?", []interface{}{"k15", "k30"}, func(k string) bool { return k >= "k15" && k <= "k30" }, -1},
+		{"SELECT key FROM t WHERE key > 'k20' AND key < 'k30'", nil, func(k string) bool { return k > "k20" && k < "k30" }, -1},
+		{"SELECT key FROM t WHERE key = 'k20' AND key >= 'k10'", nil, func(k string) bool { return k == "k20" }, -1},
+		{"SELECT key FROM t WHERE key = 'k20' AND key > 'k20'", nil, func(string) bool { return false }, -1},
+		{"SELECT key FROM t WHERE key BETWEEN 'k30' AND 'k20'", nil, func(string) bool { return false }, -1},
+		{"SELECT key FROM t WHERE key >= 'k50' LIMIT 3", nil, func(k string) bool { return k >= "k50" }, 3},
+		{"SELECT key FROM t WHERE key BETWEEN ? AND ? LIMIT ?", []interface{}{"k10", "k90", 5}, func(k string) bool { return k >= "k10" && k <= "k90" }, 5},
+		{"SELECT key FROM t LIMIT 0", nil, func(string) bool { return true }, 0},
+		{"SELECT key FROM t WHERE key >= 'k96' LIMIT 10", nil, func(k string) bool { return k >= "k96" }, 10},
+	} {
+		want := []string{}
+		for _, k := range keys {
+			if tc.keep(k) && (tc.limit < 0 || len(want) < tc.limit) {
+				want = append(want, k)
+			}
+		}
+		if got := queryKeys(t, db, tc.query, tc.args...); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s %v = %v, want %v", tc.query, tc.args, got, want)
+		}
+	}
+}
+
+func TestQueryColumns(t *testing.T) {
+	db, _ := openTest(t)
+	var key, value []byte
+	if err := db.QueryRow("SELECT * FROM t WHERE key = 'k42'").Scan(&key, &value); err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "k42" || string(value) != "v42" {
+		t.Fatalf("SELECT * = %q, %q", key, value)
+	}
+	if err := db.QueryRow("SELECT value FROM t WHERE key > 'k42'").Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "v44" {
+		t.Fatalf("SELECT value = %q, want v44", value)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	db, _ := openTest(t)
+	if _, err := db.Query("SELECT * FROM missing"); err == nil {
+		t.Fatal("query of a missing table succeeded")
+	}
+	if _, err := db.Query("SELECT * FROM t WHERE key = ?", 5); err == nil {
+		t.Fatal("an integer key argument was accepted")
+	}
+	if _, err := db.Query("SELECT * FROM t LIMIT ?", -1); err == nil {
+		t.Fatal("a negative LIMIT was accepted")
+	}
+	if _, err := db.Exec("SELECT * FROM t"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Exec = %v, want ErrReadOnly", err)
+	}
+	if _, err := db.Begin(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Begin = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	kv := btree.NewOrderedKV(3)
+	kv.Set([]byte("a"), []byte("1"))
+	cat := NewCatalog()
+	cat.AddTable("t", kv)
+	Register("kvsql-test", cat)
+	db, err := sql.Open(DriverName, "kvsql-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := queryKeys(t, db, "SELECT key FROM t"); fmt.Sprint(got) != "[a]" {
+		t.Fatalf("query through the registered catalog = %v", got)
+	}
+}
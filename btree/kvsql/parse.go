@@ -0,0 +1,314 @@
+package kvsql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tokenKindは、字句の種類です。
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokParam
+	tokSymbol
+)
+
+type (
+	// tokenは、クエリの1つの字句です。キーワードは大文字と小文字を区別せずに比べます。
+	token struct {
+		kind tokenKind
+		text string
+	}
+
+	// operandは、値の字句です。paramが0以上の場合は、その番号のプレースホルダです。
+	operand struct {
+		lit   string
+		param int
+	}
+
+	// boundは、キーの条件の一方の境界です。
+	bound struct {
+		set       bool
+		v         operand
+		inclusive bool
+	}
+
+	// queryは、解析したSELECT文です。
+	query struct {
+		table  string
+		cols   []string
+		eq     *operand
+		lo, hi bound
+		limit  *operand
+		params int
+	}
+)
+
+// lexは、sを字句に分けます。
+func lex(s string) ([]token, error) {
+	var out []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(s) {
+					return nil, errors.New("kvsql: unterminated string literal")
+				}
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						b.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+			}
+			out = append(out, token{tokString, b.String()})
+			i = j + 1
+		case c == '?':
+			out = append(out, token{tokParam, "?"})
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			out = append(out, token{tokNumber, s[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			out = append(out, token{tokIdent, s[i:j]})
+			i = j
+		case c == '<' || c == '>':
+			if i+1 < len(s) && s[i+1] == '=' {
+				out = append(out, token{tokSymbol, s[i : i+2]})
+				i += 2
+			} else {
+				out = append(out, token{tokSymbol, s[i : i+1]})
+				i++
+			}
+		case strings.IndexByte("=*,;", c) >= 0:
+			out = append(out, token{tokSymbol, s[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("kvsql: unexpected character %q", c)
+		}
+	}
+	return append(out, token{kind: tokEOF}), nil
+}
+
+// parserは、字句の列からSELECT文を読む再帰下降の構文解析器です。
+type parser struct {
+	toks []token
+	pos  int
+	q    query
+}
+
+// parseは、次の形のSELECT文を解析します。キーワードと列名の大文字と小文字は区別しません。
+//
+//	SELECT {* | key | value | key, value} FROM table
+//	  [WHERE cond [AND cond ...]] [ORDER BY key [ASC]] [LIMIT n] [;]
+//
+// condは、key = v、key < v、key <= v、key > v、key >= v、key BETWEEN v AND v のいずれかで、vは文字列リテラルか?です。
+func parse(s string) (*query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return &p.q, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// acceptは、次の字句がtextのキーワードか記号なら読み進めてtrueを返します。
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokIdent && strings.EqualFold(t.text, text)) || (t.kind == tokSymbol && t.text == text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %s", text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	near := t.text
+	if t.kind == tokEOF {
+		near = "end of query"
+	}
+	return fmt.Errorf("kvsql: %s near %q", fmt.Sprintf(format, args...), near)
+}
+
+func (p *parser) parse() error {
+	if !p.accept("SELECT") {
+		return errors.New("kvsql: only SELECT statements are supported")
+	}
+	if p.accept("*") {
+		p.q.cols = []string{"key", "value"}
+	} else {
+		for {
+			t := p.peek()
+			col := strings.ToLower(t.text)
+			if t.kind != tokIdent || (col != "key" && col != "value") {
+				return p.errorf("expected column key or value")
+			}
+			p.next()
+			p.q.cols = append(p.q.cols, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	t := p.peek()
+	if t.kind != tokIdent && t.kind != tokString {
+		return p.errorf("expected table name")
+	}
+	p.next()
+	// 識別子に使えない文字を含むテーブル名は、文字列リテラルで書ける。
+	p.q.table = t.text
+	if p.accept("WHERE") {
+		for {
+			if err := p.cond(); err != nil {
+				return err
+			}
+			if !p.accept("AND") {
+				break
+			}
+		}
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return err
+		}
+		if err := p.expect("KEY"); err != nil {
+			return err
+		}
+		if p.accept("DESC") {
+			return errors.New("kvsql: ORDER BY key DESC is not supported")
+		}
+		p.accept("ASC")
+	}
+	if p.accept("LIMIT") {
+		switch t := p.peek(); t.kind {
+		case tokNumber:
+			p.q.limit = &operand{lit: t.text, param: -1}
+		case tokParam:
+			p.q.limit = &operand{param: p.q.params}
+			p.q.params++
+		default:
+			return p.errorf("expected number or ? after LIMIT")
+		}
+		p.next()
+	}
+	p.accept(";")
+	if p.peek().kind != tokEOF {
+		return p.errorf("unexpected trailing input")
+	}
+	return nil
+}
+
+// condは、keyに対する1つの条件を読み、境界を狭めます。
+func (p *parser) cond() error {
+	if err := p.expect("KEY"); err != nil {
+		return err
+	}
+	if p.accept("BETWEEN") {
+		lo, err := p.operand()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("AND"); err != nil {
+			return err
+		}
+		hi, err := p.operand()
+		if err != nil {
+			return err
+		}
+		return p.setBounds(&p.q.lo, bound{true, lo, true}, &p.q.hi, bound{true, hi, true})
+	}
+	op := p.peek()
+	if op.kind != tokSymbol || strings.IndexByte("=<>", op.text[0]) < 0 {
+		return p.errorf("expected comparison operator")
+	}
+	p.next()
+	v, err := p.operand()
+	if err != nil {
+		return err
+	}
+	switch op.text {
+	case "=":
+		if p.q.eq != nil {
+			return errors.New("kvsql: more than one key = condition")
+		}
+		p.q.eq = &v
+		return nil
+	case ">", ">=":
+		return p.setBounds(&p.q.lo, bound{true, v, op.text == ">="}, nil, bound{})
+	default: // "<", "<="
+		return p.setBounds(&p.q.hi, bound{true, v, op.text == "<="}, nil, bound{})
+	}
+}
+
+// setBoundsは、境界を設定します。同じ側の境界を2回指定するとエラーです。
+func (p *parser) setBounds(a *bound, av bound, b *bound, bv bound) error {
+	if a.set || (b != nil && b.set) {
+		return errors.New("kvsql: key bound specified more than once")
+	}
+	*a = av
+	if b != nil {
+		*b = bv
+	}
+	return nil
+}
+
+// operandは、文字列リテラルか?を読みます。
+func (p *parser) operand() (operand, error) {
+	switch t := p.peek(); t.kind {
+	case tokString:
+		p.next()
+		return operand{lit: t.text, param: -1}, nil
+	case tokParam:
+		p.next()
+		p.q.params++
+		return operand{param: p.q.params - 1}, nil
+	}
+	return operand{}, p.errorf("expected string literal or ?")
+}
@@ -0,0 +1,80 @@
+package kvsql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// litとparamは、期待するqueryを書くためのoperandです。
+func lit(s string) operand { return operand{lit: s, param: -1} }
+func param(n int) operand  { return operand{param: n} }
+
+func TestParse(t *testing.T) {
+	a, z := lit("a"), lit("z")
+	for _, tc := range []struct {
+		sql  string
+		want query
+	}{
+		{"SELECT * FROM t", query{table: "t", cols: []string{"key", "value"}}},
+		{"select Key from T", query{table: "T", cols: []string{"key"}}},
+		{"SELECT value, key FROM 'my table';", query{table: "my table", cols: []string{"value", "key"}}},
+		{"SELECT key FROM t WHERE key = 'a'", query{table: "t", cols: []string{"key"}, eq: &a}},
+		{"SELECT key FROM t WHERE key < 'a'", query{table: "t", cols: []string{"key"}, hi: bound{true, a, false}}},
+		{"SELECT key FROM t WHERE key <= 'a'", query{table: "t", cols: []string{"key"}, hi: bound{true, a, true}}},
+		{"SELECT key FROM t WHERE key > 'a'", query{table: "t", cols: []string{"key"}, lo: bound{true, a, false}}},
+		{"SELECT key FROM t WHERE key >= 'a'", query{table: "t", cols: []string{"key"}, lo: bound{true, a, true}}},
+		{"SELECT key FROM t WHERE key BETWEEN 'a' AND 'z'", query{table: "t", cols: []string{"key"}, lo: bound{true, a, true}, hi: bound{true, z, true}}},
+		{"SELECT key FROM t WHERE key > 'a' AND key < 'z'", query{table: "t", cols: []string{"key"}, lo: bound{true, a, false}, hi: bound{true, z, false}}},
+		// ''は1つの'を表す。
+		{"SELECT key FROM t WHERE key = 'it''s'''", query{table: "t", cols: []string{"key"}, eq: &operand{lit: "it's'", param: -1}}},
+		{"SELECT key FROM t WHERE key = ''", query{table: "t", cols: []string{"key"}, eq: &operand{lit: "", param: -1}}},
+		// LIMITの?は、WHEREの?の後に番号が付く。
+		{"SELECT * FROM t WHERE key BETWEEN ? AND ? LIMIT ?", query{
+			table: "t", cols: []string{"key", "value"},
+			lo: bound{true, param(0), true}, hi: bound{true, param(1), true}, limit: &operand{param: 2}, params: 3,
+		}},
+		{"SELECT * FROM t WHERE key = ? AND key >= 'a' ORDER BY key ASC LIMIT 10;", query{
+			table: "t", cols: []string{"key", "value"},
+			eq: &operand{param: 0}, lo: bound{true, a, true}, limit: &operand{lit: "10", param: -1}, params: 1,
+		}},
+		{"SELECT * FROM t ORDER BY KEY", query{table: "t", cols: []string{"key", "value"}}},
+	} {
+		got, err := parse(tc.sql)
+		if err != nil {
+			t.Errorf("parse(%q): %v", tc.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("parse(%q) = %+v, want %+v", tc.sql, *got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		sql, err string
+	}{
+		{"DELETE FROM t", "only SELECT"},
+		{"SELECT name FROM t", "expected column"},
+		{"SELECT * t", "expected FROM"},
+		{"SELECT * FROM t WHERE key = 'abc", "unterminated string"},
+		{"SELECT * FROM t WHERE key ! 'a'", "unexpected character"},
+		{"SELECT * FROM t WHERE value = 'a'", "expected KEY"},
+		{"SELECT * FROM t WHERE key = 1", "expected string literal or ?"},
+		{"SELECT * FROM t WHERE key = 'a' AND key = 'b'", "more than one key ="},
+		{"SELECT * FROM t WHERE key > 'a' AND key >= 'b'", "more than once"},
+		{"SELECT * FROM t WHERE key < 'a' AND key BETWEEN 'b' AND 'c'", "more than once"},
+		{"SELECT * FROM t WHERE key BETWEEN 'a' AND 'b' AND key > 'c'", "more than once"},
+		{"SELECT * FROM t ORDER BY key DESC", "DESC is not supported"},
+		{"SELECT * FROM t ORDER BY value", "expected KEY"},
+		{"SELECT * FROM t LIMIT 'x'", "expected number or ?"},
+		{"SELECT * FROM t LIMIT 1 OFFSET 2", "unexpected trailing input"},
+		{"SELECT * FROM t; SELECT * FROM u", "unexpected trailing input"},
+	} {
+		_, err := parse(tc.sql)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("parse(%q) = %v, want an error containing %q", tc.sql, err, tc.err)
+		}
+	}
+}
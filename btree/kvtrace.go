@@ -0,0 +1,191 @@
+package btree
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTraceCapacityは、Traceが保持するイベントの数の既定値です。
+const DefaultTraceCapacity = 1024
+
+type (
+	// KVTraceは、OrderedKVのパターンに一致するキーへの書き込みの記録です。Traceで作ります。
+	//
+	// イベントはリングバッファに保持し、一杯になると古いものから捨てます。記録はOrderedKVへの書き込みの中で行いますが、
+	// EventsとStopは別のゴルーチンから呼んでも構いません。
+	KVTrace struct {
+		kv      *OrderedKV
+		pattern string
+		mu      sync.Mutex
+		ring    []KVTraceEvent
+		// startは、ringの中で最も古いイベントの位置です。
+		start   int
+		seq     uint64
+		dropped uint64
+		stopped bool
+	}
+
+	// KVTraceEventは、記録した1つの書き込みです。
+	KVTraceEvent struct {
+		// Seqは、このトレースの中での通し番号です。1から始まります。
+		Seq uint64
+		// Timeは、書き込みの時刻です。
+		Time time.Time
+		// Opは、操作の名前です。"set"、"delete"、"softdelete"、"undelete"、"purge"、"clear"のいずれかです。
+		Op string
+		// Keyは、書き込んだキーのコピーです。
+		Key []byte
+		// Foundは、操作の前にキーがあったかどうかです。setでは置き換えたかどうかで、何も変えなかったdeleteとsoftdeleteではfalseです。
+		// undelete、purge、clearは実際に変更した場合だけ記録するので、常にtrueです。
+		Found bool
+		// Callerは、OrderedKVのメソッドを呼び出した関数とその位置（"関数名 ファイル:行"）です。
+		Caller string
+	}
+)
+
+// Traceは、patternに一致するキーへの書き込みを記録し始め、その記録を返します。
+// patternでは、*が任意のバイト列に、?が任意の1バイトに一致し、\の後の文字はその文字そのものに一致します。それ以外のバイトはそのバイトに一致します。
+// capacityは保持するイベントの数で、0以下の場合はDefaultTraceCapacityです。
+//
+// 「誰がこのキーを消したのか」を調べるために、読み取りは記録せず、書き込みだけを記録します。
+// 記録している間は、一致するキーへの書き込みごとに呼び出し元のスタックを調べるので、少し遅くなります。不要になったらStopしてください。
+func (kv *OrderedKV) Trace(pattern string, capacity int) *KVTrace {
+	if capacity <= 0 {
+		capacity = DefaultTraceCapacity
+	}
+	t := &KVTrace{kv: kv, pattern: pattern, ring: make([]KVTraceEvent, 0, capacity)}
+	kv.traces = append(kv.traces, t)
+	return t
+}
+
+// Stopは、記録をやめます。それまでに記録したイベントはEventsで読めます。OrderedKVへの書き込みと同時に呼んではいけません。
+func (t *KVTrace) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	t.mu.Unlock()
+	traces := t.kv.traces[:0]
+	for _, other := range t.kv.traces {
+		if other != t {
+			traces = append(traces, other)
+		}
+	}
+	t.kv.traces = traces
+}
+
+// Eventsは、保持しているイベントのコピーを古い順に返します。
+func (t *KVTrace) Events() []KVTraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]KVTraceEvent, 0, len(t.ring))
+	out = append(out, t.ring[t.start:]...)
+	return append(out, t.ring[:t.start]...)
+}
+
+// Droppedは、リングバッファが一杯で捨てたイベントの数を返します。
+func (t *KVTrace) Dropped() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Stringは、保持しているイベントを1行ずつの人が読める形式で返します。
+func (t *KVTrace) String() string {
+	var b strings.Builder
+	for _, e := range t.Events() {
+		fmt.Fprintf(&b, "#%d %s %-10s %q found=%v %s\n", e.Seq, e.Time.Format(time.RFC3339Nano), e.Op, e.Key, e.Found, e.Caller)
+	}
+	return b.String()
+}
+
+func (t *KVTrace) record(e KVTraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.seq++
+	e.Seq = t.seq
+	if len(t.ring) < cap(t.ring) {
+		t.ring = append(t.ring, e)
+		return
+	}
+	t.ring[t.start] = e
+	t.start = (t.start + 1) % len(t.ring)
+	t.dropped++
+}
+
+// traceOpは、keyに一致するトレースがあれば、操作を記録します。トレースがなければ何もしません。
+func (kv *OrderedKV) traceOp(op string, key []byte, found bool) {
+	if len(kv.traces) == 0 {
+		return
+	}
+	var e *KVTraceEvent
+	for _, t := range kv.traces {
+		if !globMatch(t.pattern, key) {
+			continue
+		}
+		if e == nil {
+			e = &KVTraceEvent{Time: kv.clock(), Op: op, Key: append([]byte(nil), key...), Found: found, Caller: kvCaller()}
+		}
+		t.record(*e)
+	}
+}
+
+// kvCallerは、OrderedKVのメソッドの外側で最初の呼び出し元を返します。
+func kvCaller() string {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.Contains(f.Function, ".(*OrderedKV).") && !strings.HasSuffix(f.Function, ".kvCaller") {
+			return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// globMatchは、keyがpatternに一致するかどうかを返します。パターンの意味はTraceを参照してください。
+func globMatch(pattern string, key []byte) bool {
+	// 最後に見た*の位置と、そのときのkeyの位置から、一致しなければ*の一致を1バイトずつ伸ばしてやり直す。
+	p, k := 0, 0
+	star, mark := -1, 0
+	for k < len(key) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, k
+			p++
+			continue
+		case p < len(pattern) && pattern[p] == '?':
+			p++
+			k++
+			continue
+		case p < len(pattern):
+			c := pattern[p]
+			next := p + 1
+			if c == '\\' && p+1 < len(pattern) {
+				c, next = pattern[p+1], p+2
+			}
+			if c == key[k] {
+				p = next
+				k++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		p = star + 1
+		mark++
+		k = mark
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,131 @@
+package btree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// traceOpsは、イベントを"seq op key found"の形で返します。
+func traceOps(events []KVTraceEvent) []string {
+	out := []string{}
+	for _, e := range events {
+		out = append(out, fmt.Sprintf("%d %s %s %v", e.Seq, e.Op, e.Key, e.Found))
+	}
+	return out
+}
+
+func TestTrace(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	kv := NewOrderedKV(3)
+	kv.now = func() time.Time { return now }
+	tr := kv.Trace("user:*", 0)
+	kv.Set([]byte("user:1"), []byte("a"))
+	kv.Set([]byte("user:1"), []byte("b"))
+	kv.Set([]byte("other"), []byte("x"))
+	kv.Get([]byte("user:1"))
+	kv.Delete([]byte("user:2"))
+	kv.SoftDelete([]byte("user:1"))
+	kv.SoftDelete([]byte("user:1"))
+	kv.Undelete([]byte("user:1"))
+	kv.Set([]byte("user:2"), nil)
+	kv.SetTrashRetention(time.Hour)
+	kv.SoftDelete([]byte("user:2"))
+	now = now.Add(time.Hour)
+	kv.PurgeTrash()
+	kv.Delete([]byte("user:1"))
+	kv.Set([]byte("user:3"), nil)
+	kv.Clear()
+
+	want := []string{
+		"1 set user:1 false",
+		"2 set user:1 true",
+		"3 delete user:2 false",
+		"4 softdelete user:1 true",
+		"5 softdelete user:1 false",
+		"6 undelete user:1 true",
+		"7 set user:2 false",
+		"8 softdelete user:2 true",
+		"9 purge user:2 true",
+		"10 delete user:1 true",
+		"11 set user:3 false",
+		"12 clear user:3 true",
+	}
+	events := tr.Events()
+	if got := traceOps(events); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("trace =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// 呼び出し元は、OrderedKVのメソッドではなくこのテストになる。
+	for _, e := range events {
+		if !strings.Contains(e.Caller, "TestTrace ") || !strings.Contains(e.Caller, "kvtrace_test.go:") {
+			t.Fatalf("event %d has caller %q", e.Seq, e.Caller)
+		}
+	}
+	if !events[0].Time.Equal(now.Add(-time.Hour)) || !events[8].Time.Equal(now) {
+		t.Fatalf("event times %v and %v", events[0].Time, events[8].Time)
+	}
+	// 記録したキーは、呼び出し元のスライスのコピーである。
+	key := []byte("user:4")
+	kv.Set(key, nil)
+	key[0] = 'x'
+	if events := tr.Events(); string(events[len(events)-1].Key) != "user:4" {
+		t.Fatalf("recorded key %q changed with the caller's slice", events[len(events)-1].Key)
+	}
+
+	tr.Stop()
+	kv.Set([]byte("user:5"), nil)
+	if n := len(tr.Events()); n != 13 {
+		t.Fatalf("%d events after Stop, want 13", n)
+	}
+	if len(kv.traces) != 0 {
+		t.Fatalf("%d traces left after Stop", len(kv.traces))
+	}
+}
+
+func TestTraceRing(t *testing.T) {
+	kv := NewOrderedKV(3)
+	tr := kv.Trace("*", 3)
+	for i := 0; i < 5; i++ {
+		kv.Set([]byte(fmt.Sprint(i)), nil)
+	}
+	if got := fmt.Sprint(traceOps(tr.Events())); got != "[3 set 2 false 4 set 3 false 5 set 4 false]" {
+		t.Fatalf("events = %s", got)
+	}
+	if tr.Dropped() != 2 {
+		t.Fatalf("Dropped = %d, want 2", tr.Dropped())
+	}
+	if lines := strings.Count(tr.String(), "\n"); lines != 3 {
+		t.Fatalf("String has %d lines, want 3", lines)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "abcbc", true},
+		{"a*c", "abcb", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*b*d", "abcbd", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{`a\?`, "ab", false},
+		{`a\`, `a\`, true},
+		{"**", "x", true},
+	} {
+		if got := globMatch(tc.pattern, []byte(tc.key)); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
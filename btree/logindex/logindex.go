@@ -0,0 +1,198 @@
+// Package logindexは、追記専用のログファイルに対して、N件ごとのキーとファイル内のオフセットだけを持つ疎なBTreeインデックスを提供します。
+// 検索は、木で目的のキー以下の最も近いエントリを探し、そこからログを短く走査するだけで済みます。
+//
+// ログは、uvarintのキー長、キー、uvarintの値の長さ、値を1レコードとして並べたものです。
+// キーは厳密に昇順で追記されなければなりません（シーケンス番号やタイムスタンプのように）。
+package logindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/seipan/btree/btree"
+)
+
+// maxRecordSizeは、1レコードのキーまたは値の長さの上限です。壊れたログで巨大な割り当てをしないために使われます。
+const maxRecordSize = 1 << 30
+
+var (
+	// ErrOutOfOrderは、直前に追記したキー以下のキーを追記しようとしたことを示します。
+	ErrOutOfOrder = errors.New("logindex: key is not greater than the last appended key")
+)
+
+type (
+	// Logは、インデックスの対象となるログです。O_APPENDで開いた*os.Fileはこれを満たします。
+	Log interface {
+		io.ReaderAt
+		io.Writer
+	}
+
+	// entryは、疎なインデックスの1項目で、キーとそのレコードのログ内のオフセットを持ちます。
+	entry struct {
+		key []byte
+		off int64
+	}
+
+	// Indexは、ログに対する疎なインデックスです。Write操作は複数のゴルーチンから同時に呼んではいけません。
+	Index struct {
+		log     Log
+		tree    *btree.BTree
+		every   int
+		size    int64  // ログの現在の長さ
+		count   int    // 最後のインデックス項目以降に追記したレコード数
+		lastKey []byte // 最後に追記したキー
+		records int
+	}
+)
+
+func (a entry) Less(b btree.Item) bool {
+	return bytes.Compare(a.key, b.(entry).key) < 0
+}
+
+// Openは、長さsizeの既存のログを先頭から読み、every件ごとのレコードをインデックスに登録したIndexを返します。
+func Open(log Log, size int64, every int) (*Index, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("logindex: bad index interval %d", every)
+	}
+	x := &Index{log: log, tree: btree.New(32), every: every}
+	r := bufio.NewReader(io.NewSectionReader(log, 0, size))
+	for x.size < size {
+		key, _, n, err := readRecord(r)
+		if err != nil {
+			return nil, fmt.Errorf("logindex: record at offset %d: %w", x.size, err)
+		}
+		if x.lastKey != nil && bytes.Compare(key, x.lastKey) <= 0 {
+			return nil, fmt.Errorf("logindex: record at offset %d: %w", x.size, ErrOutOfOrder)
+		}
+		x.indexRecord(key, x.size)
+		x.size += n
+	}
+	return x, nil
+}
+
+// indexRecordは、offにあるキーkeyのレコードを追記済みとして数え、every件ごとにインデックスに登録します。
+func (x *Index) indexRecord(key []byte, off int64) {
+	if x.count == 0 {
+		x.tree.ReplaceOrInsert(entry{key: key, off: off})
+	}
+	x.count = (x.count + 1) % x.every
+	x.lastKey = key
+	x.records++
+}
+
+// Appendは、レコードをログの末尾に追記します。keyは直前に追記したキーより大きくなければなりません。
+func (x *Index) Append(key, value []byte) error {
+	if x.lastKey != nil && bytes.Compare(key, x.lastKey) <= 0 {
+		return ErrOutOfOrder
+	}
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+len(key)+len(value))
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	buf = append(buf, value...)
+	if _, err := x.log.Write(buf); err != nil {
+		return err
+	}
+	x.indexRecord(append([]byte(nil), key...), x.size)
+	x.size += int64(len(buf))
+	return nil
+}
+
+// Getは、keyのレコードの値を返します。見つからない場合、okはfalseになります。
+func (x *Index) Get(key []byte) (value []byte, ok bool, err error) {
+	err = x.Scan(key, func(k, v []byte) bool {
+		if bytes.Equal(k, key) {
+			value, ok = v, true
+		}
+		return false
+	})
+	return value, ok, err
+}
+
+// Scanは、from以上のキーを持つレコードを昇順にfnへ渡し、fnがfalseを返すかログの終わりで止まります。
+// fromがnilの場合はログの先頭から走査します。走査はfrom以下の最も近いインデックス項目から始まるので、読み飛ばすレコードは最大every-1件です。
+func (x *Index) Scan(from []byte, fn func(key, value []byte) bool) error {
+	start := int64(0)
+	if from != nil {
+		x.tree.DescendLessOrEqual(entry{key: from}, func(i btree.Item) bool {
+			start = i.(entry).off
+			return false
+		})
+	}
+	r := bufio.NewReader(io.NewSectionReader(x.log, start, x.size-start))
+	for off := start; off < x.size; {
+		key, value, n, err := readRecord(r)
+		if err != nil {
+			return fmt.Errorf("logindex: record at offset %d: %w", off, err)
+		}
+		off += n
+		if from != nil && bytes.Compare(key, from) < 0 {
+			continue
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Lenは、ログ中のレコード数を返します。
+func (x *Index) Len() int {
+	return x.records
+}
+
+// IndexLenは、疎なインデックスの項目数を返します。
+func (x *Index) IndexLen() int {
+	return x.tree.Len()
+}
+
+// Sizeは、ログの長さ（バイト）を返します。
+func (x *Index) Size() int64 {
+	return x.size
+}
+
+// readRecordは、rから1レコードを読み、キー、値、レコードのバイト数を返します。
+func readRecord(r *bufio.Reader) (key, value []byte, n int64, err error) {
+	read := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if l > maxRecordSize {
+			return nil, fmt.Errorf("length %d too large", l)
+		}
+		n += int64(uvarintLen(l)) + int64(l)
+		b := make([]byte, l)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	if key, err = read(); err != nil {
+		return nil, nil, 0, unexpectedEOF(err)
+	}
+	if value, err = read(); err != nil {
+		return nil, nil, 0, unexpectedEOF(err)
+	}
+	return key, value, n, nil
+}
+
+// unexpectedEOFは、レコードの途中でログが終わった場合のio.EOFをio.ErrUnexpectedEOFに置き換えます。
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// uvarintLenは、vをuvarintで符号化したときのバイト数を返します。
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
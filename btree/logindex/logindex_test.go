@@ -0,0 +1,181 @@
+package logindex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// memLogは、メモリ上のLogです。
+type memLog struct {
+	b []byte
+}
+
+func (l *memLog) Write(p []byte) (int, error) {
+	l.b = append(l.b, p...)
+	return len(p), nil
+}
+
+func (l *memLog) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(l.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, l.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func key(i int) []byte { return []byte(fmt.Sprintf("k%04d", i)) }
+
+// buildは、k0000からk0398までの偶数のキーと、それぞれ"v"+番号の値を、every件ごとのインデックスでログに追記します。
+func build(t *testing.T, every int) (*Index, *memLog) {
+	t.Helper()
+	log := &memLog{}
+	x, err := Open(log, 0, every)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 400; i += 2 {
+		if err := x.Append(key(i), []byte(fmt.Sprint("v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return x, log
+}
+
+// scanKeysは、fromからn件までのキーを返します。
+func scanKeys(t *testing.T, x *Index, from []byte, n int) string {
+	t.Helper()
+	var out []string
+	if err := x.Scan(from, func(k, v []byte) bool {
+		out = append(out, string(k))
+		return len(out) < n
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(out)
+}
+
+// checkIndexは、すべてのキーとその間のキーについて、GetとScanがモデルと一致することを確かめます。
+func checkIndex(t *testing.T, x *Index, every int) {
+	t.Helper()
+	if x.Len() != 200 || x.IndexLen() != (200+every-1)/every {
+		t.Fatalf("every %d: Len=%d IndexLen=%d", every, x.Len(), x.IndexLen())
+	}
+	for i := -1; i <= 401; i++ {
+		v, ok, err := x.Get(key(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		present := i >= 0 && i < 400 && i%2 == 0
+		if ok != present || (ok && string(v) != fmt.Sprint("v", i)) {
+			t.Fatalf("every %d: Get(%s) = %q, %v, want present %v", every, key(i), v, ok, present)
+		}
+		var want []string
+		for j := i; j < 400 && len(want) < 3; j++ {
+			if j >= 0 && j%2 == 0 {
+				want = append(want, string(key(j)))
+			}
+		}
+		if got := scanKeys(t, x, key(i), 3); got != fmt.Sprint(want) {
+			t.Fatalf("every %d: Scan(%s) = %s, want %v", every, key(i), got, want)
+		}
+	}
+	if got := scanKeys(t, x, nil, 2); got != "[k0000 k0002]" {
+		t.Fatalf("every %d: Scan(nil) = %s", every, got)
+	}
+}
+
+func TestGetAndScan(t *testing.T) {
+	for _, every := range []int{1, 3, 16, 1000} {
+		x, _ := build(t, every)
+		checkIndex(t, x, every)
+	}
+}
+
+func TestOpenExistingLog(t *testing.T) {
+	_, built := build(t, 1)
+	for _, every := range []int{1, 7} {
+		log := &memLog{b: append([]byte{}, built.b...)}
+		x, err := Open(log, int64(len(log.b)), every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkIndex(t, x, every)
+		// 開き直したインデックスは最後のキーを覚えていて、続けて追記できる。
+		if err := x.Append(key(398), nil); !errors.Is(err, ErrOutOfOrder) {
+			t.Fatalf("every %d: Append of the last key after Open = %v, want ErrOutOfOrder", every, err)
+		}
+		if err := x.Append(key(500), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok, err := x.Get(key(500)); err != nil || !ok || string(v) != "new" {
+			t.Fatalf("every %d: Get of a key appended after Open = %q, %v, %v", every, v, ok, err)
+		}
+	}
+	if _, err := Open(&memLog{}, 0, 0); err == nil {
+		t.Fatal("Open accepted an index interval of 0")
+	}
+}
+
+func TestAppendOutOfOrder(t *testing.T) {
+	x, log := build(t, 3)
+	size := len(log.b)
+	for _, k := range [][]byte{key(398), key(100), []byte("a")} {
+		if err := x.Append(k, nil); !errors.Is(err, ErrOutOfOrder) {
+			t.Fatalf("Append(%s) = %v, want ErrOutOfOrder", k, err)
+		}
+	}
+	if len(log.b) != size || x.Len() != 200 {
+		t.Fatalf("rejected appends changed the log: %d bytes, %d records", len(log.b), x.Len())
+	}
+}
+
+// recordは、keyとvalueのレコードをログの形式で返します。
+func record(key, value []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(len(key)))
+	b = append(b, key...)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func TestOpenOutOfOrder(t *testing.T) {
+	for _, keys := range [][]int{{1, 2, 3, 2}, {1, 1}, {5, 3}} {
+		log := &memLog{}
+		for _, k := range keys {
+			log.Write(record(key(k), nil))
+		}
+		if _, err := Open(log, int64(len(log.b)), 2); !errors.Is(err, ErrOutOfOrder) {
+			t.Fatalf("Open of a log with keys %v = %v, want ErrOutOfOrder", keys, err)
+		}
+	}
+}
+
+// TestTruncatedTailは、最後のレコードが途中で切れたログを開くとio.ErrUnexpectedEOFを包んだエラーになり、
+// 完全なレコードの長さまでを指定すれば開けることを確かめます。
+func TestTruncatedTail(t *testing.T) {
+	x, log := build(t, 3)
+	last := x.Size() - int64(len(record(key(398), []byte("v398"))))
+	for cut := last + 1; cut < x.Size(); cut++ {
+		torn := &memLog{b: log.b[:cut]}
+		if _, err := Open(torn, cut, 3); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("Open of a log cut at %d of %d bytes = %v, want ErrUnexpectedEOF", cut, x.Size(), err)
+		}
+		y, err := Open(torn, last, 3)
+		if err != nil {
+			t.Fatalf("Open of the complete records of a torn log: %v", err)
+		}
+		if y.Len() != 199 {
+			t.Fatalf("Open of the complete records found %d records, want 199", y.Len())
+		}
+	}
+	// インデックスの知っている長さより短くなったログを走査すると、エラーになる。
+	log.b = log.b[:last+1]
+	if _, _, err := x.Get(key(398)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Get from a log truncated underneath the index = %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,312 @@
+// Package ordcodeは、整数、浮動小数点数、文字列、時刻と、それらを並べた組を、バイト列の辞書順が値の自然な順序と一致するように符号化します。
+// btree.OrderedKVのようにバイト列をキーとする木で、複合キーを正しい順序で保持するために使います。
+//
+// 各値の符号は、固定長か終端付きなので、別の値の符号の接頭辞になりません。そのため、符号をつなげるだけで組の符号になり、組は先頭の値から順に比較されます。
+// Desc付きの関数は、符号の全ビットを反転して降順にした符号を作ります。
+package ordcode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidは、デコードしようとしたバイト列が正しい符号でないことを示します。
+var ErrInvalid = errors.New("ordcode: invalid encoding")
+
+const (
+	// escapeは、文字列中の0x00を表すために0x00の後に置くバイトです。
+	escape = 0xff
+	// terminatorは、文字列の終わりを表すために0x00の後に置くバイトです。
+	terminator = 0x01
+)
+
+// AppendUint64は、vを8バイトのビッグエンディアンで符号化してbに追加します。
+func AppendUint64(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// AppendInt64は、vを符号化してbに追加します。符号ビットを反転するので、負の数は正の数より前に並びます。
+func AppendInt64(b []byte, v int64) []byte {
+	return AppendUint64(b, uint64(v)^(1<<63))
+}
+
+// AppendFloat64は、fを符号化してbに追加します。-Infから+Infまでが数値の順に並び、-0は0と同じ符号になり、NaNは+Infの後に並びます。
+func AppendFloat64(b []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		f = math.NaN()
+	case f == 0:
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		// 負の数は、絶対値が大きいほど前に並ぶようにすべてのビットを反転する。
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return AppendUint64(b, bits)
+}
+
+// AppendBytesは、sを符号化してbに追加します。0x00は0x00 0xffに置き換え、終わりに0x00 0x01を置くので、どんな内容でも接頭辞の関係にある文字列より後に並びます。
+func AppendBytes(b []byte, s []byte) []byte {
+	for _, c := range s {
+		b = append(b, c)
+		if c == 0 {
+			b = append(b, escape)
+		}
+	}
+	return append(b, 0, terminator)
+}
+
+// AppendStringは、sをAppendBytesと同じ形式で符号化してbに追加します。
+func AppendString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i])
+		if s[i] == 0 {
+			b = append(b, escape)
+		}
+	}
+	return append(b, 0, terminator)
+}
+
+// AppendTimeは、tをUnix秒（AppendInt64）とナノ秒（4バイト）で符号化してbに追加します。タイムゾーンとモノトニック時計の値は保存しません。
+func AppendTime(b []byte, t time.Time) []byte {
+	b = AppendInt64(b, t.Unix())
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// AppendUint64Descは、vを降順に並ぶように符号化してbに追加します。
+func AppendUint64Desc(b []byte, v uint64) []byte {
+	return invert(AppendUint64(b, v), len(b))
+}
+
+// AppendInt64Descは、vを降順に並ぶように符号化してbに追加します。
+func AppendInt64Desc(b []byte, v int64) []byte {
+	return invert(AppendInt64(b, v), len(b))
+}
+
+// AppendFloat64Descは、fを降順に並ぶように符号化してbに追加します。
+func AppendFloat64Desc(b []byte, f float64) []byte {
+	return invert(AppendFloat64(b, f), len(b))
+}
+
+// AppendBytesDescは、sを降順に並ぶように符号化してbに追加します。
+func AppendBytesDesc(b []byte, s []byte) []byte {
+	return invert(AppendBytes(b, s), len(b))
+}
+
+// AppendStringDescは、sを降順に並ぶように符号化してbに追加します。
+func AppendStringDesc(b []byte, s string) []byte {
+	return invert(AppendString(b, s), len(b))
+}
+
+// AppendTimeDescは、tを降順に並ぶように符号化してbに追加します。
+func AppendTimeDesc(b []byte, t time.Time) []byte {
+	return invert(AppendTime(b, t), len(b))
+}
+
+// invertは、b[start:]のすべてのビットを反転してbを返します。
+func invert(b []byte, start int) []byte {
+	for i := start; i < len(b); i++ {
+		b[i] = ^b[i]
+	}
+	return b
+}
+
+// Descは、Keyに渡すと、その値を降順に並ぶように符号化します。
+type Desc struct {
+	V interface{}
+}
+
+// Keyは、valsを順に符号化してつなげた組のキーを返します。
+// 使える型は、int、int8からint64、uint、uint8からuint64、float32、float64、string、[]byte、time.Timeと、それらを包んだDescです。
+// 整数はすべてAppendInt64（符号なしはAppendUint64）で符号化するので、int32とint64のように型が違っても同じ値なら同じ符号になります。
+// それ以外の型を渡すとパニックします。
+func Key(vals ...interface{}) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = appendValue(b, v)
+	}
+	return b
+}
+
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case Desc:
+		return invert(appendValue(b, v.V), len(b))
+	case int:
+		return AppendInt64(b, int64(v))
+	case int8:
+		return AppendInt64(b, int64(v))
+	case int16:
+		return AppendInt64(b, int64(v))
+	case int32:
+		return AppendInt64(b, int64(v))
+	case int64:
+		return AppendInt64(b, v)
+	case uint:
+		return AppendUint64(b, uint64(v))
+	case uint8:
+		return AppendUint64(b, uint64(v))
+	case uint16:
+		return AppendUint64(b, uint64(v))
+	case uint32:
+		return AppendUint64(b, uint64(v))
+	case uint64:
+		return AppendUint64(b, v)
+	case float32:
+		return AppendFloat64(b, float64(v))
+	case float64:
+		return AppendFloat64(b, v)
+	case string:
+		return AppendString(b, v)
+	case []byte:
+		return AppendBytes(b, v)
+	case time.Time:
+		return AppendTime(b, v)
+	}
+	panic(fmt.Sprintf("ordcode: unsupported type %T", v))
+}
+
+// DecodeUint64は、bの先頭のAppendUint64の符号をデコードし、値と残りのバイト列を返します。
+func DecodeUint64(b []byte) (uint64, []byte, error) {
+	if len(b) < 8 {
+		return 0, b, ErrInvalid
+	}
+	return binary.BigEndian.Uint64(b), b[8:], nil
+}
+
+// DecodeInt64は、bの先頭のAppendInt64の符号をデコードし、値と残りのバイト列を返します。
+func DecodeInt64(b []byte) (int64, []byte, error) {
+	v, rest, err := DecodeUint64(b)
+	return int64(v ^ (1 << 63)), rest, err
+}
+
+// DecodeFloat64は、bの先頭のAppendFloat64の符号をデコードし、値と残りのバイト列を返します。
+func DecodeFloat64(b []byte) (float64, []byte, error) {
+	bits, rest, err := DecodeUint64(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), rest, nil
+}
+
+// DecodeBytesは、bの先頭のAppendBytesの符号をデコードし、値と残りのバイト列を返します。値は新しく割り当てたスライスです。
+func DecodeBytes(b []byte) ([]byte, []byte, error) {
+	out := []byte{}
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0 {
+			out = append(out, b[i])
+			continue
+		}
+		if i+1 >= len(b) {
+			break
+		}
+		switch b[i+1] {
+		case escape:
+			out = append(out, 0)
+			i++
+		case terminator:
+			return out, b[i+2:], nil
+		default:
+			return nil, b, ErrInvalid
+		}
+	}
+	return nil, b, ErrInvalid
+}
+
+// DecodeStringは、bの先頭のAppendStringの符号をデコードし、値と残りのバイト列を返します。
+func DecodeString(b []byte) (string, []byte, error) {
+	s, rest, err := DecodeBytes(b)
+	return string(s), rest, err
+}
+
+// DecodeTimeは、bの先頭のAppendTimeの符号をデコードし、ローカルのタイムゾーンの時刻と残りのバイト列を返します。
+func DecodeTime(b []byte) (time.Time, []byte, error) {
+	sec, rest, err := DecodeInt64(b)
+	if err != nil || len(rest) < 4 {
+		return time.Time{}, b, ErrInvalid
+	}
+	nsec := binary.BigEndian.Uint32(rest)
+	if nsec >= 1e9 {
+		return time.Time{}, b, ErrInvalid
+	}
+	return time.Unix(sec, int64(nsec)), rest[4:], nil
+}
+
+// DecodeUint64Descは、bの先頭のAppendUint64Descの符号をデコードし、値と残りのバイト列を返します。
+func DecodeUint64Desc(b []byte) (uint64, []byte, error) {
+	v, rest, err := DecodeUint64(b)
+	return ^v, rest, err
+}
+
+// DecodeInt64Descは、bの先頭のAppendInt64Descの符号をデコードし、値と残りのバイト列を返します。
+func DecodeInt64Desc(b []byte) (int64, []byte, error) {
+	v, rest, err := DecodeUint64(b)
+	return int64(^v ^ (1 << 63)), rest, err
+}
+
+// DecodeFloat64Descは、bの先頭のAppendFloat64Descの符号をデコードし、値と残りのバイト列を返します。
+func DecodeFloat64Desc(b []byte) (float64, []byte, error) {
+	if len(b) < 8 {
+		return 0, b, ErrInvalid
+	}
+	var buf [8]byte
+	copy(buf[:], b)
+	f, _, err := DecodeFloat64(invert(buf[:], 0))
+	return f, b[8:], err
+}
+
+// DecodeBytesDescは、bの先頭のAppendBytesDescの符号をデコードし、値と残りのバイト列を返します。
+func DecodeBytesDesc(b []byte) ([]byte, []byte, error) {
+	out := []byte{}
+	for i := 0; i < len(b); i++ {
+		c := ^b[i]
+		if c != 0 {
+			out = append(out, c)
+			continue
+		}
+		if i+1 >= len(b) {
+			break
+		}
+		switch ^b[i+1] {
+		case escape:
+			out = append(out, 0)
+			i++
+		case terminator:
+			return out, b[i+2:], nil
+		default:
+			return nil, b, ErrInvalid
+		}
+	}
+	return nil, b, ErrInvalid
+}
+
+// DecodeStringDescは、bの先頭のAppendStringDescの符号をデコードし、値と残りのバイト列を返します。
+func DecodeStringDesc(b []byte) (string, []byte, error) {
+	s, rest, err := DecodeBytesDesc(b)
+	return string(s), rest, err
+}
+
+// DecodeTimeDescは、bの先頭のAppendTimeDescの符号をデコードし、ローカルのタイムゾーンの時刻と残りのバイト列を返します。
+func DecodeTimeDesc(b []byte) (time.Time, []byte, error) {
+	if len(b) < 12 {
+		return time.Time{}, b, ErrInvalid
+	}
+	var buf [12]byte
+	copy(buf[:], b)
+	t, _, err := DecodeTime(invert(buf[:], 0))
+	if err != nil {
+		return time.Time{}, b, err
+	}
+	return t, b[12:], nil
+}
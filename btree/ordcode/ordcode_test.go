@@ -0,0 +1,289 @@
+package ordcode
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// kindは、1つの型の値の作り方と自然な順序での比較です。
+type kind struct {
+	name string
+	gen  func(r *rand.Rand) interface{}
+	cmp  func(a, b interface{}) int
+}
+
+func sign(c int) int {
+	switch {
+	case c < 0:
+		return -1
+	case c > 0:
+		return 1
+	}
+	return 0
+}
+
+// specialFloatsは、順序の境界になる浮動小数点数です。
+var specialFloats = []float64{
+	math.Inf(-1), -math.MaxFloat64, -1, -math.SmallestNonzeroFloat64, math.Copysign(0, -1), 0,
+	math.SmallestNonzeroFloat64, 1, math.MaxFloat64, math.Inf(1), math.NaN(),
+}
+
+// cmpFloatは、NaNを+Infより大きく、-0と+0を等しいものとして比べます。
+func cmpFloat(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return 1
+	case math.IsNaN(b):
+		return -1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// randBytesは、0x00、0x01、'a'、0xffからなる長さ0から4のバイト列を返します。0x00を含むものや互いに接頭辞になるものがよく現れます。
+func randBytes(r *rand.Rand) []byte {
+	b := make([]byte, r.Intn(5))
+	for i := range b {
+		b[i] = []byte{0x00, 0x01, 'a', 0xff}[r.Intn(4)]
+	}
+	return b
+}
+
+var kinds = []kind{
+	{"int64", func(r *rand.Rand) interface{} {
+		switch r.Intn(4) {
+		case 0:
+			return []int64{math.MinInt64, -1, 0, 1, math.MaxInt64}[r.Intn(5)]
+		case 1:
+			return int64(r.Intn(7) - 3)
+		}
+		return int64(r.Uint64())
+	}, func(a, b interface{}) int {
+		x, y := a.(int64), b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}},
+	{"uint64", func(r *rand.Rand) interface{} {
+		if r.Intn(3) == 0 {
+			return []uint64{0, 1, math.MaxUint64}[r.Intn(3)]
+		}
+		return r.Uint64()
+	}, func(a, b interface{}) int {
+		x, y := a.(uint64), b.(uint64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}},
+	{"float64", func(r *rand.Rand) interface{} {
+		if r.Intn(2) == 0 {
+			return specialFloats[r.Intn(len(specialFloats))]
+		}
+		return r.NormFloat64() * math.Pow(10, float64(r.Intn(40)-20))
+	}, func(a, b interface{}) int { return cmpFloat(a.(float64), b.(float64)) }},
+	{"string", func(r *rand.Rand) interface{} { return string(randBytes(r)) },
+		func(a, b interface{}) int { return sign(bytes.Compare([]byte(a.(string)), []byte(b.(string)))) }},
+	{"[]byte", func(r *rand.Rand) interface{} { return randBytes(r) },
+		func(a, b interface{}) int { return sign(bytes.Compare(a.([]byte), b.([]byte))) }},
+	{"time", func(r *rand.Rand) interface{} {
+		// 1970年より前の時刻と、同じ秒でナノ秒だけが違う時刻がよく現れるようにする。
+		return time.Unix(int64(r.Intn(5)-2)*int64(r.Intn(1<<40)), int64(r.Intn(3))*int64(r.Intn(1e9)))
+	}, func(a, b interface{}) int {
+		x, y := a.(time.Time), b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	}},
+}
+
+// TestKeyOrderは、ランダムな値の組で、Keyの符号のバイト列の順序が値の自然な順序と一致し、Descでは逆になることを確かめます。
+func TestKeyOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, k := range kinds {
+		for n := 0; n < 3000; n++ {
+			a, b := k.gen(r), k.gen(r)
+			want := k.cmp(a, b)
+			if got := sign(bytes.Compare(Key(a), Key(b))); got != want {
+				t.Fatalf("%s: compare(Key(%v), Key(%v)) = %d, want %d", k.name, a, b, got, want)
+			}
+			if got := sign(bytes.Compare(Key(Desc{a}), Key(Desc{b}))); got != -want {
+				t.Fatalf("%s: compare(Key(Desc{%v}), Key(Desc{%v})) = %d, want %d", k.name, a, b, got, -want)
+			}
+		}
+	}
+}
+
+// TestKeyTupleOrderは、組が先頭の値から順に比べられ、前の値の符号が後ろの値の比較に影響しないことを確かめます。
+func TestKeyTupleOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n < 20000; n++ {
+		k1, k2 := kinds[r.Intn(len(kinds))], kinds[r.Intn(len(kinds))]
+		desc1, desc2 := r.Intn(2) == 0, r.Intn(2) == 0
+		a1, b1 := k1.gen(r), k1.gen(r)
+		if r.Intn(2) == 0 {
+			b1 = a1
+		}
+		a2, b2 := k2.gen(r), k2.gen(r)
+		wrap := func(v interface{}, desc bool) interface{} {
+			if desc {
+				return Desc{v}
+			}
+			return v
+		}
+		want := k1.cmp(a1, b1)
+		if desc1 {
+			want = -want
+		}
+		if want == 0 {
+			want = k2.cmp(a2, b2)
+			if desc2 {
+				want = -want
+			}
+		}
+		got := sign(bytes.Compare(Key(wrap(a1, desc1), wrap(a2, desc2)), Key(wrap(b1, desc1), wrap(b2, desc2))))
+		if got != want {
+			t.Fatalf("(%s desc=%v, %s desc=%v): compare((%v, %v), (%v, %v)) = %d, want %d",
+				k1.name, desc1, k2.name, desc2, a1, a2, b1, b2, got, want)
+		}
+	}
+}
+
+func TestKeyIntegerTypes(t *testing.T) {
+	want := Key(int64(-5))
+	for _, v := range []interface{}{int(-5), int8(-5), int16(-5), int32(-5)} {
+		if got := Key(v); !bytes.Equal(got, want) {
+			t.Errorf("Key(%T(-5)) = %x, want %x", v, got, want)
+		}
+	}
+	want = Key(uint64(5))
+	for _, v := range []interface{}{uint(5), uint8(5), uint16(5), uint32(5)} {
+		if got := Key(v); !bytes.Equal(got, want) {
+			t.Errorf("Key(%T(5)) = %x, want %x", v, got, want)
+		}
+	}
+	if got := Key(float32(1.5)); !bytes.Equal(got, Key(1.5)) {
+		t.Errorf("Key(float32(1.5)) = %x, want %x", got, Key(1.5))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Key(struct{}{}) did not panic")
+		}
+	}()
+	Key(struct{}{})
+}
+
+// codecは、1つの型の符号化とデコードの組です。decodeは、値と残りのバイト列を返します。
+type codec struct {
+	name   string
+	kind   kind
+	append func(b []byte, v interface{}) []byte
+	decode func(b []byte) (interface{}, []byte, error)
+}
+
+// codecsは、すべてのAppend関数とDecode関数の組です。
+var codecs = []codec{
+	{"Int64", kinds[0],
+		func(b []byte, v interface{}) []byte { return AppendInt64(b, v.(int64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeInt64(b) }},
+	{"Uint64", kinds[1],
+		func(b []byte, v interface{}) []byte { return AppendUint64(b, v.(uint64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeUint64(b) }},
+	{"Float64", kinds[2],
+		func(b []byte, v interface{}) []byte { return AppendFloat64(b, v.(float64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeFloat64(b) }},
+	{"String", kinds[3],
+		func(b []byte, v interface{}) []byte { return AppendString(b, v.(string)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeString(b) }},
+	{"Bytes", kinds[4],
+		func(b []byte, v interface{}) []byte { return AppendBytes(b, v.([]byte)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeBytes(b) }},
+	{"Time", kinds[5],
+		func(b []byte, v interface{}) []byte { return AppendTime(b, v.(time.Time)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeTime(b) }},
+	{"Int64Desc", kinds[0],
+		func(b []byte, v interface{}) []byte { return AppendInt64Desc(b, v.(int64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeInt64Desc(b) }},
+	{"Uint64Desc", kinds[1],
+		func(b []byte, v interface{}) []byte { return AppendUint64Desc(b, v.(uint64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeUint64Desc(b) }},
+	{"Float64Desc", kinds[2],
+		func(b []byte, v interface{}) []byte { return AppendFloat64Desc(b, v.(float64)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeFloat64Desc(b) }},
+	{"StringDesc", kinds[3],
+		func(b []byte, v interface{}) []byte { return AppendStringDesc(b, v.(string)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeStringDesc(b) }},
+	{"BytesDesc", kinds[4],
+		func(b []byte, v interface{}) []byte { return AppendBytesDesc(b, v.([]byte)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeBytesDesc(b) }},
+	{"TimeDesc", kinds[5],
+		func(b []byte, v interface{}) []byte { return AppendTimeDesc(b, v.(time.Time)) },
+		func(b []byte) (interface{}, []byte, error) { return DecodeTimeDesc(b) }},
+}
+
+// TestDecodeRoundTripは、すべてのDecode関数が対応するAppend関数の符号から値を復元して続きのバイト列を返し、
+// 符号が途中で切れている場合はErrInvalidを返すことを確かめます。
+func TestDecodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	tail := []byte("tail")
+	for _, c := range codecs {
+		for n := 0; n < 1000; n++ {
+			v := c.kind.gen(r)
+			prefix := []byte{0x42}
+			enc := c.append(prefix, v)
+			if !bytes.Equal(enc[:1], prefix) {
+				t.Fatalf("%s(%v) overwrote the existing bytes", c.name, v)
+			}
+			enc = enc[1:]
+			got, rest, err := c.decode(append(append([]byte{}, enc...), tail...))
+			if err != nil {
+				t.Fatalf("Decode%s(%x) for %v: %v", c.name, enc, v, err)
+			}
+			// -0は0としてデコードされ、NaNはNaNとしてデコードされる。cmpは両方を等しいものとして扱う。
+			if c.kind.cmp(got, v) != 0 || !bytes.Equal(rest, tail) {
+				t.Fatalf("Decode%s(%x) = %v, %q, want %v, %q", c.name, enc, got, rest, v, tail)
+			}
+			for i := 0; i < len(enc); i++ {
+				if _, _, err := c.decode(enc[:i]); !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Decode%s of %d of the %d bytes of %v = %v, want ErrInvalid", c.name, i, len(enc), v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	// 0x00の後に0xffと0x01以外のバイトが続く文字列の符号は正しくない。
+	if _, _, err := DecodeBytes([]byte{'a', 0, 2}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeBytes with a bad escape = %v, want ErrInvalid", err)
+	}
+	if _, _, err := DecodeBytesDesc([]byte{^byte('a'), 0xff, ^byte(2)}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeBytesDesc with a bad escape = %v, want ErrInvalid", err)
+	}
+	// ナノ秒が1e9以上の時刻の符号は正しくない。
+	b := AppendInt64(nil, 0)
+	b = append(b, 0x3b, 0x9a, 0xca, 0x00) // 1e9
+	if _, _, err := DecodeTime(b); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeTime with 1e9 nanoseconds = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,87 @@
+package btree
+
+// GetAtは、木の中で小さい方から数えてi番目（0始まり）の項目を返します。iが範囲外の場合は (zeroValue, false) を返します。
+// 各ノードが保持するサブツリーの項目数を使うので、O(log n)で求まります。
+func (t *BTreeG[T]) GetAt(i int) (_ T, _ bool) {
+	if t.root == nil || t.poisoned || i < 0 || i >= t.root.size {
+		return
+	}
+	n := t.root
+	for {
+		if len(n.children) == 0 {
+			return n.items[i], true
+		}
+		for j, c := range n.children {
+			if i < c.size {
+				n = c
+				break
+			}
+			i -= c.size
+			if j < len(n.items) {
+				if i == 0 {
+					return n.items[j], true
+				}
+				i--
+			}
+		}
+	}
+}
+
+// Rankは、木の中でitemより小さい項目の数と、itemと等しい項目が木にあるかどうかを返します。
+// itemが木にある場合、GetAt(rank)はその項目を返します。O(log n)で求まります。
+func (t *BTreeG[T]) Rank(item T) (rank int, found bool) {
+	if t.root == nil || t.poisoned {
+		return 0, false
+	}
+	for n := t.root; ; {
+		i, found := n.items.find(item, t.cow.less)
+		rank += i
+		if len(n.children) == 0 {
+			return rank, found
+		}
+		for _, c := range n.children[:i] {
+			rank += c.size
+		}
+		if found {
+			return rank + n.children[i].size, true
+		}
+		n = n.children[i]
+	}
+}
+
+// Quantilesは、qの各値（0から1の割合）に対応する分位点の項目を、qと同じ順に返します。
+// 項目数をnとして、割合xに対しては小さい方から floor(x*(n-1)) 番目の項目を返すので、0は最小の項目、1は最大の項目です。
+// [0, 1] の外の値は範囲に切り詰め、NaNは0として扱います。GetAtを使うので、時間はO(len(q) log n)です。
+// 木が空か汚染されている場合はnilを返します。シャードの分割点を決めたり、キーの分布の偏りを監視したりするのに使います。
+func (t *BTreeG[T]) Quantiles(q []float64) []T {
+	if t.root == nil || t.poisoned || t.root.size == 0 {
+		return nil
+	}
+	n := t.root.size
+	out := make([]T, len(q))
+	for i, x := range q {
+		if !(x > 0) {
+			x = 0
+		} else if x > 1 {
+			x = 1
+		}
+		out[i], _ = t.GetAt(int(x * float64(n-1)))
+	}
+	return out
+}
+
+// GetAtは、木の中で小さい方から数えてi番目（0始まり）の項目を返します。iが範囲外の場合はnilを返します。
+func (t *BTree) GetAt(i int) Item {
+	out, _ := t.generic().GetAt(i)
+	return out
+}
+
+// Rankは、木の中でitemより小さい項目の数と、itemと等しい項目が木にあるかどうかを返します。
+func (t *BTree) Rank(item Item) (int, bool) {
+	return t.generic().Rank(item)
+}
+
+// Quantilesは、qの各値（0から1の割合）に対応する分位点の項目を返します。詳細はBTreeG.Quantilesを参照してください。
+func (t *BTree) Quantiles(q []float64) []Item {
+	return t.generic().Quantiles(q)
+}
@@ -0,0 +1,13 @@
+package btree
+
+// Orderedは、<演算子で順序付けられる型の制約です。比較するだけのLessFuncを書かずに済むように、Lessと組み合わせて使います。
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Lessは、Ordered型の値を<演算子で比べるLessFuncを返します。NewG(degree, Less[int]())のように使います。
+func Less[T Ordered]() LessFunc[T] {
+	return func(a, b T) bool { return a < b }
+}
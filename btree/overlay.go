@@ -0,0 +1,246 @@
+package btree
+
+// DefaultOverlayThresholdは、OverlayGが差分の木をベースの木に統合する差分の項目数の既定値です。
+const DefaultOverlayThreshold = 4096
+
+type (
+	// OverlayGは、凍結した大きなベースの木の上に、小さな変更可能な差分の木を重ねたものです。読み取りが大半を占める用途のためのものです。
+	//
+	// 書き込みは差分の木だけに行い、削除はベースの項目を隠す墓標として記録するので、ベースのノードはコピーオンライトでも複製されません。
+	// 読み取りは差分を先に調べ、走査はベースのカーソルと差分をマージしながら進めます。
+	// 差分の項目数がしきい値を超えると、Union、Differenceと同じ分割と連結で差分をベースに統合し、変わらない部分木はそのまま共有した新しいベースを作ります。
+	// BTreeGと同じく、書き込み操作は複数のゴルーチンから同時に呼んではいけません。
+	OverlayG[T any] struct {
+		base      *BTreeG[T]
+		delta     *BTreeG[overlayEntry[T]]
+		length    int
+		threshold int
+	}
+
+	// overlayEntryは、差分の木の1項目です。tombがtrueの場合は、ベースにある等しい項目を削除したことを表します。
+	overlayEntry[T any] struct {
+		item T
+		tomb bool
+	}
+
+	// Overlayは、ItemのOverlayGです。
+	Overlay OverlayG[Item]
+)
+
+// NewOverlayGは、baseを凍結したベースとするOverlayGを作成します。baseはCloneしてから使うので、以後baseを変更してもOverlayGには影響しません。
+func NewOverlayG[T any](base *BTreeG[T]) *OverlayG[T] {
+	less := base.cow.less
+	return &OverlayG[T]{
+		base: base.Clone(),
+		delta: NewG(base.degree, func(a, b overlayEntry[T]) bool {
+			return less(a.item, b.item)
+		}),
+		length:    base.Len(),
+		threshold: DefaultOverlayThreshold,
+	}
+}
+
+// SetConsolidateThresholdは、差分の項目数がnを超えたら自動的にConsolidateするように設定します。nが0以下の場合は自動では統合しません。
+func (o *OverlayG[T]) SetConsolidateThreshold(n int) {
+	o.threshold = n
+}
+
+// Getは、keyと等しい項目を返します。そのような項目がない場合は (zeroValue, false) を返します。
+func (o *OverlayG[T]) Get(key T) (_ T, _ bool) {
+	if e, ok := o.delta.Get(overlayEntry[T]{item: key}); ok {
+		if e.tomb {
+			return
+		}
+		return e.item, true
+	}
+	return o.base.Get(key)
+}
+
+// Hasは、keyと等しい項目があればtrueを返します。
+func (o *OverlayG[T]) Has(key T) bool {
+	_, ok := o.Get(key)
+	return ok
+}
+
+// Lenは、項目の数を返します。
+func (o *OverlayG[T]) Len() int {
+	return o.length
+}
+
+// DeltaLenは、まだベースに統合していない差分（挿入と墓標）の数を返します。
+func (o *OverlayG[T]) DeltaLen() int {
+	return o.delta.Len()
+}
+
+// ReplaceOrInsertは、itemを差分の木に追加します。等しい項目があった場合はそれを返し、第2戻り値はtrueになります。
+func (o *OverlayG[T]) ReplaceOrInsert(item T) (T, bool) {
+	old, had := o.Get(item)
+	o.delta.ReplaceOrInsert(overlayEntry[T]{item: item})
+	if !had {
+		o.length++
+	}
+	o.maybeConsolidate()
+	return old, had
+}
+
+// Deleteは、keyと等しい項目を削除して返します。ベースにある項目は墓標で隠します。そのような項目がない場合は (zeroValue, false) を返します。
+func (o *OverlayG[T]) Delete(key T) (T, bool) {
+	old, had := o.Get(key)
+	if !had {
+		return old, false
+	}
+	if o.base.Has(key) {
+		o.delta.ReplaceOrInsert(overlayEntry[T]{item: old, tomb: true})
+	} else {
+		o.delta.Delete(overlayEntry[T]{item: key})
+	}
+	o.length--
+	o.maybeConsolidate()
+	return old, true
+}
+
+func (o *OverlayG[T]) maybeConsolidate() {
+	if o.threshold > 0 && o.delta.Len() > o.threshold {
+		o.Consolidate()
+	}
+}
+
+// Consolidateは、差分をベースに統合して新しいベースを作り、差分を空にします。
+// 差分の挿入をまとめた木とベースのUnion（等しい項目は差分のもの）から、墓標をまとめた木をDifferenceで取り除きます。
+// 差分が触れない部分木は古いベースとそのまま共有するので、時間はベース全体ではなく差分の大きさにほぼ比例します。
+func (o *OverlayG[T]) Consolidate() {
+	if o.delta.Len() == 0 {
+		return
+	}
+	puts, tombs := o.base.emptyLike(), o.base.emptyLike()
+	o.delta.Ascend(func(e overlayEntry[T]) bool {
+		if e.tomb {
+			tombs.ReplaceOrInsert(e.item)
+		} else {
+			puts.ReplaceOrInsert(e.item)
+		}
+		return true
+	})
+	o.base = puts.Union(o.base).Difference(tombs)
+	o.delta.Clear(true)
+}
+
+// Ascendは、すべての項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (o *OverlayG[T]) Ascend(iterator ItemIteratorG[T]) {
+	o.ascend(empty[T](), empty[T](), iterator)
+}
+
+// AscendRangeは、[greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (o *OverlayG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	o.ascend(optional(greaterOrEqual), optional(lessThan), iterator)
+}
+
+// ascendは、差分を走査しながら、ベースのカーソルを差分の各項目の手前まで進めてマージします。
+func (o *OverlayG[T]) ascend(lo, hi optionalItem[T], iterator ItemIteratorG[T]) {
+	less := o.base.cow.less
+	c := o.base.Cursor()
+	var b T
+	var ok bool
+	if lo.valid {
+		b, ok = c.Seek(lo.item)
+	} else {
+		b, ok = c.First()
+	}
+	inRange := func(item T) bool {
+		return !hi.valid || less(item, hi.item)
+	}
+	stopped := false
+	dlo, dhi := empty[overlayEntry[T]](), empty[overlayEntry[T]]()
+	if lo.valid {
+		dlo = optional(overlayEntry[T]{item: lo.item})
+	}
+	if hi.valid {
+		dhi = optional(overlayEntry[T]{item: hi.item})
+	}
+	o.delta.iterate(ascend, dlo, dhi, true, func(e overlayEntry[T]) bool {
+		for ok && less(b, e.item) {
+			if !iterator(b) {
+				stopped = true
+				return false
+			}
+			b, ok = c.Next()
+		}
+		if ok && !less(e.item, b) {
+			// ベースの等しい項目は、差分の項目か墓標で置き換えられている。
+			b, ok = c.Next()
+		}
+		if !e.tomb && !iterator(e.item) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	for !stopped && ok && inRange(b) {
+		if !iterator(b) {
+			return
+		}
+		b, ok = c.Next()
+	}
+}
+
+// NewOverlayは、baseを凍結したベースとするOverlayを作成します。詳細はNewOverlayGを参照してください。
+func NewOverlay(base *BTree) *Overlay {
+	return (*Overlay)(NewOverlayG(base.generic()))
+}
+
+func (o *Overlay) generic() *OverlayG[Item] {
+	return (*OverlayG[Item])(o)
+}
+
+// SetConsolidateThresholdは、差分の項目数がnを超えたら自動的にConsolidateするように設定します。
+func (o *Overlay) SetConsolidateThreshold(n int) {
+	o.generic().SetConsolidateThreshold(n)
+}
+
+// Getは、keyと等しい項目を返します。そのような項目がない場合はnilを返します。
+func (o *Overlay) Get(key Item) Item {
+	out, _ := o.generic().Get(key)
+	return out
+}
+
+// Hasは、keyと等しい項目があればtrueを返します。
+func (o *Overlay) Has(key Item) bool {
+	return o.generic().Has(key)
+}
+
+// Lenは、項目の数を返します。
+func (o *Overlay) Len() int {
+	return o.generic().Len()
+}
+
+// DeltaLenは、まだベースに統合していない差分（挿入と墓標）の数を返します。
+func (o *Overlay) DeltaLen() int {
+	return o.generic().DeltaLen()
+}
+
+// ReplaceOrInsertは、itemを差分の木に追加します。等しい項目があった場合はそれを返し、なければnilを返します。
+func (o *Overlay) ReplaceOrInsert(item Item) Item {
+	out, _ := o.generic().ReplaceOrInsert(item)
+	return out
+}
+
+// Deleteは、keyと等しい項目を削除して返します。そのような項目がない場合はnilを返します。
+func (o *Overlay) Delete(key Item) Item {
+	out, _ := o.generic().Delete(key)
+	return out
+}
+
+// Consolidateは、差分をベースに統合して新しいベースを作り、差分を空にします。
+func (o *Overlay) Consolidate() {
+	o.generic().Consolidate()
+}
+
+// Ascendは、すべての項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (o *Overlay) Ascend(iterator ItemIterator) {
+	o.generic().Ascend(ItemIteratorG[Item](iterator))
+}
+
+// AscendRangeは、[greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorを呼び出します。nilの境界は「境界なし」を意味します。
+func (o *Overlay) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	o.generic().ascend(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), ItemIteratorG[Item](iterator))
+}
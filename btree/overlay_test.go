@@ -0,0 +1,122 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// overlayItemは、kで比較し、vで置き換えを見分ける項目です。
+type overlayItem struct{ k, v int }
+
+func overlayItemLess(a, b overlayItem) bool { return a.k < b.k }
+
+// overlayModelは、モデルのうち[lo, hi)にある項目を昇順に返します。
+func overlayModel(model map[int]int, lo, hi int) []overlayItem {
+	out := []overlayItem{}
+	for k, v := range model {
+		if k >= lo && k < hi {
+			out = append(out, overlayItem{k, v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].k < out[j].k })
+	return out
+}
+
+func TestOverlayMatchesMap(t *testing.T) {
+	r := rand.New(rand.NewSource(16))
+	for _, threshold := range []int{0, 1, 7, 50} {
+		base := NewG(3, overlayItemLess)
+		model := map[int]int{}
+		for i := 0; i < 300; i++ {
+			k := r.Intn(400)
+			base.ReplaceOrInsert(overlayItem{k, -1})
+			model[k] = -1
+		}
+		frozen := fmt.Sprint(overlayModel(model, 0, 400))
+		o := NewOverlayG(base)
+		o.SetConsolidateThreshold(threshold)
+		// NewOverlayGはbaseをCloneするので、以後のbaseへの書き込みはOverlayGに影響しない。
+		base.ReplaceOrInsert(overlayItem{1000, 0})
+		for step := 0; step < 3000; step++ {
+			k := r.Intn(400)
+			what := fmt.Sprintf("threshold %d step %d", threshold, step)
+			old, had := model[k]
+			switch op := r.Intn(20); {
+			case op < 9:
+				got, found := o.ReplaceOrInsert(overlayItem{k, step})
+				if found != had || found && got.v != old {
+					t.Fatalf("%s: ReplaceOrInsert(%d) = %v, %v, model %d, %v", what, k, got, found, old, had)
+				}
+				model[k] = step
+			case op < 18:
+				got, found := o.Delete(overlayItem{k: k})
+				if found != had || found && got.v != old {
+					t.Fatalf("%s: Delete(%d) = %v, %v, model %d, %v", what, k, got, found, old, had)
+				}
+				delete(model, k)
+			case op < 19:
+				o.Consolidate()
+				if o.DeltaLen() != 0 {
+					t.Fatalf("%s: DeltaLen %d after Consolidate", what, o.DeltaLen())
+				}
+			default:
+				got, found := o.Get(overlayItem{k: k})
+				if found != had || found && got.v != old || o.Has(overlayItem{k: k}) != had {
+					t.Fatalf("%s: Get(%d) = %v, %v, model %d, %v", what, k, got, found, old, had)
+				}
+			}
+			if threshold > 0 && o.DeltaLen() > threshold {
+				t.Fatalf("%s: DeltaLen %d is over the threshold", what, o.DeltaLen())
+			}
+			if o.Len() != len(model) {
+				t.Fatalf("%s: Len %d, model has %d", what, o.Len(), len(model))
+			}
+			if step%50 != 0 {
+				continue
+			}
+			lo, hi := r.Intn(420)-10, r.Intn(420)-10
+			got := []overlayItem{}
+			o.AscendRange(overlayItem{k: lo}, overlayItem{k: hi}, func(i overlayItem) bool {
+				got = append(got, i)
+				return true
+			})
+			if want := overlayModel(model, lo, hi); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s: AscendRange(%d, %d) = %v, want %v", what, lo, hi, got, want)
+			}
+			got = got[:0]
+			o.Ascend(func(i overlayItem) bool {
+				got = append(got, i)
+				return len(got) < 10
+			})
+			want := overlayModel(model, -1, 400)
+			if len(want) > 10 {
+				want = want[:10]
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s: first 10 items %v, want %v", what, got, want)
+			}
+		}
+		base.Delete(overlayItem{k: 1000})
+		if got := fmt.Sprint(allOverlayItems(base)); got != frozen {
+			t.Fatalf("threshold %d: writes to the overlay changed the original base", threshold)
+		}
+		o.Consolidate()
+		if err := o.base.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(allOverlayItems(o.base)), fmt.Sprint(overlayModel(model, -1, 400)); got != want {
+			t.Fatalf("threshold %d: consolidated base %v, want %v", threshold, got, want)
+		}
+	}
+}
+
+func allOverlayItems(tr *BTreeG[overlayItem]) []overlayItem {
+	out := []overlayItem{}
+	tr.Ascend(func(i overlayItem) bool {
+		out = append(out, i)
+		return true
+	})
+	return out
+}
@@ -0,0 +1,220 @@
+package btree
+
+import (
+	"sort"
+	"time"
+)
+
+type (
+	// TimeFuncは、アイテムが属する時刻を返します。Partitionedは、この時刻でアイテムをパーティションに振り分けます。
+	TimeFunc func(i Item) time.Time
+
+	// Partitionedは、時間ウィンドウ（1時間、1日など）ごとに1つのBTreeを保持するラッパーです。
+	// 書き込みはアイテムの時刻によって対応するパーティションに振り分けられ、保持期間を過ぎたパーティションは丸ごと破棄されます。
+	//
+	// アイテムの順序（Less）は時刻の順序と矛盾してはいけません。つまり、古いウィンドウのアイテムは常に新しいウィンドウのアイテムより小さくなければなりません。
+	// タイムスタンプを先頭に持つキーであればこれを満たします。この前提により、パーティションをまたぐ走査は各パーティションを順番に走査するだけで済みます。
+	//
+	// BTreeと同様に、Write操作は複数のゴルーチンによる同時変異に対して安全ではありません。
+	Partitioned struct {
+		degree    int
+		window    time.Duration
+		retention time.Duration
+		timeOf    TimeFunc
+		freelist  *FreeList
+		parts     map[int64]*BTree
+		starts    []int64 // パーティションの開始時刻（UnixNano）を昇順に保持する
+		length    int
+	}
+)
+
+// NewPartitionedは、windowごとにパーティションを切る新しいPartitionedを作成します。
+// 全パーティションは1つのフリーリストを共有するので、破棄されたパーティションのノードは新しいパーティションで再利用されます。
+func NewPartitioned(degree int, window time.Duration, timeOf TimeFunc) *Partitioned {
+	if window <= 0 {
+		panic("bad partition window")
+	}
+	if timeOf == nil {
+		panic("nil TimeFunc")
+	}
+	if degree <= 1 {
+		panic("bad degree")
+	}
+	return &Partitioned{
+		degree:   degree,
+		window:   window,
+		timeOf:   timeOf,
+		freelist: NewFreeList(DefaultFreeListSize),
+		parts:    make(map[int64]*BTree),
+	}
+}
+
+// SetRetentionは、パーティションの保持期間を設定します。0の場合、Expireは何も破棄しません。
+func (p *Partitioned) SetRetention(d time.Duration) {
+	p.retention = d
+}
+
+// Windowは、1つのパーティションがカバーする時間の長さを返します。
+func (p *Partitioned) Window() time.Duration {
+	return p.window
+}
+
+// partitionStartは、時刻tが属するパーティションの開始時刻を返します。
+func (p *Partitioned) partitionStart(t time.Time) int64 {
+	return t.Truncate(p.window).UnixNano()
+}
+
+// partitionは、itemが属するパーティションを返します。createがtrueの場合、存在しなければ作成します。
+func (p *Partitioned) partition(item Item, create bool) *BTree {
+	start := p.partitionStart(p.timeOf(item))
+	if t, ok := p.parts[start]; ok {
+		return t
+	}
+	if !create {
+		return nil
+	}
+	t := NewWithFreeList(p.degree, p.freelist)
+	p.parts[start] = t
+	i := sort.Search(len(p.starts), func(i int) bool { return p.starts[i] >= start })
+	p.starts = append(p.starts, 0)
+	copy(p.starts[i+1:], p.starts[i:])
+	p.starts[i] = start
+	return t
+}
+
+// ReplaceOrInsertは、アイテムをその時刻のパーティションに追加します。同じアイテムが既にあれば置き換えて返します。
+func (p *Partitioned) ReplaceOrInsert(item Item) Item {
+	if item == nil {
+		panic("nil item being added to Partitioned")
+	}
+	out := p.partition(item, true).ReplaceOrInsert(item)
+	if out == nil {
+		p.length++
+	}
+	return out
+}
+
+// Deleteは、渡された項目に等しい項目を削除し、それを返す。存在しない場合はnilを返す。
+func (p *Partitioned) Delete(item Item) Item {
+	t := p.partition(item, false)
+	if t == nil {
+		return nil
+	}
+	out := t.Delete(item)
+	if out != nil {
+		p.length--
+	}
+	return out
+}
+
+// Getは、キーとなる項目を探して返す。見つからない場合はnilを返す。
+func (p *Partitioned) Get(key Item) Item {
+	t := p.partition(key, false)
+	if t == nil {
+		return nil
+	}
+	return t.Get(key)
+}
+
+// 与えられたキーが存在する場合、Hasはtrueを返します。
+func (p *Partitioned) Has(key Item) bool {
+	return p.Get(key) != nil
+}
+
+// Lenは、全パーティションのアイテム数の合計を返します。
+func (p *Partitioned) Len() int {
+	return p.length
+}
+
+// Partitionsは、現在存在するパーティションの開始時刻を昇順で返します。
+func (p *Partitioned) Partitions() []time.Time {
+	out := make([]time.Time, len(p.starts))
+	for i, s := range p.starts {
+		out[i] = time.Unix(0, s)
+	}
+	return out
+}
+
+// Ascendは、全パーティションのアイテムを古い順に、iteratorがfalseを返すまで呼び出します。
+func (p *Partitioned) Ascend(iterator ItemIterator) {
+	p.AscendRange(nil, nil, iterator)
+}
+
+// AscendRangeは、[greaterOrEqual, lessThan) の範囲のアイテムについて、パーティションをまたいでiteratorを呼び出します。
+// nilの境界は、その方向に制限がないことを意味します。範囲外のパーティションは走査されません。
+func (p *Partitioned) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	from, to := 0, len(p.starts)
+	if greaterOrEqual != nil {
+		start := p.partitionStart(p.timeOf(greaterOrEqual))
+		from = sort.Search(len(p.starts), func(i int) bool { return p.starts[i] >= start })
+	}
+	if lessThan != nil {
+		start := p.partitionStart(p.timeOf(lessThan))
+		to = sort.Search(len(p.starts), func(i int) bool { return p.starts[i] > start })
+	}
+	stopped := false
+	iter := func(i Item) bool {
+		if !iterator(i) {
+			stopped = true
+			return false
+		}
+		return true
+	}
+	for i := from; i < to && !stopped; i++ {
+		t := p.parts[p.starts[i]]
+		switch {
+		case greaterOrEqual != nil && lessThan != nil:
+			t.AscendRange(greaterOrEqual, lessThan, iter)
+		case greaterOrEqual != nil:
+			t.AscendGreaterOrEqual(greaterOrEqual, iter)
+		case lessThan != nil:
+			t.AscendLessThan(lessThan, iter)
+		default:
+			t.Ascend(iter)
+		}
+	}
+}
+
+// Descendは、全パーティションのアイテムを新しい順に、iteratorがfalseを返すまで呼び出します。
+func (p *Partitioned) Descend(iterator ItemIterator) {
+	stopped := false
+	iter := func(i Item) bool {
+		if !iterator(i) {
+			stopped = true
+			return false
+		}
+		return true
+	}
+	for i := len(p.starts) - 1; i >= 0 && !stopped; i-- {
+		p.parts[p.starts[i]].Descend(iter)
+	}
+}
+
+// DropBeforeは、tより前に終わるパーティションを丸ごと破棄し、削除されたアイテム数を返します。
+// 破棄されたパーティションのノードは共有フリーリストに戻されます。
+func (p *Partitioned) DropBefore(t time.Time) int {
+	cutoff := t.UnixNano()
+	dropped, removed := 0, 0
+	for _, s := range p.starts {
+		if s+int64(p.window) > cutoff {
+			break
+		}
+		tree := p.parts[s]
+		removed += tree.Len()
+		tree.Clear(true)
+		delete(p.parts, s)
+		dropped++
+	}
+	p.starts = append(p.starts[:0], p.starts[dropped:]...)
+	p.length -= removed
+	return removed
+}
+
+// Expireは、nowから見て保持期間を過ぎたパーティションを破棄し、削除されたアイテム数を返します。
+// 保持期間が設定されていない場合は何もしません。
+func (p *Partitioned) Expire(now time.Time) int {
+	if p.retention <= 0 {
+		return 0
+	}
+	return p.DropBefore(now.Add(-p.retention))
+}
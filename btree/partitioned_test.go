@@ -0,0 +1,175 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// eventは、時刻とその中での番号で比較するItemです。時刻の順序と矛盾しないので、Partitionedに入れられます。
+type event struct {
+	at time.Time
+	id int
+}
+
+func (e event) Less(than Item) bool {
+	o := than.(event)
+	if !e.at.Equal(o.at) {
+		return e.at.Before(o.at)
+	}
+	return e.id < o.id
+}
+
+func (e event) String() string {
+	return fmt.Sprintf("%s/%d", e.at.Format("15:04"), e.id)
+}
+
+var partitionBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// eventAtは、partitionBaseからm分後のevent idを返します。
+func eventAt(m, id int) event {
+	return event{partitionBase.Add(time.Duration(m) * time.Minute), id}
+}
+
+// newPartitionedは、1時間ごとのPartitionedに、0時から4時台まで15分おきのイベントを入れて返します。
+func newPartitioned(t *testing.T) *Partitioned {
+	t.Helper()
+	p := NewPartitioned(3, time.Hour, func(i Item) time.Time { return i.(event).at })
+	for m := 0; m < 300; m += 15 {
+		if old := p.ReplaceOrInsert(eventAt(m, 0)); old != nil {
+			t.Fatalf("ReplaceOrInsert(%v) replaced %v", eventAt(m, 0), old)
+		}
+	}
+	return p
+}
+
+// partitionedItemsは、fで走査したイベントを文字列にして返します。
+func partitionedItems(f func(ItemIterator)) string {
+	var out []Item
+	f(func(i Item) bool {
+		out = append(out, i)
+		return true
+	})
+	return fmt.Sprint(out)
+}
+
+func TestPartitionedRouting(t *testing.T) {
+	p := newPartitioned(t)
+	if p.Len() != 20 || len(p.Partitions()) != 5 {
+		t.Fatalf("Len %d with %d partitions, want 20 and 5", p.Len(), len(p.Partitions()))
+	}
+	for i, start := range p.Partitions() {
+		if want := partitionBase.Add(time.Duration(i) * time.Hour); !start.Equal(want) {
+			t.Fatalf("partition %d starts at %v, want %v", i, start, want)
+		}
+		if n := p.parts[start.UnixNano()].Len(); n != 4 {
+			t.Fatalf("partition %d has %d items, want 4", i, n)
+		}
+	}
+	// 古いパーティションを後から作っても、開始時刻の順に並ぶ。
+	p.ReplaceOrInsert(eventAt(-30, 0))
+	if got := p.Partitions()[0]; !got.Equal(partitionBase.Add(-time.Hour)) || p.Len() != 21 {
+		t.Fatalf("first partition %v, Len %d", got, p.Len())
+	}
+	if old := p.ReplaceOrInsert(eventAt(15, 0)); old == nil || p.Len() != 21 {
+		t.Fatalf("replacing an item returned %v, Len %d", old, p.Len())
+	}
+	if !p.Has(eventAt(15, 0)) || p.Has(eventAt(16, 0)) || p.Get(eventAt(600, 0)) != nil {
+		t.Fatal("Has or Get looked in the wrong partition")
+	}
+	if p.Delete(eventAt(16, 0)) != nil || p.Delete(eventAt(600, 0)) != nil || p.Len() != 21 {
+		t.Fatalf("deleting missing items changed Len to %d", p.Len())
+	}
+	if p.Delete(eventAt(15, 0)) == nil || p.Has(eventAt(15, 0)) || p.Len() != 20 {
+		t.Fatalf("Delete left Has %v, Len %d", p.Has(eventAt(15, 0)), p.Len())
+	}
+	if len(p.Partitions()) != 6 {
+		t.Fatalf("a missing-item Delete or Get created a partition: %v", p.Partitions())
+	}
+}
+
+func TestPartitionedRanges(t *testing.T) {
+	p := newPartitioned(t)
+	if got := partitionedItems(p.Ascend); got != "[00:00/0 00:15/0 00:30/0 00:45/0 01:00/0 01:15/0 01:30/0 01:45/0 02:00/0 02:15/0 02:30/0 02:45/0 03:00/0 03:15/0 03:30/0 03:45/0 04:00/0 04:15/0 04:30/0 04:45/0]" {
+		t.Fatalf("Ascend = %s", got)
+	}
+	for _, tc := range []struct {
+		lo, hi Item
+		want   string
+	}{
+		{eventAt(50, 0), eventAt(135, 0), "[01:00/0 01:15/0 01:30/0 01:45/0 02:00/0]"},
+		{eventAt(45, 0), eventAt(60, 0), "[00:45/0]"},
+		{eventAt(45, 1), eventAt(60, 1), "[01:00/0]"},
+		{eventAt(60, 0), eventAt(120, 0), "[01:00/0 01:15/0 01:30/0 01:45/0]"},
+		{eventAt(230, 0), nil, "[04:00/0 04:15/0 04:30/0 04:45/0]"},
+		{nil, eventAt(35, 0), "[00:00/0 00:15/0 00:30/0]"},
+		{eventAt(-100, 0), eventAt(-50, 0), "[]"},
+		{eventAt(500, 0), nil, "[]"},
+		{eventAt(130, 0), eventAt(100, 0), "[]"},
+	} {
+		got := partitionedItems(func(f ItemIterator) { p.AscendRange(tc.lo, tc.hi, f) })
+		if got != tc.want {
+			t.Errorf("AscendRange(%v, %v) = %s, want %s", tc.lo, tc.hi, got, tc.want)
+		}
+	}
+	if got := partitionedItems(p.Descend); got != "[04:45/0 04:30/0 04:15/0 04:00/0 03:45/0 03:30/0 03:15/0 03:00/0 02:45/0 02:30/0 02:15/0 02:00/0 01:45/0 01:30/0 01:15/0 01:00/0 00:45/0 00:30/0 00:15/0 00:00/0]" {
+		t.Fatalf("Descend = %s", got)
+	}
+	// iteratorがfalseを返すと、次のパーティションに進まない。
+	for name, f := range map[string]func(ItemIterator){"Ascend": p.Ascend, "Descend": p.Descend} {
+		n := 0
+		f(func(Item) bool {
+			n++
+			return n < 6
+		})
+		if n != 6 {
+			t.Errorf("%s called the iterator %d times after it returned false", name, n)
+		}
+	}
+}
+
+func TestPartitionedDrop(t *testing.T) {
+	p := newPartitioned(t)
+	// 1時台の途中までしか過ぎていないので、終わっている0時台だけを破棄する。
+	if n := p.DropBefore(partitionBase.Add(90 * time.Minute)); n != 4 || p.Len() != 16 || len(p.Partitions()) != 4 {
+		t.Fatalf("DropBefore(01:30) = %d, Len %d, %d partitions", n, p.Len(), len(p.Partitions()))
+	}
+	if n := p.DropBefore(partitionBase.Add(90 * time.Minute)); n != 0 || p.Len() != 16 {
+		t.Fatalf("second DropBefore(01:30) = %d, Len %d", n, p.Len())
+	}
+	if n := p.Expire(partitionBase.Add(10 * time.Hour)); n != 0 || p.Len() != 16 {
+		t.Fatalf("Expire without a retention = %d, Len %d", n, p.Len())
+	}
+	p.SetRetention(2 * time.Hour)
+	// 5時から2時間前の3時までに終わる1時台と2時台を破棄する。
+	if n := p.Expire(partitionBase.Add(5 * time.Hour)); n != 8 || p.Len() != 8 {
+		t.Fatalf("Expire(05:00) = %d, Len %d", n, p.Len())
+	}
+	if got := partitionedItems(p.Ascend); got != "[03:00/0 03:15/0 03:30/0 03:45/0 04:00/0 04:15/0 04:30/0 04:45/0]" {
+		t.Fatalf("items after Expire = %s", got)
+	}
+	if p.Has(eventAt(60, 0)) || p.Delete(eventAt(60, 0)) != nil || p.Len() != 8 {
+		t.Fatalf("a dropped item is still reachable, Len %d", p.Len())
+	}
+}
+
+func TestPartitionedReusesNodes(t *testing.T) {
+	p := NewPartitioned(2, time.Hour, func(i Item) time.Time { return i.(event).at })
+	for i := 0; i < 500; i++ {
+		p.ReplaceOrInsert(eventAt(0, i))
+	}
+	before := p.freelist.Stats()
+	if n := p.DropBefore(partitionBase.Add(time.Hour)); n != 500 || p.Len() != 0 {
+		t.Fatalf("DropBefore = %d, Len %d", n, p.Len())
+	}
+	stored := p.freelist.Stats().Stored - before.Stored
+	if stored == 0 {
+		t.Fatal("dropping a partition returned no nodes to the freelist")
+	}
+	for i := 0; i < 500; i++ {
+		p.ReplaceOrInsert(eventAt(60, i))
+	}
+	if hits := p.freelist.Stats().Hits - before.Hits; hits != stored {
+		t.Fatalf("the new partition reused %d of %d freed nodes", hits, stored)
+	}
+}
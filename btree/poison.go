@@ -0,0 +1,108 @@
+package btree
+
+import "runtime/debug"
+
+// Errは、RecoverPanicsが有効な木で最後に回復されたパニックをErrInternalを包んだエラーとして返します。
+// 木が汚染されている場合は、原因を包んだPoisonedErrorを返します。パニックが起きていない場合はnilを返します。
+func (t *BTreeG[T]) Err() error {
+	return t.err
+}
+
+// Poisonedは、木が汚染されていれば、errors.Is(err, ErrPoisoned)がtrueになるPoisonedErrorを返します。汚染されていなければnilを返します。
+//
+// 汚染された木に対する読み書きは何もせずにゼロ値やfalseを返すので、「見つからなかった」と区別できません。
+// RecoverPanicsを有効にした木では、一連の操作の後（あるいはfalseやゼロ値が返ったとき）にPoisonedを確かめてください。
+//
+//	if _, ok := t.Get(key); !ok {
+//		if err := t.Poisoned(); err != nil {
+//			return err // Salvageで項目を救出するか、Clearで空に戻す
+//		}
+//	}
+func (t *BTreeG[T]) Poisoned() error {
+	if !t.poisoned {
+		return nil
+	}
+	return t.err
+}
+
+// recoverPanicは、RecoverPanicsが有効な木の公開メソッドから遅延呼び出しされ、発生したパニックをInternalErrorとして記録します。
+// 書き込み操作の途中でパニックした場合、木の構造が壊れている可能性があるので、木を汚染済みとして印を付けます。
+func (t *BTreeG[T]) recoverPanic(op string, write bool) {
+	if r := recover(); r != nil {
+		err := &InternalError{Op: op, Value: r, Stack: debug.Stack()}
+		if write {
+			t.poison(err)
+		} else {
+			t.err = err
+		}
+	}
+}
+
+// poisonは、causeを原因として木に汚染済みの印を付けます。
+func (t *BTreeG[T]) poison(cause error) {
+	t.poisoned = true
+	t.err = &PoisonedError{Cause: cause}
+}
+
+// Salvageは、汚染された（あるいは正常な）木から到達可能な項目をできる限り取り出し、新しい木に挿入して返します。
+// 取り出せなかった項目（nilの項目や、挿入中にLessがパニックした項目）の数をlostとして返します。元の木は変更されません。
+// 新しい木は、スコアやフリーリストなど元の木と同じ設定を持ちます。
+func (t *BTreeG[T]) Salvage() (out *BTreeG[T], lost int) {
+	out = t.emptyLike()
+	// 挿入中のパニックはsalvageInsertで回復するので、取り出し終わるまではout自身で回復して汚染しないようにする。
+	out.recoverPanics = false
+	defer func() { out.recoverPanics = t.recoverPanics }()
+	if t.root == nil {
+		return out, 0
+	}
+	var walk func(n *node[T], depth int)
+	walk = func(n *node[T], depth int) {
+		// 循環した参照に対する保険として、ありえない深さまでは降りない。
+		if n == nil || depth > 64 {
+			return
+		}
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+		for _, item := range n.items {
+			if isNil(item) || !out.salvageInsert(item) {
+				lost++
+			}
+		}
+	}
+	walk(t.root, 0)
+	return out, lost
+}
+
+// salvageInsertは、Lessのパニックを回復しながらitemを挿入し、挿入できたかどうかを返します。
+// insertでLessが呼ばれるのは葉に項目を書き込む前だけで、途中で行われる分割は木の構造を保つので、パニックしても木は正しいままです。
+func (t *BTreeG[T]) salvageInsert(item T) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	t.ReplaceOrInsert(item)
+	return true
+}
+
+// isNilは、Tがインターフェース型でitemがnilの場合にtrueを返します。
+func isNil[T any](item T) bool {
+	return any(item) == nil
+}
+
+// Errは、RecoverPanicsが有効な木で最後に回復されたパニックを返します。詳細はBTreeG.Errを参照してください。
+func (t *BTree) Err() error {
+	return t.generic().Err()
+}
+
+// Poisonedは、木が汚染されていればPoisonedErrorを返し、汚染されていなければnilを返します。詳細はBTreeG.Poisonedを参照してください。
+func (t *BTree) Poisoned() error {
+	return t.generic().Poisoned()
+}
+
+// Salvageは、木から到達可能な項目をできる限り取り出し、新しい木に挿入して返します。詳細はBTreeG.Salvageを参照してください。
+func (t *BTree) Salvage() (out *BTree, lost int) {
+	g, lost := t.generic().Salvage()
+	return (*BTree)(g), lost
+}
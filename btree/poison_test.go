@@ -0,0 +1,84 @@
+package btree
+
+import (
+	"errors"
+	"testing"
+)
+
+// poisonedTreeは、Lessがパニックする挿入で汚染された、RecoverPanicsが有効な木を返します。
+func poisonedTree(t *testing.T) *BTreeG[int] {
+	t.Helper()
+	explode := false
+	tr := NewWithOptionsG(3, func(a, b int) bool {
+		if explode {
+			panic("less exploded")
+		}
+		return a < b
+	}, OptionsG[int]{RecoverPanics: true})
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	explode = true
+	tr.ReplaceOrInsert(1000)
+	explode = false
+	return tr
+}
+
+func TestPoisoned(t *testing.T) {
+	tr := poisonedTree(t)
+	err := tr.Poisoned()
+	if !errors.Is(err, ErrPoisoned) || !errors.Is(err, ErrInternal) {
+		t.Fatalf("Poisoned() = %v, want ErrPoisoned caused by ErrInternal", err)
+	}
+	var pe *PoisonedError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Poisoned() = %T, want *PoisonedError", err)
+	}
+	// 汚染された木は読み書きを拒み、ゼロ値を返す。
+	if _, ok := tr.Get(5); ok {
+		t.Fatal("Get on a poisoned tree found an item")
+	}
+	if _, ok := tr.ReplaceOrInsert(5); ok {
+		t.Fatal("ReplaceOrInsert on a poisoned tree replaced an item")
+	}
+	out, lost := tr.Salvage()
+	if lost != 0 || out.Len() != 100 || out.Poisoned() != nil {
+		t.Fatalf("Salvage = %d items, %d lost, Poisoned() = %v", out.Len(), lost, out.Poisoned())
+	}
+	tr.Clear(false)
+	if err := tr.Poisoned(); err != nil {
+		t.Fatalf("Poisoned() after Clear = %v", err)
+	}
+}
+
+func TestPoisonedHealthyTree(t *testing.T) {
+	tr := New(3)
+	tr.ReplaceOrInsert(Int(1))
+	if err := tr.Poisoned(); err != nil {
+		t.Fatalf("Poisoned() on a healthy tree = %v", err)
+	}
+}
+
+// TestSalvageKeepsOptionsは、Salvageが返す木が元の木のスコア、フリーリスト、パニックの回復の設定を引き継ぐことを確かめます。
+func TestSalvageKeepsOptions(t *testing.T) {
+	f := NewFreeListG[int](DefaultFreeListSize)
+	tr := NewWithOptionsG(3, intLess, OptionsG[int]{
+		FreeList:      f,
+		Score:         func(i int) float64 { return float64(-i) },
+		RecoverPanics: true,
+	})
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	out, lost := tr.Salvage()
+	if lost != 0 || out.Len() != 100 {
+		t.Fatalf("Salvage = %d items, %d lost", out.Len(), lost)
+	}
+	if out.cow.freelist != f || !out.recoverPanics {
+		t.Fatalf("salvaged tree lost its options: shared free list %v, RecoverPanics %v", out.cow.freelist == f, out.recoverPanics)
+	}
+	if got, ok := out.MinBy(); !ok || got != 99 {
+		t.Fatalf("MinBy on the salvaged tree = %d, %v, want 99", got, ok)
+	}
+	mustVerify(t, "salvaged tree", out)
+}
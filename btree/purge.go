@@ -0,0 +1,176 @@
+package btree
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPurgeChunkは、PurgeOptions.ChunkSizeが0の場合に1回に走査する項目の数です。
+const DefaultPurgeChunk = 1024
+
+type (
+	// PurgeOptionsGは、DeleteWhereの設定です。ゼロ値は、木全体を制限なしで走査する設定になります。
+	PurgeOptionsG[T any] struct {
+		// Contextが取り消されると、DeleteWhereはその時点のまとまりを削除せずに戻ります。nilの場合はcontext.Background()です。
+		Context context.Context
+		// ChunkSizeは、1回に走査する項目の数です。0の場合はDefaultPurgeChunkです。
+		ChunkSize int
+		// Rateは、1秒あたりに削除する項目の数の上限です。0の場合は制限しません。
+		Rate int
+		// Resumeがtrueの場合はStartから走査を始め、falseの場合は先頭から始めます。
+		// 中断した削除は、最後に報告されたPurgeProgressG.NextとMoreをStartとResumeに渡すと続きから再開できます。
+		Start  T
+		Resume bool
+		// Progressは、まとまりごとに進み具合を渡して呼ばれます。nilの場合は呼ばれません。
+		Progress func(PurgeProgressG[T])
+	}
+
+	// PurgeProgressGは、DeleteWhereの進み具合です。
+	PurgeProgressG[T any] struct {
+		Scanned int // これまでに走査した項目の数
+		Deleted int // これまでに削除した項目の数
+		// Nextは、次に走査する項目です。Moreがfalseの場合は最後まで走査しており、Nextはゼロ値です。
+		Next T
+		More bool
+	}
+
+	// PurgeOptionsは、BTree.DeleteWhereの設定です。ゼロ値は、木全体を制限なしで走査する設定になります。
+	PurgeOptions struct {
+		// Contextが取り消されると、DeleteWhereはその時点のまとまりを削除せずに戻ります。nilの場合はcontext.Background()です。
+		Context context.Context
+		// ChunkSizeは、1回に走査する項目の数です。0の場合はDefaultPurgeChunkです。
+		ChunkSize int
+		// Rateは、1秒あたりに削除する項目の数の上限です。0の場合は制限しません。
+		Rate int
+		// Startは、走査を始める項目です。nilの場合は先頭から始めます。中断した削除は、最後に報告されたPurgeProgress.Nextを渡すと続きから再開できます。
+		Start Item
+		// Progressは、まとまりごとに進み具合を渡して呼ばれます。nilの場合は呼ばれません。
+		Progress func(PurgeProgress)
+	}
+
+	// PurgeProgressは、BTree.DeleteWhereの進み具合です。
+	PurgeProgress struct {
+		Scanned int // これまでに走査した項目の数
+		Deleted int // これまでに削除した項目の数
+		// Nextは、次に走査する項目です。最後まで走査した場合はnilです。
+		Next Item
+	}
+)
+
+// DeleteWhereは、predがtrueを返す項目をすべて木から削除し、削除した数を返します。
+//
+// AscendとDeleteを組み合わせるのとは違い、ReadRangeで項目をChunkSize個ずつ読み出し、まとまりの中で一致した項目をまとめて削除してから続きを読み直します。
+// まとまりの中で連続して一致した項目はDeleteRangeで一度に削除するので、古い項目がキーの順に固まっているような削除では、項目数によらずほぼ一定の手間で済みます。
+// 走査中に木を変更しないので、一致する項目が多くても安全です。Rateを指定すると削除の速さを制限し、Contextが取り消されると途中で戻ります。
+// 取り消されたかどうかはContextのErrで確かめてください。predの中で木を変更してはいけません。
+func (t *BTreeG[T]) DeleteWhere(pred func(T) bool, opts PurgeOptionsG[T]) (deleted int) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	chunk := opts.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultPurgeChunk
+	}
+	buf, hit := make([]T, chunk), make([]bool, chunk)
+	defer func() {
+		// 削除した項目をバッファから参照し続けないようにする。
+		var zero T
+		for i := range buf {
+			buf[i] = zero
+		}
+	}()
+	start := time.Now()
+	progress := PurgeProgressG[T]{Next: opts.Start, More: opts.Resume}
+	for first := true; first || progress.More; first = false {
+		if ctx.Err() != nil {
+			return deleted
+		}
+		from := empty[T]()
+		if progress.More {
+			from = optional(progress.Next)
+		}
+		n, next, more := t.readRange(ascend, from, empty[T](), buf)
+		matches := 0
+		for i, item := range buf[:n] {
+			hit[i] = pred(item)
+			if hit[i] {
+				matches++
+			}
+		}
+		if opts.Rate > 0 && matches > 0 {
+			// これまでの削除とこのまとまりの削除が、Rateの速さで終わる時刻まで待つ。
+			due := start.Add(time.Duration(deleted+matches) * time.Second / time.Duration(opts.Rate))
+			if !sleepContext(ctx, time.Until(due)) {
+				return deleted
+			}
+		}
+		if matches > 0 {
+			t.deleteRuns(buf[:n], hit[:n], optionalItem[T]{item: next, valid: more})
+		}
+		deleted += matches
+		progress.Scanned += n
+		progress.Deleted = deleted
+		progress.Next, progress.More = next, more
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	return deleted
+}
+
+// deleteRunsは、木の中で連続するitemsのうち、hitがtrueの項目を削除します。afterは、木の中でitemsの最後の次にある項目です。
+// 2つ以上続けて一致した項目は、その次の項目の手前までをdeleteRangeで一度に削除し、1つだけの項目はDeleteで削除します。
+func (t *BTreeG[T]) deleteRuns(items []T, hit []bool, after optionalItem[T]) {
+	for i := 0; i < len(items); {
+		if !hit[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(items) && hit[j] {
+			j++
+		}
+		switch {
+		case j-i == 1:
+			t.Delete(items[i])
+		case j < len(items):
+			t.deleteRange(optional(items[i]), optional(items[j]))
+		default:
+			t.deleteRange(optional(items[i]), after)
+		}
+		i = j
+	}
+}
+
+// DeleteWhereは、predがtrueを返す項目をすべて木から削除し、削除した数を返します。詳細はBTreeG.DeleteWhereを参照してください。
+func (t *BTree) DeleteWhere(pred func(Item) bool, opts PurgeOptions) int {
+	g := PurgeOptionsG[Item]{
+		Context:   opts.Context,
+		ChunkSize: opts.ChunkSize,
+		Rate:      opts.Rate,
+		Start:     opts.Start,
+		Resume:    opts.Start != nil,
+	}
+	if opts.Progress != nil {
+		g.Progress = func(p PurgeProgressG[Item]) {
+			opts.Progress(PurgeProgress{Scanned: p.Scanned, Deleted: p.Deleted, Next: p.Next})
+		}
+	}
+	return t.generic().DeleteWhere(pred, g)
+}
+
+// sleepContextは、dの間かctxが取り消されるまで待ち、dの間待った場合にtrueを返します。
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package btree
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDeleteWhereMatchesModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		tr := NewG(2+r.Intn(6), intLess)
+		model := map[int]bool{}
+		for i := 0; i < 2000; i++ {
+			k := r.Intn(5000)
+			tr.ReplaceOrInsert(k)
+			model[k] = true
+		}
+		// 長い連続と孤立した一致が混ざるように、区間ごとに一致の割合を変える。
+		lo, hi := r.Intn(5000), r.Intn(5000)
+		pred := func(k int) bool { return (k >= lo && k < hi) || k%7 == 0 }
+		want := 0
+		for k := range model {
+			if pred(k) {
+				delete(model, k)
+				want++
+			}
+		}
+		got := tr.DeleteWhere(pred, PurgeOptionsG[int]{ChunkSize: 1 + r.Intn(300)})
+		if got != want {
+			t.Fatalf("round %d: DeleteWhere = %d, want %d", round, got, want)
+		}
+		if tr.Len() != len(model) {
+			t.Fatalf("round %d: Len() = %d, want %d", round, tr.Len(), len(model))
+		}
+		tr.Ascend(func(k int) bool {
+			if !model[k] {
+				t.Fatalf("round %d: %d survived", round, k)
+			}
+			return true
+		})
+	}
+}
+
+func TestDeleteWhereResume(t *testing.T) {
+	tr := New(4)
+	for i := 0; i < 1000; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var last PurgeProgress
+	even := func(i Item) bool { return i.(Int)%2 == 0 }
+	tr.DeleteWhere(even, PurgeOptions{Context: ctx, ChunkSize: 100, Progress: func(p PurgeProgress) {
+		last = p
+		if p.Scanned >= 300 {
+			cancel()
+		}
+	}})
+	if last.Scanned != 300 || last.Deleted != 150 || last.Next != Int(300) {
+		t.Fatalf("progress at cancellation = %+v", last)
+	}
+	if tr.Len() != 850 {
+		t.Fatalf("Len() after cancellation = %d, want 850", tr.Len())
+	}
+	n := tr.DeleteWhere(even, PurgeOptions{Start: last.Next, ChunkSize: 100})
+	if n != 350 || tr.Len() != 500 || tr.Has(Int(998)) || !tr.Has(Int(999)) {
+		t.Fatalf("resumed DeleteWhere = %d, Len() = %d", n, tr.Len())
+	}
+}
+
+func TestDeleteWhereRate(t *testing.T) {
+	tr := NewG(4, intLess)
+	for i := 0; i < 40; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	start := time.Now()
+	n := tr.DeleteWhere(func(int) bool { return true }, PurgeOptionsG[int]{ChunkSize: 10, Rate: 400})
+	if n != 40 {
+		t.Fatalf("DeleteWhere = %d, want 40", n)
+	}
+	// 40項目を毎秒400項目で削除するので、少なくとも100ms近くかかる。
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("DeleteWhere with Rate 400 took %v", d)
+	}
+}
+
+func BenchmarkDeleteWhere(b *testing.B) {
+	const n = 100000
+	for _, bc := range []struct {
+		name string
+		pred func(int) bool
+	}{
+		{"prefix", func(k int) bool { return k < n/2 }},
+		{"alternate", func(k int) bool { return k%2 == 0 }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			src := NewG(32, intLess)
+			for i := 0; i < n; i++ {
+				src.ReplaceOrInsert(i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				tr := src.Clone()
+				b.StartTimer()
+				tr.DeleteWhere(bc.pred, PurgeOptionsG[int]{})
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package btree
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// ReplicaPoolOptionsは、ReplicaPoolのスナップショットを更新する条件です。
+	ReplicaPoolOptions struct {
+		// Sizeは、保持するスナップショットの最大数です。0以下の場合は1になります。
+		Size int
+		// MaxWritesは、この回数のUpdateが行われるたびにスナップショットを更新します。0の場合は回数では更新しません。
+		MaxWrites int
+		// Intervalは、書き込みがあった場合にスナップショットを更新する間隔です。0の場合は時間では更新しません。
+		Interval time.Duration
+	}
+
+	// ReplicaPoolは、1つの書き込み用の木と、そのCloneである読み取り専用のスナップショットをいくつか管理します。
+	// 書き込みはUpdateを通して直列に行われ、読み取り側のゴルーチンはAcquireで最新のスナップショットを受け取り、ロックなしで読み取ります。
+	//
+	// スナップショットは書き込まれないので、ノードを1つも所有していません（ノードはすべてCloneの時点の共有ノードか書き込み用の木のものです）。
+	// そのため古いスナップショットは、所有していないノードを走査するだけのClear(true)ではなくClear(false)で手放し、
+	// 共有ノードの回収は書き込み用の木のコピーオンライトとGCに任せます。
+	ReplicaPool struct {
+		mu       sync.Mutex
+		base     *BTree
+		opts     ReplicaPoolOptions
+		replicas []*Replica // 新しい順
+		writes   int        // 最後の更新以降のUpdateの回数
+		done     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// Replicaは、ReplicaPoolから貸し出された読み取り専用のスナップショットです。使い終わったらReleaseを呼んでください。
+	Replica struct {
+		pool    *ReplicaPool
+		tree    *BTree
+		refs    int
+		retired bool
+	}
+)
+
+// NewReplicaPoolは、baseを書き込み用の木とするReplicaPoolを作成します。以降、baseへの書き込みはUpdateを通して行ってください。
+// opts.Intervalが正の場合、定期的にスナップショットを更新するゴルーチンを起動するので、不要になったらCloseを呼んでください。
+func NewReplicaPool(base *BTree, opts ReplicaPoolOptions) *ReplicaPool {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	p := &ReplicaPool{base: base, opts: opts, done: make(chan struct{})}
+	p.refreshLocked()
+	if opts.Interval > 0 {
+		p.wg.Add(1)
+		go p.loop()
+	}
+	return p
+}
+
+// loopは、Intervalごとに、書き込みがあればスナップショットを更新します。
+func (p *ReplicaPool) loop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.writes > 0 {
+				p.refreshLocked()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Closeは、定期更新のゴルーチンを停止します。貸し出し中のスナップショットは引き続き使えます。
+func (p *ReplicaPool) Close() {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+		p.mu.Unlock()
+		return
+	default:
+		close(p.done)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Updateは、書き込み用の木に対してfnを排他的に実行します。MaxWritesに達した場合はスナップショットを更新します。
+func (p *ReplicaPool) Update(fn func(t *BTree)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p.base)
+	p.writes++
+	if p.opts.MaxWrites > 0 && p.writes >= p.opts.MaxWrites {
+		p.refreshLocked()
+	}
+}
+
+// Refreshは、書き込み用の木から新しいスナップショットを作成します。
+func (p *ReplicaPool) Refresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refreshLocked()
+}
+
+// refreshLockedは、新しいスナップショットを先頭に追加し、Sizeを超えた古いものを引退させます。
+func (p *ReplicaPool) refreshLocked() {
+	r := &Replica{pool: p, tree: p.base.Clone()}
+	p.replicas = append([]*Replica{r}, p.replicas...)
+	for len(p.replicas) > p.opts.Size {
+		old := p.replicas[len(p.replicas)-1]
+		p.replicas[len(p.replicas)-1] = nil
+		p.replicas = p.replicas[:len(p.replicas)-1]
+		old.retired = true
+		if old.refs == 0 {
+			old.tree.Clear(false)
+		}
+	}
+	p.writes = 0
+}
+
+// Acquireは、最新のスナップショットを貸し出します。返されたReplicaの木に書き込んではいけません。
+func (p *ReplicaPool) Acquire() *Replica {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.replicas[0]
+	r.refs++
+	return r
+}
+
+// Lenは、現在保持しているスナップショットの数を返します。
+func (p *ReplicaPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.replicas)
+}
+
+// Treeは、スナップショットの木を返します。読み取り操作だけを行ってください。
+func (r *Replica) Tree() *BTree {
+	return r.tree
+}
+
+// Releaseは、スナップショットを返却します。引退済みで他に使っている者がいなければ、その場で手放されます。
+func (r *Replica) Release() {
+	p := r.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.refs <= 0 {
+		panic("btree: Replica released more times than acquired")
+	}
+	r.refs--
+	if r.refs == 0 && r.retired {
+		r.tree.Clear(false)
+	}
+}
@@ -0,0 +1,183 @@
+package btree
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// insertは、Updateでiを書き込み用の木に追加します。
+func insert(p *ReplicaPool, i int) {
+	p.Update(func(t *BTree) { t.ReplaceOrInsert(Int(i)) })
+}
+
+func TestReplicaRefcount(t *testing.T) {
+	p := NewReplicaPool(New(3), ReplicaPoolOptions{Size: 2})
+	defer p.Close()
+	insert(p, 1)
+	a := p.Acquire()
+	if a.Tree().Len() != 0 {
+		t.Fatalf("snapshot taken before the write has %d items", a.Tree().Len())
+	}
+	if b := p.Acquire(); b != a || a.refs != 2 {
+		t.Fatalf("second Acquire returned a different replica or refs %d", a.refs)
+	}
+	p.Refresh()
+	c := p.Acquire()
+	if c == a || c.Tree().Len() != 1 || p.Len() != 2 {
+		t.Fatalf("after Refresh: new replica %v, Len %d, pool holds %d", c != a, c.Tree().Len(), p.Len())
+	}
+	c.Release()
+	a.Release()
+	a.Release()
+	// aはまだSizeの範囲内なので、参照がなくなっても手放さない。
+	if a.refs != 0 || a.retired || a.Tree().Len() != 0 || p.Len() != 2 {
+		t.Fatalf("replica within Size: refs %d, retired %v, pool holds %d", a.refs, a.retired, p.Len())
+	}
+	if r := p.replicas[1]; r != a {
+		t.Fatal("the older replica is not the second one in the pool")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("releasing a replica more times than acquired did not panic")
+		}
+	}()
+	a.Release()
+}
+
+func TestReplicaRetirement(t *testing.T) {
+	p := NewReplicaPool(New(3), ReplicaPoolOptions{Size: 1})
+	defer p.Close()
+	for i := 0; i < 100; i++ {
+		insert(p, i)
+	}
+	p.Refresh()
+	held := p.Acquire()
+	for i := 100; i < 200; i++ {
+		insert(p, i)
+	}
+	p.Refresh()
+	// 貸し出し中の引退したスナップショットは、Releaseされるまで読める。
+	if !held.retired || held.Tree().Len() != 100 || p.Len() != 1 {
+		t.Fatalf("retired %v with %d items, pool holds %d", held.retired, held.Tree().Len(), p.Len())
+	}
+	if err := held.Tree().generic().Verify(); err != nil {
+		t.Fatal(err)
+	}
+	held.Release()
+	if held.Tree().Len() != 0 {
+		t.Fatalf("retired replica has %d items after its last Release", held.Tree().Len())
+	}
+	// 誰も使っていないスナップショットは、引退したときに手放す。
+	idle := p.replicas[0]
+	p.Refresh()
+	if !idle.retired || idle.Tree().Len() != 0 {
+		t.Fatalf("idle replica: retired %v with %d items", idle.retired, idle.Tree().Len())
+	}
+	// スナップショットはノードを所有しないので、Clear(false)で手放しても書き込み用の木は壊れない。
+	if err := p.base.generic().Verify(); err != nil || p.base.Len() != 200 {
+		t.Fatalf("base after retirements: %v, Len %d", err, p.base.Len())
+	}
+	if r := p.Acquire(); r.Tree().Len() != 200 {
+		t.Fatalf("newest replica has %d items", r.Tree().Len())
+	}
+}
+
+func TestReplicaMaxWrites(t *testing.T) {
+	p := NewReplicaPool(New(3), ReplicaPoolOptions{Size: 3, MaxWrites: 3})
+	defer p.Close()
+	for i := 0; i < 8; i++ {
+		insert(p, i)
+		r := p.Acquire()
+		// 3回書き込むごとに、それまでの書き込みを含むスナップショットを作る。
+		if want := (i + 1) / 3 * 3; r.Tree().Len() != want {
+			t.Fatalf("after %d writes the newest replica has %d items, want %d", i+1, r.Tree().Len(), want)
+		}
+		r.Release()
+	}
+	if p.Len() != 3 {
+		t.Fatalf("pool holds %d replicas, want 3", p.Len())
+	}
+	// 明示的なRefreshは、書き込みの回数を数え直す。
+	p.Refresh()
+	insert(p, 8)
+	insert(p, 9)
+	if r := p.Acquire(); r.Tree().Len() != 8 {
+		t.Fatalf("newest replica has %d items, want 8", r.Tree().Len())
+	}
+}
+
+func TestReplicaInterval(t *testing.T) {
+	p := NewReplicaPool(New(3), ReplicaPoolOptions{Interval: time.Millisecond})
+	insert(p, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r := p.Acquire()
+		n := r.Tree().Len()
+		r.Release()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the write never reached a snapshot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p.Close()
+	p.Close()
+	// Closeした後は、時間では更新しない。
+	insert(p, 2)
+	time.Sleep(20 * time.Millisecond)
+	if r := p.Acquire(); r.Tree().Len() != 1 {
+		t.Fatalf("a snapshot was refreshed after Close: %d items", r.Tree().Len())
+	}
+}
+
+// TestReplicaConcurrentReadersは、書き込みとスナップショットの更新と並行して、スナップショットを読んで返却できることを確かめます。-raceで実行してください。
+func TestReplicaConcurrentReaders(t *testing.T) {
+	p := NewReplicaPool(New(3), ReplicaPoolOptions{Size: 2, MaxWrites: 7, Interval: time.Millisecond})
+	defer p.Close()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan string, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r := p.Acquire()
+				// 書き込みは0から順に追加するので、どのスナップショットも0からLen-1までを持つ。
+				n, next := r.Tree().Len(), 0
+				r.Tree().Ascend(func(i Item) bool {
+					if i != Int(next) {
+						return false
+					}
+					next++
+					return true
+				})
+				r.Release()
+				if next != n {
+					errs <- "a snapshot changed while it was being read"
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 2000; i++ {
+		insert(p, i)
+		if i%100 == 0 {
+			p.Refresh()
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
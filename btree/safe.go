@@ -0,0 +1,367 @@
+package btree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// SafeBTreeGは、複数のゴルーチンから同時に読み書きできるBTreeGです。
+	//
+	// 書き込みはミューテックスで直列化して書き込み用の木に行い、そのたびに書き込み用の木のCloneを読み取り用のスナップショットとして
+	// アトミックに差し替えます。読み取りは最新のスナップショットに対してロックなしで行うので、書き込みと互いに待つことはありません。
+	// Cloneの後の書き込みはコピーオンライトになるので、1回の書き込みで新しく作られるノードは経路上の O(log n) 個だけです。
+	//
+	// 反復処理はその開始時点のスナップショットをたどるので、反復中に（コールバックの中からでも）木を変更しても構いません。
+	// スナップショットはノードを所有せず、書き込み用の木もスナップショットと共有しているノードを所有しないので、
+	// 読み取り中のノードがフリーリストに戻されて再利用されることはありません。
+	SafeBTreeG[T any] struct {
+		mu   sync.Mutex
+		w    *BTreeG[T]
+		snap atomic.Pointer[BTreeG[T]]
+	}
+
+	// SafeBTreeは、アイテムをItemインターフェースで保持するSafeBTreeG[Item]と同じものです。
+	SafeBTree SafeBTreeG[Item]
+)
+
+// NewSafeGは、与えられたdegreeとLessFuncで新しいSafeBTreeGを作成します。
+func NewSafeG[T any](degree int, less LessFunc[T]) *SafeBTreeG[T] {
+	return newSafe(NewG(degree, less))
+}
+
+// newSafeは、wを書き込み用の木とするSafeBTreeGを作成します。
+func newSafe[T any](w *BTreeG[T]) *SafeBTreeG[T] {
+	s := &SafeBTreeG[T]{w: w}
+	s.publish()
+	return s
+}
+
+// publishは、書き込み用の木のCloneを新しいスナップショットにします。s.muを保持して呼ぶ必要があります。
+func (s *SafeBTreeG[T]) publish() {
+	s.snap.Store(s.w.Clone())
+}
+
+// viewは、最新のスナップショットのヘッダーのコピーを返します。
+// btreedebugビルドでは反復中であることをヘッダーに記録するので、読み取り側のゴルーチンどうしで共有のヘッダーを書き換えないようにコピーを使います。
+func (s *SafeBTreeG[T]) view() BTreeG[T] {
+	return *s.snap.Load()
+}
+
+// Cloneは、同じ内容を持つ新しいSafeBTreeGを返します。ノードはコピーオンライトで共有されます。
+func (s *SafeBTreeG[T]) Clone() *SafeBTreeG[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return newSafe(s.w.Clone())
+}
+
+// Snapshotは、現在の内容を持つ通常のBTreeGを返します。返された木は以後のsへの書き込みの影響を受けず、自由に読み書きできます。
+func (s *SafeBTreeG[T]) Snapshot() *BTreeG[T] {
+	v := s.view()
+	return v.Clone()
+}
+
+// ReplaceOrInsertは、BTreeG.ReplaceOrInsertと同じです。
+func (s *SafeBTreeG[T]) ReplaceOrInsert(item T) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publish()
+	return s.w.ReplaceOrInsert(item)
+}
+
+// Deleteは、BTreeG.Deleteと同じです。
+func (s *SafeBTreeG[T]) Delete(item T) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publish()
+	return s.w.Delete(item)
+}
+
+// DeleteMinは、BTreeG.DeleteMinと同じです。
+func (s *SafeBTreeG[T]) DeleteMin() (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publish()
+	return s.w.DeleteMin()
+}
+
+// DeleteMaxは、BTreeG.DeleteMaxと同じです。
+func (s *SafeBTreeG[T]) DeleteMax() (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publish()
+	return s.w.DeleteMax()
+}
+
+// GetOrInsertは、BTreeG.GetOrInsertと同じです。探索と挿入は1つのロックの中で行うので、同時に呼んでも挿入されるのは1つだけです。
+// 項目がすでにあった場合は、スナップショットを作り直しません。
+func (s *SafeBTreeG[T]) GetOrInsert(item T) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, loaded := s.w.GetOrInsert(item)
+	if !loaded {
+		s.publish()
+	}
+	return out, loaded
+}
+
+// Clearは、すべての項目を削除します。ノードは読み取り中のスナップショットから参照されている可能性があるので、
+// addNodesToFreelistに関わらずフリーリストには戻さず、GCに任せます。
+func (s *SafeBTreeG[T]) Clear(addNodesToFreelist bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publish()
+	s.w.Clear(false)
+}
+
+// Getは、BTreeG.Getと同じです。
+func (s *SafeBTreeG[T]) Get(key T) (T, bool) {
+	v := s.view()
+	return v.Get(key)
+}
+
+// Hasは、BTreeG.Hasと同じです。
+func (s *SafeBTreeG[T]) Has(key T) bool {
+	v := s.view()
+	return v.Has(key)
+}
+
+// Minは、BTreeG.Minと同じです。
+func (s *SafeBTreeG[T]) Min() (T, bool) {
+	v := s.view()
+	return v.Min()
+}
+
+// Maxは、BTreeG.Maxと同じです。
+func (s *SafeBTreeG[T]) Max() (T, bool) {
+	v := s.view()
+	return v.Max()
+}
+
+// Lenは、BTreeG.Lenと同じです。
+func (s *SafeBTreeG[T]) Len() int {
+	return s.snap.Load().Len()
+}
+
+// Errは、BTreeG.Errと同じです。
+func (s *SafeBTreeG[T]) Err() error {
+	return s.snap.Load().Err()
+}
+
+// AscendRangeは、BTreeG.AscendRangeと同じです。
+func (s *SafeBTreeG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// AscendLessThanは、BTreeG.AscendLessThanと同じです。
+func (s *SafeBTreeG[T]) AscendLessThan(pivot T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.AscendLessThan(pivot, iterator)
+}
+
+// AscendGreaterOrEqualは、BTreeG.AscendGreaterOrEqualと同じです。
+func (s *SafeBTreeG[T]) AscendGreaterOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.AscendGreaterOrEqual(pivot, iterator)
+}
+
+// Ascendは、BTreeG.Ascendと同じです。
+func (s *SafeBTreeG[T]) Ascend(iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.Ascend(iterator)
+}
+
+// DescendRangeは、BTreeG.DescendRangeと同じです。
+func (s *SafeBTreeG[T]) DescendRange(lessOrEqual, greaterThan T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.DescendRange(lessOrEqual, greaterThan, iterator)
+}
+
+// DescendLessOrEqualは、BTreeG.DescendLessOrEqualと同じです。
+func (s *SafeBTreeG[T]) DescendLessOrEqual(pivot T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.DescendLessOrEqual(pivot, iterator)
+}
+
+// DescendGreaterThanは、BTreeG.DescendGreaterThanと同じです。
+func (s *SafeBTreeG[T]) DescendGreaterThan(pivot T, iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.DescendGreaterThan(pivot, iterator)
+}
+
+// Descendは、BTreeG.Descendと同じです。
+func (s *SafeBTreeG[T]) Descend(iterator ItemIteratorG[T]) {
+	v := s.view()
+	v.Descend(iterator)
+}
+
+// Allは、呼び出した時点のスナップショットのすべての項目を昇順に返すイテレータを返します。
+func (s *SafeBTreeG[T]) All() func(yield func(T) bool) {
+	v := s.view()
+	return v.All()
+}
+
+// Rangeは、呼び出した時点のスナップショットの [greaterOrEqual, lessThan) の範囲の項目を昇順に返すイテレータを返します。
+func (s *SafeBTreeG[T]) Range(greaterOrEqual, lessThan T) func(yield func(T) bool) {
+	v := s.view()
+	return v.Range(greaterOrEqual, lessThan)
+}
+
+// Backwardは、呼び出した時点のスナップショットのすべての項目を降順に返すイテレータを返します。
+func (s *SafeBTreeG[T]) Backward() func(yield func(T) bool) {
+	v := s.view()
+	return v.Backward()
+}
+
+// SafeBTree
+
+// NewSafeは、与えられたdegreeで新しいSafeBTreeを作成します。
+func NewSafe(degree int) *SafeBTree {
+	return (*SafeBTree)(newSafe((*BTreeG[Item])(New(degree))))
+}
+
+func (s *SafeBTree) generic() *SafeBTreeG[Item] {
+	return (*SafeBTreeG[Item])(s)
+}
+
+// viewは、最新のスナップショットのヘッダーのコピーをBTreeとして返します。
+func (s *SafeBTree) view() *BTree {
+	v := s.generic().view()
+	return (*BTree)(&v)
+}
+
+// Cloneは、同じ内容を持つ新しいSafeBTreeを返します。
+func (s *SafeBTree) Clone() *SafeBTree {
+	return (*SafeBTree)(s.generic().Clone())
+}
+
+// Snapshotは、現在の内容を持つ通常のBTreeを返します。返された木は以後のsへの書き込みの影響を受けず、自由に読み書きできます。
+func (s *SafeBTree) Snapshot() *BTree {
+	return (*BTree)(s.generic().Snapshot())
+}
+
+// ReplaceOrInsertは、BTree.ReplaceOrInsertと同じです。
+func (s *SafeBTree) ReplaceOrInsert(item Item) Item {
+	if item == nil {
+		panic("nil item being added to BTree")
+	}
+	out, _ := s.generic().ReplaceOrInsert(item)
+	return out
+}
+
+// Deleteは、BTree.Deleteと同じです。
+func (s *SafeBTree) Delete(item Item) Item {
+	out, _ := s.generic().Delete(item)
+	return out
+}
+
+// DeleteMinは、BTree.DeleteMinと同じです。
+func (s *SafeBTree) DeleteMin() Item {
+	out, _ := s.generic().DeleteMin()
+	return out
+}
+
+// DeleteMaxは、BTree.DeleteMaxと同じです。
+func (s *SafeBTree) DeleteMax() Item {
+	out, _ := s.generic().DeleteMax()
+	return out
+}
+
+// GetOrInsertは、BTree.GetOrInsertと同じです。
+func (s *SafeBTree) GetOrInsert(item Item) (Item, bool) {
+	if item == nil {
+		panic("nil item being added to BTree")
+	}
+	return s.generic().GetOrInsert(item)
+}
+
+// Clearは、すべての項目を削除します。詳細はSafeBTreeG.Clearを参照してください。
+func (s *SafeBTree) Clear(addNodesToFreelist bool) {
+	s.generic().Clear(addNodesToFreelist)
+}
+
+// Getは、BTree.Getと同じです。
+func (s *SafeBTree) Get(key Item) Item {
+	return s.view().Get(key)
+}
+
+// Hasは、BTree.Hasと同じです。
+func (s *SafeBTree) Has(key Item) bool {
+	return s.view().Has(key)
+}
+
+// Minは、BTree.Minと同じです。
+func (s *SafeBTree) Min() Item {
+	return s.view().Min()
+}
+
+// Maxは、BTree.Maxと同じです。
+func (s *SafeBTree) Max() Item {
+	return s.view().Max()
+}
+
+// Lenは、BTree.Lenと同じです。
+func (s *SafeBTree) Len() int {
+	return s.generic().Len()
+}
+
+// Errは、BTree.Errと同じです。
+func (s *SafeBTree) Err() error {
+	return s.generic().Err()
+}
+
+// AscendRangeは、BTree.AscendRangeと同じです。
+func (s *SafeBTree) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	s.view().AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// AscendLessThanは、BTree.AscendLessThanと同じです。
+func (s *SafeBTree) AscendLessThan(pivot Item, iterator ItemIterator) {
+	s.view().AscendLessThan(pivot, iterator)
+}
+
+// AscendGreaterOrEqualは、BTree.AscendGreaterOrEqualと同じです。
+func (s *SafeBTree) AscendGreaterOrEqual(pivot Item, iterator ItemIterator) {
+	s.view().AscendGreaterOrEqual(pivot, iterator)
+}
+
+// Ascendは、BTree.Ascendと同じです。
+func (s *SafeBTree) Ascend(iterator ItemIterator) {
+	s.view().Ascend(iterator)
+}
+
+// DescendRangeは、BTree.DescendRangeと同じです。
+func (s *SafeBTree) DescendRange(lessOrEqual, greaterThan Item, iterator ItemIterator) {
+	s.view().DescendRange(lessOrEqual, greaterThan, iterator)
+}
+
+// DescendLessOrEqualは、BTree.DescendLessOrEqualと同じです。
+func (s *SafeBTree) DescendLessOrEqual(pivot Item, iterator ItemIterator) {
+	s.view().DescendLessOrEqual(pivot, iterator)
+}
+
+// DescendGreaterThanは、BTree.DescendGreaterThanと同じです。
+func (s *SafeBTree) DescendGreaterThan(pivot Item, iterator ItemIterator) {
+	s.view().DescendGreaterThan(pivot, iterator)
+}
+
+// Descendは、BTree.Descendと同じです。
+func (s *SafeBTree) Descend(iterator ItemIterator) {
+	s.view().Descend(iterator)
+}
+
+// Allは、呼び出した時点のスナップショットのすべての項目を昇順に返すイテレータを返します。
+func (s *SafeBTree) All() func(yield func(Item) bool) {
+	return s.view().All()
+}
+
+// Rangeは、呼び出した時点のスナップショットの [greaterOrEqual, lessThan) の範囲の項目を昇順に返すイテレータを返します。nilの境界は「境界なし」を意味します。
+func (s *SafeBTree) Range(greaterOrEqual, lessThan Item) func(yield func(Item) bool) {
+	return s.view().Range(greaterOrEqual, lessThan)
+}
+
+// Backwardは、呼び出した時点のスナップショットのすべての項目を降順に返すイテレータを返します。
+func (s *SafeBTree) Backward() func(yield func(Item) bool) {
+	return s.view().Backward()
+}
@@ -0,0 +1,207 @@
+package btree
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const safeWriters = 4
+
+// checkSafePrefixesは、各書き込みゴルーチンの範囲[g*10000, g*10000+10000)にある項目が、0から順に途切れずに並んでいることを確かめ、
+// 範囲ごとの項目数を返します。書き込みはその順に追加するので、どのスナップショットでも成り立ちます。
+func checkSafePrefixes(items []int) ([safeWriters]int, error) {
+	var counts [safeWriters]int
+	for j, i := range items {
+		if j > 0 && i <= items[j-1] {
+			return counts, fmt.Errorf("items out of order: %d after %d", i, items[j-1])
+		}
+		if i < 0 {
+			continue
+		}
+		g := i / 10000
+		if i%10000 != counts[g] {
+			return counts, fmt.Errorf("writer %d: item %d after %d items", g, i, counts[g])
+		}
+		counts[g]++
+	}
+	return counts, nil
+}
+
+// TestSafeConcurrentは、書き込みと並行して読み取りと走査を行い、どの走査も1つのスナップショットを一貫して見ることを確かめます。-raceで実行してください。
+func TestSafeConcurrent(t *testing.T) {
+	s := NewSafeG(3, intLess)
+	const n = 500
+	var writers, readers sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, 16)
+	for g := 0; g < safeWriters; g++ {
+		writers.Add(1)
+		go func(g int) {
+			defer writers.Done()
+			for i := 0; i < n; i++ {
+				s.ReplaceOrInsert(g*10000 + i)
+				// 負の範囲では、追加と削除を繰り返す。
+				s.ReplaceOrInsert(-1 - i%50)
+				s.Delete(-1 - (i+25)%50)
+			}
+		}(g)
+	}
+	read := func(f func() error) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := f(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var last [safeWriters]int
+	read(func() error {
+		var items []int
+		s.Ascend(func(i int) bool {
+			items = append(items, i)
+			return true
+		})
+		counts, err := checkSafePrefixes(items)
+		for g := range counts {
+			if counts[g] < last[g] {
+				return fmt.Errorf("writer %d: a later scan saw %d items, an earlier one %d", g, counts[g], last[g])
+			}
+		}
+		last = counts
+		return err
+	})
+	read(func() error {
+		var items []int
+		s.Descend(func(i int) bool {
+			items = append([]int{i}, items...)
+			return true
+		})
+		_, err := checkSafePrefixes(items)
+		return err
+	})
+	read(func() error {
+		var items []int
+		s.Range(10000, 20000)(func(i int) bool {
+			items = append(items, i)
+			return true
+		})
+		_, err := checkSafePrefixes(items)
+		return err
+	})
+	read(func() error {
+		snap := s.Snapshot()
+		if err := snap.Verify(); err != nil {
+			return err
+		}
+		n := 0
+		snap.Ascend(func(int) bool {
+			n++
+			return true
+		})
+		if n != snap.Len() {
+			return fmt.Errorf("snapshot has Len %d and %d items", snap.Len(), n)
+		}
+		// スナップショットは自由に書き換えられ、sには影響しない。
+		snap.ReplaceOrInsert(1 << 30)
+		return nil
+	})
+	read(func() error {
+		if _, ok := s.Get(0); ok && !s.Has(0) {
+			return fmt.Errorf("Get(0) found an item that Has(0) did not")
+		}
+		s.Min()
+		s.Max()
+		return nil
+	})
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	kept := 0
+	s.AscendGreaterOrEqual(0, func(int) bool {
+		kept++
+		return true
+	})
+	if s.Has(1<<30) || kept != safeWriters*n {
+		t.Fatalf("%d non-negative items at the end, want %d", kept, safeWriters*n)
+	}
+}
+
+// TestSafeWriteDuringAscendは、走査のコールバックの中から、他のゴルーチンと並行して書き込めることを確かめます。
+func TestSafeWriteDuringAscend(t *testing.T) {
+	s := NewSafe(3)
+	for i := 0; i < 100; i++ {
+		s.ReplaceOrInsert(Int(i))
+	}
+	var wg, started sync.WaitGroup
+	started.Add(4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			seen := 0
+			s.Ascend(func(i Item) bool {
+				// すべてのゴルーチンが走査を始めてから書き込むので、どの走査も元の100個を見る。
+				if seen == 0 {
+					started.Done()
+					started.Wait()
+				}
+				seen++
+				// 走査は開始時点のスナップショットをたどるので、書き込みは走査に現れない。
+				s.Delete(i)
+				s.ReplaceOrInsert(Int(1000*(g+1)) + i.(Int))
+				return true
+			})
+			if seen != 100 {
+				t.Errorf("goroutine %d saw %d items", g, seen)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if s.Len() != 400 || s.Min() != Int(1000) || s.Max() != Int(4099) {
+		t.Fatalf("Len %d, Min %v, Max %v", s.Len(), s.Min(), s.Max())
+	}
+}
+
+// TestSafeGetOrInsertは、同じ項目を同時にGetOrInsertしても、挿入されるのは1回だけであることを確かめます。
+func TestSafeGetOrInsert(t *testing.T) {
+	s := NewSafeG(3, intLess)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted := map[int]int{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if _, loaded := s.GetOrInsert(i); !loaded {
+					mu.Lock()
+					inserted[i]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(inserted) != 200 || s.Len() != 200 {
+		t.Fatalf("%d items inserted, Len %d", len(inserted), s.Len())
+	}
+	for i, n := range inserted {
+		if n != 1 {
+			t.Fatalf("item %d inserted %d times", i, n)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package btree
+
+import "time"
+
+type (
+	// Sizerは、アイテムのおおよそのバイト数を報告するためのオプションのインターフェースです。
+	// ScanLimits.MaxBytesは、Sizerを実装しているアイテムのサイズだけを数えます。
+	Sizer interface {
+		Size() int
+	}
+
+	// ScanLimitsは、1回の範囲走査に対する予算です。ゼロ値のフィールドは制限なしを意味します。
+	ScanLimits struct {
+		MaxItems    int           // 返すアイテムの最大数
+		MaxBytes    int           // 返すアイテムのSizeの合計の上限（最低1件は返す）
+		MaxDuration time.Duration // 走査にかけてよい最大時間
+	}
+
+	// ScanResultGは、予算付き走査の結果です。
+	// Truncatedがtrueの場合、Resumeには次に返されるはずだったアイテムが入っており、それを開始位置として走査を再開できます。
+	ScanResultG[T any] struct {
+		Count     int
+		Bytes     int
+		Truncated bool
+		Resume    T
+	}
+
+	// ScanResultは、BTreeの予算付き走査の結果です。打ち切られなかった場合、Resumeはnilです。
+	ScanResult ScanResultG[Item]
+)
+
+// limiterは、走査中の予算を数えるための状態です。
+type limiter[T any] struct {
+	limits   ScanLimits
+	deadline time.Time
+	res      ScanResultG[T]
+}
+
+func newLimiter[T any](limits ScanLimits) *limiter[T] {
+	l := &limiter[T]{limits: limits}
+	if limits.MaxDuration > 0 {
+		l.deadline = time.Now().Add(limits.MaxDuration)
+	}
+	return l
+}
+
+// wrapは、予算を超えたところで走査を打ち切るようにiteratorを包みます。
+func (l *limiter[T]) wrap(iterator ItemIteratorG[T]) ItemIteratorG[T] {
+	return func(i T) bool {
+		size := 0
+		if s, ok := any(i).(Sizer); ok {
+			size = s.Size()
+		}
+		if l.exceeded(size) {
+			l.res.Truncated = true
+			l.res.Resume = i
+			return false
+		}
+		l.res.Count++
+		l.res.Bytes += size
+		return iterator(i)
+	}
+}
+
+// exceededは、次のアイテム（サイズsize）を返すと予算を超えるかどうかを返します。
+func (l *limiter[T]) exceeded(size int) bool {
+	if l.limits.MaxItems > 0 && l.res.Count >= l.limits.MaxItems {
+		return true
+	}
+	if l.limits.MaxBytes > 0 && l.res.Count > 0 && l.res.Bytes+size > l.limits.MaxBytes {
+		return true
+	}
+	if !l.deadline.IsZero() && !time.Now().Before(l.deadline) {
+		return true
+	}
+	return false
+}
+
+// AscendRangeLimitsは、AscendRangeと同様に [greaterOrEqual, lessThan) の範囲を昇順に走査しますが、limitsの予算を超えた時点で打ち切ります。
+// 打ち切られた場合、結果のResumeをgreaterOrEqualに渡すと続きから走査できます。
+func (t *BTreeG[T]) AscendRangeLimits(greaterOrEqual, lessThan T, limits ScanLimits, iterator ItemIteratorG[T]) ScanResultG[T] {
+	return t.rangeLimits(ascend, optional(greaterOrEqual), optional(lessThan), limits, iterator)
+}
+
+// DescendRangeLimitsは、DescendRangeと同様に [lessOrEqual, greaterThan) の範囲を降順に走査しますが、limitsの予算を超えた時点で打ち切ります。
+// 打ち切られた場合、結果のResumeをlessOrEqualに渡すと続きから走査できます。
+func (t *BTreeG[T]) DescendRangeLimits(lessOrEqual, greaterThan T, limits ScanLimits, iterator ItemIteratorG[T]) ScanResultG[T] {
+	return t.rangeLimits(descend, optional(lessOrEqual), optional(greaterThan), limits, iterator)
+}
+
+func (t *BTreeG[T]) rangeLimits(dir direction, start, stop optionalItem[T], limits ScanLimits, iterator ItemIteratorG[T]) ScanResultG[T] {
+	l := newLimiter[T](limits)
+	t.iterate(dir, start, stop, true, l.wrap(iterator))
+	return l.res
+}
+
+// AscendRangeLimitsは、AscendRangeと同様に [greaterOrEqual, lessThan) の範囲を昇順に走査しますが、limitsの予算を超えた時点で打ち切ります。
+// nilの境界は、その方向に制限がないことを意味します。詳細はBTreeG.AscendRangeLimitsを参照してください。
+func (t *BTree) AscendRangeLimits(greaterOrEqual, lessThan Item, limits ScanLimits, iterator ItemIterator) ScanResult {
+	return ScanResult(t.generic().rangeLimits(ascend, optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), limits, ItemIteratorG[Item](iterator)))
+}
+
+// DescendRangeLimitsは、DescendRangeと同様に [lessOrEqual, greaterThan) の範囲を降順に走査しますが、limitsの予算を超えた時点で打ち切ります。
+// nilの境界は、その方向に制限がないことを意味します。詳細はBTreeG.DescendRangeLimitsを参照してください。
+func (t *BTree) DescendRangeLimits(lessOrEqual, greaterThan Item, limits ScanLimits, iterator ItemIterator) ScanResult {
+	return ScanResult(t.generic().rangeLimits(descend, optionalIfNotNil(lessOrEqual), optionalIfNotNil(greaterThan), limits, ItemIteratorG[Item](iterator)))
+}
+
+// AscendRangeLimitは、[greaterOrEqual, lessThan) の範囲の項目を昇順に最大limit個集めて返します。limitが0以下の場合は範囲のすべての項目を返します。
+// 範囲にまだ項目が残っている場合、nextは次に返されるはずだった項目でmoreはtrueです。
+// nextをgreaterOrEqualに渡すと、次のページをO(log n)で取り出せます。
+func (t *BTreeG[T]) AscendRangeLimit(greaterOrEqual, lessThan T, limit int) (items []T, next T, more bool) {
+	return t.rangeLimit(ascend, optional(greaterOrEqual), optional(lessThan), limit)
+}
+
+// DescendRangeLimitは、[lessOrEqual, greaterThan) の範囲の項目を降順に最大limit個集めて返します。limitが0以下の場合は範囲のすべての項目を返します。
+// 範囲にまだ項目が残っている場合、nextは次に返されるはずだった項目でmoreはtrueです。
+// nextをlessOrEqualに渡すと、次のページをO(log n)で取り出せます。
+func (t *BTreeG[T]) DescendRangeLimit(lessOrEqual, greaterThan T, limit int) (items []T, next T, more bool) {
+	return t.rangeLimit(descend, optional(lessOrEqual), optional(greaterThan), limit)
+}
+
+func (t *BTreeG[T]) rangeLimit(dir direction, start, stop optionalItem[T], limit int) (items []T, next T, more bool) {
+	items = make([]T, pageCap(limit, t.Len()))
+	n, next, more := t.readRange(dir, start, stop, items)
+	return items[:n], next, more
+}
+
+// AscendRangeLimitは、[greaterOrEqual, lessThan) の範囲の項目を昇順に最大limit個集めて返します。limitが0以下の場合は範囲のすべての項目を返します。
+// nilの境界は、その方向に制限がないことを意味します。範囲にまだ項目が残っている場合、nextは次に返されるはずだった項目です。
+// nextをgreaterOrEqualに渡すと、次のページをO(log n)で取り出せます。残っていない場合、nextはnilです。
+func (t *BTree) AscendRangeLimit(greaterOrEqual, lessThan Item, limit int) (items []Item, next Item) {
+	items, next, _ = t.generic().rangeLimit(ascend, optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), limit)
+	return items, next
+}
+
+// DescendRangeLimitは、[lessOrEqual, greaterThan) の範囲の項目を降順に最大limit個集めて返します。limitが0以下の場合は範囲のすべての項目を返します。
+// nilの境界は、その方向に制限がないことを意味します。範囲にまだ項目が残っている場合、nextは次に返されるはずだった項目です。
+// nextをlessOrEqualに渡すと、次のページをO(log n)で取り出せます。残っていない場合、nextはnilです。
+func (t *BTree) DescendRangeLimit(lessOrEqual, greaterThan Item, limit int) (items []Item, next Item) {
+	items, next, _ = t.generic().rangeLimit(descend, optionalIfNotNil(lessOrEqual), optionalIfNotNil(greaterThan), limit)
+	return items, next
+}
+
+// pageCapは、最大limit個の項目を集めるスライスの初期容量を、木の項目数nを超えないように決めます。
+func pageCap(limit, n int) int {
+	if limit <= 0 || limit > n {
+		return n
+	}
+	return limit
+}
+
+// AscendChunksは、[greaterOrEqual, lessThan) の範囲の項目を昇順にchunkSize個ずつまとめてfnに渡します。最後のまとまりはchunkSize個より少ないことがあります。
+// fnがfalseを返すと走査を打ち切ります。項目ごとにコールバックを呼ぶ代わりに、下流へのバッチ書き込みなどをまとめて行うために使います。
+// まとまりごとにReadRangeで続きから読み直すので、fnの中で木を変更しても構いません。
+// fnに渡すスライスは内部のバッファを使い回すので、fnから戻った後は内容が変わります。保持する場合はコピーしてください。chunkSizeが1未満の場合はpanicします。
+func (t *BTreeG[T]) AscendChunks(greaterOrEqual, lessThan T, chunkSize int, fn func(items []T) bool) {
+	t.ascendChunks(optional(greaterOrEqual), optional(lessThan), chunkSize, fn)
+}
+
+func (t *BTreeG[T]) ascendChunks(lo, hi optionalItem[T], chunkSize int, fn func(items []T) bool) {
+	if chunkSize < 1 {
+		panic("bad chunk size")
+	}
+	buf := make([]T, pageCap(chunkSize, t.Len()))
+	for {
+		n, next, more := t.readRange(ascend, lo, hi, buf)
+		if n == 0 || !fn(buf[:n]) || !more {
+			return
+		}
+		lo = optional(next)
+	}
+}
+
+// AscendChunksは、[greaterOrEqual, lessThan) の範囲の項目を昇順にchunkSize個ずつまとめてfnに渡します。nilの境界は「境界なし」を意味します。
+// 詳細はBTreeG.AscendChunksを参照してください。
+func (t *BTree) AscendChunks(greaterOrEqual, lessThan Item, chunkSize int, fn func(items []Item) bool) {
+	t.generic().ascendChunks(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), chunkSize, fn)
+}
+
+// ReadRangeは、[greaterOrEqual, lessThan) の範囲の項目を昇順にbufへ詰め、詰めた数nを返します。bufがいっぱいになると止まり、メモリを割り当てません。
+// 範囲にまだ項目が残っている場合、nextは次に読まれるはずだった項目でmoreはtrueです。nextをgreaterOrEqualに渡すと、続きをO(log n)で読めます。
+// ページ分割やまとまりごとの走査は、これを繰り返し呼んで実装します。
+func (t *BTreeG[T]) ReadRange(greaterOrEqual, lessThan T, buf []T) (n int, next T, more bool) {
+	return t.readRange(ascend, optional(greaterOrEqual), optional(lessThan), buf)
+}
+
+// readRangeは、dirの向きにstartからstopの手前までの項目をbufへ詰めます。ReadRangeと、降順を含むページ分割の共通の実装です。
+func (t *BTreeG[T]) readRange(dir direction, start, stop optionalItem[T], buf []T) (n int, next T, more bool) {
+	t.iterate(dir, start, stop, true, func(item T) bool {
+		if n == len(buf) {
+			next, more = item, true
+			return false
+		}
+		buf[n] = item
+		n++
+		return true
+	})
+	return n, next, more
+}
+
+// ReadRangeは、[greaterOrEqual, lessThan) の範囲の項目を昇順にbufへ詰め、詰めた数nを返します。nilの境界は「境界なし」を意味します。
+// 範囲にまだ項目が残っている場合、nextは次に読まれるはずだった項目です。残っていない場合はnilです。詳細はBTreeG.ReadRangeを参照してください。
+func (t *BTree) ReadRange(greaterOrEqual, lessThan Item, buf []Item) (n int, next Item) {
+	n, next, _ = t.generic().readRange(ascend, optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), buf)
+	return n, next
+}
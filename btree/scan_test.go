@@ -0,0 +1,185 @@
+package btree
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRangeLimitPaging(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	var asc []int
+	for lo, more := 10, true; more; {
+		var page []int
+		page, lo, more = tr.AscendRangeLimit(lo, 90, 7)
+		if len(page) > 7 {
+			t.Fatalf("page of %d items exceeds the limit", len(page))
+		}
+		asc = append(asc, page...)
+	}
+	var desc []int
+	for hi, more := 89, true; more; {
+		var page []int
+		page, hi, more = tr.DescendRangeLimit(hi, 9, 7)
+		desc = append(desc, page...)
+	}
+	var want, wantDesc []int
+	for i := 10; i < 90; i++ {
+		want = append(want, i)
+		wantDesc = append(wantDesc, 99-i)
+	}
+	if !reflect.DeepEqual(asc, want) {
+		t.Errorf("ascending pages = %v, want %v", asc, want)
+	}
+	if !reflect.DeepEqual(desc, wantDesc) {
+		t.Errorf("descending pages = %v, want %v", desc, wantDesc)
+	}
+	if items, _, more := tr.DescendRangeLimit(50, 40, 0); len(items) != 10 || more {
+		t.Errorf("DescendRangeLimit with no limit = %v, %v", items, more)
+	}
+}
+
+func TestBTreeRangeLimitNilBounds(t *testing.T) {
+	tr := New(3)
+	for i := 0; i < 20; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	items, next := tr.DescendRangeLimit(nil, nil, 5)
+	if len(items) != 5 || items[0] != Int(19) || next != Int(14) {
+		t.Fatalf("DescendRangeLimit(nil, nil, 5) = %v, %v", items, next)
+	}
+	items, next = tr.AscendRangeLimit(Int(15), nil, 10)
+	if len(items) != 5 || items[0] != Int(15) || next != nil {
+		t.Fatalf("AscendRangeLimit(15, nil, 10) = %v, %v", items, next)
+	}
+}
+
+// sizedは、Sizerを実装する項目です。
+type sized struct{ k, size int }
+
+func (s sized) Size() int { return s.size }
+
+func sizedLess(a, b sized) bool { return a.k < b.k }
+
+// TestRangeLimitsPagingは、MaxItemsで打ち切った走査をResumeから再開すると、範囲のすべての項目をちょうど1回ずつたどることを確かめます。
+func TestRangeLimitsPaging(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	collect := func(out *[]int) ItemIteratorG[int] {
+		return func(i int) bool {
+			*out = append(*out, i)
+			return true
+		}
+	}
+	var asc, desc []int
+	for lo, pages := 10, 0; ; pages++ {
+		res := tr.AscendRangeLimits(lo, 90, ScanLimits{MaxItems: 7}, collect(&asc))
+		if res.Count > 7 || res.Count != len(asc)-pages*7 {
+			t.Fatalf("ascending page of %d items, limit 7", res.Count)
+		}
+		if !res.Truncated {
+			break
+		}
+		lo = res.Resume
+	}
+	for hi := 89; ; {
+		res := tr.DescendRangeLimits(hi, 9, ScanLimits{MaxItems: 7}, collect(&desc))
+		if !res.Truncated {
+			break
+		}
+		hi = res.Resume
+	}
+	var want, wantDesc []int
+	for i := 10; i < 90; i++ {
+		want = append(want, i)
+		wantDesc = append(wantDesc, 99-i)
+	}
+	if !reflect.DeepEqual(asc, want) {
+		t.Errorf("ascending pages = %v, want %v", asc, want)
+	}
+	if !reflect.DeepEqual(desc, wantDesc) {
+		t.Errorf("descending pages = %v, want %v", desc, wantDesc)
+	}
+	// 範囲をちょうど使い切った場合は、打ち切りではない。
+	if res := tr.AscendRangeLimits(0, 7, ScanLimits{MaxItems: 7}, func(int) bool { return true }); res.Truncated || res.Count != 7 {
+		t.Errorf("a scan that fits the limit exactly = %+v", res)
+	}
+	// iteratorが止めた場合も、打ち切りではない。
+	if res := tr.AscendRangeLimits(0, 50, ScanLimits{MaxItems: 10}, func(i int) bool { return i < 3 }); res.Truncated || res.Count != 4 {
+		t.Errorf("a scan stopped by the iterator = %+v", res)
+	}
+}
+
+func TestRangeLimitsBytes(t *testing.T) {
+	tr := NewG(3, sizedLess)
+	for i, size := range []int{50, 30, 30, 10, 200, 5} {
+		tr.ReplaceOrInsert(sized{i, size})
+	}
+	for _, tc := range []struct {
+		lo, maxBytes int
+		count, bytes int
+		resume       int
+	}{
+		{0, 100, 2, 80, 2},
+		{0, 110, 3, 110, 3},
+		{3, 100, 1, 10, 4},
+		// 最初の1件は、それだけで予算を超えていても返す。
+		{4, 100, 1, 200, 5},
+		{0, 10, 1, 50, 1},
+	} {
+		res := tr.AscendRangeLimits(sized{k: tc.lo}, sized{k: 100}, ScanLimits{MaxBytes: tc.maxBytes}, func(sized) bool { return true })
+		if !res.Truncated || res.Count != tc.count || res.Bytes != tc.bytes || res.Resume.k != tc.resume {
+			t.Errorf("from %d with MaxBytes %d: %+v, want %d items, %d bytes, resume at %d", tc.lo, tc.maxBytes, res, tc.count, tc.bytes, tc.resume)
+		}
+	}
+	res := tr.DescendRangeLimits(sized{k: 5}, sized{k: -1}, ScanLimits{MaxItems: 3, MaxBytes: 1000}, func(sized) bool { return true })
+	if !res.Truncated || res.Count != 3 || res.Bytes != 215 || res.Resume.k != 2 {
+		t.Errorf("descending with MaxItems 3 = %+v", res)
+	}
+	// Sizerを実装しない項目は0バイトとして数える。
+	ints := NewG(3, intLess)
+	for i := 0; i < 10; i++ {
+		ints.ReplaceOrInsert(i)
+	}
+	if res := ints.AscendRangeLimits(0, 10, ScanLimits{MaxBytes: 1}, func(int) bool { return true }); res.Truncated || res.Count != 10 || res.Bytes != 0 {
+		t.Errorf("MaxBytes on items without a size = %+v", res)
+	}
+}
+
+func TestRangeLimitsDuration(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 1000; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	res := tr.AscendRangeLimits(0, 1000, ScanLimits{MaxDuration: time.Nanosecond}, func(int) bool { return true })
+	if !res.Truncated || res.Count >= 1000 || res.Resume != res.Count {
+		t.Fatalf("a 1ns budget = %+v", res)
+	}
+	if res := tr.AscendRangeLimits(0, 1000, ScanLimits{MaxDuration: time.Hour}, func(int) bool { return true }); res.Truncated || res.Count != 1000 {
+		t.Fatalf("a 1h budget = %+v", res)
+	}
+}
+
+func TestBTreeRangeLimits(t *testing.T) {
+	tr := New(3)
+	for i := 0; i < 20; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	var got []Item
+	res := tr.DescendRangeLimits(nil, nil, ScanLimits{MaxItems: 5}, func(i Item) bool {
+		got = append(got, i)
+		return true
+	})
+	if len(got) != 5 || got[0] != Int(19) || !res.Truncated || res.Resume != Int(14) {
+		t.Fatalf("DescendRangeLimits(nil, nil) = %v, %+v", got, res)
+	}
+	res = tr.AscendRangeLimits(Int(15), nil, ScanLimits{MaxItems: 10}, func(Item) bool { return true })
+	if res.Count != 5 || res.Truncated || res.Resume != nil {
+		t.Fatalf("AscendRangeLimits(15, nil) = %+v", res)
+	}
+}
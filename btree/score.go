@@ -0,0 +1,193 @@
+package btree
+
+// rescoreは、スコアを保持する木で、項目と子のサブツリーのスコアからこのノードのminScoreとmaxScoreを計算し直します。
+// 子のminScoreとmaxScoreは正しい必要があります。スコアを保持しない木では何もしません。
+func (n *node[T]) rescore() {
+	if n.cow == nil || n.cow.score == nil {
+		return
+	}
+	n.minScore, n.maxScore = n.scores(n.cow.score)
+}
+
+// scoresは、項目と子のサブツリーのスコアから、このノードのサブツリーのスコアの最小値と最大値を求めます。項目がなければ (0, 0) を返します。
+func (n *node[T]) scores(score func(T) float64) (lo, hi float64) {
+	first := true
+	add := func(a, b float64) {
+		if first || a < lo {
+			lo = a
+		}
+		if first || b > hi {
+			hi = b
+		}
+		first = false
+	}
+	for _, item := range n.items {
+		s := score(item)
+		add(s, s)
+	}
+	for _, c := range n.children {
+		add(c.minScore, c.maxScore)
+	}
+	return lo, hi
+}
+
+// MaxByは、木の中でOptionsG.Scoreが最大の項目を返します。同じスコアの項目が複数ある場合は、キーが最も小さいものを返します。
+// 木が空の場合は (zeroValue, false) を返します。Scoreを指定せずに作った木ではパニックします。
+func (t *BTreeG[T]) MaxBy() (T, bool) {
+	return t.extremeBy(empty[T](), empty[T](), true)
+}
+
+// MinByは、木の中でOptionsG.Scoreが最小の項目を返します。同じスコアの項目が複数ある場合は、キーが最も小さいものを返します。
+func (t *BTreeG[T]) MinBy() (T, bool) {
+	return t.extremeBy(empty[T](), empty[T](), false)
+}
+
+// MaxByRangeは、[greaterOrEqual, lessThan) の範囲の項目のうちOptionsG.Scoreが最大のものを返します。範囲に項目がなければ (zeroValue, false) を返します。
+// 範囲に丸ごと含まれるサブツリーは、ノードに保持したスコアの最大値だけを見て降りないので、範囲の大きさによらずO(degree log n)で求まります。
+// 「キーの範囲の中で最もスコアの高い項目」を、範囲を走査せずに求めるために使います。
+func (t *BTreeG[T]) MaxByRange(greaterOrEqual, lessThan T) (T, bool) {
+	return t.extremeBy(optional(greaterOrEqual), optional(lessThan), true)
+}
+
+// MinByRangeは、[greaterOrEqual, lessThan) の範囲の項目のうちOptionsG.Scoreが最小のものを返します。詳細はMaxByRangeを参照してください。
+func (t *BTreeG[T]) MinByRange(greaterOrEqual, lessThan T) (T, bool) {
+	return t.extremeBy(optional(greaterOrEqual), optional(lessThan), false)
+}
+
+// scoreSearchは、extremeByの探索の状態です。これまでの最良のスコアと、それを持つ項目か、まだ降りていないサブツリーを保持します。
+type scoreSearch[T any] struct {
+	score   func(T) float64
+	less    LessFunc[T]
+	highest bool
+	found   bool
+	best    float64
+	item    T
+	within  *node[T] // nilでなければ、最良のスコアはこのサブツリーの中にある
+}
+
+func (t *BTreeG[T]) extremeBy(lo, hi optionalItem[T], highest bool) (_ T, _ bool) {
+	if t.cow.score == nil {
+		panic("btree: MinBy and MaxBy need OptionsG.Score")
+	}
+	if t.root == nil || t.length == 0 || t.poisoned {
+		return
+	}
+	if lo.valid && hi.valid && !t.cow.less(lo.item, hi.item) {
+		return
+	}
+	s := &scoreSearch[T]{score: t.cow.score, less: t.cow.less, highest: highest}
+	s.search(t.root, lo, hi)
+	if !s.found {
+		return
+	}
+	if s.within != nil {
+		return s.find(s.within), true
+	}
+	return s.item, true
+}
+
+// betterは、スコアvがこれまでの最良より良いかどうかを返します。等しい場合は先に見つけた（キーの小さい）方を残します。
+func (s *scoreSearch[T]) better(v float64) bool {
+	switch {
+	case !s.found:
+		return true
+	case s.highest:
+		return v > s.best
+	default:
+		return v < s.best
+	}
+}
+
+// searchは、nのサブツリーのうち [lo, hi) の範囲の項目をキーの順に調べます。境界のないサブツリーは、保持したスコアだけで比べます。
+func (s *scoreSearch[T]) search(n *node[T], lo, hi optionalItem[T]) {
+	if !lo.valid && !hi.valid {
+		v := n.minScore
+		if s.highest {
+			v = n.maxScore
+		}
+		if len(n.items) > 0 && s.better(v) {
+			s.found, s.best, s.within = true, v, n
+		}
+		return
+	}
+	start, loFound := 0, false
+	if lo.valid {
+		start, loFound = n.items.find(lo.item, s.less)
+	}
+	end := len(n.items)
+	hiFound := false
+	if hi.valid {
+		end, hiFound = n.items.find(hi.item, s.less)
+	}
+	for i := start; i <= end; i++ {
+		if len(n.children) > 0 {
+			// 子iは items[i-1] と items[i] の間の項目を持つ。境界の項目が見つかった側は、その子の項目がすべて範囲の外か内にある。
+			clo, chi := empty[T](), empty[T]()
+			if i == start {
+				clo = lo
+			}
+			if i == end && !hiFound {
+				chi = hi
+			}
+			if !(i == start && loFound) {
+				s.search(n.children[i], clo, chi)
+			}
+		}
+		if i < end {
+			if v := s.score(n.items[i]); s.better(v) {
+				s.found, s.best, s.within, s.item = true, v, nil, n.items[i]
+			}
+		}
+	}
+}
+
+// findは、サブツリーnの中で、スコアが最良の値と等しい最初の項目を返します。
+func (s *scoreSearch[T]) find(n *node[T]) T {
+	for {
+		var next *node[T]
+		for i := 0; i <= len(n.items) && next == nil; i++ {
+			if i < len(n.children) && s.holds(n.children[i]) {
+				next = n.children[i]
+			} else if i < len(n.items) && s.score(n.items[i]) == s.best {
+				return n.items[i]
+			}
+		}
+		if next == nil {
+			panic("btree: subtree scores do not match the items")
+		}
+		n = next
+	}
+}
+
+// holdsは、サブツリーcの最良の側のスコアが、探しているスコアと等しいかどうかを返します。
+func (s *scoreSearch[T]) holds(c *node[T]) bool {
+	if s.highest {
+		return c.maxScore == s.best
+	}
+	return c.minScore == s.best
+}
+
+// MaxByは、木の中でOptions.Scoreが最大の項目を返します。木が空の場合はnilを返します。詳細はBTreeG.MaxByを参照してください。
+func (t *BTree) MaxBy() Item {
+	out, _ := t.generic().MaxBy()
+	return out
+}
+
+// MinByは、木の中でOptions.Scoreが最小の項目を返します。木が空の場合はnilを返します。
+func (t *BTree) MinBy() Item {
+	out, _ := t.generic().MinBy()
+	return out
+}
+
+// MaxByRangeは、[greaterOrEqual, lessThan) の範囲の項目のうちOptions.Scoreが最大のものを返します。nilの境界は「境界なし」を意味します。
+// 範囲に項目がなければnilを返します。詳細はBTreeG.MaxByRangeを参照してください。
+func (t *BTree) MaxByRange(greaterOrEqual, lessThan Item) Item {
+	out, _ := t.generic().extremeBy(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), true)
+	return out
+}
+
+// MinByRangeは、[greaterOrEqual, lessThan) の範囲の項目のうちOptions.Scoreが最小のものを返します。nilの境界は「境界なし」を意味します。
+func (t *BTree) MinByRange(greaterOrEqual, lessThan Item) Item {
+	out, _ := t.generic().extremeBy(optionalIfNotNil(greaterOrEqual), optionalIfNotNil(lessThan), false)
+	return out
+}
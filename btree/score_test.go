@@ -0,0 +1,128 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// scoredは、キーとは別にスコアを持つ項目です。
+type scored struct {
+	key   int
+	score float64
+}
+
+func scoredLess(a, b scored) bool { return a.key < b.key }
+
+// bruteExtremeは、[lo, hi) の項目を走査して、スコアが最大（highestがfalseなら最小）でキーが最も小さい項目を求めます。
+func bruteExtreme(tr *BTreeG[scored], lo, hi int, highest bool) (best scored, ok bool) {
+	tr.AscendRange(scored{key: lo}, scored{key: hi}, func(s scored) bool {
+		if !ok || (highest && s.score > best.score) || (!highest && s.score < best.score) {
+			best, ok = s, true
+		}
+		return true
+	})
+	return best, ok
+}
+
+func TestMinMaxByRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	opts := OptionsG[scored]{Score: func(s scored) float64 { return s.score }}
+	tr := NewWithOptionsG(2+r.Intn(4), scoredLess, opts)
+	check := func(step int) {
+		if err := tr.Verify(); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		for q := 0; q < 20; q++ {
+			lo, hi := r.Intn(1100)-50, r.Intn(1100)-50
+			for _, highest := range []bool{true, false} {
+				want, wantOK := bruteExtreme(tr, lo, hi, highest)
+				got, ok := tr.MinByRange(scored{key: lo}, scored{key: hi})
+				if highest {
+					got, ok = tr.MaxByRange(scored{key: lo}, scored{key: hi})
+				}
+				if ok != wantOK || got != want {
+					t.Fatalf("step %d: [%d, %d) highest=%v: got %v %v, want %v %v", step, lo, hi, highest, got, ok, want, wantOK)
+				}
+			}
+		}
+	}
+	for step := 0; step < 3000; step++ {
+		// スコアの種類を少なくして、同じスコアの項目を多く作る。
+		item := scored{key: r.Intn(1000), score: float64(r.Intn(50))}
+		switch op := r.Intn(10); {
+		case op < 5:
+			tr.ReplaceOrInsert(item)
+		case op < 7:
+			tr.Delete(item)
+		case op == 7:
+			tr.Update(item, func(old scored, found bool) (scored, bool) { return item, true })
+		case op == 8:
+			lo := r.Intn(1000)
+			tr.DeleteRange(scored{key: lo}, scored{key: lo + r.Intn(50)})
+		default:
+			if r.Intn(2) == 0 {
+				tr.DeleteMin()
+			} else {
+				tr.DeleteMax()
+			}
+		}
+		if step%100 == 0 {
+			check(step)
+		}
+	}
+	check(3000)
+	max, _ := tr.MaxBy()
+	if want, _ := bruteExtreme(tr, -1, 1001, true); max != want {
+		t.Fatalf("MaxBy() = %v, want %v", max, want)
+	}
+}
+
+func TestMinMaxByClone(t *testing.T) {
+	tr := NewWithOptionsG(3, scoredLess, OptionsG[scored]{Score: func(s scored) float64 { return s.score }})
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(scored{key: i, score: float64(i)})
+	}
+	c := tr.Clone()
+	c.ReplaceOrInsert(scored{key: 10, score: 1000})
+	if got, _ := c.MaxBy(); got.key != 10 {
+		t.Fatalf("clone MaxBy() = %v, want key 10", got)
+	}
+	if got, _ := tr.MaxBy(); got.key != 99 {
+		t.Fatalf("original MaxBy() = %v after writing to the clone", got)
+	}
+	if got, _ := tr.MinByRange(scored{key: 40}, scored{key: 60}); got.key != 40 {
+		t.Fatalf("MinByRange(40, 60) = %v", got)
+	}
+}
+
+func TestMaxByWithoutScorePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MaxBy on a tree without Score did not panic")
+		}
+	}()
+	New(3).MaxBy()
+}
+
+func TestMinMaxBySetOps(t *testing.T) {
+	opts := OptionsG[scored]{Score: func(s scored) float64 { return s.score }}
+	a, b := NewWithOptionsG(2, scoredLess, opts), NewWithOptionsG(2, scoredLess, opts)
+	for i := 0; i < 300; i++ {
+		a.ReplaceOrInsert(scored{key: i, score: float64(i % 17)})
+		b.ReplaceOrInsert(scored{key: i + 150, score: float64(i % 23)})
+	}
+	for name, out := range map[string]*BTreeG[scored]{
+		"Union":      a.Union(b),
+		"Intersect":  a.Intersect(b),
+		"Difference": a.Difference(b),
+		"CopyRange":  a.CopyRange(scored{key: 20}, scored{key: 200}),
+	} {
+		if err := out.Verify(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, _ := out.MaxByRange(scored{key: 100}, scored{key: 250})
+		if want, _ := bruteExtreme(out, 100, 250, true); got != want {
+			t.Fatalf("%s: MaxByRange = %v, want %v", name, got, want)
+		}
+	}
+}
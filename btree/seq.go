@@ -0,0 +1,44 @@
+package btree
+
+// このファイルの関数は、Go 1.23以降の range over func で使える func(yield func(T) bool) 型のイテレータを返します。
+// この型は iter.Seq[T] と同じ基底型なので、iter.Seq[T] を受け取る関数にもそのまま渡せます。
+// ループを break すると yield が false を返し、内部の反復処理はその場で止まります。
+// 他のAscend*/Descend*と同様に、ループの中で木を変更してはいけません。
+
+// Allは、木のすべての項目を昇順に返すイテレータを返します。
+func (t *BTreeG[T]) All() func(yield func(T) bool) {
+	return func(yield func(T) bool) {
+		t.iterate(ascend, empty[T](), empty[T](), false, yield)
+	}
+}
+
+// Rangeは、[greaterOrEqual, lessThan) の範囲の項目を昇順に返すイテレータを返します。
+func (t *BTreeG[T]) Range(greaterOrEqual, lessThan T) func(yield func(T) bool) {
+	return func(yield func(T) bool) {
+		t.iterate(ascend, optional(greaterOrEqual), optional(lessThan), true, yield)
+	}
+}
+
+// Backwardは、木のすべての項目を降順に返すイテレータを返します。
+func (t *BTreeG[T]) Backward() func(yield func(T) bool) {
+	return func(yield func(T) bool) {
+		t.iterate(descend, empty[T](), empty[T](), false, yield)
+	}
+}
+
+// Allは、木のすべての項目を昇順に返すイテレータを返します。
+func (t *BTree) All() func(yield func(Item) bool) {
+	return t.generic().All()
+}
+
+// Rangeは、[greaterOrEqual, lessThan) の範囲の項目を昇順に返すイテレータを返します。nilの境界は「境界なし」を意味します。
+func (t *BTree) Range(greaterOrEqual, lessThan Item) func(yield func(Item) bool) {
+	return func(yield func(Item) bool) {
+		t.iterate(ascend, greaterOrEqual, lessThan, true, yield)
+	}
+}
+
+// Backwardは、木のすべての項目を降順に返すイテレータを返します。
+func (t *BTree) Backward() func(yield func(Item) bool) {
+	return t.generic().Backward()
+}
@@ -0,0 +1,175 @@
+package btree
+
+// 集合演算は、2つの木が同じ順序（LessFunc）で並んでいることを前提とします。
+// 両方の木のdegreeが同じ場合は、一方の木のルートの項目で他方の木を分割し、部分木ごとに再帰的に演算してから連結します（join方式）。
+// 片側が空になった部分木は、コピーせずにそのまま結果の木と共有します。degreeが異なる場合は、ノードを共有できないので、両方の木を順にたどってマージします。
+
+// setOpは、集合演算の種類です。
+type setOp int
+
+const (
+	setUnion setOp = iota
+	setIntersect
+	setDifference
+)
+
+// Unionは、tとotherのどちらかに含まれる項目からなる新しい木を返します。両方に等しい項目がある場合はtの項目を使います。
+// tとotherは変更されないので、読み取りと同様に他のゴルーチンが木を読んでいる間に呼べます。どちらかの木が汚染されている場合はnilを返します。
+func (t *BTreeG[T]) Union(other *BTreeG[T]) *BTreeG[T] {
+	return t.setOp(other, setUnion)
+}
+
+// Intersectは、tとotherの両方に含まれる項目からなる新しい木を返します。項目はtのものを使います。
+// tとotherは変更されないので、読み取りと同様に他のゴルーチンが木を読んでいる間に呼べます。どちらかの木が汚染されている場合はnilを返します。
+func (t *BTreeG[T]) Intersect(other *BTreeG[T]) *BTreeG[T] {
+	return t.setOp(other, setIntersect)
+}
+
+// Differenceは、tに含まれotherに含まれない項目からなる新しい木を返します。
+// tとotherは変更されないので、読み取りと同様に他のゴルーチンが木を読んでいる間に呼べます。どちらかの木が汚染されている場合はnilを返します。
+func (t *BTreeG[T]) Difference(other *BTreeG[T]) *BTreeG[T] {
+	return t.setOp(other, setDifference)
+}
+
+func (t *BTreeG[T]) setOp(other *BTreeG[T], op setOp) *BTreeG[T] {
+	if t.poisoned || other.poisoned {
+		return nil
+	}
+	out := t.emptyLike()
+	if t.degree != other.degree {
+		out.merge(t, other, op)
+		return out
+	}
+	// 既存のノードをどの木も所有しない状態にする。こうしておけば、結果の木と元の木のどちらに書き込んでも、共有したノードはコピーされてから変更される。
+	t.cow.share()
+	other.cow.share()
+	s := out.setOpSubtree(t.subtree(), other.subtree(), op)
+	out.root = s.root
+	if s.root != nil {
+		out.length = s.root.size
+	}
+	out.debugAfterMutate(op.String())
+	return out
+}
+
+// emptyLikeは、tと同じdegree、順序、フリーリスト、設定を持つ空の木を返します。
+func (t *BTreeG[T]) emptyLike() *BTreeG[T] {
+	return &BTreeG[T]{
+		degree:        t.degree,
+		cow:           &copyOnWriteContext[T]{freelist: t.cow.freelist, less: t.cow.less, itemCap: t.cow.itemCap, score: t.cow.score},
+		recoverPanics: t.recoverPanics,
+	}
+}
+
+func (op setOp) String() string {
+	switch op {
+	case setUnion:
+		return "Union"
+	case setIntersect:
+		return "Intersect"
+	default:
+		return "Difference"
+	}
+}
+
+// subtreeは、木全体をsubtreeとして返します。
+func (t *BTreeG[T]) subtree() subtree[T] {
+	if t.root == nil || len(t.root.items) == 0 {
+		return subtree[T]{}
+	}
+	return subtree[T]{root: t.root, height: t.height()}
+}
+
+// setOpSubtreeは、2つの部分木aとbに集合演算を行った部分木を返します。項目が等しい場合はaの項目を使います。
+// bのルートの各項目でaを分割し、できた各区間とbの対応する子に再帰的に演算してから、区切りの項目を挟んで連結します。
+func (t *BTreeG[T]) setOpSubtree(a, b subtree[T], op setOp) subtree[T] {
+	switch {
+	case a.root == nil:
+		if op == setUnion {
+			return b
+		}
+		return subtree[T]{}
+	case b.root == nil:
+		if op == setIntersect {
+			return subtree[T]{}
+		}
+		return a
+	}
+	n := b.root
+	child := func(i int) subtree[T] {
+		if len(n.children) == 0 {
+			return subtree[T]{}
+		}
+		return subtree[T]{root: n.children[i], height: b.height - 1}
+	}
+	var piece subtree[T]
+	rest := a
+	acc := subtree[T]{}
+	for i, key := range n.items {
+		piece, rest = t.splitAt(rest, key)
+		sub := t.setOpSubtree(piece, child(i), op)
+		if i == 0 {
+			acc = sub
+		} else {
+			acc = t.concat(acc, sub)
+		}
+		item, found := key, false
+		if m, ok := rest.min(); ok && !t.cow.less(key, m) {
+			item, found = m, true
+			rest = t.removeMin(rest)
+		}
+		if op == setUnion || (op == setIntersect && found) {
+			acc = t.join(acc, item, subtree[T]{})
+		}
+	}
+	return t.concat(acc, t.setOpSubtree(rest, child(len(n.items)), op))
+}
+
+// minは、部分木の最小の項目を返します。
+func (s subtree[T]) min() (_ T, _ bool) {
+	if s.root == nil {
+		return
+	}
+	return min(s.root)
+}
+
+// removeMinは、部分木から最小の項目を取り除いた部分木を返します。
+func (t *BTreeG[T]) removeMin(s subtree[T]) subtree[T] {
+	root := s.root.mutableFor(t.cow)
+	var zero T
+	root.remove(zero, t.minItems(), removeMin)
+	return t.normalize(subtree[T]{root, s.height})
+}
+
+// mergeは、degreeが異なりノードを共有できない場合に、aとbの項目を順にたどって集合演算の結果をtに挿入します。
+func (t *BTreeG[T]) merge(a, b *BTreeG[T], op setOp) {
+	a.Ascend(func(item T) bool {
+		if op == setUnion || b.Has(item) == (op == setIntersect) {
+			t.ReplaceOrInsert(item)
+		}
+		return true
+	})
+	if op == setUnion {
+		b.Ascend(func(item T) bool {
+			if !a.Has(item) {
+				t.ReplaceOrInsert(item)
+			}
+			return true
+		})
+	}
+}
+
+// Unionは、tとotherのどちらかに含まれる項目からなる新しい木を返します。詳細はBTreeG.Unionを参照してください。
+func (t *BTree) Union(other *BTree) *BTree {
+	return (*BTree)(t.generic().Union(other.generic()))
+}
+
+// Intersectは、tとotherの両方に含まれる項目からなる新しい木を返します。詳細はBTreeG.Intersectを参照してください。
+func (t *BTree) Intersect(other *BTree) *BTree {
+	return (*BTree)(t.generic().Intersect(other.generic()))
+}
+
+// Differenceは、tに含まれotherに含まれない項目からなる新しい木を返します。詳細はBTreeG.Differenceを参照してください。
+func (t *BTree) Difference(other *BTree) *BTree {
+	return (*BTree)(t.generic().Difference(other.generic()))
+}
@@ -0,0 +1,127 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestSetOpsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	for _, degrees := range [][2]int{{2, 2}, {3, 3}, {16, 16}, {3, 5}} {
+		for n := 0; n < 200; n++ {
+			a, akeys := randomTree(r, degrees[0], r.Intn(300))
+			b, bkeys := randomTree(r, degrees[1], r.Intn(300))
+			inA, inB := map[int]bool{}, map[int]bool{}
+			for _, k := range akeys {
+				inA[k] = true
+			}
+			for _, k := range bkeys {
+				inB[k] = true
+			}
+			all := dedupSorted(append(append([]int{}, akeys...), bkeys...))
+			for _, tc := range []struct {
+				op   string
+				got  *BTreeG[int]
+				keep func(int) bool
+			}{
+				{"Union", a.Union(b), func(k int) bool { return inA[k] || inB[k] }},
+				{"Intersect", a.Intersect(b), func(k int) bool { return inA[k] && inB[k] }},
+				{"Difference", a.Difference(b), func(k int) bool { return inA[k] && !inB[k] }},
+			} {
+				what := fmt.Sprintf("degrees %v, %d and %d items, %s", degrees, len(akeys), len(bkeys), tc.op)
+				mustVerify(t, what, tc.got)
+				want := filter(all, tc.keep)
+				if got := allItems(tc.got); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("%s = %v, want %v", what, got, want)
+				}
+			}
+			// 結果の木は入力のノードを共有するので、入力への書き込みが結果に漏れないことを確かめる。
+			u := a.Union(b)
+			for _, k := range akeys {
+				a.Delete(k)
+			}
+			b.Clear(false)
+			mustVerify(t, "union after clearing its inputs", u)
+			if got := allItems(u); fmt.Sprint(got) != fmt.Sprint(all) {
+				t.Fatalf("writes to the inputs changed the union: %v, want %v", got, all)
+			}
+		}
+	}
+}
+
+func TestSetOpsWithSelf(t *testing.T) {
+	tr, keys := randomTree(rand.New(rand.NewSource(12)), 3, 200)
+	if got := allItems(tr.Union(tr)); fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Fatalf("t.Union(t) = %v, want %v", got, keys)
+	}
+	if got := allItems(tr.Intersect(tr)); fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Fatalf("t.Intersect(t) = %v, want %v", got, keys)
+	}
+	if d := tr.Difference(tr); d.Len() != 0 {
+		t.Fatalf("t.Difference(t) has %d items", d.Len())
+	}
+	mustVerify(t, "tree after set operations with itself", tr)
+}
+
+// dedupSortedは、整数を昇順に並べて重複を除いたものを返します。
+func dedupSorted(keys []int) []int {
+	sort.Ints(keys)
+	out := []int{}
+	for i, k := range keys {
+		if i == 0 || k != keys[i-1] {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// whileReadingは、いくつかのゴルーチンでtrを読み続けながらfを呼びます。-raceで、fが読み取りと競合する書き込みをしていないことを確かめるために使います。
+func whileReading(tr *BTreeG[int], f func()) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				tr.Get(i)
+				tr.AscendRange(i, i+10, func(int) bool { return true })
+				tr.Cursor().Seek(i)
+			}
+		}(i)
+	}
+	f()
+	close(stop)
+	wg.Wait()
+}
+
+func TestSetOpsConcurrentReaders(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	a, akeys := randomTree(r, 3, 500)
+	b, bkeys := randomTree(r, 3, 500)
+	want := dedupSorted(append(append([]int{}, akeys...), bkeys...))
+	var u *BTreeG[int]
+	whileReading(a, func() {
+		whileReading(b, func() {
+			for i := 0; i < 20; i++ {
+				u = a.Union(b)
+				a.Intersect(b)
+				b.Difference(a)
+			}
+		})
+	})
+	a.Clear(false)
+	b.Clear(false)
+	mustVerify(t, "union after clearing its inputs", u)
+	if got := allItems(u); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("union = %v, want %v", got, want)
+	}
+}
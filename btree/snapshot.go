@@ -0,0 +1,271 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// snapshotMagicは、WriteSnapshotが書き出すデータの先頭の識別子です。
+const snapshotMagic = "btsnap01"
+
+// maxSnapshotItemSizeは、スナップショット中の1項目の大きさの上限です。壊れたデータで巨大な割り当てをしないために使われます。
+const maxSnapshotItemSize = 1 << 30
+
+// maxSnapshotDepthは、スナップショット中の木の深さの上限です。各内部ノードは2つ以上の子を持つので、正しいデータはこれを超えません。
+const maxSnapshotDepth = 64
+
+// WriteSnapshotは、木のノード構造をそのままcodecで符号化してwに書き出し、書き出したバイト数を返します。
+// ReadSnapshotで読み込むと、項目を挿入し直すことなく、同じ形の木をO(n)で復元できます。
+//
+// 形式は、識別子、degree、項目数（いずれもuvarint）の後に、ルートから各ノードを書いたものです。
+// ノードは項目数と葉かどうかの印に続けて、子と項目を順序どおり（子0, 項目0, 子1, ..., 子n）に並べ、末尾に全体のCRC32を置きます。
+// 汚染された木は書き出せません。
+func (t *BTreeG[T]) WriteSnapshot(w io.Writer, codec CodecG[T]) (int64, error) {
+	if t.poisoned {
+		return 0, t.err
+	}
+	t.debugBeginIterate()
+	defer t.debugEndIterate()
+	e := &snapshotEncoder[T]{w: bufio.NewWriter(w), crc: crc32.NewIEEE(), codec: codec}
+	e.write([]byte(snapshotMagic))
+	e.uvarint(uint64(t.degree))
+	e.uvarint(uint64(t.length))
+	if t.root != nil && t.length > 0 {
+		e.node(t.root)
+	}
+	if e.err == nil {
+		var sum [4]byte
+		binary.LittleEndian.PutUint32(sum[:], e.crc.Sum32())
+		e.write(sum[:])
+	}
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.n, e.err
+}
+
+// snapshotEncoderは、WriteSnapshotの書き出しの状態で、最初のエラー以降の書き込みを無視します。
+type snapshotEncoder[T any] struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	codec CodecG[T]
+	n     int64
+	err   error
+	buf   [binary.MaxVarintLen64]byte
+}
+
+func (e *snapshotEncoder[T]) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	var n int
+	n, e.err = e.w.Write(b)
+	e.n += int64(n)
+	e.crc.Write(b[:n])
+}
+
+func (e *snapshotEncoder[T]) uvarint(v uint64) {
+	e.write(e.buf[:binary.PutUvarint(e.buf[:], v)])
+}
+
+func (e *snapshotEncoder[T]) node(n *node[T]) {
+	e.uvarint(uint64(len(n.items)))
+	if len(n.children) == 0 {
+		e.uvarint(0)
+	} else {
+		e.uvarint(1)
+	}
+	for i, item := range n.items {
+		if e.err != nil {
+			return
+		}
+		if len(n.children) > 0 {
+			e.node(n.children[i])
+		}
+		b, err := e.codec.Encode(item)
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.uvarint(uint64(len(b)))
+		e.write(b)
+	}
+	if len(n.children) > 0 {
+		e.node(n.children[len(n.children)-1])
+	}
+}
+
+// ReadSnapshotGは、WriteSnapshotが書き出したデータから、lessで順序付けた木を復元します。degreeはデータに記録されたものを使い、その他の設定はoptsに従います。
+// データのノード構造（各ノードの項目数、葉の深さ、項目の順序、項目数の合計）とCRC32を検証し、不正な場合はErrCorruptedを包んだエラーを返します。
+func ReadSnapshotG[T any](r io.Reader, codec CodecG[T], less LessFunc[T], opts OptionsG[T]) (*BTreeG[T], error) {
+	d := &snapshotDecoder[T]{r: bufio.NewReader(r), crc: crc32.NewIEEE(), codec: codec, less: less, leafDepth: -1}
+	t, err := d.read(opts)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("btree: snapshot: %w", err)
+	}
+	return t, nil
+}
+
+// snapshotDecoderは、ReadSnapshotの読み込みの状態です。
+type snapshotDecoder[T any] struct {
+	r         *bufio.Reader
+	crc       hash.Hash32
+	codec     CodecG[T]
+	less      LessFunc[T]
+	t         *BTreeG[T]
+	count     int
+	leafDepth int
+	prev      optionalItem[T]
+}
+
+// ReadByteは、CRC32を計算しながら1バイト読みます。binary.ReadUvarintのために使われます。
+func (d *snapshotDecoder[T]) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == nil {
+		d.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (d *snapshotDecoder[T]) readFull(b []byte) error {
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return err
+	}
+	d.crc.Write(b)
+	return nil
+}
+
+func (d *snapshotDecoder[T]) read(opts OptionsG[T]) (*BTreeG[T], error) {
+	magic := make([]byte, len(snapshotMagic))
+	if err := d.readFull(magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != snapshotMagic {
+		return nil, errors.New("not a btree snapshot")
+	}
+	degree, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, err
+	}
+	length, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, err
+	}
+	if degree <= 1 || degree > 1<<16 {
+		return nil, corrupted("bad degree %d", degree)
+	}
+	d.t = NewWithOptionsG(int(degree), d.less, opts)
+	if length > 0 {
+		if d.t.root, err = d.node(0); err != nil {
+			return nil, err
+		}
+	}
+	if uint64(d.count) != length {
+		return nil, corrupted("snapshot declares %d items but contains %d", length, d.count)
+	}
+	d.t.length = d.count
+	want := d.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(d.r, sum[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != want {
+		return nil, corrupted("snapshot checksum mismatch")
+	}
+	return d.t, nil
+}
+
+func (d *snapshotDecoder[T]) node(depth int) (*node[T], error) {
+	if depth > maxSnapshotDepth {
+		return nil, corrupted("tree deeper than %d levels", maxSnapshotDepth)
+	}
+	count, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, err
+	}
+	internal, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(d.t.maxItems()) || (depth > 0 && count < uint64(d.t.minItems())) || (depth == 0 && count == 0) {
+		return nil, corrupted("node at depth %d has %d items", depth, count)
+	}
+	if internal > 1 {
+		return nil, corrupted("bad node kind %d", internal)
+	}
+	if internal == 0 {
+		if d.leafDepth < 0 {
+			d.leafDepth = depth
+		} else if d.leafDepth != depth {
+			return nil, corrupted("leaf at depth %d, want %d", depth, d.leafDepth)
+		}
+	}
+	n := d.t.cow.newNode()
+	for i := 0; i <= int(count); i++ {
+		if internal == 1 {
+			c, err := d.node(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, c)
+		}
+		if i == int(count) {
+			break
+		}
+		item, err := d.item()
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	n.recount()
+	return n, nil
+}
+
+func (d *snapshotDecoder[T]) item() (T, error) {
+	var zero T
+	l, err := binary.ReadUvarint(d)
+	if err != nil {
+		return zero, err
+	}
+	if l > maxSnapshotItemSize {
+		return zero, corrupted("item of %d bytes", l)
+	}
+	b := make([]byte, l)
+	if err := d.readFull(b); err != nil {
+		return zero, err
+	}
+	item, err := d.codec.Decode(b)
+	if err != nil {
+		return zero, err
+	}
+	if isNil(item) {
+		return zero, corrupted("item %d decoded to nil", d.count)
+	}
+	if d.prev.valid && !d.less(d.prev.item, item) {
+		return zero, corrupted("item %d is out of order", d.count)
+	}
+	d.prev = optional(item)
+	d.count++
+	return item, nil
+}
+
+// WriteSnapshotは、木のノード構造をそのままcodecで符号化してwに書き出し、書き出したバイト数を返します。詳細はBTreeG.WriteSnapshotを参照してください。
+func (t *BTree) WriteSnapshot(w io.Writer, codec Codec) (int64, error) {
+	return t.generic().WriteSnapshot(w, codec)
+}
+
+// ReadSnapshotは、WriteSnapshotが書き出したデータから木を復元します。degreeはデータに記録されたものを使い、その他の設定はoptsに従います。
+// 詳細はReadSnapshotGを参照してください。
+func ReadSnapshot(r io.Reader, codec Codec, opts Options) (*BTree, error) {
+	t, err := ReadSnapshotG[Item](r, codec, itemLess, opts.generic())
+	return (*BTree)(t), err
+}
@@ -0,0 +1,75 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+// stringCodecは、stringの項目をそのままのバイト列にするCodecGです。
+type stringCodec struct{}
+
+func (stringCodec) Encode(s string) ([]byte, error) { return []byte(s), nil }
+func (stringCodec) Decode(b []byte) (string, error) { return string(b), nil }
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		tr := NewG(3, func(a, b string) bool { return a < b })
+		for i := 0; i < n; i++ {
+			tr.ReplaceOrInsert(fmt.Sprintf("key%05d", i*7%n))
+		}
+		var buf bytes.Buffer
+		if _, err := tr.WriteSnapshot(&buf, stringCodec{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadSnapshotG[string](&buf, stringCodec{}, tr.cow.less, OptionsG[string]{})
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if got.Len() != n || got.height() != tr.height() {
+			t.Fatalf("n=%d: Len=%d height=%d, want %d %d", n, got.Len(), got.height(), n, tr.height())
+		}
+		if err := got.checkInvariants(); err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		got.ReplaceOrInsert("zzz")
+		if got.Len() != n+1 {
+			t.Fatalf("n=%d: restored tree does not accept writes", n)
+		}
+	}
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	tr := New(2)
+	for i := 0; i < 200; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	var buf bytes.Buffer
+	if _, err := tr.WriteSnapshot(&buf, IntCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, off := range []int{len(snapshotMagic) + 3, len(data) / 2, len(data) - 1} {
+		bad := append([]byte(nil), data...)
+		bad[off] ^= 0x40
+		if _, err := ReadSnapshot(bytes.NewReader(bad), IntCodec{}, Options{}); err == nil {
+			t.Errorf("flipping byte %d was not detected", off)
+		}
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(data[:len(data)-10]), IntCodec{}, Options{}); err == nil {
+		t.Error("truncated snapshot was accepted")
+	}
+	// 項目の順序が逆のデータは、CRC32が合っていても拒否する。
+	var rev bytes.Buffer
+	rev.WriteString(snapshotMagic)
+	rev.Write(binary.AppendUvarint(nil, 2))
+	rev.Write(binary.AppendUvarint(nil, 2))
+	rev.Write([]byte{2, 0, 1, 4, 1, 2})
+	rev.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(rev.Bytes())))
+	if _, err := ReadSnapshot(&rev, IntCodec{}, Options{}); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("out-of-order snapshot: err = %v, want ErrCorrupted", err)
+	}
+}
@@ -0,0 +1,21 @@
+package btree
+
+import "sort"
+
+// SortedKeysは、mのキーを昇順に並べた新しいスライスを返します。
+// マップをキーの順に走査したいことがたまにあるだけの場合に、木を作らずに使えます。何度も走査したり、走査の間に変更したりする場合はFromMapで木を作ってください。
+func SortedKeys[K Ordered, V any](m map[K]V) []K {
+	return SortedKeysFunc(m, Less[K]())
+}
+
+// SortedKeysFuncは、mのキーをlessの順に並べた新しいスライスを返します。キーがOrderedでない場合に使います。
+func SortedKeysFunc[K comparable, V any](m map[K]V, less LessFunc[K]) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+	return keys
+}
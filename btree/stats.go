@@ -0,0 +1,78 @@
+package btree
+
+import "unsafe"
+
+// Statsは、木の形とメモリの使い方の統計です。degreeやフリーリストの大きさを調整するために使います。
+type Stats struct {
+	Height        int     // 木の高さ（葉だけの木では0、空の木では-1）
+	InternalNodes int     // 内部ノードの数
+	LeafNodes     int     // 葉の数
+	Items         int     // 項目の数
+	FillFactor    float64 // ノードの項目数の、ノードに入る最大の項目数に対する割合の平均
+	// Bytesは、ノードと、ノードが持つ項目と子のスライスが使うバイト数の見積もりです。項目が指す先のメモリは含みません。
+	Bytes int64
+	// FreeListは、木が使うフリーリストの統計です。フリーリストを共有する他の木（Cloneを含む）の分も含みます。
+	FreeList FreeListStats
+}
+
+// Statsは、木全体をたどって統計を求めます。時間はノードの数に比例します。
+func (t *BTreeG[T]) Stats() Stats {
+	s := Stats{Height: -1, FreeList: t.cow.freelist.Stats()}
+	if t.root == nil || len(t.root.items) == 0 || t.poisoned {
+		return s
+	}
+	s.Height = t.height()
+	var zero T
+	var fill float64
+	var walk func(n *node[T])
+	walk = func(n *node[T]) {
+		if len(n.children) == 0 {
+			s.LeafNodes++
+		} else {
+			s.InternalNodes++
+		}
+		s.Items += len(n.items)
+		fill += float64(len(n.items)) / float64(t.maxItems())
+		s.Bytes += int64(unsafe.Sizeof(*n)) + int64(cap(n.items))*int64(unsafe.Sizeof(zero)) + int64(cap(n.children))*int64(unsafe.Sizeof(n))
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(t.root)
+	s.FillFactor = fill / float64(s.InternalNodes+s.LeafNodes)
+	return s
+}
+
+// NodeOwnershipは、木全体をたどって、この木のコピーオンライトのコンテキストが所有するノードの数（owned）と、Cloneした木と共有しているノードの数（shared）を返します。
+//
+// 共有しているノードは、この木からは変更もフリーリストへの返却もできず、共有するすべての木がそのノードを手放すまでGCに回収されません。
+// Cloneした木を捨てた後やClear(true)の後にメモリが減らない場合に、どれだけのノードが他の木に捕まっているかを調べるために使います。
+// フリーリストにあるノードの数は、Stats().FreeList.Sizeで分かります。時間はノードの数に比例します。
+func (t *BTreeG[T]) NodeOwnership() (owned, shared int) {
+	if t.root == nil || t.poisoned {
+		return 0, 0
+	}
+	var walk func(n *node[T])
+	walk = func(n *node[T]) {
+		if t.cow.owns(n) {
+			owned++
+		} else {
+			shared++
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(t.root)
+	return owned, shared
+}
+
+// Statsは、木全体をたどって統計を求めます。詳細はBTreeG.Statsを参照してください。
+func (t *BTree) Stats() Stats {
+	return t.generic().Stats()
+}
+
+// NodeOwnershipは、この木が所有するノードの数と、Cloneした木と共有しているノードの数を返します。詳細はBTreeG.NodeOwnershipを参照してください。
+func (t *BTree) NodeOwnership() (owned, shared int) {
+	return t.generic().NodeOwnership()
+}
@@ -0,0 +1,133 @@
+package btree
+
+type (
+	// SyncMapGは、sync.Mapと同じ形のメソッドを持つ、キーの順に並んだ並行マップです。SafeBTreeGの上に作られています。
+	//
+	// sync.Mapから移行するときにメソッドの呼び出しを書き換えずに済み、Rangeはキーの昇順に走査します。
+	// 読み取りとRangeはSafeBTreeGのスナップショットに対してロックなしで行い、書き込みは1つのミューテックスで直列化します。
+	// sync.Mapと違って書き込みのたびにスナップショットを作り直すので、書き込みが読み取りより多い用途には向きません。
+	SyncMapG[K, V any] struct {
+		t *SafeBTreeG[syncMapEntry[K, V]]
+	}
+
+	// syncMapEntryは、SyncMapGの木の1項目です。
+	syncMapEntry[K, V any] struct {
+		key   K
+		value V
+	}
+
+	// SyncMapは、キーがItemのSyncMapGで、メソッドの型もsync.Mapと同じです。キーはItemを満たさなければならず、そうでない場合はpanicします。
+	SyncMap SyncMapG[Item, any]
+)
+
+// NewSyncMapGは、与えられたdegreeとキーのLessFuncで空のSyncMapGを作成します。
+func NewSyncMapG[K, V any](degree int, less LessFunc[K]) *SyncMapG[K, V] {
+	return &SyncMapG[K, V]{t: NewSafeG(degree, func(a, b syncMapEntry[K, V]) bool {
+		return less(a.key, b.key)
+	})}
+}
+
+// Loadは、keyの値を返します。keyがない場合は (zeroValue, false) を返します。
+func (m *SyncMapG[K, V]) Load(key K) (value V, ok bool) {
+	e, ok := m.t.Get(syncMapEntry[K, V]{key: key})
+	return e.value, ok
+}
+
+// Storeは、keyの値をvalueにします。
+func (m *SyncMapG[K, V]) Store(key K, value V) {
+	m.t.ReplaceOrInsert(syncMapEntry[K, V]{key: key, value: value})
+}
+
+// LoadOrStoreは、keyがあればその値とtrueを返し、なければvalueを格納してvalueとfalseを返します。
+func (m *SyncMapG[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	e, loaded := m.t.GetOrInsert(syncMapEntry[K, V]{key: key, value: value})
+	return e.value, loaded
+}
+
+// LoadAndDeleteは、keyを削除し、削除前の値とkeyがあったかどうかを返します。
+func (m *SyncMapG[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	e, loaded := m.t.Delete(syncMapEntry[K, V]{key: key})
+	return e.value, loaded
+}
+
+// Deleteは、keyを削除します。
+func (m *SyncMapG[K, V]) Delete(key K) {
+	m.t.Delete(syncMapEntry[K, V]{key: key})
+}
+
+// Swapは、keyの値をvalueにし、以前の値とkeyがあったかどうかを返します。
+func (m *SyncMapG[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	e, loaded := m.t.ReplaceOrInsert(syncMapEntry[K, V]{key: key, value: value})
+	return e.value, loaded
+}
+
+// Rangeは、呼び出した時点のスナップショットのすべてのキーと値について、キーの昇順にfがfalseを返すまでfを呼び出します。
+// sync.Mapと違い、走査中の書き込みは走査に反映されません。fの中でmを変更しても構いません。
+func (m *SyncMapG[K, V]) Range(f func(key K, value V) bool) {
+	m.t.Ascend(func(e syncMapEntry[K, V]) bool {
+		return f(e.key, e.value)
+	})
+}
+
+// RangeBetweenは、[greaterOrEqual, lessThan) の範囲のキーについて、キーの昇順にfがfalseを返すまでfを呼び出します。
+func (m *SyncMapG[K, V]) RangeBetween(greaterOrEqual, lessThan K, f func(key K, value V) bool) {
+	m.t.AscendRange(syncMapEntry[K, V]{key: greaterOrEqual}, syncMapEntry[K, V]{key: lessThan}, func(e syncMapEntry[K, V]) bool {
+		return f(e.key, e.value)
+	})
+}
+
+// Lenは、キーの数を返します。
+func (m *SyncMapG[K, V]) Len() int {
+	return m.t.Len()
+}
+
+// NewSyncMapは、与えられたdegreeで空のSyncMapを作成します。
+func NewSyncMap(degree int) *SyncMap {
+	return (*SyncMap)(NewSyncMapG[Item, any](degree, itemLess))
+}
+
+func (m *SyncMap) generic() *SyncMapG[Item, any] {
+	return (*SyncMapG[Item, any])(m)
+}
+
+// Loadは、sync.Map.Loadと同じです。
+func (m *SyncMap) Load(key any) (value any, ok bool) {
+	return m.generic().Load(key.(Item))
+}
+
+// Storeは、sync.Map.Storeと同じです。
+func (m *SyncMap) Store(key, value any) {
+	m.generic().Store(key.(Item), value)
+}
+
+// LoadOrStoreは、sync.Map.LoadOrStoreと同じです。
+func (m *SyncMap) LoadOrStore(key, value any) (actual any, loaded bool) {
+	return m.generic().LoadOrStore(key.(Item), value)
+}
+
+// LoadAndDeleteは、sync.Map.LoadAndDeleteと同じです。
+func (m *SyncMap) LoadAndDelete(key any) (value any, loaded bool) {
+	return m.generic().LoadAndDelete(key.(Item))
+}
+
+// Deleteは、sync.Map.Deleteと同じです。
+func (m *SyncMap) Delete(key any) {
+	m.generic().Delete(key.(Item))
+}
+
+// Swapは、sync.Map.Swapと同じです。
+func (m *SyncMap) Swap(key, value any) (previous any, loaded bool) {
+	return m.generic().Swap(key.(Item), value)
+}
+
+// Rangeは、sync.Map.Rangeと同じですが、キーの昇順に走査します。詳細はSyncMapG.Rangeを参照してください。
+func (m *SyncMap) Range(f func(key, value any) bool) {
+	m.generic().Range(func(key Item, value any) bool {
+		return f(key, value)
+	})
+}
+
+// Lenは、キーの数を返します。
+func (m *SyncMap) Len() int {
+	return m.generic().Len()
+}
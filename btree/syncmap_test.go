@@ -0,0 +1,117 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// TestSyncMapMatchesSyncMapは、各メソッドの戻り値がsync.Mapと同じになることを確かめます。
+func TestSyncMapMatchesSyncMap(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	m := NewSyncMap(3)
+	var want sync.Map
+	for step := 0; step < 5000; step++ {
+		key, value := Int(r.Intn(200)), step
+		var got, exp [2]any
+		switch op := r.Intn(7); op {
+		case 0:
+			m.Store(key, value)
+			want.Store(key, value)
+		case 1:
+			got[0], got[1] = m.Load(key)
+			exp[0], exp[1] = want.Load(key)
+		case 2:
+			got[0], got[1] = m.LoadOrStore(key, value)
+			exp[0], exp[1] = want.LoadOrStore(key, value)
+		case 3:
+			got[0], got[1] = m.LoadAndDelete(key)
+			exp[0], exp[1] = want.LoadAndDelete(key)
+		case 4:
+			m.Delete(key)
+			want.Delete(key)
+		default:
+			// sync.Map.SwapはGo 1.20からなので、LoadとStoreで同じ結果を作る。
+			got[0], got[1] = m.Swap(key, value)
+			exp[0], exp[1] = want.Load(key)
+			want.Store(key, value)
+		}
+		if got != exp {
+			t.Fatalf("step %d: op on %v returned %v, sync.Map returned %v", step, key, got, exp)
+		}
+		if step%100 != 0 {
+			continue
+		}
+		var keys []int
+		values := map[int]any{}
+		want.Range(func(k, v any) bool {
+			keys = append(keys, int(k.(Int)))
+			values[int(k.(Int))] = v
+			return true
+		})
+		sort.Ints(keys)
+		var gotPairs, wantPairs []string
+		for _, k := range keys {
+			wantPairs = append(wantPairs, fmt.Sprintf("%d=%v", k, values[k]))
+		}
+		m.Range(func(k, v any) bool {
+			gotPairs = append(gotPairs, fmt.Sprintf("%v=%v", k, v))
+			return true
+		})
+		if fmt.Sprint(gotPairs) != fmt.Sprint(wantPairs) {
+			t.Fatalf("step %d: Range = %v, want %v", step, gotPairs, wantPairs)
+		}
+		if m.Len() != len(keys) {
+			t.Fatalf("step %d: Len %d, want %d", step, m.Len(), len(keys))
+		}
+	}
+}
+
+func TestSyncMapRange(t *testing.T) {
+	m := NewSyncMapG[int, string](3, intLess)
+	for _, k := range []int{5, 1, 9, 3, 7} {
+		m.Store(k, fmt.Sprint(k))
+	}
+	var got []int
+	m.Range(func(k int, v string) bool {
+		got = append(got, k)
+		// 走査中の書き込みは、呼び出した時点のスナップショットの走査に影響しない。
+		m.Store(k+1, "new")
+		m.Delete(9)
+		return len(got) < 4
+	})
+	if fmt.Sprint(got) != "[1 3 5 7]" {
+		t.Fatalf("Range = %v", got)
+	}
+	if _, ok := m.Load(9); ok || m.Len() != 8 {
+		t.Fatalf("writes during Range: Load(9) found %v, Len %d", ok, m.Len())
+	}
+	got = nil
+	m.RangeBetween(3, 7, func(k int, v string) bool {
+		got = append(got, k)
+		return true
+	})
+	if fmt.Sprint(got) != "[3 4 5 6]" {
+		t.Fatalf("RangeBetween(3, 7) = %v", got)
+	}
+	if v, loaded := m.LoadOrStore(4, "other"); !loaded || v != "new" {
+		t.Fatalf("LoadOrStore of a present key = %q, %v", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore(100, "added"); loaded || v != "added" {
+		t.Fatalf("LoadOrStore of a missing key = %q, %v", v, loaded)
+	}
+	if v, loaded := m.Swap(100, "swapped"); !loaded || v != "added" {
+		t.Fatalf("Swap = %q, %v", v, loaded)
+	}
+	if v, loaded := m.LoadAndDelete(100); !loaded || v != "swapped" {
+		t.Fatalf("LoadAndDelete = %q, %v", v, loaded)
+	}
+	if v, loaded := m.LoadAndDelete(100); loaded || v != "" {
+		t.Fatalf("LoadAndDelete of a missing key = %q, %v", v, loaded)
+	}
+	if v, loaded := m.Swap(100, "x"); loaded || v != "" {
+		t.Fatalf("Swap of a missing key = %q, %v", v, loaded)
+	}
+}
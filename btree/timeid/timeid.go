@@ -0,0 +1,219 @@
+// Package timeidは、先頭にミリ秒単位の時刻を持つUUIDv7とULIDを、btreeのキーとして使うための型を提供します。
+//
+// どちらも先頭の48ビットがUnixエポックからのミリ秒をビッグエンディアンで持つので、バイト列の順序が作成した時刻の順序になります。
+// 型はbtree.Itemを満たすのでそのまま木に入れられ、バイト列（id[:]）はOrderedKVのキーにも使えます。
+// RangeForTimeは、時刻の区間に作られたIDだけを走査するための境界を返します。
+// 同じミリ秒の中のIDの順序はランダムな部分で決まるので、作成した順とは限りません。
+package timeid
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// ErrSyntaxは、文字列が正しいUUIDv7またはULIDの形式でないことを示します。
+var ErrSyntax = errors.New("timeid: invalid syntax")
+
+// maxMillisは、48ビットで表せるミリ秒の最大値です。
+const maxMillis = 1<<48 - 1
+
+type (
+	// UUIDv7は、RFC 9562のバージョン7のUUIDです。
+	UUIDv7 [16]byte
+
+	// ULIDは、Crockfordのbase32で26文字に表す、時刻順に並ぶ128ビットの識別子です。
+	ULID [16]byte
+)
+
+// millisは、tのUnixミリ秒を48ビットに収めて返します。エポックより前は0、表せる範囲より後は最大値にします。
+func millis(t time.Time) uint64 {
+	ms := t.UnixMilli()
+	switch {
+	case ms < 0:
+		return 0
+	case ms > maxMillis:
+		return maxMillis
+	}
+	return uint64(ms)
+}
+
+// putMillisは、msをidの先頭6バイトにビッグエンディアンで書きます。
+func putMillis(id *[16]byte, ms uint64) {
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+}
+
+// getMillisは、idの先頭6バイトのミリ秒を時刻にして返します。
+func getMillis(id [16]byte) time.Time {
+	var ms uint64
+	for i := 0; i < 6; i++ {
+		ms = ms<<8 | uint64(id[i])
+	}
+	return time.UnixMilli(int64(ms))
+}
+
+// NewUUIDv7は、現在の時刻とcrypto/randの乱数で新しいUUIDv7を作ります。
+func NewUUIDv7() (UUIDv7, error) {
+	return UUIDv7At(time.Now(), rand.Reader)
+}
+
+// UUIDv7Atは、時刻tとrから読んだ乱数でUUIDv7を作ります。
+func UUIDv7At(t time.Time, r io.Reader) (UUIDv7, error) {
+	var u UUIDv7
+	if _, err := io.ReadFull(r, u[6:]); err != nil {
+		return u, err
+	}
+	putMillis((*[16]byte)(&u), millis(t))
+	u[6] = 0x70 | u[6]&0x0f // バージョン7
+	u[8] = 0x80 | u[8]&0x3f // RFC 9562のバリアント
+	return u, nil
+}
+
+// ParseUUIDv7は、"xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"の形式の文字列をUUIDv7として読みます。バージョンが7でなければErrSyntaxを返します。
+func ParseUUIDv7(s string) (UUIDv7, error) {
+	var u UUIDv7
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrSyntax
+	}
+	h := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil || u[6]>>4 != 7 {
+		return UUIDv7{}, ErrSyntax
+	}
+	return u, nil
+}
+
+// Timeは、uを作成したミリ秒単位の時刻を返します。
+func (u UUIDv7) Time() time.Time {
+	return getMillis(u)
+}
+
+// Stringは、uを"xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"の形式で返します。
+func (u UUIDv7) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// Lessは、バイト列の順にuがthanより小さいかどうかを返します。thanはUUIDv7でなければなりません。
+func (u UUIDv7) Less(than btree.Item) bool {
+	v := than.(UUIDv7)
+	return bytes.Compare(u[:], v[:]) < 0
+}
+
+// UUIDv7RangeForTimeは、[from, to) の時刻に作られたUUIDv7を走査するための境界を返します。AscendRange(ge, lt, ...)にそのまま渡せます。
+// 時刻はどちらもミリ秒単位に切り捨てます。
+func UUIDv7RangeForTime(from, to time.Time) (ge, lt UUIDv7) {
+	putMillis((*[16]byte)(&ge), millis(from))
+	putMillis((*[16]byte)(&lt), millis(to))
+	return ge, lt
+}
+
+// crockfordは、ULIDの文字列に使うCrockfordのbase32の文字です。
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULIDは、現在の時刻とcrypto/randの乱数で新しいULIDを作ります。
+func NewULID() (ULID, error) {
+	return ULIDAt(time.Now(), rand.Reader)
+}
+
+// ULIDAtは、時刻tとrから読んだ乱数でULIDを作ります。
+func ULIDAt(t time.Time, r io.Reader) (ULID, error) {
+	var u ULID
+	if _, err := io.ReadFull(r, u[6:]); err != nil {
+		return u, err
+	}
+	putMillis((*[16]byte)(&u), millis(t))
+	return u, nil
+}
+
+// ParseULIDは、26文字のCrockfordのbase32の文字列をULIDとして読みます。小文字と、Crockfordの規則でI、L、Oと読み替える文字も受け付けます。
+func ParseULID(s string) (ULID, error) {
+	var u ULID
+	if len(s) != 26 {
+		return u, ErrSyntax
+	}
+	// 26文字は130ビットなので、先頭の文字は上位2ビットが0（0から7）でなければならない。
+	var hi, lo uint64 // 128ビットの上位と下位
+	for i := 0; i < len(s); i++ {
+		v := decodeCrockford(s[i])
+		if v < 0 || (i == 0 && v > 7) {
+			return ULID{}, ErrSyntax
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	for i := 0; i < 8; i++ {
+		u[i] = byte(hi >> (56 - 8*i))
+		u[8+i] = byte(lo >> (56 - 8*i))
+	}
+	return u, nil
+}
+
+// decodeCrockfordは、Crockfordのbase32の1文字の値を返します。使えない文字の場合は-1を返します。
+func decodeCrockford(c byte) int {
+	if 'a' <= c && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'I', 'L':
+		c = '1'
+	case 'O':
+		c = '0'
+	}
+	for i := 0; i < len(crockford); i++ {
+		if crockford[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// Timeは、uを作成したミリ秒単位の時刻を返します。
+func (u ULID) Time() time.Time {
+	return getMillis(u)
+}
+
+// Stringは、uを26文字のCrockfordのbase32で返します。
+func (u ULID) String() string {
+	var hi, lo uint64
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(u[i])
+		lo = lo<<8 | uint64(u[8+i])
+	}
+	var b [26]byte
+	for i := 25; i >= 0; i-- {
+		b[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// Lessは、バイト列の順にuがthanより小さいかどうかを返します。thanはULIDでなければなりません。
+func (u ULID) Less(than btree.Item) bool {
+	v := than.(ULID)
+	return bytes.Compare(u[:], v[:]) < 0
+}
+
+// ULIDRangeForTimeは、[from, to) の時刻に作られたULIDを走査するための境界を返します。AscendRange(ge, lt, ...)にそのまま渡せます。
+// 時刻はどちらもミリ秒単位に切り捨てます。
+func ULIDRangeForTime(from, to time.Time) (ge, lt ULID) {
+	putMillis((*[16]byte)(&ge), millis(from))
+	putMillis((*[16]byte)(&lt), millis(to))
+	return ge, lt
+}
@@ -0,0 +1,196 @@
+package timeid
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// randomTimeは、2020年からの約1秒の間のランダムな時刻を返します。同じミリ秒の時刻がよく現れます。
+func randomTime(r *rand.Rand) time.Time {
+	return time.UnixMilli(1577836800000 + int64(r.Intn(1000))).Add(time.Duration(r.Intn(1e6)))
+}
+
+func TestUUIDv7RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		at := randomTime(r)
+		u, err := UUIDv7At(at, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u[6]>>4 != 7 || u[8]>>6 != 2 {
+			t.Fatalf("%v has version %d and variant bits %b", u, u[6]>>4, u[8]>>6)
+		}
+		if want := at.Truncate(time.Millisecond); !u.Time().Equal(want) {
+			t.Fatalf("%v.Time() = %v, want %v", u, u.Time(), want)
+		}
+		for _, s := range []string{u.String(), strings.ToUpper(u.String())} {
+			got, err := ParseUUIDv7(s)
+			if err != nil || got != u {
+				t.Fatalf("ParseUUIDv7(%q) = %v, %v, want %v", s, got, err, u)
+			}
+		}
+	}
+}
+
+func TestParseUUIDv7Errors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0190b0a4-6f2e-7c3a-8d4e-5f6a7b8c9d0",   // 短い
+		"0190b0a4-6f2e-7c3a-8d4e-5f6a7b8c9d0e0", // 長い
+		"0190b0a46f2e-7c3a-8d4e-5f6a7b8c9d0e-",  // ハイフンの位置が違う
+		"0190b0a4-6f2e-7c3a-8d4e-5f6a7b8c9d0g",  // 16進数でない
+		"0190b0a4-6f2e-4c3a-8d4e-5f6a7b8c9d0e",  // バージョン4
+	} {
+		if _, err := ParseUUIDv7(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("ParseUUIDv7(%q) = %v, want ErrSyntax", s, err)
+		}
+	}
+}
+
+func TestULIDRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n < 1000; n++ {
+		at := randomTime(r)
+		u, err := ULIDAt(at, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := at.Truncate(time.Millisecond); !u.Time().Equal(want) {
+			t.Fatalf("%v.Time() = %v, want %v", u, u.Time(), want)
+		}
+		s := u.String()
+		if len(s) != 26 || s[0] > '7' {
+			t.Fatalf("%x.String() = %q", u[:], s)
+		}
+		for _, s := range []string{s, strings.ToLower(s)} {
+			got, err := ParseULID(s)
+			if err != nil || got != u {
+				t.Fatalf("ParseULID(%q) = %x, %v, want %x", s, got[:], err, u[:])
+			}
+		}
+	}
+}
+
+// TestParseULIDAliasesは、Crockfordの規則でI、Lを1、Oを0と読み替えることを確かめます。
+func TestParseULIDAliases(t *testing.T) {
+	const s = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	want, err := ParseULID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range []string{
+		"O1ARZ3NDEKTSV4RRFFQ69G5FAV",
+		"oIARZ3NDEKTSV4RRFFQ69G5FAV",
+		"0LARZ3NDEKTSV4RRFFQ69G5FAV",
+		"0iARZ3NDEKTSV4RRFFQ69G5FAV",
+		"0lArz3ndektsv4rrffq69g5fav",
+	} {
+		if got, err := ParseULID(alias); err != nil || got != want {
+			t.Errorf("ParseULID(%q) = %v, %v, want %v", alias, got, err, want)
+		}
+	}
+	if got := want.String(); got != s {
+		t.Errorf("String() = %q, want %q", got, s)
+	}
+}
+
+func TestParseULIDErrors(t *testing.T) {
+	max, err := ParseULID("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != (ULID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) {
+		t.Fatalf("ParseULID of the largest ULID = %x", max[:])
+	}
+	for _, s := range []string{
+		"",
+		"01ARZ3NDEKTSV4RRFFQ69G5FA",   // 短い
+		"01ARZ3NDEKTSV4RRFFQ69G5FAVV", // 長い
+		"8ZZZZZZZZZZZZZZZZZZZZZZZZZ",  // 128ビットを超える
+		"ZZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		"01ARZ3NDEKTSV4RRFFQ69G5FAU", // Uは使わない
+		"01ARZ3NDEKTSV4RRFFQ69G5FA-",
+	} {
+		if _, err := ParseULID(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("ParseULID(%q) = %v, want ErrSyntax", s, err)
+		}
+	}
+}
+
+// TestRangeForTimeは、RangeForTimeの境界でAscendRangeすると、[from, to) のミリ秒に作られたIDだけがちょうど選ばれることを確かめます。
+func TestRangeForTime(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	uuids, ulids := btree.New(3), btree.New(3)
+	created := map[string]time.Time{}
+	for n := 0; n < 2000; n++ {
+		at := randomTime(r)
+		u, err := UUIDv7At(at, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := ULIDAt(at, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids.ReplaceOrInsert(u)
+		ulids.ReplaceOrInsert(l)
+		created[u.String()], created[l.String()] = at, at
+	}
+	for n := 0; n < 200; n++ {
+		from, to := randomTime(r), randomTime(r)
+		inRange := func(at time.Time) bool {
+			ms := at.UnixMilli()
+			return ms >= from.UnixMilli() && ms < to.UnixMilli()
+		}
+		check := func(name string, tr *btree.BTree, ge, lt btree.Item) {
+			want := 0
+			tr.Ascend(func(i btree.Item) bool {
+				if inRange(created[fmt.Sprint(i)]) {
+					want++
+				}
+				return true
+			})
+			got := 0
+			tr.AscendRange(ge, lt, func(i btree.Item) bool {
+				if !inRange(created[fmt.Sprint(i)]) {
+					t.Fatalf("%s range [%v, %v) includes %v created at %v", name, from, to, i, created[fmt.Sprint(i)])
+				}
+				got++
+				return true
+			})
+			if got != want {
+				t.Fatalf("%s range [%v, %v) selected %d IDs, want %d", name, from, to, got, want)
+			}
+		}
+		ge, lt := UUIDv7RangeForTime(from, to)
+		check("UUIDv7", uuids, ge, lt)
+		lge, llt := ULIDRangeForTime(from, to)
+		check("ULID", ulids, lge, llt)
+	}
+}
+
+// TestTimeClampは、48ビットで表せない時刻が、エポックより前は0に、範囲より後は最大値に収められることを確かめます。
+func TestTimeClamp(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	u, err := UUIDv7At(time.Unix(-86400, 0), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Time().Equal(time.UnixMilli(0)) {
+		t.Fatalf("UUIDv7 before 1970 has time %v, want the epoch", u.Time())
+	}
+	l, err := ULIDAt(time.UnixMilli(maxMillis).Add(time.Hour), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Time().Equal(time.UnixMilli(maxMillis)) {
+		t.Fatalf("ULID after the 48-bit range has time %v, want %v", l.Time(), time.UnixMilli(maxMillis))
+	}
+}
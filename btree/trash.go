@@ -0,0 +1,134 @@
+package btree
+
+import (
+	"bytes"
+	"time"
+)
+
+// DefaultTrashRetentionは、SetTrashRetentionを呼ばない場合にゴミ箱に項目を残しておく期間です。
+const DefaultTrashRetention = 24 * time.Hour
+
+type (
+	// kvTrashは、OrderedKVのゴミ箱です。キーの順と削除した時刻の順の2つの木で同じ項目を持ちます。
+	kvTrash struct {
+		byKey     *BTreeG[trashEntry]
+		byTime    *BTreeG[trashEntry]
+		retention time.Duration
+	}
+
+	// trashEntryは、ゴミ箱の1項目です。
+	trashEntry struct {
+		kvEntry
+		deletedAt time.Time
+	}
+)
+
+func trashKeyLess(a, b trashEntry) bool {
+	return kvLess(a.kvEntry, b.kvEntry)
+}
+
+func trashTimeLess(a, b trashEntry) bool {
+	if !a.deletedAt.Equal(b.deletedAt) {
+		return a.deletedAt.Before(b.deletedAt)
+	}
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// trashは、ゴミ箱を返します。最初に使うときに作ります。
+func (kv *OrderedKV) trash() *kvTrash {
+	if kv.bin == nil {
+		degree := kv.tree.degree
+		kv.bin = &kvTrash{
+			byKey:     NewG(degree, trashKeyLess),
+			byTime:    NewG(degree, trashTimeLess),
+			retention: DefaultTrashRetention,
+		}
+	}
+	return kv.bin
+}
+
+// SetTrashRetentionは、SoftDeleteした項目をゴミ箱に残しておく期間を設定します。期間を過ぎた項目は、次にゴミ箱を操作したときに完全に削除されます。
+func (kv *OrderedKV) SetTrashRetention(d time.Duration) {
+	kv.trash().retention = d
+	kv.PurgeTrash()
+}
+
+// SoftDeleteは、keyを削除して、削除した時刻とともにゴミ箱に移します。keyがあればtrueを返します。
+// ゴミ箱にすでに同じキーがある場合は、新しく削除した値で置き換えます。ゴミ箱の項目はUndeleteで元に戻せます。
+func (kv *OrderedKV) SoftDelete(key []byte) bool {
+	e, ok := kv.tree.Delete(kvEntry{key: key})
+	kv.traceOp("softdelete", key, ok)
+	if !ok {
+		return false
+	}
+	b := kv.trash()
+	te := trashEntry{kvEntry: e, deletedAt: kv.clock()}
+	if old, ok := b.byKey.ReplaceOrInsert(te); ok {
+		b.byTime.Delete(old)
+	}
+	b.byTime.ReplaceOrInsert(te)
+	kv.PurgeTrash()
+	return true
+}
+
+// Undeleteは、ゴミ箱にあるkeyを元に戻し、戻した場合はtrueを返します。
+// ゴミ箱にないか保持期間を過ぎている場合と、削除した後で同じキーがSetされている場合はfalseを返し、何も変更しません。
+func (kv *OrderedKV) Undelete(key []byte) bool {
+	kv.PurgeTrash()
+	b := kv.trash()
+	te, ok := b.byKey.Get(trashEntry{kvEntry: kvEntry{key: key}})
+	if !ok || kv.tree.Has(te.kvEntry) {
+		return false
+	}
+	b.byKey.Delete(te)
+	b.byTime.Delete(te)
+	kv.tree.ReplaceOrInsert(te.kvEntry)
+	kv.traceOp("undelete", key, true)
+	return true
+}
+
+// PurgeTrashは、ゴミ箱から保持期間を過ぎた項目を完全に削除し、削除した数を返します。
+// 削除した時刻の順の木で古いものから取り除くので、時間は削除する項目数に比例します。
+func (kv *OrderedKV) PurgeTrash() (purged int) {
+	if kv.bin == nil {
+		return 0
+	}
+	b := kv.bin
+	cutoff := kv.clock().Add(-b.retention)
+	for {
+		te, ok := b.byTime.Min()
+		if !ok || te.deletedAt.After(cutoff) {
+			return purged
+		}
+		b.byTime.DeleteMin()
+		b.byKey.Delete(te)
+		kv.traceOp("purge", te.key, true)
+		purged++
+	}
+}
+
+// TrashLenは、ゴミ箱にある項目の数を返します。保持期間を過ぎてまだ削除されていない項目も含みます。
+func (kv *OrderedKV) TrashLen() int {
+	if kv.bin == nil {
+		return 0
+	}
+	return kv.bin.byKey.Len()
+}
+
+// AscendTrashは、ゴミ箱にあるすべての項目について、キーの昇順に、キーと値と削除した時刻を渡してiteratorを呼び出します。falseを返すと走査を止めます。
+func (kv *OrderedKV) AscendTrash(iterator func(key, value []byte, deletedAt time.Time) bool) {
+	if kv.bin == nil {
+		return
+	}
+	kv.bin.byKey.Ascend(func(te trashEntry) bool {
+		return iterator(te.key, te.value, te.deletedAt)
+	})
+}
+
+// clockは、現在の時刻を返します。
+func (kv *OrderedKV) clock() time.Time {
+	if kv.now != nil {
+		return kv.now()
+	}
+	return time.Now()
+}
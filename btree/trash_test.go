@@ -0,0 +1,129 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// trashKVは、時計を*nowに差し替えたOrderedKVを返します。
+func trashKV(now *time.Time) *OrderedKV {
+	kv := NewOrderedKV(3)
+	kv.now = func() time.Time { return *now }
+	return kv
+}
+
+// trashItemsは、ゴミ箱の項目を"key=value@削除した時刻"の形で返します。時刻はbaseからの経過時間です。
+func trashItems(kv *OrderedKV, base time.Time) []string {
+	out := []string{}
+	kv.AscendTrash(func(key, value []byte, deletedAt time.Time) bool {
+		out = append(out, fmt.Sprintf("%s=%s@%v", key, value, deletedAt.Sub(base)))
+		return true
+	})
+	return out
+}
+
+func TestTrashLifecycle(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	kv := trashKV(&now)
+	for _, k := range []string{"a", "b", "c"} {
+		kv.Set([]byte(k), []byte(k+"1"))
+	}
+	if kv.SoftDelete([]byte("missing")) || kv.TrashLen() != 0 {
+		t.Fatalf("SoftDelete of a missing key moved something to the trash")
+	}
+	if !kv.SoftDelete([]byte("a")) {
+		t.Fatal("SoftDelete(a) = false")
+	}
+	now = now.Add(time.Hour)
+	kv.SoftDelete([]byte("b"))
+	if kv.Has([]byte("a")) || kv.Has([]byte("b")) || kv.Len() != 1 {
+		t.Fatalf("soft-deleted keys are still visible, Len %d", kv.Len())
+	}
+	if got := fmt.Sprint(trashItems(kv, base)); got != "[a=a1@0s b=b1@1h0m0s]" {
+		t.Fatalf("trash = %s", got)
+	}
+
+	if !kv.Undelete([]byte("a")) {
+		t.Fatal("Undelete(a) = false")
+	}
+	if v, ok := kv.Get([]byte("a")); !ok || string(v) != "a1" || kv.TrashLen() != 1 {
+		t.Fatalf("after Undelete(a): Get = %q, %v, TrashLen %d", v, ok, kv.TrashLen())
+	}
+	if kv.Undelete([]byte("a")) || kv.Undelete([]byte("missing")) {
+		t.Fatal("Undelete of a key not in the trash = true")
+	}
+
+	// 削除した後で同じキーをSetした場合は、新しい値を古い値で上書きしない。
+	kv.Set([]byte("b"), []byte("b2"))
+	if kv.Undelete([]byte("b")) {
+		t.Fatal("Undelete(b) after Set(b) = true")
+	}
+	if v, _ := kv.Get([]byte("b")); string(v) != "b2" || kv.TrashLen() != 1 {
+		t.Fatalf("after a refused Undelete: Get(b) = %q, TrashLen %d", v, kv.TrashLen())
+	}
+
+	// もう一度SoftDeleteすると、ゴミ箱の項目を新しい値と時刻で置き換える。
+	now = now.Add(time.Hour)
+	kv.SoftDelete([]byte("b"))
+	if got := fmt.Sprint(trashItems(kv, base)); got != "[b=b2@2h0m0s]" {
+		t.Fatalf("trash after deleting b again = %s", got)
+	}
+	if !kv.Undelete([]byte("b")) {
+		t.Fatal("Undelete(b) = false")
+	}
+	if v, _ := kv.Get([]byte("b")); string(v) != "b2" || kv.TrashLen() != 0 {
+		t.Fatalf("after Undelete(b): Get = %q, TrashLen %d", v, kv.TrashLen())
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	kv := trashKV(&now)
+	kv.SetTrashRetention(time.Hour)
+	for i := 0; i < 4; i++ {
+		k := []byte(fmt.Sprint(i))
+		kv.Set(k, k)
+		kv.SoftDelete(k)
+		now = now.Add(10 * time.Minute)
+	}
+	// 0から3を、0分、10分、20分、30分に削除した。
+	now = base.Add(time.Hour - time.Nanosecond)
+	if n := kv.PurgeTrash(); n != 0 || kv.TrashLen() != 4 {
+		t.Fatalf("PurgeTrash before the retention = %d, TrashLen %d", n, kv.TrashLen())
+	}
+	// 保持期間がちょうど過ぎた項目は削除する。
+	now = base.Add(time.Hour)
+	if n := kv.PurgeTrash(); n != 1 {
+		t.Fatalf("PurgeTrash at the retention = %d, want 1", n)
+	}
+	now = base.Add(time.Hour + 15*time.Minute)
+	// 期限を過ぎた項目は、PurgeTrashを呼ばなくても戻せない。TrashLenには残っている。
+	if kv.TrashLen() != 3 {
+		t.Fatalf("TrashLen = %d, want 3", kv.TrashLen())
+	}
+	if kv.Undelete([]byte("1")) || kv.Has([]byte("1")) {
+		t.Fatal("Undelete of an expired item succeeded")
+	}
+	if got := fmt.Sprint(trashItems(kv, base)); got != "[2=2@20m0s 3=3@30m0s]" {
+		t.Fatalf("trash = %s", got)
+	}
+	// 保持期間を短くすると、すぐに削除する。
+	kv.SetTrashRetention(50 * time.Minute)
+	if got := fmt.Sprint(trashItems(kv, base)); got != "[3=3@30m0s]" {
+		t.Fatalf("trash after shortening the retention = %s", got)
+	}
+	// SoftDeleteも期限を過ぎた項目を削除する。
+	now = base.Add(2 * time.Hour)
+	kv.Set([]byte("x"), []byte("x"))
+	kv.SoftDelete([]byte("x"))
+	if got := fmt.Sprint(trashItems(kv, base)); got != "[x=x@2h0m0s]" {
+		t.Fatalf("trash after SoftDelete = %s", got)
+	}
+	kv.SetTrashRetention(0)
+	if kv.TrashLen() != 0 || kv.Len() != 0 {
+		t.Fatalf("zero retention left TrashLen %d, Len %d", kv.TrashLen(), kv.Len())
+	}
+}
@@ -0,0 +1,292 @@
+// Package ttlcacheは、項目ごとの有効期限と項目数の上限を持ち、キーの順に走査できるキャッシュを提供します。
+//
+// Get、Set、Deleteと、有効期限切れや上限による追い出しを知らせるOnEvictという、一般的なキャッシュと同じ使い方ができます。
+// 加えて、キーの順の走査と範囲の走査、次に追い出される順の走査ができるので、順序付きの走査も必要な場面でristrettoやbigcacheの代わりに使えます。
+//
+// キャッシュはキーの順と有効期限の順の2つの木で同じ項目を持ちます。期限切れの項目は、読んだときと書き込みのたびに有効期限の順の木の先頭から取り除くので、
+// バックグラウンドのゴルーチンは使いません。
+package ttlcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// degreeは、キャッシュの木のdegreeです。
+const degree = 32
+
+// EvictReasonは、OnEvictが呼ばれた理由です。
+type EvictReason int
+
+const (
+	// Expiredは、有効期限を過ぎたために追い出されたことを示します。
+	Expired EvictReason = iota
+	// Capacityは、項目数がMaxItemsを超えるために、次に期限が切れる項目から追い出されたことを示します。
+	Capacity
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Capacity:
+		return "capacity"
+	default:
+		return "unknown"
+	}
+}
+
+type (
+	// Optionsは、Newで作るキャッシュの設定です。ゼロ値は、上限も有効期限もない設定になります。
+	Options[K, V any] struct {
+		// MaxItemsは、項目数の上限です。0の場合は制限しません。
+		MaxItems int
+		// DefaultTTLは、Setで入れた項目の有効期間です。0の場合は期限切れになりません。
+		DefaultTTL time.Duration
+		// OnEvictは、項目が期限切れか上限で追い出されたときに呼ばれます。DeleteやSetでの置き換えでは呼ばれません。
+		// キャッシュのロックを外してから呼ぶので、OnEvictの中でキャッシュを使っても構いません。
+		OnEvict func(key K, value V, reason EvictReason)
+		// Nowは、キャッシュが使う時計です。nilの場合はtime.Nowを使います。
+		Now func() time.Time
+	}
+
+	// Cacheは、有効期限と項目数の上限を持つ、キーの順に並んだキャッシュです。複数のゴルーチンから同時に使えます。
+	Cache[K, V any] struct {
+		mu       sync.Mutex
+		byKey    *btree.BTreeG[entry[K, V]]
+		byExpiry *btree.BTreeG[entry[K, V]]
+		opts     Options[K, V]
+		// seqは、有効期限が同じ項目を入れた順に並べるための通し番号です。
+		seq uint64
+	}
+
+	// entryは、キャッシュの1項目です。expiresがゼロ値の項目は期限切れになりません。
+	entry[K, V any] struct {
+		key     K
+		value   V
+		expires time.Time
+		seq     uint64
+	}
+)
+
+// Newは、keyの順序lessと設定optsで空のキャッシュを作成します。
+func New[K, V any](less btree.LessFunc[K], opts Options[K, V]) *Cache[K, V] {
+	if opts.MaxItems < 0 {
+		panic("bad max items")
+	}
+	return &Cache[K, V]{
+		byKey: btree.NewG(degree, func(a, b entry[K, V]) bool {
+			return less(a.key, b.key)
+		}),
+		byExpiry: btree.NewG(degree, expiryLess[K, V]),
+		opts:     opts,
+	}
+}
+
+// expiryLessは、有効期限の早い順（期限のない項目は最後）、同じなら入れた順に並べます。
+func expiryLess[K, V any](a, b entry[K, V]) bool {
+	switch {
+	case a.expires.Equal(b.expires):
+		return a.seq < b.seq
+	case a.expires.IsZero():
+		return false
+	case b.expires.IsZero():
+		return true
+	}
+	return a.expires.Before(b.expires)
+}
+
+// clockは、現在の時刻を返します。
+func (c *Cache[K, V]) clock() time.Time {
+	if c.opts.Now != nil {
+		return c.opts.Now()
+	}
+	return time.Now()
+}
+
+// expiredは、eがnowの時点で期限切れかどうかを返します。
+func (e entry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// removeは、eを両方の木から取り除きます。c.muを保持して呼ぶ必要があります。
+func (c *Cache[K, V]) remove(e entry[K, V]) {
+	c.byKey.Delete(e)
+	c.byExpiry.Delete(e)
+}
+
+// purgeは、nowの時点で期限切れの項目を有効期限の順に取り除き、evictedに加えて返します。c.muを保持して呼ぶ必要があります。
+func (c *Cache[K, V]) purge(now time.Time, evicted []eviction[K, V]) []eviction[K, V] {
+	for {
+		e, ok := c.byExpiry.Min()
+		if !ok || !e.expired(now) {
+			return evicted
+		}
+		c.remove(e)
+		evicted = append(evicted, eviction[K, V]{e, Expired})
+	}
+}
+
+// evictionは、ロックを外してからOnEvictに渡す、追い出した項目と理由です。
+type eviction[K, V any] struct {
+	entry[K, V]
+	reason EvictReason
+}
+
+// notifyは、追い出した項目についてOnEvictを呼びます。c.muを保持せずに呼ぶ必要があります。
+func (c *Cache[K, V]) notify(evicted []eviction[K, V]) {
+	if c.opts.OnEvict == nil {
+		return
+	}
+	for _, ev := range evicted {
+		c.opts.OnEvict(ev.key, ev.value, ev.reason)
+	}
+}
+
+// Getは、keyの値を返します。keyがないか期限切れの場合は (zeroValue, false) を返します。
+func (c *Cache[K, V]) Get(key K) (_ V, _ bool) {
+	c.mu.Lock()
+	e, ok := c.byKey.Get(entry[K, V]{key: key})
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	if e.expired(c.clock()) {
+		c.remove(e)
+		c.mu.Unlock()
+		c.notify([]eviction[K, V]{{e, Expired}})
+		return
+	}
+	c.mu.Unlock()
+	return e.value, true
+}
+
+// Hasは、keyがあり期限切れでなければtrueを返します。
+func (c *Cache[K, V]) Has(key K) bool {
+	_, ok := c.Get(key)
+	return ok
+}
+
+// Setは、keyの値をvalueにします。有効期間はOptions.DefaultTTLです。
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.opts.DefaultTTL)
+}
+
+// SetWithTTLは、keyの値をvalueにし、ttlの後に期限切れにします。ttlが0以下の場合は期限切れになりません。
+// 新しいキーで項目数がMaxItemsを超える場合は、期限切れの項目を取り除いた後、次に期限が切れる項目から追い出します。
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	now := c.clock()
+	evicted := c.purge(now, nil)
+	c.seq++
+	e := entry[K, V]{key: key, value: value, seq: c.seq}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	if old, ok := c.byKey.ReplaceOrInsert(e); ok {
+		c.byExpiry.Delete(old)
+	}
+	c.byExpiry.ReplaceOrInsert(e)
+	for c.opts.MaxItems > 0 && c.byKey.Len() > c.opts.MaxItems {
+		victim, _ := c.byExpiry.DeleteMin()
+		c.byKey.Delete(victim)
+		evicted = append(evicted, eviction[K, V]{victim, Capacity})
+	}
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// Deleteは、keyを削除し、削除した場合はtrueを返します。期限切れの項目を削除した場合もtrueを返します。OnEvictは呼びません。
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.byKey.Delete(entry[K, V]{key: key})
+	if ok {
+		c.byExpiry.Delete(e)
+	}
+	return ok
+}
+
+// TTLは、keyが期限切れになるまでの時間を返します。期限切れにならない項目では0を返します。keyがないか期限切れの場合は (0, false) を返します。
+func (c *Cache[K, V]) TTL(key K) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.byKey.Get(entry[K, V]{key: key})
+	now := c.clock()
+	if !ok || e.expired(now) {
+		return 0, false
+	}
+	if e.expires.IsZero() {
+		return 0, true
+	}
+	return e.expires.Sub(now), true
+}
+
+// DeleteExpiredは、期限切れの項目をすべて取り除いてOnEvictに知らせ、取り除いた数を返します。
+func (c *Cache[K, V]) DeleteExpired() int {
+	c.mu.Lock()
+	evicted := c.purge(c.clock(), nil)
+	c.mu.Unlock()
+	c.notify(evicted)
+	return len(evicted)
+}
+
+// Lenは、期限切れの項目を取り除いた後の項目の数を返します。
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	evicted := c.purge(c.clock(), nil)
+	n := c.byKey.Len()
+	c.mu.Unlock()
+	c.notify(evicted)
+	return n
+}
+
+// Clearは、すべての項目を削除します。OnEvictは呼びません。
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byKey.Clear(true)
+	c.byExpiry.Clear(true)
+}
+
+// snapshotは、期限切れの項目を取り除いた後の木のCloneを返します。走査はロックを外してCloneに対して行うので、iteratorの中でキャッシュを使っても構いません。
+func (c *Cache[K, V]) snapshot(byExpiry bool) *btree.BTreeG[entry[K, V]] {
+	c.mu.Lock()
+	evicted := c.purge(c.clock(), nil)
+	t := c.byKey
+	if byExpiry {
+		t = c.byExpiry
+	}
+	t = t.Clone()
+	c.mu.Unlock()
+	c.notify(evicted)
+	return t
+}
+
+// Ascendは、すべての項目について、キーの昇順に、キーと値と有効期限（期限のない項目ではゼロ値）を渡してiteratorを呼び出します。falseを返すと走査を止めます。
+// 走査は呼び出した時点のスナップショットに対して行います。
+func (c *Cache[K, V]) Ascend(iterator func(key K, value V, expires time.Time) bool) {
+	t := c.snapshot(false)
+	t.Ascend(func(e entry[K, V]) bool {
+		return iterator(e.key, e.value, e.expires)
+	})
+}
+
+// AscendRangeは、[greaterOrEqual, lessThan) の範囲の項目について、キーの昇順にiteratorを呼び出します。
+func (c *Cache[K, V]) AscendRange(greaterOrEqual, lessThan K, iterator func(key K, value V, expires time.Time) bool) {
+	t := c.snapshot(false)
+	t.AscendRange(entry[K, V]{key: greaterOrEqual}, entry[K, V]{key: lessThan}, func(e entry[K, V]) bool {
+		return iterator(e.key, e.value, e.expires)
+	})
+}
+
+// AscendEvictionは、すべての項目について、追い出される順（有効期限の早い順、期限のない項目は最後）にiteratorを呼び出します。
+// 上限による追い出しもこの順に行うので、次に消える項目を調べるために使います。
+func (c *Cache[K, V]) AscendEviction(iterator func(key K, value V, expires time.Time) bool) {
+	t := c.snapshot(true)
+	t.Ascend(func(e entry[K, V]) bool {
+		return iterator(e.key, e.value, e.expires)
+	})
+}
@@ -0,0 +1,170 @@
+package ttlcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClockは、テストで進めるOptions.Nowの時計です。
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestは、偽の時計を使い、OnEvictの呼び出しを"key:reason"の形でevictedに記録するキャッシュを作ります。
+func newTest(maxItems int, ttl time.Duration) (c *Cache[string, int], clock *fakeClock, evicted *[]string) {
+	clock = &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	evicted = &[]string{}
+	c = New(func(a, b string) bool { return a < b }, Options[string, int]{
+		MaxItems:   maxItems,
+		DefaultTTL: ttl,
+		Now:        clock.Now,
+		OnEvict: func(key string, value int, reason EvictReason) {
+			*evicted = append(*evicted, fmt.Sprintf("%s:%v", key, reason))
+		},
+	})
+	return c, clock, evicted
+}
+
+// keysは、キャッシュのキーを、Ascendで見える順に返します。
+func keys(c *Cache[string, int]) string {
+	var out []string
+	c.Ascend(func(key string, _ int, _ time.Time) bool {
+		out = append(out, key)
+		return true
+	})
+	return fmt.Sprint(out)
+}
+
+func TestExpiry(t *testing.T) {
+	c, clock, evicted := newTest(0, 10*time.Second)
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 20*time.Second)
+	c.SetWithTTL("forever", 3, 0)
+	clock.advance(5 * time.Second)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) before expiry = %d, %v", v, ok)
+	}
+	if ttl, ok := c.TTL("a"); !ok || ttl != 5*time.Second {
+		t.Fatalf("TTL(a) = %v, %v, want 5s", ttl, ok)
+	}
+	if ttl, ok := c.TTL("forever"); !ok || ttl != 0 {
+		t.Fatalf("TTL(forever) = %v, %v, want 0, true", ttl, ok)
+	}
+	if ttl, ok := c.TTL("missing"); ok || ttl != 0 {
+		t.Fatalf("TTL(missing) = %v, %v, want 0, false", ttl, ok)
+	}
+	// 有効期限ちょうどの時刻で期限切れになる。
+	clock.advance(5 * time.Second)
+	if _, ok := c.TTL("a"); ok {
+		t.Fatal("TTL(a) found an expired item")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get(a) found an expired item")
+	}
+	if fmt.Sprint(*evicted) != "[a:expired]" {
+		t.Fatalf("evicted %v, want [a:expired]", *evicted)
+	}
+	if got := keys(c); got != "[b forever]" {
+		t.Fatalf("keys = %s, want [b forever]", got)
+	}
+	clock.advance(time.Hour)
+	if n := c.DeleteExpired(); n != 1 {
+		t.Fatalf("DeleteExpired = %d, want 1", n)
+	}
+	if c.Len() != 1 || !c.Has("forever") {
+		t.Fatalf("after an hour Len=%d, keys %s", c.Len(), keys(c))
+	}
+	if fmt.Sprint(*evicted) != "[a:expired b:expired]" {
+		t.Fatalf("evicted %v, want [a:expired b:expired]", *evicted)
+	}
+}
+
+// TestMaxItemsは、上限を超えると、有効期限の早い順、期限のない項目は入れた順に追い出されることを確かめます。
+func TestMaxItems(t *testing.T) {
+	c, clock, evicted := newTest(3, 0)
+	c.SetWithTTL("a", 1, 30*time.Second)
+	c.SetWithTTL("b", 2, 10*time.Second)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, 20*time.Second)
+	var order []string
+	c.AscendEviction(func(key string, _ int, _ time.Time) bool {
+		order = append(order, key)
+		return true
+	})
+	if fmt.Sprint(order) != "[d a c]" {
+		t.Fatalf("eviction order %v, want [d a c]", order)
+	}
+	c.Set("e", 5)
+	c.Set("f", 6)
+	if got := keys(c); got != "[c e f]" {
+		t.Fatalf("keys = %s, want [c e f]", got)
+	}
+	c.Set("g", 7)
+	if got := keys(c); got != "[e f g]" {
+		t.Fatalf("keys = %s, want [e f g]", got)
+	}
+	if want := "[b:capacity d:capacity a:capacity c:capacity]"; fmt.Sprint(*evicted) != want {
+		t.Fatalf("evicted %v, want %s", *evicted, want)
+	}
+	// 期限切れの項目があれば、上限による追い出しより先に取り除く。
+	c.Delete("g")
+	c.SetWithTTL("h", 8, time.Second)
+	clock.advance(time.Second)
+	*evicted = nil
+	c.Set("i", 9)
+	if got := keys(c); got != "[e f i]" {
+		t.Fatalf("keys = %s, want [e f i]", got)
+	}
+	if want := "[h:expired]"; fmt.Sprint(*evicted) != want {
+		t.Fatalf("evicted %v, want %s", *evicted, want)
+	}
+}
+
+// TestNoCallbackは、Delete、Setでの置き換え、Clearでは、OnEvictが呼ばれないことを確かめます。
+func TestNoCallback(t *testing.T) {
+	c, clock, evicted := newTest(2, time.Minute)
+	c.Set("a", 1)
+	c.Set("a", 2)
+	if v, _ := c.Get("a"); v != 2 {
+		t.Fatalf("Get(a) after replacing = %d, want 2", v)
+	}
+	if !c.Delete("a") || c.Delete("a") {
+		t.Fatal("Delete(a) did not report exactly one deletion")
+	}
+	// 期限切れの項目の削除もtrueを返すが、OnEvictは呼ばない。
+	c.Set("b", 1)
+	clock.advance(time.Minute)
+	if !c.Delete("b") {
+		t.Fatal("Delete of an expired item returned false")
+	}
+	c.Set("c", 1)
+	c.Set("d", 1)
+	c.Clear()
+	if c.Len() != 0 || len(*evicted) != 0 {
+		t.Fatalf("Len=%d, evicted %v", c.Len(), *evicted)
+	}
+}
+
+func TestAscendRange(t *testing.T) {
+	c, clock, _ := newTest(0, 0)
+	for i, k := range []string{"a", "b", "c", "d", "e"} {
+		c.SetWithTTL(k, i, time.Duration(i+1)*time.Second)
+	}
+	clock.advance(2 * time.Second)
+	var got []string
+	c.AscendRange("a", "e", func(key string, value int, expires time.Time) bool {
+		if want := clock.now.Add(time.Duration(value-1) * time.Second); !expires.Equal(want) {
+			t.Errorf("%s expires at %v, want %v", key, expires, want)
+		}
+		got = append(got, key)
+		return true
+	})
+	if fmt.Sprint(got) != "[c d]" {
+		t.Fatalf("AscendRange(a, e) = %v, want [c d]", got)
+	}
+}
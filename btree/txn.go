@@ -0,0 +1,263 @@
+package btree
+
+type (
+	// TxnGは、Beginで開始したトランザクションです。開始時点の木のCloneに対して読み書きするので、
+	// 書き込みはCommitするまで元の木から見えず、元の木への以後の変更もトランザクションからは見えません。
+	//
+	// 書き込み可能なトランザクションは1つの木につき同時に1つだけ開けますが、読み取り専用のトランザクションはいくつでも開けます。
+	// トランザクションのメソッドは、Commit/Rollbackの後に呼ぶとErrClosedを返します（読み取りはゼロ値を返します）。
+	TxnG[T any] struct {
+		t         *BTreeG[T]
+		tree      *BTreeG[T]
+		writable  bool
+		mutations uint64 // 開始時点のt.mutations
+		done      bool
+	}
+
+	// Txnは、BTreeのトランザクションです。
+	Txn TxnG[Item]
+)
+
+// Beginは、木のトランザクションを開始します。writableがtrueの場合は書き込み可能なトランザクションになります。
+// 書き込み可能なトランザクションがすでに開いている木でもう1つ開こうとするとパニックします。
+// 開始はCloneと同じくO(1)で、トランザクション中の書き込みはコピーオンライトで新しいノードに行われます。
+func (t *BTreeG[T]) Begin(writable bool) *TxnG[T] {
+	if writable && t.writer != nil {
+		panic("btree: a writable transaction is already open")
+	}
+	tx := &TxnG[T]{t: t, tree: t.Clone(), writable: writable, mutations: t.mutations}
+	if writable {
+		t.writer = tx
+	}
+	return tx
+}
+
+// Writableは、書き込み可能なトランザクションであればtrueを返します。
+func (tx *TxnG[T]) Writable() bool {
+	return tx.writable
+}
+
+// checkWriteは、トランザクションに書き込めなければその理由のエラーを返します。
+func (tx *TxnG[T]) checkWrite() error {
+	switch {
+	case tx.done:
+		return ErrClosed
+	case !tx.writable:
+		return ErrReadOnly
+	case tx.tree.poisoned:
+		return tx.tree.err
+	}
+	return nil
+}
+
+// ReplaceOrInsertは、トランザクションの中で項目を追加または置き換えます。戻り値はBTreeG.ReplaceOrInsertと同じです。
+func (tx *TxnG[T]) ReplaceOrInsert(item T) (_ T, _ bool, err error) {
+	if err = tx.checkWrite(); err != nil {
+		return
+	}
+	out, ok := tx.tree.ReplaceOrInsert(item)
+	return out, ok, tx.tree.Err()
+}
+
+// Deleteは、トランザクションの中で項目を削除します。戻り値はBTreeG.Deleteと同じです。
+func (tx *TxnG[T]) Delete(item T) (_ T, _ bool, err error) {
+	if err = tx.checkWrite(); err != nil {
+		return
+	}
+	out, ok := tx.tree.Delete(item)
+	return out, ok, tx.tree.Err()
+}
+
+// Getは、トランザクションから見える木でkeyを探します。
+func (tx *TxnG[T]) Get(key T) (_ T, _ bool) {
+	if tx.done {
+		return
+	}
+	return tx.tree.Get(key)
+}
+
+// Hasは、トランザクションから見える木にkeyがあればtrueを返します。
+func (tx *TxnG[T]) Has(key T) bool {
+	_, ok := tx.Get(key)
+	return ok
+}
+
+// Lenは、トランザクションから見える木の項目数を返します。
+func (tx *TxnG[T]) Len() int {
+	if tx.done {
+		return 0
+	}
+	return tx.tree.Len()
+}
+
+// Ascendは、トランザクションから見える木のすべての項目について、昇順にiteratorを呼び出します。
+func (tx *TxnG[T]) Ascend(iterator ItemIteratorG[T]) {
+	if tx.done {
+		return
+	}
+	tx.tree.Ascend(iterator)
+}
+
+// AscendRangeは、トランザクションから見える木の [greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorを呼び出します。
+func (tx *TxnG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	if tx.done {
+		return
+	}
+	tx.tree.AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// Descendは、トランザクションから見える木のすべての項目について、降順にiteratorを呼び出します。
+func (tx *TxnG[T]) Descend(iterator ItemIteratorG[T]) {
+	if tx.done {
+		return
+	}
+	tx.tree.Descend(iterator)
+}
+
+// Commitは、トランザクションを終了します。書き込み可能なトランザクションでは、トランザクション中の変更を1回の代入で元の木に反映するので、
+// 元の木から変更の一部だけが見えることはありません。
+// トランザクションの開始後に元の木が直接変更されていた場合は、変更を反映せずにロールバックしてErrConflictを返します。
+func (tx *TxnG[T]) Commit() error {
+	if tx.done {
+		return ErrClosed
+	}
+	if !tx.writable {
+		tx.finish()
+		return nil
+	}
+	if tx.tree.poisoned {
+		err := tx.tree.err
+		tx.rollback()
+		return err
+	}
+	t := tx.t
+	if t.mutations != tx.mutations {
+		tx.rollback()
+		return ErrConflict
+	}
+	// トランザクションが作ったノードはtx.treeのコンテキストが所有しているので、それごと引き継いで以後の書き込みをその場で行えるようにする。
+	t.debugBeforeMutate("Commit")
+	t.root, t.length, t.cow = tx.tree.root, tx.tree.length, tx.tree.cow
+	t.mutations++
+	tx.finish()
+	t.debugAfterMutate("Commit")
+	return nil
+}
+
+// Rollbackは、トランザクション中の変更を捨てて終了し、トランザクションが作ったノードをフリーリストに戻します。
+func (tx *TxnG[T]) Rollback() error {
+	if tx.done {
+		return ErrClosed
+	}
+	tx.rollback()
+	return nil
+}
+
+func (tx *TxnG[T]) rollback() {
+	if tx.writable && tx.tree.root != nil && !tx.tree.poisoned {
+		tx.tree.root.release(tx.tree.cow)
+	}
+	tx.finish()
+}
+
+// finishは、トランザクションを閉じ、書き込み可能なトランザクションであれば木の書き込み中の印を外します。
+func (tx *TxnG[T]) finish() {
+	tx.done = true
+	tx.tree = nil
+	if tx.writable && tx.t.writer == tx {
+		tx.t.writer = nil
+	}
+}
+
+// releaseは、cが所有するノードをフリーリストに戻します。所有するノードはルートからつながった上の部分にしかないので、
+// 木全体をたどるresetと違い、所有していないノードの下には降りません。
+func (n *node[T]) release(c *copyOnWriteContext[T]) {
+	if !c.owns(n) {
+		return
+	}
+	for _, child := range n.children {
+		child.release(c)
+	}
+	c.freeNode(n)
+}
+
+// Txn
+
+// Beginは、木のトランザクションを開始します。詳細はBTreeG.Beginを参照してください。
+func (t *BTree) Begin(writable bool) *Txn {
+	return (*Txn)(t.generic().Begin(writable))
+}
+
+func (tx *Txn) generic() *TxnG[Item] {
+	return (*TxnG[Item])(tx)
+}
+
+// Writableは、書き込み可能なトランザクションであればtrueを返します。
+func (tx *Txn) Writable() bool {
+	return tx.writable
+}
+
+// ReplaceOrInsertは、トランザクションの中で項目を追加または置き換え、置き換えられた項目を返します。nilは追加できません（パニックになります）。
+func (tx *Txn) ReplaceOrInsert(item Item) (Item, error) {
+	if item == nil {
+		panic("nil item being added to BTree")
+	}
+	out, _, err := tx.generic().ReplaceOrInsert(item)
+	return out, err
+}
+
+// Deleteは、トランザクションの中で項目を削除し、削除した項目を返します。
+func (tx *Txn) Delete(item Item) (Item, error) {
+	out, _, err := tx.generic().Delete(item)
+	return out, err
+}
+
+// Getは、トランザクションから見える木でkeyを探します。見つからない場合はnilを返します。
+func (tx *Txn) Get(key Item) Item {
+	out, _ := tx.generic().Get(key)
+	return out
+}
+
+// Hasは、トランザクションから見える木にkeyがあればtrueを返します。
+func (tx *Txn) Has(key Item) bool {
+	return tx.generic().Has(key)
+}
+
+// Lenは、トランザクションから見える木の項目数を返します。
+func (tx *Txn) Len() int {
+	return tx.generic().Len()
+}
+
+// Ascendは、トランザクションから見える木のすべての項目について、昇順にiteratorを呼び出します。
+func (tx *Txn) Ascend(iterator ItemIterator) {
+	if tx.done {
+		return
+	}
+	(*BTree)(tx.tree).Ascend(iterator)
+}
+
+// AscendRangeは、トランザクションから見える木の [greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorを呼び出します。nilの境界は「境界なし」を意味します。
+func (tx *Txn) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	if tx.done {
+		return
+	}
+	(*BTree)(tx.tree).AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// Descendは、トランザクションから見える木のすべての項目について、降順にiteratorを呼び出します。
+func (tx *Txn) Descend(iterator ItemIterator) {
+	if tx.done {
+		return
+	}
+	(*BTree)(tx.tree).Descend(iterator)
+}
+
+// Commitは、トランザクションを終了し、書き込み可能なトランザクションであれば変更を木に反映します。詳細はTxnG.Commitを参照してください。
+func (tx *Txn) Commit() error {
+	return tx.generic().Commit()
+}
+
+// Rollbackは、トランザクション中の変更を捨てて終了します。
+func (tx *Txn) Rollback() error {
+	return tx.generic().Rollback()
+}
@@ -0,0 +1,157 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func intLess(a, b int) bool { return a < b }
+
+func TestTxnCommitConflict(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 100; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	tx := tr.Begin(true)
+	if _, _, err := tx.Delete(10); err != nil {
+		t.Fatal(err)
+	}
+	tr.ReplaceOrInsert(1000)
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Commit after a concurrent write = %v, want ErrConflict", err)
+	}
+	if !tr.Has(10) || !tr.Has(1000) || tr.Len() != 101 {
+		t.Fatalf("conflicting commit changed the tree: Has(10)=%v Has(1000)=%v Len=%d", tr.Has(10), tr.Has(1000), tr.Len())
+	}
+}
+
+func TestTxnCommitAfterNoopDeletes(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 100; i += 2 {
+		tr.ReplaceOrInsert(i)
+	}
+	tx := tr.Begin(true)
+	if _, _, err := tx.ReplaceOrInsert(1); err != nil {
+		t.Fatal(err)
+	}
+	// 存在しない項目の削除や空の木からのDeleteMin/DeleteMaxは木を変えないので、衝突にならない。
+	for i := 1; i < 100; i += 2 {
+		if _, ok := tr.Delete(i); ok {
+			t.Fatalf("Delete(%d) reported a removal", i)
+		}
+	}
+	empty := NewG(3, intLess)
+	empty.DeleteMin()
+	empty.DeleteMax()
+	if empty.mutations != 0 {
+		t.Fatalf("DeleteMin/DeleteMax on an empty tree counted %d mutations", empty.mutations)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit after no-op deletes = %v, want nil", err)
+	}
+	if !tr.Has(1) || tr.Len() != 51 {
+		t.Fatalf("after commit Has(1)=%v Len=%d, want true 51", tr.Has(1), tr.Len())
+	}
+}
+
+func TestTxnRollback(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 50; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	tx := tr.Begin(true)
+	for i := 0; i < 50; i += 3 {
+		tx.Delete(i)
+	}
+	if got := tx.Len(); got != 33 {
+		t.Fatalf("tx.Len() = %d, want 33", got)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Len() != 50 || !tr.Has(0) {
+		t.Fatalf("rollback leaked writes: Len=%d Has(0)=%v", tr.Len(), tr.Has(0))
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Commit after Rollback = %v, want ErrClosed", err)
+	}
+	// 書き込み可能なトランザクションを閉じた後は、次を開ける。
+	tr.Begin(true).Rollback()
+}
+
+// TestTxnRandomは、書き込み可能なトランザクションでランダムに書き込み、CommitかRollbackで終えることを繰り返し、
+// 木がCommitした変更だけを反映すること、開いている読み取り専用のトランザクションが開始時点の内容を見続けることを確かめます。
+func TestTxnRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	tr := NewG(3, intLess)
+	model := map[int]bool{}
+	for round := 0; round < 200; round++ {
+		snapshot := tr.Begin(false)
+		before := allItems(tr)
+		tx := tr.Begin(true)
+		pending := map[int]bool{}
+		for k := range model {
+			pending[k] = true
+		}
+		for i := r.Intn(50); i > 0; i-- {
+			k := r.Intn(300)
+			if r.Intn(2) == 0 {
+				if _, found, err := tx.ReplaceOrInsert(k); err != nil || found != pending[k] {
+					t.Fatalf("round %d: tx.ReplaceOrInsert(%d) = %v, %v, want found %v", round, k, found, err, pending[k])
+				}
+				pending[k] = true
+			} else {
+				if _, found, err := tx.Delete(k); err != nil || found != pending[k] {
+					t.Fatalf("round %d: tx.Delete(%d) = %v, %v, want found %v", round, k, found, err, pending[k])
+				}
+				delete(pending, k)
+			}
+			if tx.Has(k) != pending[k] {
+				t.Fatalf("round %d: the transaction does not see its own write to %d", round, k)
+			}
+		}
+		if fmt.Sprint(allItems(tr)) != fmt.Sprint(before) {
+			t.Fatalf("round %d: uncommitted writes are visible in the tree", round)
+		}
+		if r.Intn(3) == 0 {
+			if err := tx.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			model = pending
+		}
+		mustVerify(t, fmt.Sprintf("round %d", round), tr)
+		if got, want := fmt.Sprint(allItems(tr)), fmt.Sprint(sortedInts(model)); got != want {
+			t.Fatalf("round %d: tree %v, model %v", round, got, want)
+		}
+		var seen []int
+		snapshot.Ascend(func(i int) bool {
+			seen = append(seen, i)
+			return true
+		})
+		if fmt.Sprint(seen) != fmt.Sprint(before) {
+			t.Fatalf("round %d: a read-only transaction saw later writes", round)
+		}
+		if _, _, err := snapshot.ReplaceOrInsert(1); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("write to a read-only transaction = %v, want ErrReadOnly", err)
+		}
+		if err := snapshot.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sortedInts(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+	return out
+}
@@ -0,0 +1,131 @@
+package btree
+
+// GetOrInsertは、itemと等しい項目が木にあればそれを変更せずに (その項目, true) を返し、なければitemを挿入して (item, false) を返します。
+// GetとReplaceOrInsertを続けて呼ぶのとは違い、木を1回たどるだけで済みます。
+func (t *BTreeG[T]) GetOrInsert(item T) (_ T, _ bool) {
+	out, loaded := item, false
+	t.upsert("GetOrInsert", item, func(existing T, found bool) (T, bool) {
+		if found {
+			out, loaded = existing, true
+			return existing, false
+		}
+		return item, true
+	})
+	return out, loaded
+}
+
+// Updateは、keyと等しい項目を探し、見つかった項目（見つからなければゼロ値とfalse）を渡してfnを呼びます。
+// fnが (newItem, true) を返すと、見つかった項目をnewItemで置き換えるか、見つからなかった場合はnewItemを挿入します。(_, false) を返すと木は変更されません。
+// 探索と変更は木を1回たどるだけで行います。newItemはkeyと等しくなければならず、そうでない場合はpanicします。fnの中でtを変更してはいけません。
+func (t *BTreeG[T]) Update(key T, fn func(existing T, found bool) (T, bool)) {
+	t.upsert("Update", key, func(existing T, found bool) (T, bool) {
+		item, ok := fn(existing, found)
+		if ok && (t.cow.less(item, key) || t.cow.less(key, item)) {
+			panic("btree: Update: fn returned an item that is not equal to the key")
+		}
+		return item, ok
+	})
+}
+
+// upsertは、GetOrInsertとUpdateの共通部分です。keyを探しながら、ReplaceOrInsertと同じように経路上のノードをコピーして満杯のノードを分割します。
+func (t *BTreeG[T]) upsert(op string, key T, fn func(existing T, found bool) (T, bool)) {
+	if t.poisoned {
+		return
+	}
+	if t.recoverPanics {
+		defer t.recoverPanic(op, true)
+	}
+	t.debugBeforeMutate(op)
+	defer t.debugAfterMutate(op)
+	t.mutations++
+	if t.events != nil {
+		defer t.events.end(op, t.beginEvent())
+	}
+	if t.root == nil {
+		var zero T
+		item, ok := fn(zero, false)
+		if ok {
+			t.root = t.cow.newNode()
+			t.root.items = append(t.root.items, item)
+			t.root.recount()
+			t.length++
+		}
+		return
+	}
+	t.root = t.root.mutableFor(t.cow)
+	if len(t.root.items) >= t.maxItems() {
+		item2, second := t.root.split(t.maxItems() / 2)
+		oldroot := t.root
+		t.root = t.cow.newNode()
+		t.root.items = append(t.root.items, item2)
+		t.root.children = append(t.root.children, oldroot, second)
+		t.root.recount()
+	}
+	if t.root.upsert(key, fn, t.maxItems()) {
+		t.length++
+	}
+}
+
+// upsertは、このノードをルートとするサブツリーでkeyを探してfnを呼び、fnが返した項目で置き換えるか挿入します。挿入した場合はtrueを返します。
+// insertと同じく、降りる前に満杯の子を分割します。
+func (n *node[T]) upsert(key T, fn func(existing T, found bool) (T, bool), maxItems int) bool {
+	i, found := n.items.find(key, n.cow.less)
+	if found {
+		if item, ok := fn(n.items[i], true); ok {
+			n.items[i] = item
+			n.rescore()
+		}
+		return false
+	}
+	if len(n.children) == 0 {
+		var zero T
+		item, ok := fn(zero, false)
+		if ok {
+			n.items.insertAt(i, item)
+			n.size++
+			n.rescore()
+		}
+		return ok
+	}
+	if n.maybeSplitChild(i, maxItems) {
+		inTree := n.items[i]
+		switch {
+		case n.cow.less(key, inTree):
+			// no change, we want first split node
+		case n.cow.less(inTree, key):
+			i++ // we want second split node
+		default:
+			if item, ok := fn(inTree, true); ok {
+				n.items[i] = item
+				n.rescore()
+			}
+			return false
+		}
+	}
+	inserted := n.mutableChild(i).upsert(key, fn, maxItems)
+	if inserted {
+		n.size++
+	}
+	n.rescore()
+	return inserted
+}
+
+// GetOrInsertは、itemと等しい項目が木にあればそれを変更せずに (その項目, true) を返し、なければitemを挿入して (item, false) を返します。
+func (t *BTree) GetOrInsert(item Item) (Item, bool) {
+	if item == nil {
+		panic("nil item being added to BTree")
+	}
+	return t.generic().GetOrInsert(item)
+}
+
+// Updateは、keyと等しい項目（見つからなければnil）を渡してfnを呼び、fnが (newItem, true) を返せばnewItemで置き換えるか挿入します。
+// 詳細はBTreeG.Updateを参照してください。
+func (t *BTree) Update(key Item, fn func(existing Item) (Item, bool)) {
+	t.generic().Update(key, func(existing Item, _ bool) (Item, bool) {
+		item, ok := fn(existing)
+		if ok && item == nil {
+			panic("nil item being added to BTree")
+		}
+		return item, ok
+	})
+}
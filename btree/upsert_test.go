@@ -0,0 +1,44 @@
+package btree
+
+import "testing"
+
+func TestGetOrInsert(t *testing.T) {
+	tr := New(3)
+	for i := 0; i < 50; i++ {
+		if _, ok := tr.GetOrInsert(Int(i)); ok {
+			t.Fatalf("GetOrInsert(%d) found an item in a tree without it", i)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		got, ok := tr.GetOrInsert(Int(i))
+		if !ok || got != Int(i) {
+			t.Fatalf("GetOrInsert(%d) = %v, %v, want %d, true", i, got, ok, i)
+		}
+	}
+	if tr.Len() != 50 {
+		t.Fatalf("Len() = %d, want 50", tr.Len())
+	}
+}
+
+func TestNilItemPanics(t *testing.T) {
+	for name, fn := range map[string]func(*BTree){
+		"ReplaceOrInsert": func(tr *BTree) { tr.ReplaceOrInsert(nil) },
+		"GetOrInsert":     func(tr *BTree) { tr.GetOrInsert(nil) },
+		"Update": func(tr *BTree) {
+			tr.Update(Int(1), func(Item) (Item, bool) { return nil, true })
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tr := New(3)
+			defer func() {
+				if recover() == nil {
+					t.Fatal("no panic for a nil item")
+				}
+				if tr.Len() != 0 {
+					t.Fatalf("Len() = %d after the panic, want 0", tr.Len())
+				}
+			}()
+			fn(tr)
+		})
+	}
+}
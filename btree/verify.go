@@ -0,0 +1,93 @@
+package btree
+
+// Verifyは、木全体を走査して構造上の不変条件（項目の順序、子の数が項目の数+1であること、ノードごとの項目数の上限と下限、
+// すべての葉の深さが同じであること、各ノードが記録しているサブツリーの項目数とスコア、木の項目数）を検査し、最初に見つかった違反を
+// ErrCorruptedを包んだエラーとして返します。汚染された木ではその原因のエラーを返します。時間は項目数に比例します。
+//
+// btreedebugビルドではすべての変更操作の後に同じ検査が行われますが、Verifyは通常のビルドでも、例えばファジングの各手順の後に呼べます。
+func (t *BTreeG[T]) Verify() error {
+	if t.poisoned {
+		return t.err
+	}
+	return t.checkInvariants()
+}
+
+// Verifyは、木の構造上の不変条件を検査します。詳細はBTreeG.Verifyを参照してください。
+func (t *BTree) Verify() error {
+	return t.generic().Verify()
+}
+
+// checkInvariantsは、木全体を走査して構造上の不変条件を検査し、最初に見つかった違反を返します。
+func (t *BTreeG[T]) checkInvariants() error {
+	if t.root == nil {
+		if t.length != 0 {
+			return corrupted("empty tree has length %d", t.length)
+		}
+		return nil
+	}
+	c := invariantChecker[T]{less: t.cow.less, minItems: t.minItems(), maxItems: t.maxItems(), leafDepth: -1, score: t.cow.score}
+	if err := c.check(t.root, 0, true); err != nil {
+		return err
+	}
+	if c.count != t.length {
+		return corrupted("length is %d but tree holds %d items", t.length, c.count)
+	}
+	return nil
+}
+
+// invariantCheckerは、走査中に見つけた情報（直前の項目、葉の深さ、項目数）を保持します。
+type invariantChecker[T any] struct {
+	less               LessFunc[T]
+	minItems, maxItems int
+	leafDepth          int
+	count              int
+	prev               optionalItem[T]
+	// scoreは、スコアを保持する木のOptionsG.Scoreです。nilでなければ各ノードのスコアの最小値と最大値も検査します。
+	score func(T) float64
+}
+
+func (c *invariantChecker[T]) check(n *node[T], depth int, isRoot bool) error {
+	start := c.count
+	if len(n.items) > c.maxItems {
+		return corrupted("node at depth %d has %d items, max is %d", depth, len(n.items), c.maxItems)
+	}
+	if !isRoot && len(n.items) < c.minItems {
+		return corrupted("node at depth %d has %d items, min is %d", depth, len(n.items), c.minItems)
+	}
+	if len(n.children) != 0 && len(n.children) != len(n.items)+1 {
+		return corrupted("node at depth %d has %d items and %d children", depth, len(n.items), len(n.children))
+	}
+	if len(n.children) == 0 {
+		if c.leafDepth < 0 {
+			c.leafDepth = depth
+		} else if c.leafDepth != depth {
+			return corrupted("leaf at depth %d, expected all leaves at depth %d", depth, c.leafDepth)
+		}
+	}
+	for i, item := range n.items {
+		if len(n.children) > 0 {
+			if err := c.check(n.children[i], depth+1, false); err != nil {
+				return err
+			}
+		}
+		if c.prev.valid && !c.less(c.prev.item, item) {
+			return corrupted("item %v at depth %d is not greater than preceding item %v", item, depth, c.prev.item)
+		}
+		c.prev = optional(item)
+		c.count++
+	}
+	if len(n.children) > 0 {
+		if err := c.check(n.children[len(n.children)-1], depth+1, false); err != nil {
+			return err
+		}
+	}
+	if n.size != c.count-start {
+		return corrupted("node at depth %d records %d items in its subtree but holds %d", depth, n.size, c.count-start)
+	}
+	if c.score != nil {
+		if lo, hi := n.scores(c.score); lo != n.minScore || hi != n.maxScore {
+			return corrupted("node at depth %d records scores [%v, %v] but holds [%v, %v]", depth, n.minScore, n.maxScore, lo, hi)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package wal
+
+import "errors"
+
+// ErrBackpressureは、Backpressureの水位を超えているためにSetを拒否したことを示します。
+var ErrBackpressure = errors.New("wal: backpressure")
+
+type (
+	// Watermarkは、1つの量（バイト）についての上限と下限です。Highが0の場合はその量を制限しません。
+	Watermark struct {
+		// Highは、量がこれ以上になるとバックプレッシャーを始める値です。
+		High int64
+		// Lowは、バックプレッシャーを解くために量が下がらなければならない値です。0の場合はHighの半分です。
+		Low int64
+	}
+
+	// Backpressureは、ログやデータが大きくなりすぎたときに書き込みを止める水位の設定です。ゼロ値では止めません。
+	//
+	// どれかの量がHigh以上になるとバックプレッシャーが始まり、SetはErrBackpressureを返します。すべての量がLow以下に戻ると解けます。
+	// 埋め込むアプリケーションは、メモリを使い果たす前にこのエラーで負荷を断れます。Deleteはデータを減らす手段なので、バックプレッシャー中も行えます。
+	Backpressure struct {
+		// Logは、ログファイルの大きさです。Checkpointで0に戻ります。
+		Log Watermark
+		// Unsyncedは、まだfsyncしていないログのバイト数です。SyncやSyncIntervalのfsyncで0に戻ります。
+		Unsynced Watermark
+		// Dataは、木に入っているキーと値のバイト数の合計です。メモリの使用量の目安で、Deleteで減ります。
+		Data Watermark
+		// Blockがtrueの場合、SetはErrBackpressureを返す代わりに、バックプレッシャーが解けるまで待ちます。
+		// LogとUnsyncedを下げるCheckpointやSyncは、別のゴルーチンから呼ぶ必要があります（SyncIntervalのfsyncでもUnsyncedは下がります）。
+		// Dataは書き込みを待っている間は下がらないので、DataがLowを超えている間はBlockでもErrBackpressureを返します。
+		Block bool
+		// OnChangeは、バックプレッシャーが始まったとき（activeがtrue）と解けたとき（false）に、そのときの使用量とともに呼ばれます。
+		// ストアのロックを外してから呼びます。
+		OnChange func(active bool, u Usage)
+	}
+
+	// Usageは、Backpressureの対象となる量と、バックプレッシャーの統計です。
+	Usage struct {
+		// LogBytesは、ログファイルの大きさです。
+		LogBytes int64
+		// UnsyncedBytesは、まだfsyncしていないログのバイト数です。
+		UnsyncedBytes int64
+		// DataBytesは、木に入っているキーと値のバイト数の合計です。
+		DataBytes int64
+		// Activeは、バックプレッシャー中かどうかです。
+		Active bool
+		// Rejectedは、ErrBackpressureを返したSetの数です。
+		Rejected uint64
+		// Blockedは、Blockでバックプレッシャーが解けるのを待ったSetの数です。
+		Blocked uint64
+	}
+)
+
+func (w Watermark) over(v int64) bool {
+	return w.High > 0 && v >= w.High
+}
+
+func (w Watermark) under(v int64) bool {
+	if w.High <= 0 {
+		return true
+	}
+	if w.Low == 0 {
+		return v <= w.High/2
+	}
+	return v <= w.Low
+}
+
+// Usageは、現在の使用量とバックプレッシャーの統計を返します。
+func (s *Store) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usageLocked()
+}
+
+func (s *Store) usageLocked() Usage {
+	return Usage{
+		LogBytes:      s.logBytes,
+		UnsyncedBytes: s.unsynced,
+		DataBytes:     s.data,
+		Active:        s.active,
+		Rejected:      s.rejected,
+		Blocked:       s.blocked,
+	}
+}
+
+// unlockは、使用量に応じてバックプレッシャーを始めるか解いてからs.muを外し、状態が変わっていればOnChangeを呼びます。
+func (s *Store) unlock() {
+	bp := s.opts.Backpressure
+	changed := false
+	switch {
+	case !s.active && (bp.Log.over(s.logBytes) || bp.Unsynced.over(s.unsynced) || bp.Data.over(s.data)):
+		s.active, changed = true, true
+	case s.active && bp.Log.under(s.logBytes) && bp.Unsynced.under(s.unsynced) && bp.Data.under(s.data):
+		s.active, changed = false, true
+		s.cond.Broadcast()
+	}
+	u := s.usageLocked()
+	s.mu.Unlock()
+	if changed && bp.OnChange != nil {
+		bp.OnChange(u.Active, u)
+	}
+}
+
+// admitLockedは、バックプレッシャー中であれば、Blockの場合は解けるまで待ち、そうでなければErrBackpressureを返します。s.muを保持して呼ぶ必要があります。
+func (s *Store) admitLocked() error {
+	waited := false
+	for s.active {
+		bp := s.opts.Backpressure
+		if !bp.Block || !bp.Data.under(s.data) {
+			s.rejected++
+			return ErrBackpressure
+		}
+		if !waited {
+			s.blocked++
+			waited = true
+		}
+		s.cond.Wait()
+		if err := s.checkLocked(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
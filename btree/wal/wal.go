@@ -0,0 +1,642 @@
+// Package walは、btree.OrderedKVに先行書き込みログ（WAL）を付けて、プロセスがクラッシュしても書き込みを失わないキー・バリューストアを提供します。
+//
+// SetとDeleteは、まずディレクトリ内のログファイルにCRC32付きのレコードを追記してから、メモリ上の木に反映します。
+// Openはスナップショットファイルを読み込んでからログを先頭から再生して木を復元し、Checkpointは現在の内容をスナップショットに書き出してログを空にします。
+// Options.CheckpointBytesを設定すると、ログがその大きさになるたびに自動でCheckpointするので、ログと再生の時間に上限ができます。
+// ログの末尾の書きかけのレコード（CRCが合わない、または途中で切れているもの）は、クラッシュで失われた書き込みとみなして切り捨てます。
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+const (
+	// logFileは、ディレクトリ内のログファイルの名前です。
+	logFile = "wal.log"
+	// snapshotFileは、ディレクトリ内のスナップショットファイルの名前です。
+	snapshotFile = "snapshot"
+	// snapshotMagicは、スナップショットファイルの先頭の識別子です。
+	snapshotMagic = "kvsnap01"
+	// DefaultDegreeは、Options.Degreeが0の場合の木のdegreeです。
+	DefaultDegree = 32
+	// DefaultSyncIntervalは、SyncIntervalでOptions.Intervalが0の場合にfsyncする間隔です。
+	DefaultSyncInterval = time.Second
+	// maxRecordSizeは、1レコードの大きさの上限です。壊れたファイルで巨大な割り当てをしないために使われます。
+	maxRecordSize = 1 << 30
+)
+
+// レコードの種類です。
+const (
+	opSet    = 1
+	opDelete = 2
+	opEnd    = 3 // スナップショットの終わり。キーにレコード数を持つ
+)
+
+// SyncPolicyは、ログをいつfsyncするかを表します。
+type SyncPolicy int
+
+const (
+	// SyncAlwaysは、SetとDeleteのたびにfsyncします。戻った書き込みはクラッシュしても失われません。
+	SyncAlways SyncPolicy = iota
+	// SyncIntervalは、書き込みがあった場合にOptions.Intervalごとにfsyncします。クラッシュすると最後の間隔の書き込みを失うことがあります。
+	SyncInterval
+	// SyncNeverは、SyncとCloseとCheckpointのときにだけfsyncします。
+	SyncNever
+)
+
+type (
+	// Optionsは、Openでストアを開く際の設定です。ゼロ値は、DefaultDegreeの木とSyncAlwaysになります。
+	Options struct {
+		// Degreeは、メモリ上の木のdegreeです。
+		Degree int
+		// Syncは、ログをfsyncする方針です。
+		Sync SyncPolicy
+		// Intervalは、SyncIntervalでfsyncする間隔です。0の場合はDefaultSyncIntervalになります。
+		Interval time.Duration
+		// Backpressureは、ログやデータが大きくなりすぎたときにSetを止める水位です。ゼロ値では止めません。
+		Backpressure Backpressure
+		// CheckpointBytesは、ログがこのバイト数以上になったときに、SetやDeleteの後で自動的にCheckpointする大きさです。
+		// 0の場合は自動ではCheckpointしないので、Checkpointを呼ばない限りログは大きくなり続け、Openでの再生も長くなります。
+		CheckpointBytes int64
+	}
+
+	// Patchは、Configureで開いているストアに適用する設定の変更です。nilのフィールドは現在の値のまま変更しません。
+	// Degreeのように開いた後は変えられない設定は、Patchには含まれません。
+	Patch struct {
+		// Syncは、ログをfsyncする新しい方針です。
+		Sync *SyncPolicy
+		// Intervalは、SyncIntervalでfsyncする新しい間隔です。0の場合はDefaultSyncIntervalになります。
+		Interval *time.Duration
+		// Backpressureは、新しい水位です。OnChangeとBlockを含めて全体を置き換えます。
+		Backpressure *Backpressure
+		// CheckpointBytesは、自動でCheckpointするログの新しい大きさです。0の場合は自動ではCheckpointしません。
+		CheckpointBytes *int64
+	}
+
+	// CheckpointStatsは、Checkpointの統計です。
+	CheckpointStats struct {
+		// Countは、成功したCheckpointの数です。自動で行ったものを含みます。
+		Count uint64
+		// Autoは、Countのうち、CheckpointBytesによって自動で行ったものの数です。
+		Auto uint64
+		// Lastは、最後に成功したCheckpointにかかった時間です。
+		Last time.Duration
+		// Maxは、成功したCheckpointにかかった時間の最大値です。
+		Max time.Duration
+		// Totalは、成功したCheckpointにかかった時間の合計です。
+		Total time.Duration
+		// Errは、最後の自動のCheckpointが失敗した場合のエラーです。次にCheckpointが成功すればnilに戻ります。
+		Err error
+	}
+
+	// Storeは、WALで永続化されるOrderedKVです。読み取りはメモリ上の木に対して行われます。
+	// OrderedKVと同じく、書き込み操作を複数のゴルーチンから同時に呼んではいけません。
+	// ログへの書き込みに失敗すると、ストアはそのエラーを記録し、以降の書き込みはすべてそのエラーを返します。
+	Store struct {
+		kv *btree.OrderedKV
+
+		mu     sync.Mutex // ログファイルとdirtyと使用量を、定期的にfsyncするゴルーチンから守る
+		cond   *sync.Cond // バックプレッシャーが解けるのを待つ。Lはmu
+		dir    string
+		opts   Options
+		log    *os.File
+		buf    []byte
+		dirty  bool // 最後のfsync以降にログに書き込んだ
+		err    error
+		closed bool
+		done   chan struct{}
+		stop   chan struct{} // 動いているloopを止める。SyncIntervalでない場合はnil
+		wg     sync.WaitGroup
+
+		// 以下は、Backpressureの対象となる使用量と統計。
+		logBytes int64
+		unsynced int64
+		data     int64
+		active   bool
+		rejected uint64
+		blocked  uint64
+
+		checkpoints CheckpointStats
+	}
+)
+
+// Openは、ディレクトリdirのストアを開きます（存在しなければ作成します）。スナップショットを読み込んでからログを再生して内容を復元します。
+// SyncIntervalの場合はfsyncするゴルーチンを起動するので、使い終わったら必ずCloseを呼んでください。
+func Open(dir string, opts Options) (*Store, error) {
+	if opts.Degree == 0 {
+		opts.Degree = DefaultDegree
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultSyncInterval
+	}
+	if opts.CheckpointBytes < 0 {
+		return nil, fmt.Errorf("wal: bad checkpoint size %d", opts.CheckpointBytes)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{kv: btree.NewOrderedKV(opts.Degree), dir: dir, opts: opts, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	if err := s.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("wal: %s: %w", snapshotFile, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replay(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("wal: %s: %w", logFile, err)
+	}
+	s.log = f
+	if s.logBytes, err = f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.kv.Ascend(func(key, value []byte) bool {
+		s.data += int64(len(key) + len(value))
+		return true
+	})
+	if opts.Sync == SyncInterval {
+		s.startLoop()
+	}
+	return s, nil
+}
+
+// loadSnapshotは、スナップショットファイルがあれば読み込みます。スナップショットは書き終えてから置き換えるので、壊れていればErrCorruptedを包んだエラーを返します。
+func (s *Store) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != snapshotMagic {
+		return corrupted("not a snapshot file")
+	}
+	count := 0
+	for {
+		op, key, value, _, err := readRecord(r)
+		if err != nil {
+			return corrupted("record %d: %v", count, err)
+		}
+		switch op {
+		case opSet:
+			s.kv.Set(key, value)
+			count++
+		case opEnd:
+			if n, k := binary.Uvarint(key); k <= 0 || n != uint64(count) {
+				return corrupted("snapshot ends after %d records, want %d", count, n)
+			}
+			return nil
+		default:
+			return corrupted("record %d has bad kind %d", count, op)
+		}
+	}
+}
+
+// replayは、ログを先頭から再生します。書きかけのレコードが見つかった場合は、そこでログを切り詰めます。
+func (s *Store) replay(f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var off int64
+	for {
+		op, key, value, n, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			switch op {
+			case opSet:
+				s.kv.Set(key, value)
+			case opDelete:
+				s.kv.Delete(key)
+			default:
+				err = fmt.Errorf("bad record kind %d", op)
+			}
+		}
+		if err != nil {
+			// 書きかけのレコードとそれ以降を捨てる。
+			if err := f.Truncate(off); err != nil {
+				return err
+			}
+			return f.Sync()
+		}
+		off += n
+	}
+}
+
+// startLoopは、現在のIntervalでloopを起動します。Open以外ではs.muを保持して呼ぶ必要があります。
+func (s *Store) startLoop() {
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.loop(s.stop, s.opts.Interval)
+}
+
+// loopは、SyncIntervalの場合に、書き込みがあればinterval間隔でログをfsyncします。stopかs.doneが閉じられると終わります。
+func (s *Store) loop(stop chan struct{}, interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.err == nil && !s.closed {
+				s.syncLocked()
+			}
+			s.unlock()
+		}
+	}
+}
+
+// Getは、keyの値を返します。keyがない場合は (nil, false) を返します。返された値を変更してはいけません。
+func (s *Store) Get(key []byte) ([]byte, bool) {
+	return s.kv.Get(key)
+}
+
+// Hasは、keyがあればtrueを返します。
+func (s *Store) Has(key []byte) bool {
+	return s.kv.Has(key)
+}
+
+// Lenは、キーの数を返します。
+func (s *Store) Len() int {
+	return s.kv.Len()
+}
+
+// Ascendは、すべてのキーと値の組について、キーの昇順にiteratorを呼び出します。
+func (s *Store) Ascend(iterator btree.KVIterator) {
+	s.kv.Ascend(iterator)
+}
+
+// Descendは、すべてのキーと値の組について、キーの降順にiteratorを呼び出します。
+func (s *Store) Descend(iterator btree.KVIterator) {
+	s.kv.Descend(iterator)
+}
+
+// Rangeは、[start, end) の範囲のキーと値の組について、キーの昇順にiteratorを呼び出します。nilの境界は「境界なし」を意味します。
+func (s *Store) Range(start, end []byte, iterator btree.KVIterator) {
+	s.kv.Range(start, end, iterator)
+}
+
+// ScanPrefixは、prefixで始まるキーと値の組について、キーの昇順にiteratorを呼び出します。
+func (s *Store) ScanPrefix(prefix []byte, iterator btree.KVIterator) {
+	s.kv.ScanPrefix(prefix, iterator)
+}
+
+// Setは、keyの値をvalueにします。レコードをログに書いてから木に反映します。
+// Options.Backpressureの水位を超えている場合は、ErrBackpressureを返すか、Blockであれば水位が下がるまで待ちます。
+func (s *Store) Set(key, value []byte) error {
+	delta := int64(len(key) + len(value))
+	if old, ok := s.kv.Get(key); ok {
+		delta -= int64(len(key) + len(old))
+	}
+	if err := s.append(opSet, key, value, delta); err != nil {
+		return err
+	}
+	s.kv.Set(key, value)
+	s.maybeCheckpoint()
+	return nil
+}
+
+// Deleteは、keyを削除し、削除した場合はtrueを返します。keyがない場合はログに何も書きません。
+func (s *Store) Delete(key []byte) (bool, error) {
+	old, ok := s.kv.Get(key)
+	if !ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return false, s.checkLocked()
+	}
+	if err := s.append(opDelete, key, nil, -int64(len(key)+len(old))); err != nil {
+		return false, err
+	}
+	ok = s.kv.Delete(key)
+	s.maybeCheckpoint()
+	return ok, nil
+}
+
+// appendは、1レコードをログに追記し、SyncAlwaysであればfsyncします。deltaは、この書き込みによるキーと値のバイト数の増減です。
+func (s *Store) append(op byte, key, value []byte, delta int64) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.checkLocked(); err != nil {
+		return err
+	}
+	if op == opSet {
+		if err := s.admitLocked(); err != nil {
+			return err
+		}
+	}
+	s.buf = appendRecord(s.buf[:0], op, key, value)
+	if _, err := s.log.Write(s.buf); err != nil {
+		return s.fail(err)
+	}
+	s.dirty = true
+	s.logBytes += int64(len(s.buf))
+	s.unsynced += int64(len(s.buf))
+	s.data += delta
+	if s.opts.Sync == SyncAlways {
+		return s.syncLocked()
+	}
+	return nil
+}
+
+// checkLockedは、ストアが閉じられているか失敗していればそのエラーを返します。
+func (s *Store) checkLocked() error {
+	if s.closed {
+		return btree.ErrClosed
+	}
+	return s.err
+}
+
+// failは、ログへの書き込みの失敗を記録して返します。
+func (s *Store) fail(err error) error {
+	s.err = fmt.Errorf("wal: %w", err)
+	return s.err
+}
+
+func (s *Store) syncLocked() error {
+	if err := s.log.Sync(); err != nil {
+		return s.fail(err)
+	}
+	s.dirty = false
+	s.unsynced = 0
+	return nil
+}
+
+// Configureは、開いているストアにpatchの設定を適用します。nilのフィールドは変更しません。
+// SyncとIntervalは次の書き込みから新しい方針でfsyncし、SyncAlwaysに変えた場合はまだfsyncしていない書き込みをすぐにfsyncします。
+// Backpressureを変えた場合は、新しい水位ですぐにバックプレッシャーを始めるか解きます。CheckpointBytesは次の書き込みから使います。
+// IntervalかCheckpointBytesが負の場合はエラーを返し、何も変更しません。
+func (s *Store) Configure(patch Patch) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.checkLocked(); err != nil {
+		return err
+	}
+	opts := s.opts
+	if patch.Sync != nil {
+		opts.Sync = *patch.Sync
+	}
+	if patch.Interval != nil {
+		if *patch.Interval < 0 {
+			return fmt.Errorf("wal: bad sync interval %v", *patch.Interval)
+		}
+		opts.Interval = *patch.Interval
+		if opts.Interval == 0 {
+			opts.Interval = DefaultSyncInterval
+		}
+	}
+	if patch.Backpressure != nil {
+		opts.Backpressure = *patch.Backpressure
+	}
+	if patch.CheckpointBytes != nil {
+		if *patch.CheckpointBytes < 0 {
+			return fmt.Errorf("wal: bad checkpoint size %d", *patch.CheckpointBytes)
+		}
+		opts.CheckpointBytes = *patch.CheckpointBytes
+	}
+	old := s.opts
+	s.opts = opts
+	if old.Sync == SyncInterval && (opts.Sync != SyncInterval || opts.Interval != old.Interval) {
+		close(s.stop)
+		s.stop = nil
+	}
+	if opts.Sync == SyncInterval && s.stop == nil {
+		s.startLoop()
+	}
+	if opts.Sync == SyncAlways && s.dirty {
+		return s.syncLocked()
+	}
+	return nil
+}
+
+// Errは、ログへの書き込みに失敗していればそのエラーを返します。
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Syncは、ログをfsyncします。
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.checkLocked(); err != nil {
+		return err
+	}
+	return s.syncLocked()
+}
+
+// Checkpointは、現在の内容をスナップショットファイルに書き出し、ログを空にします。
+// スナップショットは一時ファイルに書いてfsyncしてから名前を変えて置き換えるので、途中でクラッシュしても古いスナップショットとログから復元できます。
+func (s *Store) Checkpoint() error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.checkLocked(); err != nil {
+		return err
+	}
+	return s.checkpointLocked()
+}
+
+// maybeCheckpointは、ログがOptions.CheckpointBytes以上になっていればCheckpointします。
+// 書き込み自体はログに記録済みなので、スナップショットの書き出しに失敗しても書き込みの失敗にはせず、CheckpointStats.Errに記録して次の書き込みでやり直します。
+func (s *Store) maybeCheckpoint() {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.opts.CheckpointBytes <= 0 || s.logBytes < s.opts.CheckpointBytes || s.checkLocked() != nil {
+		return
+	}
+	if err := s.checkpointLocked(); err != nil {
+		s.checkpoints.Err = err
+		return
+	}
+	s.checkpoints.Auto++
+}
+
+// checkpointLockedは、スナップショットを書き出してログを空にし、かかった時間を統計に加えます。s.muを保持して呼ぶ必要があります。
+func (s *Store) checkpointLocked() error {
+	start := time.Now()
+	if err := s.writeSnapshot(); err != nil {
+		return fmt.Errorf("wal: checkpoint: %w", err)
+	}
+	// スナップショットに含まれたので、ログのレコードはもう要らない。
+	if err := s.log.Truncate(0); err != nil {
+		return s.fail(err)
+	}
+	s.logBytes = 0
+	if err := s.syncLocked(); err != nil {
+		return err
+	}
+	d := time.Since(start)
+	c := &s.checkpoints
+	c.Count++
+	c.Err = nil
+	c.Last = d
+	c.Total += d
+	if d > c.Max {
+		c.Max = d
+	}
+	return nil
+}
+
+// CheckpointStatsは、Checkpointの回数とかかった時間の統計を返します。
+func (s *Store) CheckpointStats() CheckpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoints
+}
+
+func (s *Store) writeSnapshot() (err error) {
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	w.WriteString(snapshotMagic)
+	var buf []byte
+	count := 0
+	s.kv.Ascend(func(key, value []byte) bool {
+		buf = appendRecord(buf[:0], opSet, key, value)
+		_, err = w.Write(buf)
+		count++
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	buf = appendRecord(buf[:0], opEnd, binary.AppendUvarint(nil, uint64(count)), nil)
+	if _, err = w.Write(buf); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// syncDirは、ディレクトリをfsyncして、ファイルの作成や名前の変更を永続化します。
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Closeは、ログをfsyncしてファイルを閉じます。閉じた後のストアの書き込みはErrClosedを返します。
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return btree.ErrClosed
+	}
+	var err error
+	if s.err == nil {
+		err = s.syncLocked()
+	}
+	s.closed = true
+	close(s.done)
+	s.cond.Broadcast() // バックプレッシャーで待っているSetにErrClosedを返させる
+	s.mu.Unlock()
+	s.wg.Wait()
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// レコードの形式は、本体のCRC32（4バイト）、本体の長さ（4バイト）、本体（種類1バイト、uvarintのキーの長さ、キー、値）です。
+
+// appendRecordは、1レコードを符号化してbufに追加します。
+func appendRecord(buf []byte, op byte, key, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, 8)...)
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	body := buf[start+8:]
+	binary.LittleEndian.PutUint32(buf[start:], crc32.ChecksumIEEE(body))
+	binary.LittleEndian.PutUint32(buf[start+4:], uint32(len(body)))
+	return buf
+}
+
+// readRecordは、1レコードを読み、その種類、キー、値と、レコード全体のバイト数を返します。
+// レコードの前でファイルが終わっている場合はio.EOFを、途中で切れているか壊れている場合はそれ以外のエラーを返します。
+func readRecord(r *bufio.Reader) (op byte, key, value []byte, n int64, err error) {
+	var head [8]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("truncated record header")
+		}
+		return
+	}
+	size := binary.LittleEndian.Uint32(head[4:])
+	if size == 0 || size > maxRecordSize {
+		err = fmt.Errorf("bad record size %d", size)
+		return
+	}
+	body := make([]byte, size)
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = errors.New("truncated record")
+		return
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(head[:4]) {
+		err = errors.New("checksum mismatch")
+		return
+	}
+	klen, k := binary.Uvarint(body[1:])
+	if k <= 0 || klen > uint64(len(body)-1-k) {
+		err = errors.New("bad key length")
+		return
+	}
+	op = body[0]
+	key = body[1+k : 1+k+int(klen)]
+	value = body[1+k+int(klen):]
+	return op, key, value, int64(8 + size), nil
+}
+
+// corruptedは、スナップショットの破損をCorruptionErrorとして返します。
+func corrupted(format string, args ...interface{}) error {
+	return &btree.CorruptionError{Page: -1, Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,437 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// openTestは、dirのストアを開きます。
+func openTest(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(dir, Options{Degree: 3, Sync: SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// verifyは、ストアの内容がモデルと一致することを確かめます。
+func verify(t *testing.T, s *Store, model map[string]string) {
+	t.Helper()
+	if s.Len() != len(model) {
+		t.Fatalf("store has %d keys, model has %d", s.Len(), len(model))
+	}
+	var prev []byte
+	s.Ascend(func(key, value []byte) bool {
+		if prev != nil && string(prev) >= string(key) {
+			t.Fatalf("keys out of order: %q then %q", prev, key)
+		}
+		prev = key
+		if want, ok := model[string(key)]; !ok || want != string(value) {
+			t.Fatalf("key %q = %q, model has %q (present %v)", key, value, want, ok)
+		}
+		return true
+	})
+}
+
+func TestStoreMatchesMap(t *testing.T) {
+	dir := t.TempDir()
+	s := openTest(t, dir)
+	model := map[string]string{}
+	r := rand.New(rand.NewSource(1))
+	for step := 0; step < 5000; step++ {
+		key := fmt.Sprintf("k%03d", r.Intn(300))
+		switch op := r.Intn(10); {
+		case op < 6:
+			value := fmt.Sprint(step)
+			if err := s.Set([]byte(key), []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			model[key] = value
+		case op < 9:
+			_, had := model[key]
+			ok, err := s.Delete([]byte(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != had {
+				t.Fatalf("step %d: Delete(%q) = %v, want %v", step, key, ok, had)
+			}
+			delete(model, key)
+		default:
+			if err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if step%500 == 499 {
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = openTest(t, dir)
+			verify(t, s, model)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set([]byte("a"), nil); !errors.Is(err, btree.ErrClosed) {
+		t.Fatalf("Set after Close = %v, want ErrClosed", err)
+	}
+}
+
+// TestReplayTornTailは、ログの最後のレコードが途中で切れているか壊れている場合に、
+// Openがそのレコードだけを捨て、ログを切り詰めて続きを書けることを確かめます。
+func TestReplayTornTail(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// tearは、最後のレコードがlast（バイト数）から始まる長さsizeのログファイルを壊します。
+		tear func(t *testing.T, path string, last, size int64)
+	}{
+		{"truncated header", func(t *testing.T, path string, last, size int64) {
+			truncate(t, path, last+3)
+		}},
+		{"truncated body", func(t *testing.T, path string, last, size int64) {
+			truncate(t, path, size-1)
+		}},
+		{"bad checksum", func(t *testing.T, path string, last, size int64) {
+			flipByte(t, path, size-1)
+		}},
+		{"bad size", func(t *testing.T, path string, last, size int64) {
+			flipByte(t, path, last+7)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openTest(t, dir)
+			model := map[string]string{}
+			for i := 0; i < 20; i++ {
+				key, value := fmt.Sprintf("k%02d", i), fmt.Sprint(i)
+				if err := s.Set([]byte(key), []byte(value)); err != nil {
+					t.Fatal(err)
+				}
+				model[key] = value
+			}
+			path := filepath.Join(dir, logFile)
+			last := fileSize(t, path)
+			if err := s.Set([]byte("torn"), []byte("lost")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tc.tear(t, path, last, fileSize(t, path))
+
+			s = openTest(t, dir)
+			verify(t, s, model)
+			if size := fileSize(t, path); size != last {
+				t.Fatalf("log is %d bytes after replay, want it truncated to %d", size, last)
+			}
+			// 切り詰めた後に追記したレコードも、次に開いたときに読める。
+			if err := s.Set([]byte("after"), []byte("ok")); err != nil {
+				t.Fatal(err)
+			}
+			model["after"] = "ok"
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = openTest(t, dir)
+			defer s.Close()
+			verify(t, s, model)
+		})
+	}
+}
+
+// TestReopenAfterCrashは、SyncAlwaysのストアをCloseせずに捨てても、戻った書き込みがすべて復元されることを確かめます。
+func TestReopenAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{Degree: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[string]string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%02d", i%40)
+		if i%3 == 2 {
+			if _, err := s.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			delete(model, key)
+			continue
+		}
+		if err := s.Set([]byte(key), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+		model[key] = fmt.Sprint(i)
+		if i == 50 {
+			if err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Closeせずにファイルだけを閉じ、プロセスが落ちた状態にする。
+	s.log.Close()
+
+	s = openTest(t, dir)
+	defer s.Close()
+	verify(t, s, model)
+}
+
+func TestCorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openTest(t, dir)
+	for i := 0; i < 10; i++ {
+		if err := s.Set([]byte(fmt.Sprint(i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if size := fileSize(t, filepath.Join(dir, logFile)); size != 0 {
+		t.Fatalf("log is %d bytes after Checkpoint, want 0", size)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// スナップショットは書き終えてから置き換えるので、書きかけのログと違い、壊れていれば開けない。
+	path := filepath.Join(dir, snapshotFile)
+	flipByte(t, path, fileSize(t, path)-1)
+	if _, err := Open(dir, Options{}); !errors.Is(err, btree.ErrCorrupted) {
+		t.Fatalf("Open with a corrupt snapshot = %v, want ErrCorrupted", err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func truncate(t *testing.T, path string, size int64) {
+	t.Helper()
+	if err := os.Truncate(path, size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flipByteは、ファイルのoff番目のバイトを反転させます。
+func flipByte(t *testing.T, path string, off int64) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[off] ^= 0xff
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openConfiguredは、SyncIntervalとBackpressureを設定したストアを開きます。changesはOnChangeが呼ばれた回数です。
+func openConfigured(t *testing.T) (s *Store, changes *int) {
+	t.Helper()
+	changes = new(int)
+	s, err := Open(t.TempDir(), Options{
+		Degree:       3,
+		Sync:         SyncInterval,
+		Interval:     time.Hour,
+		Backpressure: Backpressure{Data: Watermark{High: 1 << 20}, OnChange: func(bool, Usage) { *changes++ }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, changes
+}
+
+// checkOptionsは、Degree、Sync、IntervalとBackpressureの水位が期待どおりで、OnChangeが残っていることを確かめます。
+func checkOptions(t *testing.T, s *Store, sync SyncPolicy, interval time.Duration, high int64) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.opts
+	if o.Degree != 3 || o.Sync != sync || o.Interval != interval || o.Backpressure.Data.High != high || o.Backpressure.OnChange == nil {
+		t.Fatalf("options are %+v, want Sync %v, Interval %v and Data.High %d", o, sync, interval, high)
+	}
+	if running := s.stop != nil; running != (sync == SyncInterval) {
+		t.Fatalf("sync loop running = %v with Sync %v", running, sync)
+	}
+}
+
+func TestConfigureSync(t *testing.T) {
+	s, _ := openConfigured(t)
+	never := SyncNever
+	if err := s.Configure(Patch{Sync: &never}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncNever, time.Hour, 1<<20)
+	if err := s.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	// SyncAlwaysに変えると、まだfsyncしていない書き込みをすぐにfsyncする。
+	always := SyncAlways
+	if err := s.Configure(Patch{Sync: &always}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncAlways, time.Hour, 1<<20)
+	if u := s.Usage(); u.UnsyncedBytes != 0 {
+		t.Fatalf("%d bytes unsynced after switching to SyncAlways", u.UnsyncedBytes)
+	}
+	interval := SyncInterval
+	if err := s.Configure(Patch{Sync: &interval}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncInterval, time.Hour, 1<<20)
+}
+
+func TestConfigureInterval(t *testing.T) {
+	s, _ := openConfigured(t)
+	d := time.Minute
+	if err := s.Configure(Patch{Interval: &d}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncInterval, time.Minute, 1<<20)
+	d = 0
+	if err := s.Configure(Patch{Interval: &d}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncInterval, DefaultSyncInterval, 1<<20)
+	d = -time.Second
+	if err := s.Configure(Patch{Interval: &d}); err == nil {
+		t.Fatal("Configure accepted a negative Interval")
+	}
+	checkOptions(t, s, SyncInterval, DefaultSyncInterval, 1<<20)
+}
+
+func TestConfigureBackpressure(t *testing.T) {
+	s, changes := openConfigured(t)
+	if err := s.Set([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	bp := s.opts.Backpressure
+	bp.Data.High = 4
+	if err := s.Configure(Patch{Backpressure: &bp}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncInterval, time.Hour, 4)
+	// 新しい水位はすぐに適用される。
+	if u := s.Usage(); !u.Active || *changes != 1 {
+		t.Fatalf("after lowering Data.High: Active=%v, OnChange called %d times", u.Active, *changes)
+	}
+	if err := s.Set([]byte("more"), nil); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("Set over the new watermark = %v, want ErrBackpressure", err)
+	}
+	if err := s.Configure(Patch{}); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(t, s, SyncInterval, time.Hour, 4)
+}
+
+func TestAutoCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{Degree: 3, Sync: SyncNever, CheckpointBytes: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[string]string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("k%02d", i%30)
+		if i%4 == 3 {
+			if _, err := s.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			delete(model, key)
+			continue
+		}
+		if err := s.Set([]byte(key), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+		model[key] = fmt.Sprint(i)
+		// 1レコードは200バイトよりずっと小さいので、書き込みの後のログはしきい値を超えない。
+		if u := s.Usage(); u.LogBytes >= 200 {
+			t.Fatalf("write %d: log is %d bytes, want it checkpointed below 200", i, u.LogBytes)
+		}
+	}
+	st := s.CheckpointStats()
+	if st.Auto == 0 || st.Count != st.Auto || st.Err != nil || st.Last <= 0 || st.Max < st.Last || st.Total < st.Max {
+		t.Fatalf("stats after automatic checkpoints: %+v", st)
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.CheckpointStats(); got.Count != st.Count+1 || got.Auto != st.Auto {
+		t.Fatalf("a manual Checkpoint changed the stats from %+v to %+v", st, got)
+	}
+	// 0にすると、自動ではCheckpointしない。
+	zero := int64(0)
+	if err := s.Configure(Patch{CheckpointBytes: &zero}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := s.Set([]byte("big"), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	model["big"] = "49"
+	if u := s.Usage(); u.LogBytes < 200 {
+		t.Fatalf("log is %d bytes with automatic checkpoints off", u.LogBytes)
+	}
+	negative := int64(-1)
+	if err := s.Configure(Patch{CheckpointBytes: &negative}); err == nil {
+		t.Fatal("Configure accepted a negative CheckpointBytes")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = openTest(t, dir)
+	defer s.Close()
+	verify(t, s, model)
+}
+
+// TestAutoCheckpointFailureは、自動のCheckpointが失敗しても書き込みは成功し、エラーを統計に記録して次の書き込みでやり直すことを確かめます。
+func TestAutoCheckpointFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{Degree: 3, Sync: SyncNever, CheckpointBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// 一時ファイルの名前でディレクトリを作り、スナップショットを書けなくする。
+	tmp := filepath.Join(dir, snapshotFile+".tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := s.Set([]byte(fmt.Sprint(i)), []byte("value")); err != nil {
+			t.Fatalf("Set with a failing checkpoint = %v", err)
+		}
+	}
+	if st := s.CheckpointStats(); st.Err == nil || st.Count != 0 || s.Usage().LogBytes < 100 {
+		t.Fatalf("after failed checkpoints: %+v, log %d bytes", st, s.Usage().LogBytes)
+	}
+	if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set([]byte("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.CheckpointStats(); st.Err != nil || st.Auto != 1 || s.Usage().LogBytes != 0 {
+		t.Fatalf("after a successful retry: %+v, log %d bytes", st, s.Usage().LogBytes)
+	}
+}
+
+func TestOpenBadCheckpointBytes(t *testing.T) {
+	if _, err := Open(t.TempDir(), Options{CheckpointBytes: -1}); err == nil {
+		t.Fatal("Open accepted a negative CheckpointBytes")
+	}
+}
@@ -0,0 +1,166 @@
+package btree
+
+// DefaultWeakSnapshotLagは、WeakSnapshotGが古くなったとみなす、元の木の変更の回数の既定値です。
+const DefaultWeakSnapshotLag = 1024
+
+type (
+	// WeakSnapshotGは、元の木のCloneを読み取りに使い、元の木が一定の回数以上変更されたら取り直すスナップショットです。
+	//
+	// Cloneは、元の木が書き換えたノードの古い版を持ち続けるので、Cloneを長く保持するほど、元の木との差分の分だけメモリが増えます。
+	// WeakSnapshotGは、元の木の変更の回数（遅れ）がしきい値を超えると、次の読み取りの前に古いCloneを捨てて取り直すので、保持するメモリに上限ができます。
+	// 自動の取り直しを止めた場合は、読み取りは古いCloneのまま続き、Staleで古くなったことが分かります。
+	// 少しの遅れは許せるが、Cloneを無制限に持ち続けたくないダッシュボードのような用途のためのものです。
+	//
+	// 取り直しは元の木をCloneするので、Cloneと同じく、WeakSnapshotGの読み取りを元の木への書き込みと同時に呼んではいけません。
+	WeakSnapshotG[T any] struct {
+		t    *BTreeG[T]
+		snap *BTreeG[T]
+		// atは、snapを取った時点のt.mutationsです。
+		at      uint64
+		maxLag  uint64
+		refresh bool
+	}
+
+	// WeakSnapshotは、ItemのWeakSnapshotGです。
+	WeakSnapshot WeakSnapshotG[Item]
+)
+
+// WeakSnapshotは、現在の木のスナップショットを取り、遅れがDefaultWeakSnapshotLagを超えたら自動で取り直すWeakSnapshotGを返します。
+func (t *BTreeG[T]) WeakSnapshot() *WeakSnapshotG[T] {
+	s := &WeakSnapshotG[T]{t: t, maxLag: DefaultWeakSnapshotLag, refresh: true}
+	s.Refresh()
+	return s
+}
+
+// SetMaxLagは、スナップショットを古いとみなす元の木の変更の回数をnにします。nが0の場合は、元の木が1回でも変更されたら古いとみなします。
+func (s *WeakSnapshotG[T]) SetMaxLag(n int) {
+	if n < 0 {
+		panic("bad lag")
+	}
+	s.maxLag = uint64(n)
+}
+
+// SetAutoRefreshは、古くなったスナップショットを読み取りの前に自動で取り直すかどうかを設定します。
+// falseの場合は、Refreshを呼ぶまで古いスナップショットから読み続けます。
+func (s *WeakSnapshotG[T]) SetAutoRefresh(on bool) {
+	s.refresh = on
+}
+
+// Refreshは、古いスナップショットを捨てて、元の木の現在のスナップショットを取り直します。
+func (s *WeakSnapshotG[T]) Refresh() {
+	s.snap = s.t.Clone()
+	s.at = s.t.mutations
+}
+
+// Releaseは、スナップショットを捨てて、元の木と共有していないノードをGCが回収できるようにします。次の読み取りはスナップショットを取り直します。
+func (s *WeakSnapshotG[T]) Release() {
+	s.snap = nil
+}
+
+// Lagは、スナップショットを取ってから元の木を変更した回数を返します。変更しうる操作を数えるので、実際には何も変わらなかった操作も含みます。
+func (s *WeakSnapshotG[T]) Lag() int {
+	return int(s.t.mutations - s.at)
+}
+
+// Staleは、遅れがしきい値を超えていて、スナップショットが古いかどうかを返します。
+func (s *WeakSnapshotG[T]) Stale() bool {
+	return s.t.mutations-s.at > s.maxLag
+}
+
+// currentは、読み取りに使うスナップショットを返します。捨てられているか、自動の取り直しが有効で古くなっている場合は取り直します。
+func (s *WeakSnapshotG[T]) current() *BTreeG[T] {
+	if s.snap == nil || (s.refresh && s.Stale()) {
+		s.Refresh()
+	}
+	return s.snap
+}
+
+// Getは、スナップショットからkeyと等しい項目を返します。そのような項目がない場合は (zeroValue, false) を返します。
+func (s *WeakSnapshotG[T]) Get(key T) (T, bool) {
+	return s.current().Get(key)
+}
+
+// Hasは、スナップショットにkeyと等しい項目があればtrueを返します。
+func (s *WeakSnapshotG[T]) Has(key T) bool {
+	return s.current().Has(key)
+}
+
+// Lenは、スナップショットの項目の数を返します。
+func (s *WeakSnapshotG[T]) Len() int {
+	return s.current().Len()
+}
+
+// Ascendは、スナップショットのすべての項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (s *WeakSnapshotG[T]) Ascend(iterator ItemIteratorG[T]) {
+	s.current().Ascend(iterator)
+}
+
+// AscendRangeは、スナップショットの [greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (s *WeakSnapshotG[T]) AscendRange(greaterOrEqual, lessThan T, iterator ItemIteratorG[T]) {
+	s.current().AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// WeakSnapshotは、現在の木のスナップショットを取り、遅れがDefaultWeakSnapshotLagを超えたら自動で取り直すWeakSnapshotを返します。詳細はWeakSnapshotGを参照してください。
+func (t *BTree) WeakSnapshot() *WeakSnapshot {
+	return (*WeakSnapshot)(t.generic().WeakSnapshot())
+}
+
+func (s *WeakSnapshot) generic() *WeakSnapshotG[Item] {
+	return (*WeakSnapshotG[Item])(s)
+}
+
+// SetMaxLagは、スナップショットを古いとみなす元の木の変更の回数をnにします。
+func (s *WeakSnapshot) SetMaxLag(n int) {
+	s.generic().SetMaxLag(n)
+}
+
+// SetAutoRefreshは、古くなったスナップショットを読み取りの前に自動で取り直すかどうかを設定します。
+func (s *WeakSnapshot) SetAutoRefresh(on bool) {
+	s.generic().SetAutoRefresh(on)
+}
+
+// Refreshは、元の木の現在のスナップショットを取り直します。
+func (s *WeakSnapshot) Refresh() {
+	s.generic().Refresh()
+}
+
+// Releaseは、スナップショットを捨てます。次の読み取りはスナップショットを取り直します。
+func (s *WeakSnapshot) Release() {
+	s.generic().Release()
+}
+
+// Lagは、スナップショットを取ってから元の木を変更した回数を返します。
+func (s *WeakSnapshot) Lag() int {
+	return s.generic().Lag()
+}
+
+// Staleは、遅れがしきい値を超えていて、スナップショットが古いかどうかを返します。
+func (s *WeakSnapshot) Stale() bool {
+	return s.generic().Stale()
+}
+
+// Getは、スナップショットからkeyと等しい項目を返します。そのような項目がない場合はnilを返します。
+func (s *WeakSnapshot) Get(key Item) Item {
+	out, _ := s.generic().Get(key)
+	return out
+}
+
+// Hasは、スナップショットにkeyと等しい項目があればtrueを返します。
+func (s *WeakSnapshot) Has(key Item) bool {
+	return s.generic().Has(key)
+}
+
+// Lenは、スナップショットの項目の数を返します。
+func (s *WeakSnapshot) Len() int {
+	return s.generic().Len()
+}
+
+// Ascendは、スナップショットのすべての項目について、昇順にiteratorがfalseを返すまでiteratorを呼び出します。
+func (s *WeakSnapshot) Ascend(iterator ItemIterator) {
+	s.generic().Ascend(ItemIteratorG[Item](iterator))
+}
+
+// AscendRangeは、スナップショットの [greaterOrEqual, lessThan) の範囲の項目について、昇順にiteratorを呼び出します。nilの境界は「境界なし」を意味します。
+func (s *WeakSnapshot) AscendRange(greaterOrEqual, lessThan Item, iterator ItemIterator) {
+	(*BTree)(s.generic().current()).AscendRange(greaterOrEqual, lessThan, iterator)
+}
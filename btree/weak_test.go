@@ -0,0 +1,91 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWeakSnapshotAutoRefresh(t *testing.T) {
+	tr := NewG(3, intLess)
+	for i := 0; i < 10; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	s := tr.WeakSnapshot()
+	s.SetMaxLag(3)
+	snap := s.snap
+	for i := 10; i < 13; i++ {
+		tr.ReplaceOrInsert(i)
+	}
+	// 遅れがしきい値と等しいうちは、古いスナップショットから読む。
+	if s.Lag() != 3 || s.Stale() || s.Len() != 10 || s.Has(12) || s.snap != snap {
+		t.Fatalf("at the max lag: Lag %d, Stale %v, Len %d", s.Lag(), s.Stale(), s.Len())
+	}
+	tr.ReplaceOrInsert(13)
+	if s.Lag() != 4 || !s.Stale() {
+		t.Fatalf("past the max lag: Lag %d, Stale %v", s.Lag(), s.Stale())
+	}
+	// しきい値を超えたら、次の読み取りの前に取り直す。
+	if _, ok := s.Get(13); !ok || s.Lag() != 0 || s.Stale() || s.snap == snap {
+		t.Fatalf("after a read: Get(13) found %v, Lag %d, Stale %v", ok, s.Lag(), s.Stale())
+	}
+	tr.Delete(0)
+	if s.Len() != 14 || !s.Has(0) {
+		t.Fatalf("a snapshot within the lag saw a delete: Len %d", s.Len())
+	}
+	s.SetMaxLag(0)
+	if s.Len() != 13 || s.Has(0) {
+		t.Fatalf("with lag 0 a snapshot after a delete has Len %d", s.Len())
+	}
+	got := []int{}
+	s.AscendRange(5, 8, func(i int) bool {
+		got = append(got, i)
+		return true
+	})
+	if fmt.Sprint(got) != "[5 6 7]" {
+		t.Fatalf("AscendRange(5, 8) = %v", got)
+	}
+}
+
+func TestWeakSnapshotStaleReads(t *testing.T) {
+	tr := New(3)
+	for i := 0; i < 10; i++ {
+		tr.ReplaceOrInsert(Int(i))
+	}
+	s := tr.WeakSnapshot()
+	s.SetMaxLag(1)
+	s.SetAutoRefresh(false)
+	for i := 0; i < 5; i++ {
+		tr.Delete(Int(i))
+	}
+	tr.ReplaceOrInsert(Int(100))
+	// 自動の取り直しを止めると、古くなっても取り直さず、元の木の変更が見えない。
+	if !s.Stale() || s.Lag() != 6 || s.Len() != 10 || s.Get(Int(0)) == nil || s.Has(Int(100)) {
+		t.Fatalf("stale reads: Stale %v, Lag %d, Len %d", s.Stale(), s.Lag(), s.Len())
+	}
+	var got []Item
+	s.Ascend(func(i Item) bool {
+		got = append(got, i)
+		return true
+	})
+	if fmt.Sprint(got) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Fatalf("stale Ascend = %v", got)
+	}
+	s.Refresh()
+	if s.Stale() || s.Lag() != 0 || s.Len() != 6 || !s.Has(Int(100)) {
+		t.Fatalf("after Refresh: Stale %v, Lag %d, Len %d", s.Stale(), s.Lag(), s.Len())
+	}
+	got = nil
+	s.AscendRange(nil, Int(7), func(i Item) bool {
+		got = append(got, i)
+		return true
+	})
+	if fmt.Sprint(got) != "[5 6]" {
+		t.Fatalf("AscendRange(nil, 7) = %v", got)
+	}
+	// Releaseした後は、自動の取り直しを止めていても、次の読み取りで取り直す。
+	tr.ReplaceOrInsert(Int(200))
+	s.Release()
+	if s.Len() != 7 || s.Lag() != 0 {
+		t.Fatalf("after Release: Len %d, Lag %d", s.Len(), s.Lag())
+	}
+}
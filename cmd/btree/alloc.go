@@ -0,0 +1,150 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seipan/btree/btree"
+	"github.com/spf13/cobra"
+)
+
+// allocModesは、allocサブコマンドが比較するノードの割り当て方です。
+var allocModes = []string{"default", "freelist", "arena", "shared", "sharded"}
+
+var allocCmd = &cobra.Command{
+	Use:          "alloc",
+	SilenceUsage: true,
+	Short:        "Compare node allocation strategies under insert/delete churn",
+	Long: `alloc runs the same churn workload (build a tree of --n random keys, delete and
+re-insert half of them, then Clear(true)) --rounds times on --goroutines trees at
+once, and reports the time, heap allocations and GC work for each mode:
+
+  default   a private freelist of DefaultFreeListSize nodes per tree
+  freelist  a private freelist of --freelist-size nodes per tree
+  arena     a tree created with NewWithArenaG
+  shared    one freelist of --freelist-size nodes per tree shared by all trees
+  sharded   like shared, but split into one shard per goroutine`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := cmd.Flags()
+		n, _ := f.GetInt("n")
+		rounds, _ := f.GetInt("rounds")
+		goroutines, _ := f.GetInt("goroutines")
+		degree, _ := f.GetInt("degree")
+		size, _ := f.GetInt("freelist-size")
+		modes, _ := f.GetString("modes")
+		if n <= 0 || rounds <= 0 || goroutines <= 0 || degree < 2 || size < 0 {
+			return fmt.Errorf("--n, --rounds and --goroutines must be positive and --degree at least 2")
+		}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "mode\ttime\tmallocs\tbytes\tgc cycles\tgc pause\tfreelist hits\tslabs")
+		for _, mode := range strings.Split(modes, ",") {
+			r, err := AllocChurn(mode, n, rounds, goroutines, degree, size)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "%s\t%v\t%d\t%s\t%d\t%v\t%d\t%d\n", mode, r.Elapsed.Round(time.Millisecond), r.Mallocs,
+				formatBytes(int64(r.Bytes)), r.GCs, r.Pause, r.FreeList.Hits, r.FreeList.Slabs)
+		}
+		return tw.Flush()
+	},
+}
+
+// AllocResultは、AllocChurnの1つのモードの測定結果です。
+type AllocResult struct {
+	Elapsed  time.Duration
+	Mallocs  uint64
+	Bytes    uint64
+	GCs      uint32
+	Pause    time.Duration
+	FreeList btree.FreeListStats
+}
+
+// AllocChurnは、goroutines個の木で同時に、n個のランダムなキーで木を作り、半分を削除して入れ直してからClear(true)することをrounds回繰り返し、
+// その間のヒープの割り当てとGCの仕事量を返します。modeはallocModesのどれかです。
+func AllocChurn(mode string, n, rounds, goroutines, degree, size int) (AllocResult, error) {
+	less := func(a, b int) bool { return a < b }
+	var shared *btree.FreeListG[int]
+	switch mode {
+	case "shared":
+		shared = btree.NewFreeListG[int](size * goroutines)
+	case "sharded":
+		shared = btree.NewShardedFreeListG[int](goroutines, size*goroutines)
+	}
+	trees := make([]*btree.BTreeG[int], goroutines)
+	for g := range trees {
+		switch mode {
+		case "default":
+			trees[g] = btree.NewG(degree, less)
+		case "freelist":
+			trees[g] = btree.NewWithOptionsG(degree, less, btree.OptionsG[int]{FreeListSize: size})
+		case "arena":
+			trees[g] = btree.NewWithArenaG(degree, less)
+		case "shared", "sharded":
+			trees[g] = btree.NewWithFreeListG(degree, less, shared)
+		default:
+			return AllocResult{}, fmt.Errorf("unknown mode %q (want one of %s)", mode, strings.Join(allocModes, ", "))
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for g, t := range trees {
+		wg.Add(1)
+		go func(g int, t *btree.BTreeG[int]) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for round := 0; round < rounds; round++ {
+				for i := 0; i < n; i++ {
+					t.ReplaceOrInsert(r.Intn(n * 4))
+				}
+				for i := 0; i < n/2; i++ {
+					t.Delete(r.Intn(n * 4))
+				}
+				for i := 0; i < n/2; i++ {
+					t.ReplaceOrInsert(r.Intn(n * 4))
+				}
+				t.Clear(true)
+			}
+		}(g, t)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	res := AllocResult{
+		Elapsed: elapsed,
+		Mallocs: after.Mallocs - before.Mallocs,
+		Bytes:   after.TotalAlloc - before.TotalAlloc,
+		GCs:     after.NumGC - before.NumGC,
+		Pause:   time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+	}
+	if shared != nil {
+		res.FreeList = shared.Stats()
+	} else {
+		for _, t := range trees {
+			st := t.Stats().FreeList
+			res.FreeList.Hits += st.Hits
+			res.FreeList.Slabs += st.Slabs
+		}
+	}
+	return res, nil
+}
+
+func init() {
+	rootCmd.AddCommand(allocCmd)
+	f := allocCmd.Flags()
+	f.Int("n", 100000, "number of keys inserted into each tree per round")
+	f.Int("rounds", 10, "number of build/churn/clear rounds")
+	f.Int("goroutines", 1, "number of trees churned at once, one per goroutine")
+	f.Int("degree", 32, "degree of the trees")
+	f.Int("freelist-size", 1024, "freelist size per tree for the freelist, shared and sharded modes")
+	f.String("modes", strings.Join(allocModes, ","), "comma-separated modes to compare")
+}
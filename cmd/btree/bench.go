@@ -0,0 +1,408 @@
+package btree
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seipan/btree/btree"
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:          "bench",
+	SilenceUsage: true,
+	Short:        "Run a mixed read/write/scan workload against several backends",
+	Long: `bench preloads --keys keys into each backend and then runs --ops operations
+split across --goroutines goroutines, choosing reads, writes and scans by the
+given ratios and keys by the given distribution. It reports throughput, latency
+percentiles and allocations per operation for each backend.
+
+Backends: btree (a BTree behind a sync.RWMutex), safe (SafeBTree), map (a Go map
+behind a sync.RWMutex) and syncmap (sync.Map). Maps have no ordered scan, so a
+scan on them is --scan-len point lookups of consecutive keys.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := benchConfigFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		var results []BenchResult
+		for _, name := range cfg.Backends {
+			b, err := newBackend(name, cfg.Degree)
+			if err != nil {
+				return err
+			}
+			results = append(results, RunBench(b, cfg))
+		}
+		return writeResults(cmd.OutOrStdout(), cfg.Format, results)
+	},
+}
+
+// BenchConfigは、benchサブコマンドの作業負荷の設定です。
+type BenchConfig struct {
+	Ops, Keys, Goroutines int
+	Read, Write, Scan     float64 // 操作の割合。合計で正規化されます
+	ScanLen               int
+	Dist                  string // sequential、random、zipfian
+	Degree                int
+	Payloads              *Payloads
+	Backends              []string
+	Format                string // text、csv、json
+}
+
+func benchConfigFromFlags(cmd *cobra.Command) (BenchConfig, error) {
+	f := cmd.Flags()
+	var cfg BenchConfig
+	var err error
+	get := func(name string) int {
+		v, e := f.GetInt(name)
+		if err == nil {
+			err = e
+		}
+		return v
+	}
+	getFloat := func(name string) float64 {
+		v, e := f.GetFloat64(name)
+		if err == nil {
+			err = e
+		}
+		return v
+	}
+	getString := func(name string) string {
+		v, e := f.GetString(name)
+		if err == nil {
+			err = e
+		}
+		return v
+	}
+	cfg.Ops, cfg.Keys, cfg.Goroutines = get("ops"), get("keys"), get("goroutines")
+	cfg.Read, cfg.Write, cfg.Scan = getFloat("read"), getFloat("write"), getFloat("scan")
+	cfg.ScanLen, cfg.Degree = get("scan-len"), get("degree")
+	cfg.Dist, cfg.Format = getString("dist"), getString("format")
+	size, valueDist := get("value-size"), getString("value-dist")
+	backends := getString("backends")
+	if err != nil {
+		return cfg, err
+	}
+	switch {
+	case cfg.Ops <= 0 || cfg.Keys <= 0 || cfg.Goroutines <= 0 || cfg.ScanLen <= 0:
+		return cfg, fmt.Errorf("--ops, --keys, --goroutines and --scan-len must be positive")
+	case cfg.Degree < 2:
+		return cfg, fmt.Errorf("--degree must be at least 2")
+	case cfg.Read < 0 || cfg.Write < 0 || cfg.Scan < 0 || cfg.Read+cfg.Write+cfg.Scan == 0:
+		return cfg, fmt.Errorf("operation ratios must be non-negative and not all zero")
+	case cfg.Dist != "sequential" && cfg.Dist != "random" && cfg.Dist != "zipfian":
+		return cfg, fmt.Errorf("unknown key distribution %q (want sequential, random or zipfian)", cfg.Dist)
+	case cfg.Format != "text" && cfg.Format != "csv" && cfg.Format != "json":
+		return cfg, fmt.Errorf("unknown format %q (want text, csv or json)", cfg.Format)
+	}
+	if cfg.Payloads, err = NewPayloads(size, valueDist); err != nil {
+		return cfg, err
+	}
+	cfg.Backends = strings.Split(backends, ",")
+	return cfg, nil
+}
+
+// backendは、benchが比較するストアです。すべてのメソッドは複数のゴルーチンから同時に呼ばれます。
+type backend interface {
+	Name() string
+	Get(k int) bool
+	Set(k int, v []byte)
+	// Scanは、k以上の最大n個のキーを読み、読んだ数を返します。
+	Scan(k, n int) int
+}
+
+func newBackend(name string, degree int) (backend, error) {
+	switch name {
+	case "btree":
+		return &btreeBackend{t: btree.New(degree)}, nil
+	case "safe":
+		return &safeBackend{t: btree.NewSafe(degree)}, nil
+	case "map":
+		return &mapBackend{m: make(map[int][]byte)}, nil
+	case "syncmap":
+		return &syncMapBackend{}, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q (want btree, safe, map or syncmap)", name)
+}
+
+type btreeBackend struct {
+	mu sync.RWMutex
+	t  *btree.BTree
+}
+
+func (b *btreeBackend) Name() string { return "btree" }
+
+func (b *btreeBackend) Get(k int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.t.Get(KV{Key: btree.Int(k)}) != nil
+}
+
+func (b *btreeBackend) Set(k int, v []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.t.ReplaceOrInsert(KV{Key: btree.Int(k), Value: v})
+}
+
+func (b *btreeBackend) Scan(k, n int) (read int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	b.t.AscendGreaterOrEqual(KV{Key: btree.Int(k)}, func(btree.Item) bool {
+		read++
+		return read < n
+	})
+	return read
+}
+
+type safeBackend struct {
+	t *btree.SafeBTree
+}
+
+func (b *safeBackend) Name() string { return "safe" }
+
+func (b *safeBackend) Get(k int) bool {
+	return b.t.Get(KV{Key: btree.Int(k)}) != nil
+}
+
+func (b *safeBackend) Set(k int, v []byte) {
+	b.t.ReplaceOrInsert(KV{Key: btree.Int(k), Value: v})
+}
+
+func (b *safeBackend) Scan(k, n int) (read int) {
+	b.t.AscendGreaterOrEqual(KV{Key: btree.Int(k)}, func(btree.Item) bool {
+		read++
+		return read < n
+	})
+	return read
+}
+
+type mapBackend struct {
+	mu sync.RWMutex
+	m  map[int][]byte
+}
+
+func (b *mapBackend) Name() string { return "map" }
+
+func (b *mapBackend) Get(k int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.m[k]
+	return ok
+}
+
+func (b *mapBackend) Set(k int, v []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.m[k] = v
+}
+
+func (b *mapBackend) Scan(k, n int) (read int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := 0; i < n; i++ {
+		if _, ok := b.m[k+i]; ok {
+			read++
+		}
+	}
+	return read
+}
+
+type syncMapBackend struct {
+	m sync.Map
+}
+
+func (b *syncMapBackend) Name() string { return "syncmap" }
+
+func (b *syncMapBackend) Get(k int) bool {
+	_, ok := b.m.Load(k)
+	return ok
+}
+
+func (b *syncMapBackend) Set(k int, v []byte) {
+	b.m.Store(k, v)
+}
+
+func (b *syncMapBackend) Scan(k, n int) (read int) {
+	for i := 0; i < n; i++ {
+		if _, ok := b.m.Load(k + i); ok {
+			read++
+		}
+	}
+	return read
+}
+
+// BenchResultは、1つのバックエンドの測定結果です。時間はナノ秒です。
+type BenchResult struct {
+	Backend     string  `json:"backend"`
+	Ops         int     `json:"ops"`
+	Seconds     float64 `json:"seconds"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	P50         int64   `json:"p50_ns"`
+	P90         int64   `json:"p90_ns"`
+	P99         int64   `json:"p99_ns"`
+	Max         int64   `json:"max_ns"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+}
+
+// keyGenは、1つのゴルーチンが使うキーの列を作ります。
+type keyGen struct {
+	dist string
+	keys int
+	next int
+	r    *rand.Rand
+	zipf *rand.Zipf
+}
+
+func newKeyGen(cfg BenchConfig, g int) *keyGen {
+	r := rand.New(rand.NewSource(int64(g) + 1))
+	k := &keyGen{dist: cfg.Dist, keys: cfg.Keys, next: g * (cfg.Keys / cfg.Goroutines), r: r}
+	if cfg.Dist == "zipfian" {
+		k.zipf = rand.NewZipf(r, 1.1, 1, uint64(cfg.Keys-1))
+	}
+	return k
+}
+
+func (k *keyGen) key() int {
+	switch k.dist {
+	case "random":
+		return k.r.Intn(k.keys)
+	case "zipfian":
+		return int(k.zipf.Uint64())
+	}
+	key := k.next % k.keys
+	k.next++
+	return key
+}
+
+// RunBenchは、bにcfg.Keys個のキーを入れてから作業負荷を実行し、結果を返します。
+func RunBench(b backend, cfg BenchConfig) BenchResult {
+	for i := 0; i < cfg.Keys; i++ {
+		b.Set(i, cfg.Payloads.Next())
+	}
+	values := make([][]byte, 1024)
+	for i := range values {
+		values[i] = cfg.Payloads.Next()
+	}
+	total := cfg.Read + cfg.Write + cfg.Scan
+	readBelow, writeBelow := cfg.Read/total, (cfg.Read+cfg.Write)/total
+
+	// 測定中のアロケーションに含めないように、レイテンシの記録先とキーの生成器は先に作っておく。
+	latencies := make([][]time.Duration, cfg.Goroutines)
+	gens := make([]*keyGen, cfg.Goroutines)
+	for g := range latencies {
+		ops := cfg.Ops / cfg.Goroutines
+		if g < cfg.Ops%cfg.Goroutines {
+			ops++
+		}
+		latencies[g] = make([]time.Duration, ops)
+		gens[g] = newKeyGen(cfg, g)
+	}
+	var wg sync.WaitGroup
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for g := range latencies {
+		wg.Add(1)
+		go func(lat []time.Duration, keys *keyGen) {
+			defer wg.Done()
+			for i := range lat {
+				k, p := keys.key(), keys.r.Float64()
+				t0 := time.Now()
+				switch {
+				case p < readBelow:
+					b.Get(k)
+				case p < writeBelow:
+					b.Set(k, values[i%len(values)])
+				default:
+					b.Scan(k, cfg.ScanLen)
+				}
+				lat[i] = time.Since(t0)
+			}
+		}(latencies[g], gens[g])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	var all []time.Duration
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	pct := func(p float64) int64 {
+		if len(all) == 0 {
+			return 0
+		}
+		return int64(all[int(p*float64(len(all)-1))])
+	}
+	return BenchResult{
+		Backend:     b.Name(),
+		Ops:         len(all),
+		Seconds:     elapsed.Seconds(),
+		OpsPerSec:   float64(len(all)) / elapsed.Seconds(),
+		P50:         pct(0.50),
+		P90:         pct(0.90),
+		P99:         pct(0.99),
+		Max:         pct(1),
+		AllocsPerOp: float64(after.Mallocs-before.Mallocs) / float64(len(all)),
+		BytesPerOp:  float64(after.TotalAlloc-before.TotalAlloc) / float64(len(all)),
+	}
+}
+
+func writeResults(w io.Writer, format string, results []BenchResult) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"backend", "ops", "seconds", "ops_per_sec", "p50_ns", "p90_ns", "p99_ns", "max_ns", "allocs_per_op", "bytes_per_op"})
+		for _, r := range results {
+			cw.Write([]string{
+				r.Backend, strconv.Itoa(r.Ops), strconv.FormatFloat(r.Seconds, 'f', 6, 64), strconv.FormatFloat(r.OpsPerSec, 'f', 0, 64),
+				strconv.FormatInt(r.P50, 10), strconv.FormatInt(r.P90, 10), strconv.FormatInt(r.P99, 10), strconv.FormatInt(r.Max, 10),
+				strconv.FormatFloat(r.AllocsPerOp, 'f', 2, 64), strconv.FormatFloat(r.BytesPerOp, 'f', 1, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "backend\tops/sec\tp50\tp90\tp99\tmax\tallocs/op\tB/op")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%.0f\t%v\t%v\t%v\t%v\t%.2f\t%.1f\n", r.Backend, r.OpsPerSec,
+			time.Duration(r.P50), time.Duration(r.P90), time.Duration(r.P99), time.Duration(r.Max), r.AllocsPerOp, r.BytesPerOp)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	f := benchCmd.Flags()
+	f.Int("ops", 1000000, "number of operations to run")
+	f.Int("keys", 100000, "number of keys to preload; operations use keys in [0, keys)")
+	f.Int("goroutines", 1, "number of goroutines running operations")
+	f.Float64("read", 80, "relative share of point reads")
+	f.Float64("write", 15, "relative share of writes")
+	f.Float64("scan", 5, "relative share of scans")
+	f.Int("scan-len", 100, "number of keys read by a scan")
+	f.String("dist", "random", "key distribution: sequential, random or zipfian")
+	f.Int("degree", 32, "degree of the trees")
+	f.Int("value-size", 0, "average size in bytes of the value stored with each key")
+	f.String("value-dist", "fixed", "distribution of value sizes: fixed or lognormal")
+	f.String("backends", "btree,safe,map,syncmap", "comma-separated backends to compare")
+	f.String("format", "text", "output format: text, csv or json")
+}
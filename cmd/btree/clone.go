@@ -0,0 +1,50 @@
+package btree
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/seipan/btree/btree"
+)
+
+// CloneBtreeは、N回のランダムな書き込みの間に、every回ごとにClone、Cloneの全件の走査、Clear(true)を行い、
+// かかった時間と、コピーオンライトによるノードの複製やフリーリストの再利用の回数を表示します。
+//
+// Cloneの直後はどちらの木もノードを所有しないので、次の書き込みは経路上のノードを複製します。
+// また、Cloneした木は何も所有しないので、Clear(true)は木全体をたどってもノードをフリーリストに戻せません。
+func CloneBtree(N, degree, every int) {
+	fmt.Println("--------------------------- btree clone ---------------------------")
+	fl := btree.NewFreeList(btree.DefaultFreeListSize)
+	btr := btree.NewWithFreeList(degree, fl)
+	r := rand.New(rand.NewSource(1))
+	var clones int
+	var cloneTime, iterTime, clearTime time.Duration
+	start := time.Now()
+	for i := 0; i < N; i++ {
+		btr.ReplaceOrInsert(btree.Int(r.Intn(N)))
+		if (i+1)%every != 0 {
+			continue
+		}
+		t0 := time.Now()
+		c := btr.Clone()
+		t1 := time.Now()
+		c.Ascend(func(btree.Item) bool { return true })
+		t2 := time.Now()
+		c.Clear(true)
+		t3 := time.Now()
+		clones++
+		cloneTime += t1.Sub(t0)
+		iterTime += t2.Sub(t1)
+		clearTime += t3.Sub(t2)
+	}
+	total := time.Since(start)
+	st := fl.Stats()
+	owned, shared := btr.NodeOwnership()
+	fmt.Println("--------------------------- btree clone ---------------------------")
+	log.Printf("writes=%d clones=%d total=%v clone=%v iterate=%v clear=%v", N, clones, total, cloneTime, iterTime, clearTime)
+	log.Printf("cow copies=%d (%.2f per write) freelist hits=%d misses=%d stored=%d dropped=%d size=%d",
+		st.Copies, float64(st.Copies)/float64(N), st.Hits, st.Misses, st.Stored, st.Dropped, st.Size)
+	log.Printf("nodes owned=%d shared=%d", owned, shared)
+}
@@ -0,0 +1,248 @@
+package btree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seipan/btree/btree/disk"
+	"github.com/spf13/cobra"
+)
+
+// slowSyncは、これより遅いfsyncを警告する閾値です。
+const slowSync = 50 * time.Millisecond
+
+// checkBudgetは、doctorがファイルの検査に使う時間です。すべてを検査するにはcheckコマンドを使います。
+const checkBudget = time.Second
+
+var doctorCmd = &cobra.Command{
+	Use:          "doctor",
+	SilenceUsage: true,
+	Short:        "Report the effective configuration and check the environment for problems",
+	Long: `doctor prints the effective configuration of a disk tree (from --file if it
+exists, otherwise from the flags), the cache size compared with the available
+memory, the result of a time-limited check of the file, the state of a WAL
+directory (--dir), and whether fsync works on the filesystem that holds them. It exits with an error if it finds a problem.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, _ := cmd.Flags().GetString("file")
+		dir, _ := cmd.Flags().GetString("dir")
+		degree, _ := cmd.Flags().GetInt("degree")
+		pageSize, _ := cmd.Flags().GetInt("page-size")
+		cachePages, _ := cmd.Flags().GetInt("cache-pages")
+		d := &doctor{w: cmd.OutOrStdout()}
+		d.run(file, dir, degree, pageSize, cachePages)
+		if d.problems > 0 {
+			return fmt.Errorf("%d problem(s) found", d.problems)
+		}
+		fmt.Fprintln(d.w, "no problems found")
+		return nil
+	},
+}
+
+// doctorは、doctorコマンドの出力と見つけた問題の数です。
+type doctor struct {
+	w        io.Writer
+	problems int
+}
+
+func (d *doctor) info(key string, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "%-20s %s\n", key+":", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(format string, args ...interface{}) {
+	d.problems++
+	fmt.Fprintf(d.w, "WARNING: %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) run(file, dir string, degree, pageSize, cachePages int) {
+	d.info("go", "%s %s/%s, %d CPUs", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	d.info("format version", "%d", disk.FormatVersion)
+
+	syncDir := "."
+	if file != "" {
+		syncDir = filepath.Dir(file)
+		h, err := disk.ReadHeader(file)
+		switch {
+		case os.IsNotExist(err):
+			d.info("file", "%s (does not exist yet; using flags)", file)
+		case err != nil:
+			d.warn("cannot read %s: %v", file, err)
+		default:
+			d.info("file", "%s: %d items in %d pages", file, h.Length, h.Pages)
+			if degree != 0 && degree != h.Degree {
+				d.warn("--degree %d does not match the file's degree %d; opening it with this degree would fail", degree, h.Degree)
+			}
+			if pageSize != disk.DefaultPageSize && pageSize != h.PageSize {
+				d.warn("--page-size %d does not match the file's page size %d", pageSize, h.PageSize)
+			}
+			degree, pageSize = h.Degree, h.PageSize
+			d.checkFile(file)
+		}
+	}
+	switch {
+	case degree == 0 && file != "":
+		d.warn("no degree given; creating %s needs --degree", file)
+	case degree == 0:
+		d.info("degree", "not set")
+	default:
+		d.info("degree", "%d", degree)
+	}
+	d.info("page size", "%d bytes", pageSize)
+	if pageSize&(pageSize-1) != 0 {
+		d.warn("page size %d is not a power of two; pages will straddle filesystem blocks", pageSize)
+	}
+	if degree != 0 {
+		max, err := disk.MaxItemSize(degree, pageSize)
+		if err != nil {
+			d.warn("%v", err)
+		} else {
+			d.info("max item size", "%d bytes", max)
+			if max < 16 {
+				d.warn("items may be at most %d bytes; lower --degree or raise --page-size", max)
+			}
+		}
+	}
+
+	if cachePages <= 0 {
+		cachePages = disk.DefaultCachePages
+	}
+	cache := int64(cachePages) * int64(pageSize)
+	if avail, ok := availableMemory(); ok {
+		d.info("cache", "%d pages = %s of %s available memory", cachePages, formatBytes(cache), formatBytes(avail))
+		if cache > avail/2 {
+			d.warn("the page cache would use more than half of the available memory")
+		}
+	} else {
+		d.info("cache", "%d pages = %s (available memory unknown)", cachePages, formatBytes(cache))
+	}
+
+	if dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			syncDir = dir
+		} else {
+			// ストアはOpenで作られるので、その親のディレクトリのファイルシステムを調べる。
+			syncDir = filepath.Dir(dir)
+		}
+		d.checkWAL(dir)
+	}
+	d.checkSync(syncDir)
+}
+
+// checkFileは、ファイルをcheckBudgetの間だけ検査し、見つけた問題を符号と対処の提案とともに警告します。
+func (d *doctor) checkFile(file string) {
+	r, err := disk.CheckFile(file, checkBudget)
+	if err != nil {
+		d.warn("cannot check %s: %v", file, err)
+		return
+	}
+	if r.Complete {
+		d.info("check", "%d pages checked in %v", r.Checked, r.Elapsed)
+	} else {
+		d.info("check", "%d of %d pages checked in %v; run check for a full pass", r.Checked, r.Pages, r.Elapsed)
+	}
+	for _, f := range r.Findings {
+		d.warn("%s (%s)", formatFinding(f), f.Code.Suggestion())
+	}
+}
+
+// checkWALは、WALのディレクトリにあるログとスナップショットの大きさを報告します。
+func (d *doctor) checkWAL(dir string) {
+	size := func(name string) int64 {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return -1
+		}
+		return fi.Size()
+	}
+	log, snap := size("wal.log"), size("snapshot")
+	switch {
+	case log < 0 && snap < 0:
+		d.info("wal", "%s (no store yet)", dir)
+	default:
+		d.info("wal", "%s: log %s, snapshot %s", dir, formatBytes(log), formatBytes(snap))
+		if log > 64<<20 && log > snap {
+			d.warn("the log is larger than the snapshot; call Checkpoint to shorten recovery")
+		}
+	}
+	if size("snapshot.tmp") >= 0 {
+		d.warn("%s contains a leftover snapshot.tmp from an interrupted checkpoint; it is safe to delete", dir)
+	}
+}
+
+// checkSyncは、dirに一時ファイルを作ってfsyncし、fsyncが使えるかとその時間を報告します。
+func (d *doctor) checkSync(dir string) {
+	f, err := os.CreateTemp(dir, ".btree-doctor-*")
+	if err != nil {
+		d.warn("cannot create a file in %s: %v", dir, err)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	buf := make([]byte, 4096)
+	const rounds = 5
+	var total time.Duration
+	for i := 0; i < rounds; i++ {
+		if _, err := f.Write(buf); err != nil {
+			d.warn("cannot write to %s: %v", dir, err)
+			return
+		}
+		start := time.Now()
+		if err := f.Sync(); err != nil {
+			d.warn("fsync is not supported in %s: %v", dir, err)
+			return
+		}
+		total += time.Since(start)
+	}
+	avg := total / rounds
+	d.info("fsync", "%s: %v per call", dir, avg)
+	if avg > slowSync {
+		d.warn("fsync takes %v; SyncAlways will limit writes to about %d per second", avg, time.Second/avg)
+	}
+}
+
+// availableMemoryは、/proc/meminfoのMemAvailableを返します。得られない場合はfalseを返します。
+func availableMemory() (int64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			return kb << 10, err == nil
+		}
+	}
+	return 0, false
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n < 0:
+		return "none"
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().String("file", "", "path of a disk tree file to inspect")
+	doctorCmd.Flags().String("dir", "", "path of a WAL store directory to inspect")
+	doctorCmd.Flags().Int("degree", 0, "degree used to open the disk tree")
+	doctorCmd.Flags().Int("page-size", disk.DefaultPageSize, "page size used to create the disk tree")
+	doctorCmd.Flags().Int("cache-pages", disk.DefaultCachePages, "number of pages kept in the cache")
+}
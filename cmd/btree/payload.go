@@ -0,0 +1,87 @@
+package btree
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/seipan/btree/btree"
+)
+
+// KVは、値のペイロードを持つ項目です。キーだけで比較します。
+type KV struct {
+	Key   btree.Int
+	Value []byte
+}
+
+// Lessは、キーを比較します。
+func (a KV) Less(b btree.Item) bool {
+	return a.Key < b.(KV).Key
+}
+
+// Payloadsは、ベンチマークで保存する値のペイロードを作ります。sizeが0の場合は値を持たない（キーだけの）ベンチマークになります。
+type Payloads struct {
+	size int
+	dist string
+	r    *rand.Rand
+	buf  []byte
+}
+
+// NewPayloadsは、平均sizeバイトの値を分布distで作るPayloadsを返します。distはfixed（常にsizeバイト）かlognormal（平均sizeバイトの対数正規分布）です。
+func NewPayloads(size int, dist string) (*Payloads, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("bad value size %d", size)
+	}
+	if dist != "fixed" && dist != "lognormal" {
+		return nil, fmt.Errorf("unknown value distribution %q (want fixed or lognormal)", dist)
+	}
+	p := &Payloads{size: size, dist: dist, r: rand.New(rand.NewSource(1))}
+	p.buf = make([]byte, 0, 64*size+1)
+	for i := 0; i < cap(p.buf); i++ {
+		p.buf = append(p.buf, byte(p.r.Intn(256)))
+	}
+	return p, nil
+}
+
+// sigmaは、lognormalの分布の対数の標準偏差です。
+const sigma = 1.0
+
+// Nextは、次の値を返します。値は共通のランダムなバッファの一部なので、変更してはいけません。
+func (p *Payloads) Next() []byte {
+	n := p.size
+	if p.dist == "lognormal" && n > 0 {
+		// 平均がsizeになるように、対数の平均を ln(size) - σ²/2 にする。
+		mu := math.Log(float64(p.size)) - sigma*sigma/2
+		n = int(math.Exp(mu + sigma*p.r.NormFloat64()))
+		if n > len(p.buf) {
+			n = len(p.buf)
+		}
+	}
+	off := p.r.Intn(len(p.buf) - n + 1)
+	return p.buf[off : off+n : off+n]
+}
+
+// Itemは、キーiの木の項目を返します。値を持たない場合はbtree.Int、持つ場合はvalueを値とするKVです。
+func (p *Payloads) Item(i int, value []byte) btree.Item {
+	if p.size == 0 {
+		return btree.Int(i)
+	}
+	return KV{Key: btree.Int(i), Value: value}
+}
+
+// MapValueは、mapに保存するキーiの値を返します。値を持たない場合はキーと同じ文字列です。
+func (p *Payloads) MapValue(i int) string {
+	if p.size == 0 {
+		return strconv.Itoa(i)
+	}
+	return string(p.Next())
+}
+
+// KVValueは、OrderedKVに保存するキーiの値を返します。値を持たない場合はキーと同じバイト列です。
+func (p *Payloads) KVValue(i int) []byte {
+	if p.size == 0 {
+		return []byte(strconv.Itoa(i))
+	}
+	return p.Next()
+}
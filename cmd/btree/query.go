@@ -0,0 +1,197 @@
+package btree
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/seipan/btree/btree"
+)
+
+type (
+	// shellQueryは、シェルのselectとcountを解析したものです。
+	shellQuery struct {
+		count bool
+		// spansは、対象のキーの範囲を両端を含めて昇順に並べたものです。
+		spans []keySpan
+		// limitは、selectで表示する項目の最大数です。負の場合は制限しません。
+		limit int
+	}
+
+	// keySpanは、両端を含むキーの範囲 [lo, hi] です。
+	keySpan struct {
+		lo, hi int64
+	}
+)
+
+// allKeysは、すべてのキーの範囲です。
+var allKeys = []keySpan{{math.MinInt64, math.MaxInt64}}
+
+// parseQueryは、次の形のselectとcountを解析します。キーワードの大文字と小文字は区別せず、値は'か"で囲んでも構いません。
+//
+//	select * [where key between <a> and <b> | where prefix <p>] [limit <n>]
+//	count [where key between <a> and <b> | where prefix <p>]
+//
+// betweenはSQLと同じく両端を含みます。prefixは、10進数で書いたときにpで始まるキーを選びます。
+func parseQuery(fields []string) (*shellQuery, error) {
+	q := &shellQuery{count: strings.EqualFold(fields[0], "count"), spans: allKeys, limit: -1}
+	rest := fields[1:]
+	// wantは、次の語がwordであれば読み進めてtrueを返します。
+	want := func(word string) bool {
+		if len(rest) > 0 && strings.EqualFold(rest[0], word) {
+			rest = rest[1:]
+			return true
+		}
+		return false
+	}
+	value := func(what string) (string, error) {
+		if len(rest) == 0 {
+			return "", fmt.Errorf("missing %s", what)
+		}
+		v := rest[0]
+		rest = rest[1:]
+		if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		return v, nil
+	}
+	key := func(what string) (int64, error) {
+		v, err := value(what)
+		if err != nil {
+			return 0, err
+		}
+		k, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad key %q", v)
+		}
+		return k, nil
+	}
+	if !q.count && !want("*") {
+		return nil, fmt.Errorf("select supports only *")
+	}
+	if want("where") {
+		switch {
+		case want("key"):
+			if !want("between") {
+				return nil, fmt.Errorf("expected between after key")
+			}
+			lo, err := key("lower bound")
+			if err != nil {
+				return nil, err
+			}
+			if !want("and") {
+				return nil, fmt.Errorf("expected and after the lower bound")
+			}
+			hi, err := key("upper bound")
+			if err != nil {
+				return nil, err
+			}
+			q.spans = nil
+			if lo <= hi {
+				q.spans = []keySpan{{lo, hi}}
+			}
+		case want("prefix"):
+			p, err := value("prefix")
+			if err != nil {
+				return nil, err
+			}
+			if q.spans, err = prefixSpans(p); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected key between or prefix after where")
+		}
+	}
+	if !q.count && want("limit") {
+		v, err := value("limit")
+		if err != nil {
+			return nil, err
+		}
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit < 0 {
+			return nil, fmt.Errorf("bad limit %q", v)
+		}
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %q", rest[0])
+	}
+	return q, nil
+}
+
+// prefixSpansは、10進数で書いたときにpで始まるキーの範囲を昇順に返します。
+// 例えば"12"は、12、120から129、1200から1299、…を選びます。範囲は桁数ごとに1つなので、高々19個です。
+func prefixSpans(p string) ([]keySpan, error) {
+	neg := strings.HasPrefix(p, "-")
+	digits := strings.TrimPrefix(p, "-")
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("bad prefix %q", p)
+		}
+	}
+	switch {
+	case p == "":
+		return allKeys, nil
+	case digits == "":
+		return []keySpan{{math.MinInt64, -1}}, nil
+	case digits == "0" && !neg:
+		return []keySpan{{0, 0}}, nil
+	case digits[0] == '0':
+		// 先頭に0を書いたキーはないので、何も選ばない。
+		return nil, nil
+	}
+	// 絶対値の範囲を求める。負のキーの絶対値は、MaxInt64より1大きいものまである。
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	lo, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || lo > limit {
+		return nil, nil
+	}
+	var spans []keySpan
+	for span := uint64(1); ; span *= 10 {
+		hi := limit
+		if lo <= limit-(span-1) {
+			hi = lo + span - 1
+		}
+		if neg {
+			// 2の補数では、-int64(1<<63)はMinInt64になる。
+			spans = append([]keySpan{{-int64(hi), -int64(lo)}}, spans...)
+		} else {
+			spans = append(spans, keySpan{int64(lo), int64(hi)})
+		}
+		if lo > limit/10 {
+			return spans, nil
+		}
+		lo *= 10
+	}
+}
+
+// runは、クエリをbtrに対して実行し、結果をoutに書き出します。countは範囲ごとにRankの差で数えるので、範囲の項目を走査しません。
+func (q *shellQuery) run(btr *btree.BTree, out io.Writer) {
+	if q.count {
+		n := 0
+		for _, s := range q.spans {
+			hi, found := btr.Rank(btree.Int(s.hi))
+			if found {
+				hi++
+			}
+			lo, _ := btr.Rank(btree.Int(s.lo))
+			n += hi - lo
+		}
+		fmt.Fprintln(out, n)
+		return
+	}
+	var items []string
+	for _, s := range q.spans {
+		btr.AscendGreaterOrEqual(btree.Int(s.lo), func(i btree.Item) bool {
+			if int64(i.(btree.Int)) > s.hi || len(items) == q.limit {
+				return false
+			}
+			items = append(items, fmt.Sprint(i))
+			return true
+		})
+	}
+	fmt.Fprintf(out, "%d item(s): %s\n", len(items), strings.Join(items, " "))
+}
@@ -0,0 +1,116 @@
+package btree
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/seipan/btree/btree"
+)
+
+func TestPrefixSpans(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   string
+	}{
+		{"", fmt.Sprint(allKeys)},
+		{"-", fmt.Sprint([]keySpan{{math.MinInt64, -1}})},
+		{"0", "[{0 0}]"},
+		{"-0", "[]"},
+		{"01", "[]"},
+		{"922337203685477580", "[{922337203685477580 922337203685477580} {9223372036854775800 9223372036854775807}]"},
+		{"9223372036854775807", "[{9223372036854775807 9223372036854775807}]"},
+		{"9223372036854775808", "[]"},
+		{"-9223372036854775808", "[{-9223372036854775808 -9223372036854775808}]"},
+		{"-922337203685477580", "[{-9223372036854775808 -9223372036854775800} {-922337203685477580 -922337203685477580}]"},
+		{"99999999999999999999", "[]"},
+	} {
+		spans, err := prefixSpans(tc.prefix)
+		if err != nil {
+			t.Errorf("prefixSpans(%q): %v", tc.prefix, err)
+			continue
+		}
+		if got := fmt.Sprint(spans); got != tc.want && !(len(spans) == 0 && tc.want == "[]") {
+			t.Errorf("prefixSpans(%q) = %s, want %s", tc.prefix, got, tc.want)
+		}
+	}
+	// 1で始まる正のキーの範囲は、桁数ごとに1つずつで、昇順に並ぶ。20桁の範囲はMaxInt64を超えるのでない。
+	spans, _ := prefixSpans("1")
+	if len(spans) != 19 || spans[0] != (keySpan{1, 1}) || spans[1] != (keySpan{10, 19}) || spans[18] != (keySpan{1e18, 2e18 - 1}) {
+		t.Errorf("prefixSpans(\"1\") = %v", spans)
+	}
+	for _, p := range []string{"1a", "--1", "+1", "1-"} {
+		if _, err := prefixSpans(p); err == nil {
+			t.Errorf("prefixSpans(%q) accepted a prefix that is not a number", p)
+		}
+	}
+}
+
+// TestShellQueriesは、シェルのselectとcountの結果が、すべてのキーを調べたものと一致することを確かめます。
+func TestShellQueries(t *testing.T) {
+	btr := btree.New(3)
+	var keys []int
+	for i := -300; i <= 1300; i += 7 {
+		btr.ReplaceOrInsert(btree.Int(i))
+		keys = append(keys, i)
+	}
+	for _, tc := range []struct {
+		query string
+		keep  func(k int) bool
+	}{
+		{"select *", func(int) bool { return true }},
+		{"SELECT * WHERE KEY BETWEEN -20 AND 50", func(k int) bool { return k >= -20 && k <= 50 }},
+		{"select * where key between '15' and '15'", func(k int) bool { return k == 15 }},
+		{"select * where key between 50 and -20", func(int) bool { return false }},
+		{"select * where prefix 1", func(k int) bool { return strings.HasPrefix(fmt.Sprint(k), "1") }},
+		{"select * where prefix '-2'", func(k int) bool { return strings.HasPrefix(fmt.Sprint(k), "-2") }},
+		{`select * where prefix "-"`, func(k int) bool { return k < 0 }},
+		{"select * where prefix 0", func(k int) bool { return k == 0 }},
+	} {
+		var want []string
+		for _, k := range keys {
+			if tc.keep(k) {
+				want = append(want, fmt.Sprint(k))
+			}
+		}
+		if got := shellRun(t, btr, tc.query); got != strings.TrimSpace(fmt.Sprintf("%d item(s): %s", len(want), strings.Join(want, " "))) {
+			t.Errorf("%s = %s, want %v", tc.query, got, want)
+		}
+		count := "count" + strings.TrimPrefix(strings.TrimPrefix(tc.query, "select *"), "SELECT *")
+		if got := shellRun(t, btr, count); got != fmt.Sprint(len(want)) {
+			t.Errorf("%s = %s, want %d", count, got, len(want))
+		}
+		if len(want) > 3 {
+			if got := shellRun(t, btr, tc.query+" limit 3"); got != "3 item(s): "+strings.Join(want[:3], " ") {
+				t.Errorf("%s limit 3 = %s", tc.query, got)
+			}
+		}
+	}
+	for _, query := range []string{
+		"select",
+		"select key",
+		"select * where",
+		"select * where key 1 and 2",
+		"select * where key between 1",
+		"select * where key between 1 or 2",
+		"select * where key between a and 2",
+		"select * where prefix",
+		"select * limit x",
+		"select * limit 3 extra",
+		"count limit 3",
+	} {
+		if got := shellRun(t, btr, query); !strings.HasPrefix(got, "error: ") {
+			t.Errorf("%s = %s, want an error", query, got)
+		}
+	}
+}
+
+// shellRunは、シェルで1つのコマンドを実行し、その出力をプロンプトを除いて返します。
+func shellRun(t *testing.T, btr *btree.BTree, command string) string {
+	t.Helper()
+	var out strings.Builder
+	Shell(btr, strings.NewReader(command+"\n"), &out)
+	got, _, _ := strings.Cut(strings.TrimPrefix(out.String(), "> "), "\n")
+	return strings.TrimSpace(got)
+}
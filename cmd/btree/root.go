@@ -32,6 +32,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// payloadsは、ベンチマークで保存する値を作ります。--value-sizeが0の場合は値を持たない項目になります。
+var payloads = &Payloads{}
+
 var rootCmd = &cobra.Command{
 	Use:   "btree",
 	Short: "A brief description of your application",
@@ -50,7 +53,27 @@ var rootCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		btr := btree.New(n)
+		size, err := cmd.Flags().GetInt("value-size")
+		if err != nil {
+			log.Fatal(err)
+		}
+		dist, err := cmd.Flags().GetString("value-dist")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if payloads, err = NewPayloads(size, dist); err != nil {
+			log.Fatal(err)
+		}
+
+		degree, err := cmd.Flags().GetInt("degree")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if degree < 2 {
+			log.Fatal("--degree must be at least 2")
+		}
+
+		btr := btree.New(degree)
 		timedp := MeasurerDMP(n, mdp, SetMap)
 		log.Println(timedp)
 		timedp = MeasurerDMP(n, mdp, GetMap)
@@ -60,14 +83,31 @@ var rootCmd = &cobra.Command{
 		log.Println(timebtr)
 		timebtr = MeasurerBtree(n, btr, GetBtree)
 		log.Println(timebtr)
+		timebtr = MeasurerBtree(n, btr, AscendBtree)
+		log.Println(timebtr)
+		timebtr = MeasurerBtree(n, btr, DescendBtree)
+		log.Println(timebtr)
 
+		kv := btree.NewOrderedKV(degree)
+		timekv := MeasurerKV(n, kv, SetKV)
+		log.Println(timekv)
+		timekv = MeasurerKV(n, kv, GetKV)
+		log.Println(timekv)
+
+		every, err := cmd.Flags().GetInt("clone-every")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if every > 0 {
+			CloneBtree(n, degree, every)
+		}
 	},
 }
 
 func SetMap(N int, mdp *btree.Defaultdb) {
 	fmt.Println("--------------------------- default map create ---------------------------")
 	for i := 0; i < N; i++ {
-		mdp.Set(strconv.Itoa(i), strconv.Itoa(i))
+		mdp.Set(strconv.Itoa(i), payloads.MapValue(i))
 	}
 	fmt.Println("--------------------------- default map create ---------------------------")
 }
@@ -81,17 +121,43 @@ func GetMap(N int, mdp *btree.Defaultdb) {
 func SetBtree(N int, btr *btree.BTree) {
 	fmt.Println("--------------------------- btree create ---------------------------")
 	for i := 0; i < N; i++ {
-		btr.ReplaceOrInsert(btree.Int(i))
+		btr.ReplaceOrInsert(payloads.Item(i, payloads.Next()))
 	}
 	fmt.Println("--------------------------- btree create ---------------------------")
 }
 
 func GetBtree(N int, btr *btree.BTree) {
 	fmt.Println("--------------------------- btree get ---------------------------")
-	btr.Get(btree.Int(N - 2))
+	btr.Get(payloads.Item(N-2, nil))
 	fmt.Println("--------------------------- btree get ---------------------------")
 }
 
+func AscendBtree(N int, btr *btree.BTree) {
+	fmt.Println("--------------------------- btree ascend ---------------------------")
+	btr.AscendRange(payloads.Item(N/10, nil), payloads.Item(N-N/10, nil), func(btree.Item) bool { return true })
+	fmt.Println("--------------------------- btree ascend ---------------------------")
+}
+
+func DescendBtree(N int, btr *btree.BTree) {
+	fmt.Println("--------------------------- btree descend ---------------------------")
+	btr.DescendRange(payloads.Item(N-N/10, nil), payloads.Item(N/10, nil), func(btree.Item) bool { return true })
+	fmt.Println("--------------------------- btree descend ---------------------------")
+}
+
+func SetKV(N int, kv *btree.OrderedKV) {
+	fmt.Println("--------------------------- ordered kv create ---------------------------")
+	for i := 0; i < N; i++ {
+		kv.Set([]byte(strconv.Itoa(i)), payloads.KVValue(i))
+	}
+	fmt.Println("--------------------------- ordered kv create ---------------------------")
+}
+
+func GetKV(N int, kv *btree.OrderedKV) {
+	fmt.Println("--------------------------- ordered kv get ---------------------------")
+	kv.Get([]byte(strconv.Itoa(N - 2)))
+	fmt.Println("--------------------------- ordered kv get ---------------------------")
+}
+
 func MeasurerDMP(N int, mdp *btree.Defaultdb, fnc func(N int, mdp *btree.Defaultdb)) time.Duration {
 	start := time.Now()
 	fnc(N, mdp)
@@ -106,6 +172,13 @@ func MeasurerBtree(N int, btr *btree.BTree, fnc func(N int, btr *btree.BTree)) t
 	return end.Sub(start)
 }
 
+func MeasurerKV(N int, kv *btree.OrderedKV, fnc func(N int, kv *btree.OrderedKV)) time.Duration {
+	start := time.Now()
+	fnc(N, kv)
+	end := time.Now()
+	return end.Sub(start)
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -115,4 +188,8 @@ func Execute() {
 
 func init() {
 	rootCmd.Flags().StringP("N", "N", "", "number of keys in the tree")
+	rootCmd.Flags().Int("value-size", 0, "average size in bytes of the value stored with each key (0 stores bare keys)")
+	rootCmd.Flags().String("value-dist", "fixed", "distribution of value sizes: fixed or lognormal")
+	rootCmd.Flags().Int("clone-every", 0, "also run the snapshot scenario, taking a Clone every this many writes (0 disables it)")
+	rootCmd.Flags().Int("degree", 32, "degree of the trees")
 }
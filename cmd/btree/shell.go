@@ -0,0 +1,147 @@
+package btree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/seipan/btree/btree"
+	"github.com/spf13/cobra"
+)
+
+const shellHelp = `commands:
+  insert <k>       insert the key k
+  get <k>          look up the key k
+  delete <k>       delete the key k
+  range <a> <b>    list the keys in [a, b)
+  explain <a> <b>  estimate the cost of scanning [a, b)
+  select * [where key between <a> and <b> | where prefix <p>] [limit <n>]
+                   list the keys in [a, b] or whose decimal form starts with p
+  count [where key between <a> and <b> | where prefix <p>]
+                   count the same keys without scanning them
+  min, max         print the smallest or largest key
+  len              print the number of keys
+  print            print the nodes of the tree
+  help             show this message
+  exit             leave the shell`
+
+// shellArgsは、シェルのコマンドごとの引数の数です。
+var shellArgs = map[string]int{
+	"insert": 1, "get": 1, "delete": 1, "range": 2, "explain": 2,
+	"min": 0, "max": 0, "len": 0, "print": 0, "help": 0,
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Explore a tree of integer keys interactively",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		degree, err := cmd.Flags().GetInt("degree")
+		if err != nil {
+			return err
+		}
+		if degree < 2 {
+			return fmt.Errorf("bad degree %d", degree)
+		}
+		Shell(btree.New(degree), cmd.InOrStdin(), cmd.OutOrStdout())
+		return nil
+	},
+}
+
+// Shellは、inから1行ずつコマンドを読んでbtrに対して実行し、結果をoutに書き出します。inが終わるかexitで戻ります。
+func Shell(btr *btree.BTree, in io.Reader, out io.Writer) {
+	s := bufio.NewScanner(in)
+	fmt.Fprint(out, "> ")
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) > 0 {
+			if fields[0] == "exit" || fields[0] == "quit" {
+				return
+			}
+			if err := shellExec(btr, fields, out); err != nil {
+				fmt.Fprintln(out, "error:", err)
+			}
+		}
+		fmt.Fprint(out, "> ")
+	}
+	fmt.Fprintln(out)
+}
+
+// shellExecは、1つのコマンドを実行します。
+func shellExec(btr *btree.BTree, fields []string, out io.Writer) error {
+	if strings.EqualFold(fields[0], "select") || strings.EqualFold(fields[0], "count") {
+		q, err := parseQuery(fields)
+		if err != nil {
+			return err
+		}
+		q.run(btr, out)
+		return nil
+	}
+	keys := make([]btree.Int, 0, 2)
+	for _, f := range fields[1:] {
+		k, err := strconv.Atoi(f)
+		if err != nil {
+			return fmt.Errorf("bad key %q", f)
+		}
+		keys = append(keys, btree.Int(k))
+	}
+	want, ok := shellArgs[fields[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q (try help)", fields[0])
+	}
+	if len(keys) != want {
+		return fmt.Errorf("%s takes %d argument(s)", fields[0], want)
+	}
+	switch fields[0] {
+	case "insert":
+		if old := btr.ReplaceOrInsert(keys[0]); old != nil {
+			fmt.Fprintln(out, "replaced", old)
+		} else {
+			fmt.Fprintln(out, "inserted", keys[0])
+		}
+	case "get":
+		if item := btr.Get(keys[0]); item != nil {
+			fmt.Fprintln(out, item)
+		} else {
+			fmt.Fprintln(out, "not found")
+		}
+	case "delete":
+		if item := btr.Delete(keys[0]); item != nil {
+			fmt.Fprintln(out, "deleted", item)
+		} else {
+			fmt.Fprintln(out, "not found")
+		}
+	case "range":
+		var items []string
+		btr.AscendRange(keys[0], keys[1], func(i btree.Item) bool {
+			items = append(items, fmt.Sprint(i))
+			return true
+		})
+		fmt.Fprintf(out, "%d item(s): %s\n", len(items), strings.Join(items, " "))
+	case "explain":
+		fmt.Fprint(out, btr.Explain(btree.RangeOp{Start: keys[0], Stop: keys[1]}))
+	case "min", "max":
+		item := btr.Min()
+		if fields[0] == "max" {
+			item = btr.Max()
+		}
+		if item == nil {
+			fmt.Fprintln(out, "empty")
+		} else {
+			fmt.Fprintln(out, item)
+		}
+	case "len":
+		fmt.Fprintln(out, btr.Len())
+	case "print":
+		btr.Print(out)
+	case "help":
+		fmt.Fprintln(out, shellHelp)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+	shellCmd.Flags().Int("degree", 2, "degree of the tree; small degrees make the structure easy to see")
+}